@@ -2,9 +2,16 @@ package main
 
 import (
 	"backend/internal/api"
+	"backend/internal/campaign"
+	"backend/internal/checkout"
 	"backend/internal/db"
+	"backend/internal/loyalty"
+	"backend/internal/payment"
+	"backend/internal/refund"
+	"context"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/joho/godotenv"
@@ -33,6 +40,22 @@ func main() {
 	// Register routes
 	api.RegisterRoutes(r, database)
 
+	// Hủy đơn chờ thanh toán quá hạn giữ hàng
+	reaper := checkout.NewService(database, time.Now, checkout.ReservationTTLFromEnv())
+	go reaper.RunReaper(context.Background(), time.Minute)
+
+	// Tra cứu trạng thái giao dịch trực tuyến không nhận được IPN và các lần hoàn tiền đang xử lý
+	providers := payment.ProvidersFromEnv()
+	reconciler := payment.NewReconciler(database, providers, time.Now, payment.ReconcileAfterFromEnv())
+	reconciler.Refunds = refund.NewService(database, time.Now, providers)
+	go reconciler.Run(context.Background(), 2*time.Minute)
+
+	// Đóng các lô điểm thưởng đã hết hạn
+	go loyalty.RunExpirer(context.Background(), database, time.Hour)
+
+	// Chạy các chiến dịch tặng voucher đến lịch
+	go campaign.NewRunner(database, time.Now).RunScheduler(context.Background(), 15*time.Minute)
+
 	allowedOrigins := handlers.AllowedOrigins([]string{
 		"http://localhost:3000",
 		"http://localhost:3124",
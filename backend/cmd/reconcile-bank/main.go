@@ -0,0 +1,71 @@
+// Lệnh reconcile-bank đối soát file sao kê ngân hàng (CSV) với các đơn chờ thanh toán chuyển
+// khoản và in báo cáo JSON.
+//
+//	go run ./cmd/reconcile-bank -file sao-ke.csv [-mapping '{"credit":"So tien"}'] [-dry-run]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"backend/internal/banktransfer"
+	"backend/internal/db"
+	"backend/internal/orderstatus"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	path := flag.String("file", "", "đường dẫn file sao kê CSV")
+	rawMapping := flag.String("mapping", "", "mapping cột dạng JSON (mặc định lấy BANK_STATEMENT_MAPPING)")
+	dryRun := flag.Bool("dry-run", false, "chỉ in báo cáo, không cập nhật đơn hàng")
+	flag.Parse()
+	if *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found")
+	}
+
+	mapping, err := banktransfer.MappingFromEnv()
+	if *rawMapping != "" {
+		mapping, err = banktransfer.ParseMapping(*rawMapping)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	lines, err := banktransfer.ParseStatement(f, mapping)
+	if err != nil {
+		log.Fatalf("Không đọc được sao kê: %v", err)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		log.Fatalf("Không thể kết nối tới database: %v", err)
+	}
+	defer database.Close()
+
+	report, err := banktransfer.Reconcile(context.Background(), database, lines, orderstatus.System, time.Now(), *dryRun)
+	if err != nil {
+		log.Fatalf("Đối soát thất bại: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	log.Printf("Khớp %d, không khớp %d, cần kiểm tra %d, đã xử lý trước đó %d / %d dòng",
+		report.Matched, report.Unmatched, report.Ambiguous, report.AlreadyProcessed, report.TotalLines)
+}
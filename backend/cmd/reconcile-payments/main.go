@@ -0,0 +1,49 @@
+// Lệnh reconcile-payments tra cứu trạng thái các giao dịch MoMo/VNPay của đơn còn chờ thanh
+// toán mà không nhận được IPN và các lần hoàn tiền cổng báo đang xử lý, cập nhật kết quả rồi in
+// thống kê JSON.
+//
+//	go run ./cmd/reconcile-payments [-older-than 10m]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/payment"
+	"backend/internal/refund"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found")
+	}
+
+	olderThan := flag.Duration("older-than", payment.ReconcileAfterFromEnv(), "chỉ tra cứu giao dịch tạo trước khoảng thời gian này")
+	flag.Parse()
+
+	database, err := db.Connect()
+	if err != nil {
+		log.Fatalf("Không thể kết nối tới database: %v", err)
+	}
+	defer database.Close()
+
+	providers := payment.ProvidersFromEnv()
+	reconciler := payment.NewReconciler(database, providers, time.Now, *olderThan)
+	reconciler.Refunds = refund.NewService(database, time.Now, providers)
+	result, err := reconciler.ReconcilePending(context.Background())
+	if err != nil {
+		log.Fatalf("Đối soát thất bại: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(result)
+}
@@ -2,12 +2,19 @@ package api
 
 import (
 	"backend/internal/models"
+	"backend/internal/orderstatus"
+	"backend/internal/payment"
+	"backend/internal/refund"
 	"backend/internal/utils"
+	"backend/internal/wallet"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -19,12 +26,18 @@ func (h *handler) createProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	productType, ok := parseProductType(payload.ProductType)
+	if !ok {
+		utils.RespondWithError(w, http.StatusBadRequest, "Loại sản phẩm không hợp lệ")
+		return
+	}
+
 	var productID int
 	err := h.db.QueryRow(
-		`INSERT INTO products (name, price, image, slug, description, details, quantity, category_id, calories, protein_grams, carb_grams, fat_grams)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`,
+		`INSERT INTO products (name, price, image, slug, description, details, quantity, category_id, calories, protein_grams, carb_grams, fat_grams, product_type)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`,
 		payload.Name, payload.Price, payload.Image, payload.Slug, payload.Description, payload.Details, payload.Quantity,
-		payload.CategoryID, payload.Calories, payload.ProteinGrams, payload.CarbGrams, payload.FatGrams,
+		payload.CategoryID, payload.Calories, payload.ProteinGrams, payload.CarbGrams, payload.FatGrams, productType,
 	).Scan(&productID)
 
 	if err != nil {
@@ -35,6 +48,17 @@ func (h *handler) createProduct(w http.ResponseWriter, r *http.Request) {
 	utils.RespondWithJSON(w, http.StatusCreated, map[string]int{"id": productID})
 }
 
+// parseProductType trả về loại sản phẩm, mặc định là món ăn.
+func parseProductType(s string) (string, bool) {
+	switch s {
+	case "", "food":
+		return "food", true
+	case wallet.ProductTypeGiftCard:
+		return s, true
+	}
+	return "", false
+}
+
 func (h *handler) getProductByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -69,14 +93,19 @@ func (h *handler) updateProduct(w http.ResponseWriter, r *http.Request) {
         utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
         return
     }
+    productType, ok := parseProductType(payload.ProductType)
+    if !ok {
+        utils.RespondWithError(w, http.StatusBadRequest, "Loại sản phẩm không hợp lệ")
+        return
+    }
 
     _, err = h.db.Exec(
         `UPDATE products SET
          name=$1, price=$2, image=$3, slug=$4, description=$5, details=$6, quantity=$7,
-         category_id=$8, calories=$9, protein_grams=$10, carb_grams=$11, fat_grams=$12
-         WHERE id=$13`,
+         category_id=$8, calories=$9, protein_grams=$10, carb_grams=$11, fat_grams=$12, product_type=$13
+         WHERE id=$14`,
         payload.Name, payload.Price, payload.Image, payload.Slug, payload.Description, payload.Details, payload.Quantity,
-		payload.CategoryID, payload.Calories, payload.ProteinGrams, payload.CarbGrams, payload.FatGrams,
+		payload.CategoryID, payload.Calories, payload.ProteinGrams, payload.CarbGrams, payload.FatGrams, productType,
 		id,
     )
     if err != nil {
@@ -113,17 +142,39 @@ func (h *handler) deleteProduct(w http.ResponseWriter, r *http.Request) {
 func (h *handler) getAllOrders(w http.ResponseWriter, r *http.Request) {
 	page, limit, offset := utils.GetPaginationParams(r, 10)
 
+	// Lọc theo phương thức / trạng thái thanh toán
+	var conditions []string
+	var args []interface{}
+	if method := r.URL.Query().Get("payment_method"); method != "" {
+		args = append(args, method)
+		conditions = append(conditions, "o.payment_method = $"+strconv.Itoa(len(args)))
+	}
+	if paymentStatus := r.URL.Query().Get("payment_status"); paymentStatus != "" {
+		args = append(args, paymentStatus)
+		conditions = append(conditions, "o.payment_status = $"+strconv.Itoa(len(args)))
+	}
+	// Lọc theo kết quả xử lý giao dịch, vd payment_outcome=paid_after_cancel cho các đơn cần hoàn tiền
+	if outcome := r.URL.Query().Get("payment_outcome"); outcome != "" {
+		args = append(args, outcome)
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM payment_transactions pt WHERE pt.order_id = o.id AND pt.outcome = $"+strconv.Itoa(len(args))+")")
+	}
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
 	var totalRecords int
-	h.db.QueryRow("SELECT COUNT(*) FROM orders").Scan(&totalRecords)
+	h.db.QueryRow("SELECT COUNT(*) FROM orders o"+whereClause, args...).Scan(&totalRecords)
 	totalPages := int(math.Ceil(float64(totalRecords) / float64(limit)))
 
     rows, err := h.db.Query(`
-        SELECT o.id, o.customer_name, o.customer_phone, o.shipping_address, o.total_amount, o.status, o.created_at, u.username
+        SELECT o.id, o.customer_name, o.customer_phone, o.shipping_address, o.total_amount, o.status,
+               o.payment_method, o.payment_status, o.created_at, u.username
         FROM orders o
-        LEFT JOIN users u ON o.user_id = u.id
+        LEFT JOIN users u ON o.user_id = u.id`+whereClause+`
         ORDER BY o.created_at DESC
-		LIMIT $1 OFFSET $2
-    `, limit, offset)
+		LIMIT $`+strconv.Itoa(len(args)+1)+` OFFSET $`+strconv.Itoa(len(args)+2)+`
+    `, append(args, limit, offset)...)
 
     if err != nil {
         utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi truy vấn đơn hàng")
@@ -135,7 +186,7 @@ func (h *handler) getAllOrders(w http.ResponseWriter, r *http.Request) {
     for rows.Next() {
         var o models.Order
         var username sql.NullString
-        if err := rows.Scan(&o.ID, &o.CustomerName, &o.CustomerPhone, &o.ShippingAddress, &o.TotalAmount, &o.Status, &o.CreatedAt, &username); err != nil {
+        if err := rows.Scan(&o.ID, &o.CustomerName, &o.CustomerPhone, &o.ShippingAddress, &o.TotalAmount, &o.Status, &o.PaymentMethod, &o.PaymentStatus, &o.CreatedAt, &username); err != nil {
             utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi quét dữ liệu đơn hàng")
             return
         }
@@ -144,6 +195,7 @@ func (h *handler) getAllOrders(w http.ResponseWriter, r *http.Request) {
         } else {
             o.Username = "Guest"
         }
+        o.AllowedTransitions = allowedTransitions(o.Status)
         orders = append(orders, o)
     }
 
@@ -160,11 +212,37 @@ func (h *handler) updateOrderStatus(w http.ResponseWriter, r *http.Request) {
 	orderID, _ := strconv.Atoi(vars["id"])
 	var payload struct {
 		Status string `json:"status"`
+		Reason string `json:"reason"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
 		return
 	}
+	status, ok := orderstatus.Parse(payload.Status)
+	if !ok {
+		utils.RespondWithError(w, http.StatusBadRequest, "Trạng thái không hợp lệ")
+		return
+	}
+
+	// Hủy/hoàn đơn đã thu tiền qua cổng sẽ hoàn tiền thật, nên cần quyền quản lý thanh toán như
+	// POST /orders/{id}/refunds
+	role, _ := r.Context().Value("role").(Role)
+	if (status == orderstatus.Cancelled || status == orderstatus.Refunded) && !role.Can(PermPaymentsManage) {
+		captured, err := h.refunds.HasRemaining(r.Context(), orderID)
+		if err != nil {
+			fmt.Printf("ERROR checking captured payment of order %d: %v\n", orderID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi kiểm tra thanh toán của đơn hàng")
+			return
+		}
+		if captured {
+			utils.RespondWithAPIError(w, http.StatusForbidden, "permission_denied",
+				"Đơn hàng đã thanh toán trực tuyến, bạn không có quyền hủy/hoàn tiền", map[string]string{
+					"role":                string(role),
+					"required_permission": string(PermPaymentsManage),
+				})
+			return
+		}
+	}
 
 	tx, err := h.db.Begin()
 	if err != nil {
@@ -173,92 +251,88 @@ func (h *handler) updateOrderStatus(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Lấy trạng thái cũ của đơn hàng
-	var oldStatus string
-	err = tx.QueryRow("SELECT status FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&oldStatus)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy đơn hàng")
+	staffID, _ := r.Context().Value("userID").(int)
+	if _, err := orderstatus.Transition(r.Context(), tx, orderID, status, orderstatus.Staff(staffID), payload.Reason, h.now()); err != nil {
+		respondTransitionError(w, err)
 		return
 	}
+	// Nhân viên xác nhận đã nhận tiền (vd chuyển khoản) thì ghi nhận thanh toán cùng lúc
+	if status == orderstatus.Paid {
+		if err := payment.SetOrderPaymentStatus(r.Context(), tx, orderID, payment.PaymentPaid); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật trạng thái thanh toán")
+			return
+		}
+	}
 
-	// Lấy danh sách sản phẩm trong đơn hàng
-	rows, err := tx.Query("SELECT product_id, quantity FROM order_items WHERE order_id = $1", orderID)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy chi tiết đơn hàng")
+	if err := tx.Commit(); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi commit transaction")
 		return
 	}
-	defer rows.Close()
 
-	var items []struct {
-		ProductID int
-		Quantity  int
-	}
-	for rows.Next() {
-		var item struct {
-			ProductID int
-			Quantity  int
+	response := map[string]interface{}{"message": "Cập nhật trạng thái thành công"}
+	if status == orderstatus.Cancelled || status == orderstatus.Refunded {
+		// Đơn đã thanh toán qua cổng trực tuyến thì hoàn lại tiền cho khách
+		reason := payload.Reason
+		if reason == "" {
+			reason = "Đơn hàng bị hủy"
 		}
-		rows.Scan(&item.ProductID, &item.Quantity)
-		items = append(items, item)
-	}
-
-	// Xác định trạng thái ĐÃ TRỪ KHO: chỉ shipped và completed
-	isNowDeducted := payload.Status == "shipped" || payload.Status == "completed"
-	wasAlreadyDeducted := oldStatus == "shipped" || oldStatus == "completed"
-
-	// CASE 1: TRỪ KHO - Khi chuyển sang shipped hoặc completed (và chưa từng bị trừ kho)
-	if isNowDeducted && !wasAlreadyDeducted {
-		for _, item := range items {
-			res, err := tx.Exec(
-				"UPDATE products SET quantity = quantity - $1 WHERE id = $2 AND quantity >= $1",
-				item.Quantity, item.ProductID,
-			)
-			if err != nil {
-				utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật kho")
-				return
-			}
-			rowsAffected, _ := res.RowsAffected()
-			if rowsAffected == 0 {
-				utils.RespondWithError(w, http.StatusBadRequest, "Sản phẩm trong kho không đủ")
-				return
+		refunded, err := h.refunds.RefundRemaining(r.Context(), orderID, reason, orderstatus.Staff(staffID))
+		if err != nil {
+			fmt.Printf("ERROR refunding order %d: %v\n", orderID, err)
+			response["message"] = "Cập nhật trạng thái thành công nhưng hoàn tiền thất bại, vui lòng hoàn tiền thủ công"
+		} else if refunded != nil {
+			response["refund"] = refunded
+			if refunded.Status == refund.StatusFailed {
+				response["message"] = "Cập nhật trạng thái thành công nhưng hoàn tiền thất bại, vui lòng hoàn tiền thủ công"
 			}
 		}
 	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
 
-	// CASE 2: HOÀN KHO - Khi chuyển sang cancelled (và đã từng bị trừ kho)
-	if payload.Status == "cancelled" && wasAlreadyDeducted {
-		for _, item := range items {
-			_, err := tx.Exec(
-				"UPDATE products SET quantity = quantity + $1 WHERE id = $2",
-				item.Quantity, item.ProductID,
-			)
-			if err != nil {
-				utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi hoàn kho")
-				return
-			}
+// Shipper/admin xác nhận đã thu tiền mặt của đơn COD
+func (h *handler) confirmCODCollection(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+	var payload struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+			return
 		}
 	}
 
-	// Cập nhật trạng thái đơn hàng
-	_, err = tx.Exec("UPDATE orders SET status = $1 WHERE id = $2", payload.Status, orderID)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật trạng thái đơn hàng")
+	staffID, _ := r.Context().Value("userID").(int)
+	err = h.checkout.ConfirmCollection(r.Context(), orderID, payload.Note, orderstatus.Staff(staffID))
+	if errors.Is(err, orderstatus.ErrOrderNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy đơn hàng")
 		return
 	}
-
-	if err := tx.Commit(); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi commit transaction")
+	if err != nil {
+		respondCheckoutError(w, err, "Không thể xác nhận thu tiền")
 		return
 	}
-
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Cập nhật trạng thái thành công"})
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Đã xác nhận thu tiền", "payment_status": payment.PaymentPaid})
 }
 
 func (h *handler) getDashboardStats(w http.ResponseWriter, r *http.Request) {
     var totalRevenue float64
     var totalOrders, totalCustomers, totalProducts, totalCategories int
 
-    h.db.QueryRow("SELECT COALESCE(SUM(total_amount), 0) FROM orders WHERE status = 'completed'").Scan(&totalRevenue)
+    // Doanh thu thuần: trừ các khoản đã hoàn cho khách (phần hoàn vào ví không nằm trong total_amount)
+    h.db.QueryRow(`
+        SELECT COALESCE(SUM(o.total_amount - COALESCE(rf.refunded, 0)), 0)
+        FROM orders o
+        LEFT JOIN (
+            SELECT order_id, SUM(amount) AS refunded FROM refunds WHERE status = 'succeeded' AND provider <> 'wallet' GROUP BY order_id
+        ) rf ON rf.order_id = o.id
+        WHERE o.status = 'completed'
+    `).Scan(&totalRevenue)
     h.db.QueryRow("SELECT COUNT(*) FROM orders").Scan(&totalOrders)
     h.db.QueryRow("SELECT COUNT(*) FROM users WHERE is_admin = false").Scan(&totalCustomers)
     h.db.QueryRow("SELECT COUNT(*) FROM products").Scan(&totalProducts)
@@ -267,7 +341,7 @@ func (h *handler) getDashboardStats(w http.ResponseWriter, r *http.Request) {
     rows, err := h.db.Query(`
         SELECT
             TO_CHAR(date_series, 'YYYY-MM-DD') AS date,
-            COALESCE(SUM(o.total_amount), 0) AS revenue
+            COALESCE(SUM(o.total_amount - COALESCE(rf.refunded, 0)), 0) AS revenue
         FROM
             generate_series(
                 (NOW() AT TIME ZONE 'Asia/Ho_Chi_Minh')::date - INTERVAL '6 days',
@@ -277,6 +351,9 @@ func (h *handler) getDashboardStats(w http.ResponseWriter, r *http.Request) {
         LEFT JOIN
             orders o ON DATE(o.created_at AT TIME ZONE 'Asia/Ho_Chi_Minh') = date_series.date
                      AND o.status IN ('completed', 'shipped')
+        LEFT JOIN (
+            SELECT order_id, SUM(amount) AS refunded FROM refunds WHERE status = 'succeeded' AND provider <> 'wallet' GROUP BY order_id
+        ) rf ON rf.order_id = o.id
         GROUP BY
             date_series
         ORDER BY
@@ -324,8 +401,11 @@ func (h *handler) getDashboardStats(w http.ResponseWriter, r *http.Request) {
     }
 
     rows, err = h.db.Query(`
-        SELECT o.customer_name, SUM(o.total_amount) as total_spent
+        SELECT o.customer_name, SUM(o.total_amount - COALESCE(rf.refunded, 0)) as total_spent
         FROM orders o
+        LEFT JOIN (
+            SELECT order_id, SUM(amount) AS refunded FROM refunds WHERE status = 'succeeded' AND provider <> 'wallet' GROUP BY order_id
+        ) rf ON rf.order_id = o.id
         WHERE o.status IN ('completed', 'shipped') AND o.customer_name != ''
         GROUP BY o.customer_name
         ORDER BY total_spent DESC
@@ -387,7 +467,7 @@ func (h *handler) getAllUsers(w http.ResponseWriter, r *http.Request) {
 
 	// Get paginated data
 	rows, err := h.db.Query(`
-		SELECT id, username, email, created_at
+		SELECT id, username, email, is_admin, role, CASE WHEN locked_until > NOW() THEN locked_until END, created_at
 		FROM users
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -401,7 +481,7 @@ func (h *handler) getAllUsers(w http.ResponseWriter, r *http.Request) {
 	var users []models.User
 	for rows.Next() {
 		var u models.User
-		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.CreatedAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.IsAdmin, &u.Role, &u.LockedUntil, &u.CreatedAt); err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét dữ liệu user")
 			return
 		}
@@ -441,10 +521,10 @@ func (h *handler) getAdminOrderDetails(w http.ResponseWriter, r *http.Request) {
 
 	var order models.Order
 	err = h.db.QueryRow(`
-        SELECT id, customer_name, customer_phone, shipping_address, total_amount, status, created_at
+        SELECT id, customer_name, customer_phone, shipping_address, total_amount, discount_amount, promotion_discount, points_redeemed, points_discount, wallet_amount, wallet_refunded, status, payment_method, payment_status, created_at
         FROM orders
         WHERE id = $1
-    `, orderID).Scan(&order.ID, &order.CustomerName, &order.CustomerPhone, &order.ShippingAddress, &order.TotalAmount, &order.Status, &order.CreatedAt)
+    `, orderID).Scan(&order.ID, &order.CustomerName, &order.CustomerPhone, &order.ShippingAddress, &order.TotalAmount, &order.DiscountAmount, &order.PromotionDiscount, &order.PointsRedeemed, &order.PointsDiscount, &order.WalletAmount, &order.WalletRefunded, &order.Status, &order.PaymentMethod, &order.PaymentStatus, &order.CreatedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -456,7 +536,7 @@ func (h *handler) getAdminOrderDetails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := h.db.Query(`
-        SELECT oi.id, oi.product_id, oi.quantity, oi.price_at_purchase, p.name, p.image
+        SELECT oi.id, oi.product_id, oi.quantity, oi.price_at_purchase, oi.discount_amount, p.name, p.image
         FROM order_items oi
         JOIN products p ON oi.product_id = p.id
         WHERE oi.order_id = $1
@@ -471,7 +551,7 @@ func (h *handler) getAdminOrderDetails(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var item models.OrderItem
 		var productImage sql.NullString
-		if err := rows.Scan(&item.ID, &item.ProductID, &item.Quantity, &item.PriceAtPurchase, &item.ProductName, &productImage); err != nil {
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.Quantity, &item.PriceAtPurchase, &item.DiscountAmount, &item.ProductName, &productImage); err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Error scanning order items")
 			return
 		}
@@ -480,5 +560,19 @@ func (h *handler) getAdminOrderDetails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	order.Items = items
+
+	order.Timeline, err = orderstatus.Timeline(r.Context(), h.db, orderID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Database error while fetching order timeline")
+		return
+	}
+	order.AllowedTransitions = allowedTransitions(order.Status)
+
+	order.Refunds, err = h.refunds.List(r.Context(), orderID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Database error while fetching refunds")
+		return
+	}
+
 	utils.RespondWithJSON(w, http.StatusOK, order)
 }
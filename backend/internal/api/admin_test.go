@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend/internal/dbtest"
+	"backend/internal/payment"
+	"backend/internal/refund"
+
+	"github.com/gorilla/mux"
+)
+
+func updateStatus(h *handler, body string) *httptest.ResponseRecorder {
+	return updateStatusAs(h, RoleManager, body)
+}
+
+func updateStatusAs(h *handler, role Role, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/orders/12/status", bytes.NewBufferString(body))
+	req = mux.SetURLVars(req, map[string]string{"id": "12"})
+	ctx := context.WithValue(req.Context(), "userID", 3)
+	req = req.WithContext(context.WithValue(ctx, "role", role))
+	rec := httptest.NewRecorder()
+	h.updateOrderStatus(rec, req)
+	return rec
+}
+
+func TestUpdateOrderStatusToPaidRecordsPayment(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{"pending"}))
+	fake.On("FROM gift_cards WHERE order_id", dbtest.Rows([]driver.Value{true, "bank_transfer"}))
+	h := &handler{db: db, clock: newTestClock().now}
+
+	rec := updateStatus(h, `{"status":"paid","reason":"Đã nhận chuyển khoản"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, muốn 200: %s", rec.Code, rec.Body)
+	}
+	paid := fake.Calls("UPDATE orders SET payment_status")
+	if len(paid) != 1 || paid[0].Args[0] != payment.PaymentPaid {
+		t.Fatalf("payment_status = %+v, muốn paid", paid)
+	}
+	if fake.Commits != 1 {
+		t.Error("trạng thái đơn và trạng thái thanh toán phải cùng một transaction")
+	}
+}
+
+func TestUpdateOrderStatusInvalidMoveKeepsPaymentStatus(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{"cancelled"}))
+	h := &handler{db: db, clock: newTestClock().now}
+
+	rec := updateStatus(h, `{"status":"paid"}`)
+	if rec.Code == http.StatusOK {
+		t.Fatal("không được chuyển đơn đã hủy sang paid")
+	}
+	if len(fake.Calls("UPDATE orders SET payment_status")) != 0 || fake.Commits != 0 {
+		t.Error("không được ghi nhận thanh toán khi chuyển trạng thái thất bại")
+	}
+}
+
+func TestUpdateOrderStatusCancelCapturedPaymentNeedsPaymentsPermission(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{"paid"}))
+	fake.On("FROM payment_transactions", dbtest.Rows([]driver.Value{"sandbox", "ORD12_1", "T1", int64(150000)}))
+	fake.On("SELECT COALESCE(SUM(amount), 0) FROM refunds", dbtest.Rows([]driver.Value{int64(0)}))
+	clock := newTestClock()
+	sandbox := payment.NewSandbox()
+	h := &handler{db: db, clock: clock.now, refunds: refund.NewService(db, clock.now, map[string]payment.Provider{sandbox.Name(): sandbox})}
+
+	rec := updateStatusAs(h, RoleKitchenStaff, `{"status":"cancelled"}`)
+	if rec.Code != http.StatusForbidden || errorCode(t, rec) != "permission_denied" {
+		t.Fatalf("status %d, muốn 403 permission_denied: %s", rec.Code, rec.Body)
+	}
+	if len(fake.Calls("UPDATE orders SET status")) != 0 || len(fake.Calls("INSERT INTO refunds")) != 0 {
+		t.Error("nhân viên bếp không được hủy đơn đã thu tiền qua cổng")
+	}
+}
+
+func TestUpdateOrderStatusCancelUnpaidOrderAsKitchenStaff(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{"pending"}))
+	fake.On("FROM gift_cards WHERE order_id", dbtest.Rows([]driver.Value{false, "cod"}))
+	fake.On("SELECT wallet_amount - wallet_refunded", dbtest.Rows([]driver.Value{int64(0)}))
+	clock := newTestClock()
+	h := &handler{db: db, clock: clock.now, refunds: refund.NewService(db, clock.now, map[string]payment.Provider{})}
+
+	rec := updateStatusAs(h, RoleKitchenStaff, `{"status":"cancelled"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, muốn 200: %s", rec.Code, rec.Body)
+	}
+	if len(fake.Calls("UPDATE orders SET status")) != 1 {
+		t.Error("đơn chưa thu tiền trực tuyến thì nhân viên bếp được hủy")
+	}
+}
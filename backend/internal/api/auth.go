@@ -12,7 +12,10 @@ import (
 	"fmt"
 	"os"
 	"encoding/hex"
+	"errors"
+	"strings"
 	"backend/internal/models"
+	"backend/internal/referral"
 	"backend/internal/utils"
 
 	"github.com/dgrijalva/jwt-go"
@@ -24,6 +27,9 @@ var jwtKey = []byte(os.Getenv("JWT_SECRET_KEY"))
 type Claims struct {
 	Username string `json:"username"`
 	IsAdmin  bool   `json:"is_admin"`
+	Role     Role   `json:"role"`
+	// SessionID trỏ tới user_sessions; session bị thu hồi thì token mất hiệu lực
+	SessionID int64 `json:"sid"`
 	jwt.StandardClaims
 }
 
@@ -34,16 +40,61 @@ func (h *handler) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		utils.RespondWithError(w, http.StatusBadRequest, "Email không hợp lệ")
+		return
+	}
+	req.Email = email
+
+	// device_id được lưu vào users.signup_device_id (VARCHAR(64)) kể cả khi không có mã giới thiệu
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+	if len(req.DeviceID) > 64 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Không xác định được thiết bị đăng ký")
+		return
+	}
+
+	// Mã giới thiệu sai thì báo lỗi ngay để người dùng sửa, không tạo tài khoản
+	var referrerID int
+	if strings.TrimSpace(req.ReferralCode) != "" {
+		if req.DeviceID == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "Không xác định được thiết bị đăng ký")
+			return
+		}
+		id, err := referral.Lookup(r.Context(), h.db, req.ReferralCode)
+		if errors.Is(err, referral.ErrInvalidCode) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Mã giới thiệu không hợp lệ")
+			return
+		}
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi CSDL")
+			return
+		}
+		referrerID = id
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi mã hóa mật khẩu")
 		return
 	}
+	referralCode, err := referral.NewCode()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo người dùng")
+		return
+	}
+
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo người dùng")
+		return
+	}
+	defer tx.Rollback()
 
 	var userID int
-	err = h.db.QueryRow(
-		"INSERT INTO users (username, email, password_hash) VALUES ($1, $2, $3) RETURNING id",
-		req.Username, req.Email, string(hashedPassword),
+	err = tx.QueryRow(
+		"INSERT INTO users (username, email, password_hash, referral_code, signup_device_id, signup_ip) VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, '')) RETURNING id",
+		req.Username, req.Email, string(hashedPassword), referralCode, req.DeviceID, clientIP(r),
 	).Scan(&userID)
 
 	if err != nil {
@@ -51,8 +102,27 @@ func (h *handler) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if referrerID != 0 {
+		status, err := referral.Link(r.Context(), tx, referrerID, userID, req.DeviceID, clientIP(r))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo người dùng")
+			return
+		}
+		if status == referral.StatusRejected {
+			fmt.Printf("Referral from user %d to user %d rejected (device %s, ip %s)\n", referrerID, userID, req.DeviceID, clientIP(r))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo người dùng")
+		return
+	}
+
+	if err := h.sendVerificationEmail(userID, req.Email); err != nil {
+		fmt.Printf("ERROR: Could not send verification email to %s: %v\n", req.Email, err)
+	}
+
 	utils.RespondWithJSON(w, http.StatusCreated, map[string]interface{}{
-		"message": "Đăng ký thành công",
+		"message": "Đăng ký thành công. Vui lòng kiểm tra email để xác thực tài khoản.",
 		"user_id": userID,
 	})
 }
@@ -64,10 +134,41 @@ func (h *handler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := clientIP(r)
+	if wait, err := h.ipLoginRetryAfter(ip); err != nil {
+		fmt.Printf("ERROR checking login attempts for %s: %v\n", ip, err)
+	} else if wait > 0 {
+		h.recordAttempt(attemptKindLogin, nil, req.Username, attemptThrottled, r)
+		respondThrottled(w, "too_many_attempts", "Bạn đã thử đăng nhập quá nhiều lần. Vui lòng thử lại sau.", wait)
+		return
+	}
+
+	// Đăng nhập bằng tên đăng nhập hoặc email; email được so sánh ở dạng chuẩn hóa như khi đăng ký
+	email, _ := normalizeEmail(req.Username)
+
+	// Khóa dòng người dùng tới khi ghi xong kết quả, để các lần thử song song được đếm lần lượt
+	tx, err := h.db.Begin()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi CSDL")
+		return
+	}
+	defer tx.Rollback()
+
 	var user models.User
-	err := h.db.QueryRow("SELECT id, username, password_hash, is_admin, email FROM users WHERE username = $1", req.Username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.Email)
+	var failedCount int
+	var lastFailedAt, lockedUntil sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, username, password_hash, is_admin, role, email, email_verified_at IS NOT NULL,
+		       failed_login_count, last_failed_login_at, locked_until, totp_enabled_at IS NOT NULL
+		FROM users WHERE username = $1 OR LOWER(email) = $2
+		ORDER BY username = $1 DESC
+		LIMIT 1
+		FOR UPDATE
+	`, req.Username, email).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.Role, &user.Email, &user.EmailVerified,
+		&failedCount, &lastFailedAt, &lockedUntil, &user.TwoFactorEnabled)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			h.recordAttempt(attemptKindLogin, nil, req.Username, attemptUnknownUser, r)
 			utils.RespondWithError(w, http.StatusUnauthorized, "Tên đăng nhập hoặc mật khẩu không đúng")
 		} else {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi CSDL")
@@ -75,44 +176,64 @@ func (h *handler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	now := h.now()
+	if lockedUntil.Valid && now.Before(lockedUntil.Time) {
+		h.recordAttempt(attemptKindLogin, &user.ID, req.Username, attemptLocked, r)
+		respondThrottled(w, "account_locked", lockedMessage(lockedUntil.Time), lockedUntil.Time.Sub(now))
+		return
+	}
+	if lastFailedAt.Valid {
+		if wait := h.throttle.retryAfter(now, failedCount, h.throttle.FreeAttempts, lastFailedAt.Time); wait > 0 {
+			h.recordAttempt(attemptKindLogin, &user.ID, req.Username, attemptThrottled, r)
+			respondThrottled(w, "too_many_attempts", "Bạn đã thử đăng nhập quá nhiều lần. Vui lòng thử lại sau.", wait)
+			return
+		}
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		log.Println("!!! Lỗi so sánh mật khẩu: ", err)
+		h.recordAttempt(attemptKindLogin, &user.ID, req.Username, attemptBadPassword, r)
+		until, lockErr := h.registerLoginFailure(tx, user.ID)
+		if lockErr == nil {
+			lockErr = tx.Commit()
+		}
+		if lockErr != nil {
+			fmt.Printf("ERROR updating failed login count for user %d: %v\n", user.ID, lockErr)
+		}
+		if until != nil {
+			respondThrottled(w, "account_locked", lockedMessage(*until), until.Sub(now))
+			return
+		}
 		utils.RespondWithError(w, http.StatusUnauthorized, "Tên đăng nhập hoặc mật khẩu không đúng")
 		return
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Username: user.Username,
-		IsAdmin:  user.IsAdmin,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+	// Tài khoản đã bật 2FA: chưa cấp token, chỉ trả về mfa_token cho bước nhập mã
+	if user.TwoFactorEnabled {
+		tx.Commit()
+		h.respondTwoFactorChallenge(w, user.ID)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tx.Exec("UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL WHERE id = $1", user.ID)
+	if err := tx.Commit(); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi CSDL")
+		return
+	}
+	h.recordAttempt(attemptKindLogin, &user.ID, req.Username, attemptSuccess, r)
+
 	if len(jwtKey) == 0 {
 		log.Fatal("Lỗi nghiêm trọng: JWT_SECRET_KEY chưa được set")
 		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi cấu hình server")
 		return
 	}
-	tokenString, err := token.SignedString(jwtKey)
+	resp, err := h.issueTokens(r, user)
 	if err != nil {
+		fmt.Printf("ERROR issuing tokens: %v\n", err)
 		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo token")
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, models.LoginResponse{
-		Token:    tokenString,
-		Username: user.Username,
-		IsAdmin:  user.IsAdmin,
-		ID:       user.ID,
-		Email:    user.Email,
-	})
-}
-
-func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
+	utils.RespondWithJSON(w, http.StatusOK, resp)
 }
 
 func (h *handler) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
@@ -122,12 +243,30 @@ func (h *handler) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if email, ok := normalizeEmail(req.Email); ok {
+		req.Email = email
+	}
 	var userID int
-	err := h.db.QueryRow("SELECT id FROM users WHERE email = $1", req.Email).Scan(&userID)
+	err := h.db.QueryRow("SELECT id FROM users WHERE LOWER(email) = $1", req.Email).Scan(&userID)
+	var knownUser *int
+	if err == nil {
+		knownUser = &userID
+	}
+
+	allowed, limitErr := h.passwordResetAllowed(clientIP(r), knownUser)
+	if limitErr != nil {
+		fmt.Printf("ERROR checking password reset limit: %v\n", limitErr)
+	} else if !allowed {
+		respondThrottled(w, "too_many_attempts", "Bạn đã yêu cầu đặt lại mật khẩu quá nhiều lần. Vui lòng thử lại sau.", h.throttle.ResetWindow)
+		return
+	}
+
 	if err != nil {
+		h.recordAttempt(attemptKindPasswordReset, nil, req.Email, attemptUnknownUser, r)
 		utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Nếu email tồn tại, một liên kết đặt lại mật khẩu đã được gửi."})
 		return
 	}
+	h.recordAttempt(attemptKindPasswordReset, &userID, req.Email, attemptResetRequest, r)
 
 	// Tạo token ngẫu nhiên
 	tokenBytes := make([]byte, 32)
@@ -161,7 +300,7 @@ func (h *handler) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
 	// Gửi email
 	err = utils.SendPasswordResetEmail(req.Email, resetLink)
 	if err != nil {
-		log.Printf("ERROR: Could not send password reset email to %s: %v", req.Email, err)
+		fmt.Printf("ERROR: Could not send password reset email to %s: %v\n", req.Email, err)
 	}
 
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Nếu email tồn tại, một liên kết đặt lại mật khẩu đã được gửi."})
@@ -209,6 +348,9 @@ func (h *handler) resetPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.db.Exec("DELETE FROM password_reset_tokens WHERE user_id = $1", userID)
+	h.db.Exec("UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL WHERE id = $1", userID)
+	// Đổi mật khẩu thì đăng xuất mọi thiết bị
+	h.db.Exec("UPDATE user_sessions SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL", userID, h.now())
 
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Mật khẩu đã được đặt lại thành công."})
 }
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+)
+
+func TestRegisterRejectsLongDeviceIDWithoutReferralCode(t *testing.T) {
+	fake, db := dbtest.New()
+	h := &handler{db: db, clock: newTestClock().now}
+	body := `{"username":"lan","email":"lan@example.com","password":"secret123","device_id":"` + strings.Repeat("x", 65) + `"}`
+
+	rec := httptest.NewRecorder()
+	h.register(rec, httptest.NewRequest(http.MethodPost, "/api/auth/register", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, muốn 400", rec.Code)
+	}
+	if len(fake.Calls("INSERT INTO users")) != 0 {
+		t.Error("không được tạo người dùng với device_id quá dài")
+	}
+}
+
+func TestLoginMatchesNormalizedEmail(t *testing.T) {
+	f := newLoginFixture(t)
+	body := `{"username":" Alice@Example.COM ","password":"secret"}`
+	rec := httptest.NewRecorder()
+	f.h.login(rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBufferString(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, muốn 200: %s", rec.Code, rec.Body)
+	}
+	lookup := f.fake.Calls("FROM users WHERE username = $1")
+	if len(lookup) != 1 || lookup[0].Args[1] != "alice@example.com" {
+		t.Errorf("email phải được chuẩn hóa trước khi tìm người dùng, có %+v", lookup)
+	}
+}
+
+func TestRequestPasswordResetLooksUpNormalizedEmail(t *testing.T) {
+	fake, db := dbtest.New()
+	h := &handler{db: db, clock: newTestClock().now, throttle: defaultThrottlePolicy}
+	body := `{"email":" Lan@Example.COM "}`
+
+	rec := httptest.NewRecorder()
+	h.requestPasswordReset(rec, httptest.NewRequest(http.MethodPost, "/api/auth/forgot-password", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, muốn 200", rec.Code)
+	}
+	lookup := fake.Calls("SELECT id FROM users WHERE LOWER(email) = $1")
+	if len(lookup) != 1 || lookup[0].Args[0] != "lan@example.com" {
+		t.Errorf("email phải được chuẩn hóa trước khi tìm người dùng, có %+v", lookup)
+	}
+}
+
+func TestVerifyEmailUsesHandlerClock(t *testing.T) {
+	clock := newTestClock()
+	for _, c := range []struct {
+		name      string
+		expiresAt time.Time
+		status    int
+	}{
+		{"còn hạn", clock.now().Add(time.Minute), http.StatusOK},
+		{"hết hạn", clock.now().Add(-time.Minute), http.StatusBadRequest},
+	} {
+		fake, db := dbtest.New()
+		fake.On("FROM email_verification_tokens", dbtest.Rows([]driver.Value{int64(7), c.expiresAt}))
+		h := &handler{db: db, clock: clock.now}
+
+		rec := httptest.NewRecorder()
+		h.verifyEmail(rec, httptest.NewRequest(http.MethodPost, "/api/auth/verify-email", strings.NewReader(`{"token":"abc"}`)))
+		if rec.Code != c.status {
+			t.Fatalf("%s: status %d, muốn %d", c.name, rec.Code, c.status)
+		}
+		verified := fake.Calls("SET email_verified_at")
+		if c.status != http.StatusOK {
+			if len(verified) != 0 {
+				t.Errorf("%s: không được xác thực email", c.name)
+			}
+			continue
+		}
+		if len(verified) != 1 || verified[0].Args[1] != clock.now() {
+			t.Errorf("%s: email_verified_at phải là giờ của handler, có %+v", c.name, verified)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backend/internal/banktransfer"
+	"backend/internal/orderstatus"
+	"backend/internal/payment"
+	"backend/internal/utils"
+
+	"github.com/gorilla/mux"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+type bankTransferQR struct {
+	OrderID   int                  `json:"order_id"`
+	Amount    int64                `json:"amount"`
+	Memo      string               `json:"memo"`
+	QRPayload string               `json:"qr_payload"`
+	Bank      banktransfer.Account `json:"bank"`
+}
+
+// orderTransferQR tạo thông tin chuyển khoản cho đơn {id} chọn chuyển khoản và đang chờ thanh toán.
+func (h *handler) orderTransferQR(w http.ResponseWriter, r *http.Request) (*bankTransferQR, bool) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid order ID")
+		return nil, false
+	}
+
+	var status, method string
+	var totalAmount int64
+	err = h.db.QueryRow("SELECT status, payment_method, total_amount FROM orders WHERE id = $1", orderID).Scan(&status, &method, &totalAmount)
+	if err == sql.ErrNoRows {
+		utils.RespondWithError(w, http.StatusNotFound, "Order not found")
+		return nil, false
+	}
+	if err != nil {
+		fmt.Printf("ERROR fetching order for VietQR: %v\n", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
+		return nil, false
+	}
+	// Đơn COD/cổng thanh toán không được ghi nhận qua đối soát sao kê, không phát mã chuyển khoản
+	if method != payment.MethodBankTransfer {
+		utils.RespondWithError(w, http.StatusNotFound, "Đơn hàng không thanh toán bằng chuyển khoản")
+		return nil, false
+	}
+	if orderstatus.Status(status) != orderstatus.Pending {
+		utils.RespondWithError(w, http.StatusConflict, "Đơn hàng không ở trạng thái chờ thanh toán")
+		return nil, false
+	}
+
+	qr, err := h.newBankTransferQR(orderID, totalAmount)
+	if err != nil {
+		fmt.Printf("ERROR building VietQR for order %d: %v\n", orderID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo mã VietQR")
+		return nil, false
+	}
+	return qr, true
+}
+
+func (h *handler) newBankTransferQR(orderID int, amount int64) (*bankTransferQR, error) {
+	payload, err := h.bankAccount.QRPayload(orderID, amount)
+	if err != nil {
+		return nil, err
+	}
+	return &bankTransferQR{
+		OrderID:   orderID,
+		Amount:    amount,
+		Memo:      banktransfer.Memo(orderID),
+		QRPayload: payload,
+		Bank:      h.bankAccount,
+	}, nil
+}
+
+// Public: thông tin chuyển khoản và payload VietQR của đơn hàng
+func (h *handler) getOrderVietQR(w http.ResponseWriter, r *http.Request) {
+	qr, ok := h.orderTransferQR(w, r)
+	if !ok {
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, qr)
+}
+
+// Public: ảnh PNG mã VietQR của đơn hàng
+func (h *handler) getOrderVietQRImage(w http.ResponseWriter, r *http.Request) {
+	qr, ok := h.orderTransferQR(w, r)
+	if !ok {
+		return
+	}
+
+	png, err := qrcode.Encode(qr.QRPayload, qrcode.Medium, 512)
+	if err != nil {
+		fmt.Printf("ERROR encoding VietQR PNG for order %d: %v\n", qr.OrderID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo mã VietQR")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(png)
+}
+
+// Admin: import sao kê ngân hàng (CSV) để tự động xác nhận các đơn chuyển khoản.
+// Form multipart: file, mapping (JSON ColumnMapping, tùy chọn), dry_run=true để chỉ xem báo cáo.
+func (h *handler) importBankStatement(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("userID").(int)
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "File sao kê không hợp lệ (tối đa 10MB)")
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Thiếu file sao kê")
+		return
+	}
+	defer file.Close()
+
+	mapping, err := banktransfer.MappingFromEnv()
+	if raw := r.FormValue("mapping"); raw != "" {
+		mapping, err = banktransfer.ParseMapping(raw)
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lines, err := banktransfer.ParseStatement(file, mapping)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Không đọc được sao kê: "+err.Error())
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.FormValue("dry_run"))
+	report, err := banktransfer.Reconcile(r.Context(), h.db, lines, orderstatus.Staff(userID), h.now(), dryRun)
+	if err != nil {
+		fmt.Printf("ERROR reconciling bank statement: %v\n", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể đối soát sao kê")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend/internal/banktransfer"
+	"backend/internal/dbtest"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOrderVietQROnlyForPendingBankTransfer(t *testing.T) {
+	cases := []struct {
+		name   string
+		row    []driver.Value
+		status int
+	}{
+		{"chuyển khoản chờ thanh toán", []driver.Value{"pending", "bank_transfer", int64(150000)}, http.StatusOK},
+		{"COD", []driver.Value{"pending", "cod", int64(150000)}, http.StatusNotFound},
+		{"cổng thanh toán", []driver.Value{"pending", "momo", int64(150000)}, http.StatusNotFound},
+		{"chuyển khoản đã thanh toán", []driver.Value{"paid", "bank_transfer", int64(150000)}, http.StatusConflict},
+		{"chuyển khoản đã hủy", []driver.Value{"cancelled", "bank_transfer", int64(150000)}, http.StatusConflict},
+		{"không có đơn", nil, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		fake, db := dbtest.New()
+		if c.row != nil {
+			fake.On("FROM orders WHERE id", dbtest.Rows(c.row))
+		}
+		h := &handler{db: db, bankAccount: banktransfer.Account{BankBIN: "970407", AccountNumber: "19072027706012"}}
+
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/orders/12/vietqr", nil), map[string]string{"id": "12"})
+		rec := httptest.NewRecorder()
+		h.getOrderVietQR(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s: status %d, muốn %d: %s", c.name, rec.Code, c.status, rec.Body)
+		}
+	}
+}
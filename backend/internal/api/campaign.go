@@ -0,0 +1,302 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/internal/campaign"
+	"backend/internal/models"
+	"backend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Admin: Danh sách chiến dịch tặng voucher
+func (h *handler) getCampaigns(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.QueryContext(r.Context(), `
+		SELECT c.id, c.name, c.voucher_id, v.code, c.segment, c.inactive_days, c.interval_hours,
+		       c.email_subject, c.email_message, c.starts_at, c.ends_at, c.is_active, c.last_run_at, c.next_run_at,
+		       (SELECT COUNT(*) FROM voucher_campaign_deliveries d WHERE d.campaign_id = c.id), c.created_at
+		FROM voucher_campaigns c
+		JOIN vouchers v ON v.id = c.voucher_id
+		ORDER BY c.created_at DESC
+	`)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi truy vấn chiến dịch")
+		return
+	}
+	defer rows.Close()
+
+	campaigns := []models.VoucherCampaign{}
+	for rows.Next() {
+		var c models.VoucherCampaign
+		var endsAt, lastRunAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.Name, &c.VoucherID, &c.VoucherCode, &c.Segment, &c.InactiveDays, &c.IntervalHours,
+			&c.EmailSubject, &c.EmailMessage, &c.StartsAt, &endsAt, &c.IsActive, &lastRunAt, &c.NextRunAt,
+			&c.Deliveries, &c.CreatedAt); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét dữ liệu chiến dịch")
+			return
+		}
+		if endsAt.Valid {
+			c.EndsAt = &endsAt.Time
+		}
+		if lastRunAt.Valid {
+			c.LastRunAt = &lastRunAt.Time
+		}
+		campaigns = append(campaigns, c)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, campaigns)
+}
+
+// decodeCampaign đọc và kiểm tra chiến dịch từ body; trả về false nếu đã gửi lỗi cho client.
+func (h *handler) decodeCampaign(w http.ResponseWriter, r *http.Request) (models.VoucherCampaign, bool) {
+	var c models.VoucherCampaign
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return c, false
+	}
+	if c.StartsAt.IsZero() {
+		c.StartsAt = h.now()
+	}
+	if msg := campaign.Validate(c); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return c, false
+	}
+
+	// Voucher công khai (mã nhập tay) không cấp vào ví người dùng được
+	var isPublic bool
+	err := h.db.QueryRowContext(r.Context(), "SELECT is_public FROM vouchers WHERE id = $1", c.VoucherID).Scan(&isPublic)
+	if err == sql.ErrNoRows {
+		utils.RespondWithError(w, http.StatusBadRequest, "Voucher không tồn tại")
+		return c, false
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi kiểm tra voucher")
+		return c, false
+	}
+	if isPublic {
+		utils.RespondWithError(w, http.StatusBadRequest, "Không thể dùng mã khuyến mãi công khai cho chiến dịch")
+		return c, false
+	}
+	return c, true
+}
+
+// Admin: Tạo chiến dịch tặng voucher. Lần chạy đầu tiên vào starts_at.
+func (h *handler) createCampaign(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.decodeCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	var id int
+	err := h.db.QueryRowContext(r.Context(), `
+		INSERT INTO voucher_campaigns (name, voucher_id, segment, inactive_days, interval_hours, email_subject,
+		                               email_message, starts_at, ends_at, is_active, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $8) RETURNING id
+	`, c.Name, c.VoucherID, c.Segment, c.InactiveDays, c.IntervalHours, c.EmailSubject,
+		c.EmailMessage, c.StartsAt, c.EndsAt, c.IsActive).Scan(&id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi tạo chiến dịch")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, map[string]int{"id": id})
+}
+
+// Admin: Cập nhật chiến dịch. Người đã nhận vẫn không nhận lại.
+func (h *handler) updateCampaign(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID chiến dịch không hợp lệ")
+		return
+	}
+	c, ok := h.decodeCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	// Chưa chạy lần nào thì lịch chạy đầu theo starts_at mới
+	result, err := h.db.ExecContext(r.Context(), `
+		UPDATE voucher_campaigns
+		SET name = $1, voucher_id = $2, segment = $3, inactive_days = $4, interval_hours = $5, email_subject = $6,
+		    email_message = $7, starts_at = $8, ends_at = $9, is_active = $10,
+		    next_run_at = CASE WHEN last_run_at IS NULL THEN $8 ELSE next_run_at END, updated_at = NOW()
+		WHERE id = $11
+	`, c.Name, c.VoucherID, c.Segment, c.InactiveDays, c.IntervalHours, c.EmailSubject,
+		c.EmailMessage, c.StartsAt, c.EndsAt, c.IsActive, id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật chiến dịch")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy chiến dịch")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Cập nhật chiến dịch thành công"})
+}
+
+// Admin: Xóa chiến dịch. Voucher đã tặng vẫn nằm trong ví người dùng.
+func (h *handler) deleteCampaign(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID chiến dịch không hợp lệ")
+		return
+	}
+
+	result, err := h.db.ExecContext(r.Context(), "DELETE FROM voucher_campaigns WHERE id = $1", id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi xóa chiến dịch")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy chiến dịch")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Xóa chiến dịch thành công"})
+}
+
+// Admin: Chạy chiến dịch ngay, không chờ lịch
+func (h *handler) runCampaign(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID chiến dịch không hợp lệ")
+		return
+	}
+
+	result, err := campaign.NewRunner(h.db, h.now).Run(r.Context(), id)
+	if err == campaign.ErrNotFound {
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy chiến dịch")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi chạy chiến dịch")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, result)
+}
+
+// Admin: Danh sách người đã nhận voucher của chiến dịch
+func (h *handler) getCampaignDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID chiến dịch không hợp lệ")
+		return
+	}
+	page, limit, offset := utils.GetPaginationParams(r, 20)
+
+	var totalRecords int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM voucher_campaign_deliveries WHERE campaign_id = $1", id).Scan(&totalRecords); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi đếm lượt tặng")
+		return
+	}
+	totalPages := int(math.Ceil(float64(totalRecords) / float64(limit)))
+
+	rows, err := h.db.Query(`
+		SELECT d.id, d.user_id, u.username, u.email, d.user_voucher_id, d.email_sent_at, COALESCE(d.email_error, ''), d.created_at
+		FROM voucher_campaign_deliveries d
+		JOIN users u ON u.id = d.user_id
+		WHERE d.campaign_id = $1
+		ORDER BY d.created_at DESC, d.id DESC
+		LIMIT $2 OFFSET $3
+	`, id, limit, offset)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi truy vấn lượt tặng")
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.CampaignDelivery{}
+	for rows.Next() {
+		var d models.CampaignDelivery
+		var userVoucherID sql.NullInt64
+		var emailSentAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Username, &d.Email, &userVoucherID, &emailSentAt, &d.EmailError, &d.CreatedAt); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét lượt tặng")
+			return
+		}
+		if userVoucherID.Valid {
+			uv := int(userVoucherID.Int64)
+			d.UserVoucherID = &uv
+		}
+		if emailSentAt.Valid {
+			d.EmailSentAt = &emailSentAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"items":      deliveries,
+		"page":       page,
+		"totalPages": totalPages,
+	})
+}
+
+// User: Cập nhật ngày sinh (dùng cho chiến dịch sinh nhật). Lần đầu được đặt tự do; sau đó chỉ được
+// đổi khi cả ngày sinh cũ lẫn mới không rơi vào tháng này hoặc tháng sau, để không thể đổi ngày sinh
+// liên tục nhằm nhận voucher sinh nhật.
+func (h *handler) updateBirthday(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var req models.BirthdayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+	now := h.now()
+	var birthday sql.NullTime
+	if req.Birthday != "" {
+		t, err := time.Parse("2006-01-02", req.Birthday)
+		if err != nil || t.After(now) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Ngày sinh không hợp lệ (YYYY-MM-DD)")
+			return
+		}
+		birthday = sql.NullTime{Time: t, Valid: true}
+	}
+
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật ngày sinh")
+		return
+	}
+	defer tx.Rollback()
+
+	var current sql.NullTime
+	if err := tx.QueryRowContext(r.Context(), "SELECT birthday FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&current); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật ngày sinh")
+		return
+	}
+	if current.Valid && !(birthday.Valid && sameDate(current.Time, birthday.Time)) &&
+		(birthdaySoon(current.Time, now) || (birthday.Valid && birthdaySoon(birthday.Time, now))) {
+		utils.RespondWithError(w, http.StatusConflict, "Không thể đổi ngày sinh trong tháng sinh nhật hoặc tháng liền trước")
+		return
+	}
+
+	var value interface{}
+	if birthday.Valid {
+		value = birthday.Time.Format("2006-01-02")
+	}
+	if _, err := tx.ExecContext(r.Context(), "UPDATE users SET birthday = $1 WHERE id = $2", value, userID); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật ngày sinh")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật ngày sinh")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Cập nhật ngày sinh thành công"})
+}
+
+// birthdaySoon cho biết sinh nhật rơi vào tháng hiện tại hoặc tháng sau (giờ Việt Nam, như chiến
+// dịch birthday_month).
+func birthdaySoon(birthday, now time.Time) bool {
+	local := now.In(vietnamLocation())
+	thisMonth := local.Month()
+	nextMonth := thisMonth%12 + 1
+	return birthday.Month() == thisMonth || birthday.Month() == nextMonth
+}
+
+func sameDate(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+)
+
+func TestUpdateBirthdayBlocksChangesNearBirthday(t *testing.T) {
+	date := func(s string) driver.Value {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	// Đồng hồ test là 10/03/2025: sinh nhật tháng 3 hoặc tháng 4 là sắp tới
+	cases := []struct {
+		name    string
+		current driver.Value
+		body    string
+		status  int
+	}{
+		{"đặt lần đầu", nil, `{"birthday":"1995-03-20"}`, http.StatusOK},
+		{"đổi ngoài tháng sinh nhật", date("1995-08-01"), `{"birthday":"1995-09-01"}`, http.StatusOK},
+		{"đổi sang tháng này", date("1995-08-01"), `{"birthday":"1995-03-15"}`, http.StatusConflict},
+		{"đổi sang tháng sau", date("1995-08-01"), `{"birthday":"1995-04-15"}`, http.StatusConflict},
+		{"đổi khi sinh nhật sắp tới", date("1995-04-02"), `{"birthday":"1995-09-01"}`, http.StatusConflict},
+		{"xóa khi sinh nhật sắp tới", date("1995-03-20"), `{"birthday":""}`, http.StatusConflict},
+		{"gửi lại ngày sinh cũ", date("1995-03-20"), `{"birthday":"1995-03-20"}`, http.StatusOK},
+	}
+	for _, c := range cases {
+		fake, db := dbtest.New()
+		fake.On("SELECT birthday FROM users", dbtest.Rows([]driver.Value{c.current}))
+		h := &handler{db: db, clock: newTestClock().now}
+
+		req := httptest.NewRequest(http.MethodPut, "/api/user/birthday", strings.NewReader(c.body))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 7))
+		rec := httptest.NewRecorder()
+		h.updateBirthday(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s: status %d, muốn %d: %s", c.name, rec.Code, c.status, rec.Body)
+		}
+		if updated := len(fake.Calls("UPDATE users SET birthday")) == 1; updated != (c.status == http.StatusOK) {
+			t.Errorf("%s: cập nhật = %v", c.name, updated)
+		}
+	}
+}
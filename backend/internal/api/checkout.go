@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"backend/internal/checkout"
+	"backend/internal/models"
+	"backend/internal/utils"
+)
+
+// respondCheckoutError trả 400 cho lỗi dữ liệu đặt hàng, 500 cho các lỗi còn lại.
+func respondCheckoutError(w http.ResponseWriter, err error, message string) {
+	var ce *checkout.Error
+	if errors.As(err, &ce) {
+		utils.RespondWithError(w, http.StatusBadRequest, ce.Message)
+		return
+	}
+	fmt.Printf("ERROR checkout: %v\n", err)
+	utils.RespondWithError(w, http.StatusInternalServerError, message)
+}
+
+// placeOrder là phần chung của các endpoint đặt hàng; chỉ khác nhau ở phương thức thanh toán.
+func (h *handler) placeOrder(w http.ResponseWriter, r *http.Request, method checkout.PaymentMethod) (*checkout.Order, bool) {
+	var req models.CreateOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return nil, false
+	}
+	// Đơn luôn thuộc về người dùng của session; khách vãng lai không cần xác thực email
+	req.UserID = sessionUserID(r)
+	if !h.requireVerifiedEmail(w, h.db, req.UserID) {
+		return nil, false
+	}
+
+	order, err := h.checkout.PlaceOrder(r.Context(), req, method)
+	if err != nil {
+		respondCheckoutError(w, err, "Không thể tạo đơn hàng")
+		return nil, false
+	}
+	return order, true
+}
+
+// respondPaidOrder trả kết quả cho đơn đã được ví hoặc voucher/điểm thưởng trả hết tiền, không cần
+// chuyển sang cổng thanh toán hay chuyển khoản. Trả về false nếu đơn vẫn phải thanh toán qua
+// phương thức khách chọn.
+func respondPaidOrder(w http.ResponseWriter, order *checkout.Order) bool {
+	message := "Đặt hàng thành công, đơn đã được thanh toán bằng số dư ví"
+	switch order.Method {
+	case checkout.Wallet.Name():
+	case checkout.Free.Name():
+		message = "Đặt hàng thành công, đơn không cần thanh toán thêm"
+	default:
+		return false
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"order_id": order.ID,
+		"paid":     true,
+		"message":  message,
+	})
+	return true
+}
+
+// Báo giá giỏ hàng (tạm tính, giảm giá, tổng tiền) trước khi đặt hàng
+func (h *handler) quoteCheckout(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+	req.UserID = sessionUserID(r)
+
+	quote, err := h.checkout.Quote(r.Context(), req)
+	if err != nil {
+		respondCheckoutError(w, err, "Không thể tính giá đơn hàng")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, quote)
+}
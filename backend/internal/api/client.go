@@ -2,14 +2,18 @@ package api
 
 import (
 	"database/sql"
-	"encoding/json"
 	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 	"fmt"
+	"backend/internal/banktransfer"
+	"backend/internal/checkout"
 	"backend/internal/models"
+	"backend/internal/oidc"
+	"backend/internal/payment"
+	"backend/internal/refund"
 	"backend/internal/utils"
 
 	"github.com/gorilla/mux"
@@ -18,6 +22,19 @@ import (
 
 type handler struct {
 	db *sql.DB
+	// clock cho phép thay thời gian hiện tại (mặc định time.Now)
+	clock    func() time.Time
+	throttle throttlePolicy
+	checkout *checkout.Service
+	refunds  *refund.Service
+	// oidcProviders: đăng nhập mạng xã hội, key là tên provider trong URL
+	oidcProviders map[string]*oidc.Provider
+	// payments: cổng thanh toán trực tuyến, key là tên cổng trong URL /api/payment/{provider}
+	payments map[string]payment.Provider
+	// sandbox là cổng giả trong tiến trình phục vụ chế độ demo
+	sandbox *payment.Sandbox
+	// bankAccount là tài khoản nhận chuyển khoản (VietQR)
+	bankAccount banktransfer.Account
 }
 
 func (h *handler) getProducts(w http.ResponseWriter, r *http.Request) {
@@ -93,7 +110,7 @@ func (h *handler) getProducts(w http.ResponseWriter, r *http.Request) {
 	// Xây dựng câu query chính
 	queryBase := `
         SELECT p.id, p.name, p.price, p.image, p.slug, p.description, p.details, p.quantity,
-               p.category_id, p.calories, p.protein_grams, p.carb_grams, p.fat_grams
+               p.category_id, p.calories, p.protein_grams, p.carb_grams, p.fat_grams, p.product_type
         FROM products p
         LEFT JOIN categories c ON p.category_id = c.id` + whereClause
 
@@ -122,7 +139,7 @@ func (h *handler) getProducts(w http.ResponseWriter, r *http.Request) {
 	var productsList []models.Product // List để dùng cho trường hợp ko sort AI
 	for rows.Next() {
 		var np models.NullableProduct
-		if err := rows.Scan(&np.ID, &np.Name, &np.Price, &np.Image, &np.Slug, &np.Description, &np.Details, &np.Quantity, &np.CategoryID, &np.Calories, &np.ProteinGrams, &np.CarbGrams, &np.FatGrams); err != nil {
+		if err := rows.Scan(&np.ID, &np.Name, &np.Price, &np.Image, &np.Slug, &np.Description, &np.Details, &np.Quantity, &np.CategoryID, &np.Calories, &np.ProteinGrams, &np.CarbGrams, &np.FatGrams, &np.ProductType); err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi quét dữ liệu sản phẩm")
 			return
 		}
@@ -135,6 +152,7 @@ func (h *handler) getProducts(w http.ResponseWriter, r *http.Request) {
 			Description: np.Description.String,
 			Details:     np.Details.String,
 			Quantity:    np.Quantity,
+			ProductType: np.ProductType,
 		}
 		if np.CategoryID.Valid { categoryID := int(np.CategoryID.Int64); p.CategoryID = &categoryID }
 		if np.Calories.Valid { p.Calories = int(np.Calories.Int64) }
@@ -190,8 +208,8 @@ func (h *handler) getProductBySlug(w http.ResponseWriter, r *http.Request) {
     var np models.NullableProduct
     err := h.db.QueryRow(`
         SELECT id, name, price, image, slug, description, details, quantity,
-               category_id, calories, protein_grams, carb_grams, fat_grams
-        FROM products WHERE slug = $1`, slug).Scan(&np.ID, &np.Name, &np.Price, &np.Image, &np.Slug, &np.Description, &np.Details, &np.Quantity, &np.CategoryID, &np.Calories, &np.ProteinGrams, &np.CarbGrams, &np.FatGrams)
+               category_id, calories, protein_grams, carb_grams, fat_grams, product_type
+        FROM products WHERE slug = $1`, slug).Scan(&np.ID, &np.Name, &np.Price, &np.Image, &np.Slug, &np.Description, &np.Details, &np.Quantity, &np.CategoryID, &np.Calories, &np.ProteinGrams, &np.CarbGrams, &np.FatGrams, &np.ProductType)
 
     if err != nil {
         if err == sql.ErrNoRows {
@@ -211,6 +229,7 @@ func (h *handler) getProductBySlug(w http.ResponseWriter, r *http.Request) {
 		Description: np.Description.String,
 		Details:     np.Details.String,
 		Quantity:    np.Quantity,
+		ProductType: np.ProductType,
 	}
 	if np.CategoryID.Valid {
 		categoryID := int(np.CategoryID.Int64)
@@ -233,154 +252,13 @@ func (h *handler) getProductBySlug(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *handler) createOrder(w http.ResponseWriter, r *http.Request) {
-    var req models.CreateOrderRequest
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
-        return
-    }
-
-    // Validate request
-    if len(req.CartItems) == 0 {
-        utils.RespondWithError(w, http.StatusBadRequest, "Giỏ hàng trống")
-        return
-    }
-
-    tx, err := h.db.Begin()
-    if err != nil {
-        utils.RespondWithError(w, http.StatusInternalServerError, "Không thể bắt đầu transaction")
-        return
-    }
-    defer tx.Rollback()
-
-    var totalAmount int64
-    productPrices := make(map[int]int64)
-
-    // Check product availability and prices
-    for _, item := range req.CartItems {
-        var price int64
-        var availableQuantity int
-        err := tx.QueryRow("SELECT price, quantity FROM products WHERE id = $1", item.ProductID).
-            Scan(&price, &availableQuantity)
-        if err != nil {
-            if err == sql.ErrNoRows {
-                utils.RespondWithError(w, http.StatusBadRequest, "Sản phẩm không tồn tại: ID "+strconv.Itoa(item.ProductID))
-                return
-            }
-            utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi kiểm tra sản phẩm")
-            return
-        }
-
-        if availableQuantity < item.Quantity {
-            utils.RespondWithError(w, http.StatusBadRequest,
-                fmt.Sprintf("Sản phẩm ID %d chỉ còn %d sản phẩm", item.ProductID, availableQuantity))
-            return
-        }
-
-        totalAmount += price * int64(item.Quantity)
-        productPrices[item.ProductID] = price
-    }
-
-    var discountAmount int64 = 0
-    if req.AppliedUserVoucherID != nil {
-        var uv models.UserVoucher
-        var v models.Voucher
-
-        err := tx.QueryRow(`
-            SELECT uv.is_used, uv.expires_at, v.discount_type, v.discount_value
-            FROM user_vouchers uv
-            JOIN vouchers v ON uv.voucher_id = v.id
-            WHERE uv.id = $1 AND uv.user_id = $2 FOR UPDATE
-        `, *req.AppliedUserVoucherID, req.UserID).Scan(&uv.IsUsed, &uv.ExpiresAt, &v.DiscountType, &v.DiscountValue)
-
-        if err != nil {
-            if err == sql.ErrNoRows {
-                utils.RespondWithError(w, http.StatusBadRequest, "Voucher không tồn tại hoặc không thuộc về bạn")
-                return
-            }
-            utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi kiểm tra voucher")
-            return
-        }
-
-        if uv.IsUsed {
-            utils.RespondWithError(w, http.StatusBadRequest, "Voucher này đã được sử dụng")
-            return
-        }
-
-        if time.Now().UTC().After(uv.ExpiresAt) {
-            utils.RespondWithError(w, http.StatusBadRequest, "Voucher đã hết hạn")
-            return
-        }
-
-        if v.DiscountType == "percentage" {
-            discountAmount = (totalAmount * v.DiscountValue) / 100
-        } else if v.DiscountType == "fixed_amount" {
-            discountAmount = v.DiscountValue
-        }
-
-        if discountAmount > totalAmount {
-            discountAmount = totalAmount
-        }
-    }
-
-    finalAmount := totalAmount - discountAmount
-
-    var orderID int
-    err = tx.QueryRow(`
-        INSERT INTO orders (
-            user_id, customer_name, customer_phone, shipping_address,
-            total_amount, status, applied_voucher_id, discount_amount
-        ) VALUES ($1, $2, $3, $4, $5, 'pending', $6, $7)
-        RETURNING id`,
-        req.UserID, req.CustomerName, req.CustomerPhone,
-        req.ShippingAddress, finalAmount, req.AppliedUserVoucherID,
-        discountAmount,
-    ).Scan(&orderID)
-
-    if err != nil {
-        utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo đơn hàng")
-        return
-    }
-
-    // Insert order items and update product quantities
-    for _, item := range req.CartItems {
-        _, err = tx.Exec(`
-            INSERT INTO order_items (order_id, product_id, quantity, price_at_purchase)
-            VALUES ($1, $2, $3, $4)`,
-            orderID, item.ProductID, item.Quantity, productPrices[item.ProductID],
-        )
-        if err != nil {
-            utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi thêm chi tiết đơn hàng")
-            return
-        }
-    }
-
-    // Mark voucher as used
-    if req.AppliedUserVoucherID != nil {
-        _, err := tx.Exec(
-            "UPDATE user_vouchers SET is_used = true WHERE id = $1",
-            *req.AppliedUserVoucherID,
-        )
-        if err != nil {
-            utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật trạng thái voucher")
-            return
-        }
-    }
-
-	if req.UserID != nil {
-		_, err = tx.Exec("DELETE FROM carts WHERE user_id = $1", *req.UserID)
-		if err != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi dọn dẹp giỏ hàng")
-			return
-		}
-	}
-
-    if err := tx.Commit(); err != nil {
-        utils.RespondWithError(w, http.StatusInternalServerError, "Không thể hoàn tất đơn hàng")
+    order, ok := h.placeOrder(w, r, checkout.CashOnDelivery)
+    if !ok {
         return
     }
 
     utils.RespondWithJSON(w, http.StatusCreated, map[string]interface{}{
-        "order_id": orderID,
+        "order_id": order.ID,
         "message": "Đặt hàng thành công",
     })
 }
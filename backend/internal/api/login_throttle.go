@@ -0,0 +1,254 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Loại và lý do của một lần thử, lưu trong login_attempts.
+const (
+	attemptKindLogin         = "login"
+	attemptKindPasswordReset = "password_reset"
+
+	attemptSuccess      = "success"
+	attemptBadPassword  = "bad_password"
+	attemptBadTOTP      = "bad_totp"
+	attemptUnknownUser  = "unknown_user"
+	attemptThrottled    = "throttled"
+	attemptLocked       = "locked"
+	attemptResetRequest = "reset_requested"
+)
+
+// throttlePolicy quy định độ trễ tăng dần và thời gian khóa tài khoản.
+type throttlePolicy struct {
+	FreeAttempts    int           // số lần sai liên tiếp chưa bị bắt chờ
+	BaseDelay       time.Duration // thời gian chờ sau lần sai đầu tiên vượt ngưỡng, nhân đôi mỗi lần
+	MaxDelay        time.Duration
+	LockoutAfter    int // số lần sai liên tiếp thì khóa tài khoản
+	LockoutDuration time.Duration
+
+	IPWindow        time.Duration // cửa sổ đếm số lần sai theo IP
+	IPFreeAttempts  int
+	ResetWindow     time.Duration // cửa sổ giới hạn yêu cầu quên mật khẩu
+	ResetMaxPerIP   int
+	ResetMaxPerUser int
+}
+
+var defaultThrottlePolicy = throttlePolicy{
+	FreeAttempts:    3,
+	BaseDelay:       2 * time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+
+	IPWindow:        15 * time.Minute,
+	IPFreeAttempts:  20,
+	ResetWindow:     time.Hour,
+	ResetMaxPerIP:   10,
+	ResetMaxPerUser: 3,
+}
+
+// delay trả về thời gian phải chờ sau `failures` lần sai liên tiếp.
+func (p throttlePolicy) delay(failures, free int) time.Duration {
+	if failures < free {
+		return 0
+	}
+	shift := failures - free
+	if shift > 30 {
+		return p.MaxDelay
+	}
+	d := p.BaseDelay << uint(shift)
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// retryAfter trả về thời gian còn phải chờ tính từ lần sai gần nhất (0 nếu được thử tiếp).
+func (p throttlePolicy) retryAfter(now time.Time, failures, free int, lastFailure time.Time) time.Duration {
+	wait := lastFailure.Add(p.delay(failures, free)).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+func (h *handler) now() time.Time {
+	if h.clock != nil {
+		return h.clock().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (h *handler) recordAttempt(kind string, userID *int, username, result string, r *http.Request) {
+	_, err := h.db.Exec(`
+		INSERT INTO login_attempts (user_id, username, ip_address, user_agent, kind, result, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, userID, username, clientIP(r), r.UserAgent(), kind, result, h.now())
+	if err != nil {
+		fmt.Printf("ERROR recording %s attempt: %v\n", kind, err)
+	}
+}
+
+// ipLoginRetryAfter đếm số lần đăng nhập sai từ IP trong cửa sổ IPWindow.
+func (h *handler) ipLoginRetryAfter(ip string) (time.Duration, error) {
+	now := h.now()
+	var failures int
+	var lastFailure sql.NullTime
+	err := h.db.QueryRow(`
+		SELECT COUNT(*), MAX(created_at)
+		FROM login_attempts
+		WHERE ip_address = $1 AND kind = $2 AND result IN ($3, $4) AND created_at > $5
+	`, ip, attemptKindLogin, attemptBadPassword, attemptUnknownUser, now.Add(-h.throttle.IPWindow)).Scan(&failures, &lastFailure)
+	if err != nil || !lastFailure.Valid {
+		return 0, err
+	}
+	return h.throttle.retryAfter(now, failures, h.throttle.IPFreeAttempts, lastFailure.Time), nil
+}
+
+// registerLoginFailure tăng bộ đếm sai của tài khoản và khóa tạm thời khi vượt ngưỡng. tx phải
+// đang khóa dòng users (SELECT ... FOR UPDATE) từ lúc kiểm tra bộ đếm, để các lần thử song song
+// không cùng vượt qua kiểm tra trước khi lần sai nào được đếm.
+func (h *handler) registerLoginFailure(tx *sql.Tx, userID int) (lockedUntil *time.Time, err error) {
+	now := h.now()
+	var count int
+	err = tx.QueryRow(`
+		UPDATE users SET failed_login_count = failed_login_count + 1, last_failed_login_at = $1
+		WHERE id = $2 RETURNING failed_login_count
+	`, now, userID).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count < h.throttle.LockoutAfter {
+		return nil, nil
+	}
+	until := now.Add(h.throttle.LockoutDuration)
+	_, err = tx.Exec("UPDATE users SET locked_until = $1 WHERE id = $2", until, userID)
+	return &until, err
+}
+
+func respondThrottled(w http.ResponseWriter, code, message string, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	utils.RespondWithAPIError(w, http.StatusTooManyRequests, code, message, map[string]string{
+		"retry_after_seconds": strconv.Itoa(seconds),
+	})
+}
+
+// Admin: Mở khóa tài khoản bị khóa do đăng nhập sai nhiều lần
+func (h *handler) unlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID không hợp lệ")
+		return
+	}
+
+	res, err := h.db.Exec(
+		"UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL WHERE id = $1",
+		userID,
+	)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi mở khóa tài khoản")
+		return
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy người dùng")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Đã mở khóa tài khoản"})
+}
+
+// User: Lịch sử đăng nhập của chính mình
+func (h *handler) getLoginHistory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	page, limit, offset := utils.GetPaginationParams(r, 20)
+
+	var totalRecords int
+	h.db.QueryRow("SELECT COUNT(*) FROM login_attempts WHERE user_id = $1 AND kind = $2", userID, attemptKindLogin).Scan(&totalRecords)
+	totalPages := int(math.Ceil(float64(totalRecords) / float64(limit)))
+
+	rows, err := h.db.Query(`
+		SELECT id, ip_address, user_agent, result, created_at
+		FROM login_attempts
+		WHERE user_id = $1 AND kind = $2
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4
+	`, userID, attemptKindLogin, limit, offset)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy lịch sử đăng nhập")
+		return
+	}
+	defer rows.Close()
+
+	attempts := []models.LoginAttempt{}
+	for rows.Next() {
+		var a models.LoginAttempt
+		var userAgent sql.NullString
+		if err := rows.Scan(&a.ID, &a.IPAddress, &userAgent, &a.Result, &a.CreatedAt); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét lịch sử đăng nhập")
+			return
+		}
+		a.UserAgent = userAgent.String
+		a.Success = a.Result == attemptSuccess
+		attempts = append(attempts, a)
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"attempts":   attempts,
+		"page":       page,
+		"totalPages": totalPages,
+	})
+}
+
+// passwordResetAllowed giới hạn số yêu cầu quên mật khẩu theo IP và theo tài khoản.
+func (h *handler) passwordResetAllowed(ip string, userID *int) (bool, error) {
+	since := h.now().Add(-h.throttle.ResetWindow)
+
+	var perIP int
+	err := h.db.QueryRow(
+		"SELECT COUNT(*) FROM login_attempts WHERE ip_address = $1 AND kind = $2 AND created_at > $3",
+		ip, attemptKindPasswordReset, since,
+	).Scan(&perIP)
+	if err != nil {
+		return false, err
+	}
+	if perIP >= h.throttle.ResetMaxPerIP {
+		return false, nil
+	}
+
+	if userID == nil {
+		return true, nil
+	}
+	var perUser int
+	err = h.db.QueryRow(
+		"SELECT COUNT(*) FROM login_attempts WHERE user_id = $1 AND kind = $2 AND result = $3 AND created_at > $4",
+		*userID, attemptKindPasswordReset, attemptResetRequest, since,
+	).Scan(&perUser)
+	if err != nil {
+		return false, err
+	}
+	return perUser < h.throttle.ResetMaxPerUser, nil
+}
+
+func lockedMessage(until time.Time) string {
+	return fmt.Sprintf("Tài khoản tạm thời bị khóa do đăng nhập sai nhiều lần. Vui lòng thử lại sau %s.",
+		until.In(vietnamLocation()).Format("15:04 02/01/2006"))
+}
+
+func vietnamLocation() *time.Location {
+	loc, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	if err != nil {
+		return time.FixedZone("ICT", 7*60*60)
+	}
+	return loc
+}
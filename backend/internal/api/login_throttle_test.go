@@ -0,0 +1,292 @@
+package api
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testClock là đồng hồ có thể tua của handler trong test.
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestClock() *testClock {
+	return &testClock{t: time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)}
+}
+
+func TestThrottleDelayIsProgressive(t *testing.T) {
+	p := defaultThrottlePolicy
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, 2 * time.Second},
+		{4, 4 * time.Second},
+		{5, 8 * time.Second},
+		{9, 128 * time.Second},
+		{10, 256 * time.Second},
+		{11, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+	for _, c := range cases {
+		if got := p.delay(c.failures, p.FreeAttempts); got != c.want {
+			t.Errorf("delay(%d) = %v, muốn %v", c.failures, got, c.want)
+		}
+	}
+}
+
+func TestRetryAfterCountsDownFromLastFailure(t *testing.T) {
+	p := defaultThrottlePolicy
+	clock := newTestClock()
+	lastFailure := clock.now()
+
+	// 5 lần sai: phải chờ 8s kể từ lần sai cuối
+	if got := p.retryAfter(clock.now(), 5, p.FreeAttempts, lastFailure); got != 8*time.Second {
+		t.Fatalf("ngay sau lần sai: chờ %v, muốn 8s", got)
+	}
+	clock.advance(5 * time.Second)
+	if got := p.retryAfter(clock.now(), 5, p.FreeAttempts, lastFailure); got != 3*time.Second {
+		t.Fatalf("sau 5s: chờ %v, muốn 3s", got)
+	}
+	clock.advance(3 * time.Second)
+	if got := p.retryAfter(clock.now(), 5, p.FreeAttempts, lastFailure); got != 0 {
+		t.Fatalf("sau 8s: chờ %v, muốn 0", got)
+	}
+}
+
+func TestRegisterLoginFailureLocksAtThreshold(t *testing.T) {
+	clock := newTestClock()
+	for _, c := range []struct {
+		count  int64
+		locked bool
+	}{
+		{1, false},
+		{9, false},
+		{10, true},
+		{12, true},
+	} {
+		fake, db := dbtest.New()
+		fake.On("RETURNING failed_login_count", dbtest.Rows([]driver.Value{c.count}))
+		h := &handler{db: db, clock: clock.now, throttle: defaultThrottlePolicy}
+
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		until, err := h.registerLoginFailure(tx, 7)
+		tx.Rollback()
+		if err != nil {
+			t.Fatalf("count %d: %v", c.count, err)
+		}
+		if got := fake.Calls("RETURNING failed_login_count"); len(got) != 1 || got[0].Args[0] != clock.now() {
+			t.Fatalf("count %d: last_failed_login_at phải là giờ của clock, có %+v", c.count, got)
+		}
+		locks := fake.Calls("SET locked_until")
+		if !c.locked {
+			if until != nil || len(locks) != 0 {
+				t.Errorf("count %d: không được khóa, có until=%v", c.count, until)
+			}
+			continue
+		}
+		want := clock.now().Add(defaultThrottlePolicy.LockoutDuration)
+		if until == nil || !until.Equal(want) {
+			t.Fatalf("count %d: khóa đến %v, muốn %v", c.count, until, want)
+		}
+		if len(locks) != 1 || locks[0].Args[0] != want {
+			t.Errorf("count %d: locked_until lưu xuống %+v, muốn %v", c.count, locks, want)
+		}
+	}
+}
+
+// loginFixture là một tài khoản "alice" (mật khẩu "secret") trên DB giả.
+type loginFixture struct {
+	fake        *dbtest.DB
+	h           *handler
+	clock       *testClock
+	failedCount int64
+	lastFailed  interface{}
+	lockedUntil interface{}
+	ipFailures  int64
+	ipLast      interface{}
+}
+
+func newLoginFixture(t *testing.T) *loginFixture {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake, db := dbtest.New()
+	f := &loginFixture{fake: fake, clock: newTestClock()}
+	f.h = &handler{db: db, clock: f.clock.now, throttle: defaultThrottlePolicy}
+
+	fake.On("FROM login_attempts", func([]driver.Value) ([][]driver.Value, error) {
+		return [][]driver.Value{{f.ipFailures, f.ipLast}}, nil
+	})
+	fake.On("FROM users WHERE username = $1", func([]driver.Value) ([][]driver.Value, error) {
+		return [][]driver.Value{{
+			int64(7), "alice", string(hash), false, "customer", "alice@example.com", true,
+			f.failedCount, f.lastFailed, f.lockedUntil, false,
+		}}, nil
+	})
+	fake.On("RETURNING failed_login_count", func([]driver.Value) ([][]driver.Value, error) {
+		f.failedCount++
+		return [][]driver.Value{{f.failedCount}}, nil
+	})
+	fake.On("INSERT INTO user_sessions", dbtest.Rows([]driver.Value{int64(1)}))
+
+	oldKey := jwtKey
+	jwtKey = []byte("test-secret")
+	t.Cleanup(func() { jwtKey = oldKey })
+	return f
+}
+
+func (f *loginFixture) login(password string) *httptest.ResponseRecorder {
+	body := `{"username":"alice","password":"` + password + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBufferString(body))
+	req.RemoteAddr = "203.0.113.5:4000"
+	rec := httptest.NewRecorder()
+	f.h.login(rec, req)
+	return rec
+}
+
+func TestLoginLockoutAndExpiry(t *testing.T) {
+	f := newLoginFixture(t)
+	lockStart := f.clock.now()
+	f.failedCount = 10
+	f.lastFailed = lockStart
+	f.lockedUntil = lockStart.Add(defaultThrottlePolicy.LockoutDuration)
+
+	// Đang bị khóa: kể cả mật khẩu đúng cũng bị từ chối, Retry-After là thời gian khóa còn lại
+	f.clock.advance(5 * time.Minute)
+	rec := f.login("secret")
+	if rec.Code != http.StatusTooManyRequests || errorCode(t, rec) != "account_locked" {
+		t.Fatalf("đang khóa: status %d code %q, muốn 429 account_locked", rec.Code, errorCode(t, rec))
+	}
+	if got := rec.Header().Get("Retry-After"); got != "600" {
+		t.Errorf("Retry-After = %s, muốn 600", got)
+	}
+	if len(f.fake.Calls("INSERT INTO user_sessions")) != 0 {
+		t.Fatal("không được tạo session khi tài khoản đang khóa")
+	}
+
+	// Hết thời gian khóa: đăng nhập đúng thì thành công và bộ đếm được xóa
+	f.clock.advance(10*time.Minute + time.Second)
+	rec = f.login("secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("hết khóa: status %d, muốn 200: %s", rec.Code, rec.Body)
+	}
+	if len(f.fake.Calls("SET failed_login_count = 0")) != 1 {
+		t.Error("đăng nhập thành công phải xóa bộ đếm sai")
+	}
+}
+
+func TestLoginLocksAccountOnThresholdFailure(t *testing.T) {
+	f := newLoginFixture(t)
+	f.failedCount = int64(defaultThrottlePolicy.LockoutAfter - 1)
+	// Lần sai trước đã đủ lâu để hết độ trễ
+	f.lastFailed = f.clock.now().Add(-time.Hour)
+
+	rec := f.login("wrong")
+	if rec.Code != http.StatusTooManyRequests || errorCode(t, rec) != "account_locked" {
+		t.Fatalf("status %d code %q, muốn 429 account_locked", rec.Code, errorCode(t, rec))
+	}
+	if got := rec.Header().Get("Retry-After"); got != "900" {
+		t.Errorf("Retry-After = %s, muốn 900", got)
+	}
+}
+
+func TestLoginProgressiveDelay(t *testing.T) {
+	f := newLoginFixture(t)
+	f.failedCount = 4
+	f.lastFailed = f.clock.now()
+
+	// 4 lần sai: chờ 4s, trong lúc chờ kể cả mật khẩu đúng cũng bị chặn
+	f.clock.advance(time.Second)
+	rec := f.login("secret")
+	if rec.Code != http.StatusTooManyRequests || errorCode(t, rec) != "too_many_attempts" {
+		t.Fatalf("status %d code %q, muốn 429 too_many_attempts", rec.Code, errorCode(t, rec))
+	}
+	if got := rec.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("Retry-After = %s, muốn 3", got)
+	}
+
+	f.clock.advance(3 * time.Second)
+	rec = f.login("wrong")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("hết thời gian chờ: status %d, muốn 401", rec.Code)
+	}
+	if f.failedCount != 5 {
+		t.Errorf("failed_login_count = %d, muốn 5", f.failedCount)
+	}
+}
+
+func TestLoginIPWindow(t *testing.T) {
+	p := defaultThrottlePolicy
+	f := newLoginFixture(t)
+
+	// Dưới ngưỡng của IP: đi tiếp tới kiểm tra mật khẩu
+	f.ipFailures = int64(p.IPFreeAttempts - 1)
+	f.ipLast = f.clock.now()
+	if rec := f.login("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("dưới ngưỡng IP: status %d, muốn 401", rec.Code)
+	}
+	calls := f.fake.Calls("FROM login_attempts")
+	if len(calls) != 1 {
+		t.Fatalf("phải đếm số lần sai theo IP đúng một lần, có %d", len(calls))
+	}
+	if calls[0].Args[0] != "203.0.113.5" {
+		t.Errorf("IP = %v, muốn 203.0.113.5", calls[0].Args[0])
+	}
+	if want := f.clock.now().Add(-p.IPWindow); calls[0].Args[4] != want {
+		t.Errorf("cửa sổ IP bắt đầu từ %v, muốn %v", calls[0].Args[4], want)
+	}
+
+	// Đủ ngưỡng: chặn trước khi tra tài khoản
+	f.ipFailures = int64(p.IPFreeAttempts)
+	f.ipLast = f.clock.now().Add(-time.Second)
+	rec := f.login("secret")
+	if rec.Code != http.StatusTooManyRequests || errorCode(t, rec) != "too_many_attempts" {
+		t.Fatalf("vượt ngưỡng IP: status %d code %q, muốn 429 too_many_attempts", rec.Code, errorCode(t, rec))
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %s, muốn 1", got)
+	}
+	if len(f.fake.Calls("FROM users WHERE username")) != 1 {
+		t.Error("bị chặn theo IP thì không được tra tài khoản")
+	}
+
+	// Lần sai cuối của IP đã đủ lâu: được thử tiếp
+	f.clock.advance(time.Second)
+	if rec := f.login("secret"); rec.Code != http.StatusOK {
+		t.Fatalf("hết thời gian chờ IP: status %d, muốn 200", rec.Code)
+	}
+}
+
+func TestLoginCountsFailureWhileHoldingUserLock(t *testing.T) {
+	f := newLoginFixture(t)
+
+	if rec := f.login("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, muốn 401", rec.Code)
+	}
+	lookup := f.fake.Calls("FROM users WHERE username = $1")
+	if len(lookup) != 1 || !strings.Contains(lookup[0].Query, "FOR UPDATE") {
+		t.Fatalf("phải khóa dòng người dùng trước khi so mật khẩu, có %+v", lookup)
+	}
+	// Bộ đếm được tăng trong cùng transaction giữ khóa rồi mới commit
+	if f.failedCount != 1 || f.fake.Commits != 1 {
+		t.Errorf("failed_login_count = %d, commits = %d, muốn 1 và 1", f.failedCount, f.fake.Commits)
+	}
+}
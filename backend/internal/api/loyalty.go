@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/internal/loyalty"
+	"backend/internal/models"
+	"backend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// loyaltyBalance đọc số điểm khả dụng và số điểm sắp hết hạn (30 ngày tới) của người dùng.
+func (h *handler) loyaltyBalance(r *http.Request, userID int) (models.LoyaltyBalance, error) {
+	now := h.now()
+	policy := loyalty.PolicyFromEnv()
+	balance := models.LoyaltyBalance{Policy: policy, ExpiringBefore: now.AddDate(0, 0, 30)}
+
+	var err error
+	balance.Points, err = loyalty.Balance(r.Context(), h.db, userID, now, false)
+	if err != nil {
+		return balance, err
+	}
+	balance.Value = int64(balance.Points) * policy.PointValue
+	balance.ExpiringPoints, err = loyalty.Expiring(r.Context(), h.db, userID, now, balance.ExpiringBefore)
+	return balance, err
+}
+
+// User: Số điểm thưởng hiện có
+func (h *handler) getLoyaltyBalance(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	balance, err := h.loyaltyBalance(r, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy điểm thưởng")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, balance)
+}
+
+// User: Lịch sử cộng/trừ điểm thưởng
+func (h *handler) getLoyaltyHistory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	page, limit, offset := utils.GetPaginationParams(r, 20)
+
+	var totalRecords int
+	h.db.QueryRow("SELECT COUNT(*) FROM loyalty_ledger WHERE user_id = $1", userID).Scan(&totalRecords)
+	totalPages := int(math.Ceil(float64(totalRecords) / float64(limit)))
+
+	entries, err := loyalty.History(r.Context(), h.db, userID, limit, offset)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy lịch sử điểm thưởng")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"entries":    entries,
+		"page":       page,
+		"totalPages": totalPages,
+	})
+}
+
+// Admin: Xem điểm thưởng và lịch sử gần đây của một người dùng
+func (h *handler) getUserLoyalty(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID không hợp lệ")
+		return
+	}
+	balance, err := h.loyaltyBalance(r, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy điểm thưởng")
+		return
+	}
+	entries, err := loyalty.History(r.Context(), h.db, userID, 50, 0)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy lịch sử điểm thưởng")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"balance": balance,
+		"entries": entries,
+	})
+}
+
+// Admin: Cộng/trừ điểm thưởng thủ công, bắt buộc ghi lý do
+func (h *handler) adjustLoyaltyPoints(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID không hợp lệ")
+		return
+	}
+	var req models.LoyaltyAdjustRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Points == 0 || req.Reason == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Cần nhập số điểm khác 0 và lý do điều chỉnh")
+		return
+	}
+
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil || !exists {
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy người dùng")
+		return
+	}
+
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi bắt đầu giao dịch")
+		return
+	}
+	defer tx.Rollback()
+
+	staffID := r.Context().Value("userID").(int)
+	err = loyalty.Adjust(r.Context(), tx, userID, req.Points, req.Reason, staffID, h.now())
+	if errors.Is(err, loyalty.ErrInsufficientPoints) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Người dùng không đủ điểm để trừ")
+		return
+	}
+	if err != nil || tx.Commit() != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi điều chỉnh điểm thưởng")
+		return
+	}
+
+	balance, err := h.loyaltyBalance(r, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy điểm thưởng")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, balance)
+}
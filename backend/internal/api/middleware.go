@@ -35,15 +35,47 @@ func (h *handler) AuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		// Get information user db
+		// Session phải còn hiệu lực (chưa logout / chưa bị thu hồi / chưa hết hạn)
 		var userID int
-		err = h.db.QueryRow("SELECT id FROM users WHERE username = $1", claims.Username).Scan(&userID)
+		var role Role
+		var twoFactorEnabled bool
+		err = h.db.QueryRow(`
+			SELECT u.id, u.role, u.totp_enabled_at IS NOT NULL
+			FROM users u
+			JOIN user_sessions s ON s.user_id = u.id
+			WHERE u.username = $1 AND s.id = $2 AND s.revoked_at IS NULL AND s.expires_at > $3
+		`, claims.Username, claims.SessionID, h.now()).Scan(&userID, &role, &twoFactorEnabled)
 		if err != nil {
-			utils.RespondWithError(w, http.StatusUnauthorized, "User not found")
+			utils.RespondWithError(w, http.StatusUnauthorized, "Session expired or revoked")
 			return
 		}
 		
-		// Assign userID
+		// Assign userID, role (role lấy từ DB để thay đổi quyền có hiệu lực ngay)
 		ctx := context.WithValue(r.Context(), "userID", userID)
+		ctx = context.WithValue(ctx, "role", role)
+		ctx = context.WithValue(ctx, "sessionID", claims.SessionID)
+		ctx = context.WithValue(ctx, "twoFactorEnabled", twoFactorEnabled)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
-}
\ No newline at end of file
+}
+
+// OptionalAuthMiddleware dùng cho các route khách vãng lai cũng gọi được (đặt hàng, báo giá): không
+// gửi token thì đi tiếp như khách, có token thì phải hợp lệ như AuthMiddleware.
+func (h *handler) OptionalAuthMiddleware(next http.Handler) http.Handler {
+	auth := h.AuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		auth.ServeHTTP(w, r)
+	})
+}
+
+// sessionUserID là người dùng đã đăng nhập của request, nil nếu là khách vãng lai.
+func sessionUserID(r *http.Request) *int {
+	if userID, ok := r.Context().Value("userID").(int); ok {
+		return &userID
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/oidc"
+	"backend/internal/referral"
+	"backend/internal/utils"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var usernameUnsafeChars = regexp.MustCompile(`[^a-z0-9_.]`)
+
+func (h *handler) oidcProvider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	provider, ok := h.oidcProviders[mux.Vars(r)["provider"]]
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "Nhà cung cấp đăng nhập không được hỗ trợ")
+		return nil, false
+	}
+	return provider, true
+}
+
+// Danh sách nhà cung cấp đăng nhập mạng xã hội đang được cấu hình
+func (h *handler) getOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for name := range h.oidcProviders {
+		names = append(names, name)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string][]string{"providers": names})
+}
+
+// Bước 1: tạo state/nonce/PKCE và trả về URL đăng nhập của nhà cung cấp
+func (h *handler) startOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể khởi tạo đăng nhập")
+		return
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể khởi tạo đăng nhập")
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể khởi tạo đăng nhập")
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		fmt.Printf("ERROR building %s authorization URL: %v\n", provider.Name(), err)
+		utils.RespondWithError(w, http.StatusBadGateway, "Không thể kết nối tới nhà cung cấp đăng nhập")
+		return
+	}
+
+	_, err = h.db.Exec(`
+		INSERT INTO oidc_login_states (state_hash, provider, code_verifier, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, hashToken(state), provider.Name(), verifier, nonce, h.now().Add(oidcStateTTL))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể khởi tạo đăng nhập")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"authorization_url": authURL})
+}
+
+// Bước 2: frontend gửi code + state nhận được từ redirect, backend đổi lấy ID token
+// và trả về LoginResponse giống /login.
+func (h *handler) completeOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.State == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+
+	// State chỉ dùng được một lần
+	var verifier, nonce string
+	var expiresAt time.Time
+	err := h.db.QueryRow(`
+		DELETE FROM oidc_login_states WHERE state_hash = $1 AND provider = $2
+		RETURNING code_verifier, nonce, expires_at
+	`, hashToken(req.State), provider.Name()).Scan(&verifier, &nonce, &expiresAt)
+	if err != nil || h.now().After(expiresAt) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Phiên đăng nhập không hợp lệ hoặc đã hết hạn")
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), req.Code, verifier, nonce)
+	if err != nil {
+		fmt.Printf("ERROR exchanging %s code: %v\n", provider.Name(), err)
+		utils.RespondWithError(w, http.StatusUnauthorized, "Đăng nhập bằng tài khoản mạng xã hội thất bại")
+		return
+	}
+
+	user, err := h.findOrLinkOIDCUser(provider.Name(), identity)
+	if err == errOIDCEmailUnverified {
+		utils.RespondWithError(w, http.StatusConflict, "Email đã được dùng cho một tài khoản khác. Vui lòng đăng nhập bằng mật khẩu để liên kết.")
+		return
+	}
+	if err == errOIDCAccountUnverified {
+		utils.RespondWithError(w, http.StatusConflict, "Email đã được dùng cho một tài khoản chưa xác thực email. Vui lòng đăng nhập bằng mật khẩu và xác thực email trước khi liên kết.")
+		return
+	}
+	if err != nil {
+		fmt.Printf("ERROR linking %s identity: %v\n", provider.Name(), err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể đăng nhập")
+		return
+	}
+
+	if lockedUntil := user.LockedUntil; lockedUntil != nil && h.now().Before(*lockedUntil) {
+		respondThrottled(w, "account_locked", lockedMessage(*lockedUntil), lockedUntil.Sub(h.now()))
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		h.respondTwoFactorChallenge(w, user.ID)
+		return
+	}
+
+	h.recordAttempt(attemptKindLogin, &user.ID, user.Username, attemptSuccess, r)
+	resp, err := h.issueTokens(r, user)
+	if err != nil {
+		fmt.Printf("ERROR issuing tokens: %v\n", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo token")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+var (
+	errOIDCEmailUnverified   = errors.New("email chưa được nhà cung cấp xác thực")
+	errOIDCAccountUnverified = errors.New("tài khoản cùng email chưa xác thực email")
+)
+
+// findOrLinkOIDCUser tìm user theo (provider, sub); nếu chưa có thì liên kết với user
+// cùng email, hoặc tạo user mới. Chỉ tự liên kết khi cả nhà cung cấp và tài khoản đã xác
+// thực email: tài khoản chưa xác thực có thể do người khác đăng ký trước bằng email của
+// nạn nhân, liên kết vào đó sẽ giao tài khoản cho họ.
+func (h *handler) findOrLinkOIDCUser(provider string, id *oidc.Identity) (models.User, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	const userColumns = `u.id, u.username, u.email, u.is_admin, u.role, u.email_verified_at IS NOT NULL,
+		u.totp_enabled_at IS NOT NULL, u.locked_until`
+	scanUser := func(row *sql.Row) (models.User, error) {
+		var u models.User
+		err := row.Scan(&u.ID, &u.Username, &u.Email, &u.IsAdmin, &u.Role, &u.EmailVerified, &u.TwoFactorEnabled, &u.LockedUntil)
+		return u, err
+	}
+
+	user, err := scanUser(tx.QueryRow(`
+		SELECT `+userColumns+`
+		FROM user_identities i JOIN users u ON i.user_id = u.id
+		WHERE i.provider = $1 AND i.subject = $2
+	`, provider, id.Subject))
+	if err == nil {
+		return user, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return models.User{}, err
+	}
+
+	email, ok := normalizeEmail(id.Email)
+	if !ok {
+		return models.User{}, fmt.Errorf("nhà cung cấp %s không trả về email hợp lệ", provider)
+	}
+
+	user, err = scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users u WHERE LOWER(u.email) = $1`, email))
+	switch {
+	case err == nil && !id.EmailVerified:
+		return models.User{}, errOIDCEmailUnverified
+	case err == nil && !user.EmailVerified:
+		return models.User{}, errOIDCAccountUnverified
+	case err == nil:
+		// Cả hai phía đã xác thực cùng email: liên kết vào tài khoản sẵn có
+	case err == sql.ErrNoRows:
+		user, err = h.createOIDCUser(tx, email, id.EmailVerified)
+		if err != nil {
+			return models.User{}, err
+		}
+	default:
+		return models.User{}, err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)",
+		user.ID, provider, id.Subject, email,
+	)
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, tx.Commit()
+}
+
+// createOIDCUser tạo tài khoản mới với mật khẩu ngẫu nhiên (người dùng có thể đặt lại qua quên mật khẩu)
+// và mã giới thiệu riêng như tài khoản đăng ký bằng mật khẩu.
+func (h *handler) createOIDCUser(tx *sql.Tx, email string, emailVerified bool) (models.User, error) {
+	randomPassword, err := newRandomToken()
+	if err != nil {
+		return models.User{}, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	base := usernameUnsafeChars.ReplaceAllString(strings.ToLower(strings.Split(email, "@")[0]), "")
+	if base == "" {
+		base = "user"
+	}
+	suffix, err := newRandomToken()
+	if err != nil {
+		return models.User{}, err
+	}
+	referralCode, err := referral.NewCode()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{
+		Username:      base + "_" + suffix[:6],
+		Email:         email,
+		Role:          string(RoleCustomer),
+		EmailVerified: emailVerified,
+	}
+	var verifiedAt interface{}
+	if emailVerified {
+		verifiedAt = h.now()
+	}
+	err = tx.QueryRow(
+		"INSERT INTO users (username, email, password_hash, email_verified_at, referral_code) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		user.Username, user.Email, string(hashedPassword), verifiedAt, referralCode,
+	).Scan(&user.ID)
+	return user, err
+}
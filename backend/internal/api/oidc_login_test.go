@@ -0,0 +1,198 @@
+package api
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+	"backend/internal/oidc"
+	"backend/internal/oidc/oidctest"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+)
+
+// oidcFixture là luồng callback OIDC với nhà cung cấp giả "google" và DB giả.
+type oidcFixture struct {
+	fake     *dbtest.DB
+	h        *handler
+	clock    *testClock
+	provider *oidctest.Server
+	// stateExpiresAt là hạn của state đã lưu ở bước start.
+	stateExpiresAt time.Time
+	// linkedUser là dòng users đã liên kết với (provider, sub), nil nếu chưa liên kết.
+	linkedUser []driver.Value
+	// localUser là dòng users có cùng email, nil nếu chưa có.
+	localUser []driver.Value
+}
+
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	t.Helper()
+	provider, err := oidctest.NewServer("shop-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(provider.Close)
+
+	fake, db := dbtest.New()
+	f := &oidcFixture{fake: fake, clock: newTestClock(), provider: provider}
+	f.stateExpiresAt = f.clock.now().Add(oidcStateTTL)
+	f.h = &handler{
+		db:            db,
+		clock:         f.clock.now,
+		throttle:      defaultThrottlePolicy,
+		oidcProviders: map[string]*oidc.Provider{"google": provider.Provider("google")},
+	}
+
+	fake.On("DELETE FROM oidc_login_states", func([]driver.Value) ([][]driver.Value, error) {
+		return [][]driver.Value{{"verifier", "nonce-1", f.stateExpiresAt}}, nil
+	})
+	fake.On("FROM user_identities i JOIN users u", func([]driver.Value) ([][]driver.Value, error) {
+		if f.linkedUser == nil {
+			return nil, nil
+		}
+		return [][]driver.Value{f.linkedUser}, nil
+	})
+	fake.On("FROM users u WHERE LOWER(u.email)", func([]driver.Value) ([][]driver.Value, error) {
+		if f.localUser == nil {
+			return nil, nil
+		}
+		return [][]driver.Value{f.localUser}, nil
+	})
+	fake.On("INSERT INTO users", dbtest.Rows([]driver.Value{int64(42)}))
+	fake.On("INSERT INTO user_sessions", dbtest.Rows([]driver.Value{int64(1)}))
+
+	oldKey := jwtKey
+	jwtKey = []byte("test-secret")
+	t.Cleanup(func() { jwtKey = oldKey })
+	return f
+}
+
+// userRow là một dòng users theo thứ tự cột của findOrLinkOIDCUser.
+func userRow(id int64, email string, emailVerified bool) []driver.Value {
+	return []driver.Value{id, "alice", email, false, "customer", emailVerified, false, nil}
+}
+
+// callback đăng nhập bằng một code mà nhà cung cấp giả đổi ra ID token với email đã cho.
+func (f *oidcFixture) callback(email string, emailVerified bool) *httptest.ResponseRecorder {
+	f.provider.IssueCode("code-1", jwt.MapClaims{
+		"sub": "google-sub-1", "email": email, "email_verified": emailVerified, "nonce": "nonce-1",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/google/callback",
+		bytes.NewBufferString(`{"code":"code-1","state":"state-1"}`))
+	req = mux.SetURLVars(req, map[string]string{"provider": "google"})
+	rec := httptest.NewRecorder()
+	f.h.completeOIDCLogin(rec, req)
+	return rec
+}
+
+func (f *oidcFixture) linkedTo(t *testing.T) []int64 {
+	t.Helper()
+	var ids []int64
+	for _, c := range f.fake.Calls("INSERT INTO user_identities") {
+		ids = append(ids, c.Args[0].(int64))
+	}
+	return ids
+}
+
+func TestOIDCLoginWithLinkedIdentity(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.linkedUser = userRow(5, "alice@example.com", true)
+
+	rec := f.callback("alice@example.com", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, muốn 200: %s", rec.Code, rec.Body)
+	}
+	if ids := f.linkedTo(t); len(ids) != 0 {
+		t.Errorf("đã liên kết thì không liên kết lại, có %v", ids)
+	}
+	if form := f.provider.TokenRequests[0]; form.Get("code_verifier") != "verifier" {
+		t.Errorf("phải gửi code_verifier đã lưu cùng state, có %v", form)
+	}
+}
+
+func TestOIDCLinksVerifiedLocalAccount(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.localUser = userRow(5, "alice@example.com", true)
+
+	rec := f.callback("Alice@Example.com", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, muốn 200: %s", rec.Code, rec.Body)
+	}
+	if ids := f.linkedTo(t); len(ids) != 1 || ids[0] != 5 {
+		t.Fatalf("phải liên kết vào user 5, có %v", ids)
+	}
+	if len(f.fake.Calls("INSERT INTO users")) != 0 {
+		t.Error("không được tạo tài khoản mới khi đã có tài khoản cùng email")
+	}
+}
+
+func TestOIDCRefusesToLinkUnverifiedLocalAccount(t *testing.T) {
+	f := newOIDCFixture(t)
+	// Tài khoản cùng email chưa xác thực: có thể do kẻ khác đăng ký trước bằng email của nạn nhân
+	f.localUser = userRow(5, "alice@example.com", false)
+
+	rec := f.callback("alice@example.com", true)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status %d, muốn 409: %s", rec.Code, rec.Body)
+	}
+	if ids := f.linkedTo(t); len(ids) != 0 {
+		t.Errorf("không được liên kết, có %v", ids)
+	}
+	if len(f.fake.Calls("email_verified_at =")) != 0 {
+		t.Error("không được đánh dấu tài khoản là đã xác thực email")
+	}
+	if len(f.fake.Calls("INSERT INTO user_sessions")) != 0 {
+		t.Error("không được cấp session")
+	}
+}
+
+func TestOIDCRefusesToLinkWhenProviderEmailUnverified(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.localUser = userRow(5, "alice@example.com", true)
+
+	rec := f.callback("alice@example.com", false)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status %d, muốn 409: %s", rec.Code, rec.Body)
+	}
+	if ids := f.linkedTo(t); len(ids) != 0 {
+		t.Errorf("không được liên kết, có %v", ids)
+	}
+}
+
+func TestOIDCCreatesNewAccount(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	rec := f.callback("bob@example.com", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, muốn 200: %s", rec.Code, rec.Body)
+	}
+	inserts := f.fake.Calls("INSERT INTO users")
+	if len(inserts) != 1 || inserts[0].Args[1] != "bob@example.com" || inserts[0].Args[3] != f.clock.now() {
+		t.Fatalf("phải tạo user bob@example.com đã xác thực email lúc %v, có %+v", f.clock.now(), inserts)
+	}
+	if code, _ := inserts[0].Args[4].(string); len(code) != 8 {
+		t.Errorf("tài khoản mới phải có mã giới thiệu, có %q", inserts[0].Args[4])
+	}
+	if ids := f.linkedTo(t); len(ids) != 1 || ids[0] != 42 {
+		t.Errorf("phải liên kết vào user mới 42, có %v", ids)
+	}
+}
+
+func TestOIDCRejectsExpiredState(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.linkedUser = userRow(5, "alice@example.com", true)
+	f.clock.advance(oidcStateTTL + time.Second)
+
+	rec := f.callback("alice@example.com", true)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, muốn 400", rec.Code)
+	}
+	if len(f.provider.TokenRequests) != 0 {
+		t.Error("state hết hạn thì không được đổi code")
+	}
+}
@@ -14,6 +14,33 @@ import (
 	"github.com/jung-kurt/gofpdf"
 )
 
+var paymentMethodNames = map[string]string{
+	"cod":           "Thanh toán khi nhận hàng (COD)",
+	"bank_transfer": "Chuyển khoản ngân hàng",
+	"momo":          "Ví MoMo",
+	"vnpay":         "VNPay",
+}
+
+var paymentStatusNames = map[string]string{
+	"unpaid":             "Chưa thanh toán",
+	"paid":               "Đã thanh toán",
+	"partially_refunded": "Đã hoàn một phần",
+	"refunded":           "Đã hoàn tiền",
+}
+
+// paymentLabel trả về phương thức và trạng thái thanh toán (không dấu) để in lên hóa đơn.
+func paymentLabel(order models.Order) string {
+	method, ok := paymentMethodNames[order.PaymentMethod]
+	if !ok {
+		method = order.PaymentMethod
+	}
+	status, ok := paymentStatusNames[order.PaymentStatus]
+	if !ok {
+		status = order.PaymentStatus
+	}
+	return removeVietnameseAccents(fmt.Sprintf("%s - %s", method, status))
+}
+
 // Helper function to remove Vietnamese accents
 func removeVietnameseAccents(s string) string {
 	replacements := map[string]string{
@@ -66,15 +93,16 @@ func (h *handler) exportOrderPDF(w http.ResponseWriter, r *http.Request) {
 	var voucherCode sql.NullString
 	err = h.db.QueryRow(`
         SELECT o.id, o.customer_name, o.customer_phone, o.shipping_address,
-               o.total_amount, o.discount_amount, o.status, o.created_at,
-               v.code
+               o.total_amount, o.discount_amount, o.status, o.payment_method, o.payment_status, o.created_at,
+               COALESCE(v.code, pv.code)
         FROM orders o
         LEFT JOIN user_vouchers uv ON o.applied_voucher_id = uv.id
         LEFT JOIN vouchers v ON uv.voucher_id = v.id
+        LEFT JOIN vouchers pv ON o.promo_voucher_id = pv.id
         WHERE o.id = $1 AND o.user_id = $2
     `, orderID, userID).Scan(&order.ID, &order.CustomerName, &order.CustomerPhone,
 		&order.ShippingAddress, &order.TotalAmount, &order.DiscountAmount,
-		&order.Status, &order.CreatedAt, &voucherCode)
+		&order.Status, &order.PaymentMethod, &order.PaymentStatus, &order.CreatedAt, &voucherCode)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -140,6 +168,8 @@ func (h *handler) exportOrderPDF(w http.ResponseWriter, r *http.Request) {
 	pdf.Cell(190, 6, fmt.Sprintf("Dia chi: %s", removeVietnameseAccents(order.ShippingAddress)))
 	pdf.Ln(6)
 	pdf.Cell(190, 6, fmt.Sprintf("Trang thai: %s", order.Status))
+	pdf.Ln(6)
+	pdf.Cell(190, 6, fmt.Sprintf("Thanh toan: %s", paymentLabel(order)))
 	pdf.Ln(12)
 
 	// Bảng sản phẩm
@@ -211,15 +241,16 @@ func (h *handler) adminExportOrderPDF(w http.ResponseWriter, r *http.Request) {
 	var voucherCode sql.NullString
 	err = h.db.QueryRow(`
         SELECT o.id, o.customer_name, o.customer_phone, o.shipping_address,
-               o.total_amount, o.discount_amount, o.status, o.created_at,
-               v.code
+               o.total_amount, o.discount_amount, o.status, o.payment_method, o.payment_status, o.created_at,
+               COALESCE(v.code, pv.code)
         FROM orders o
         LEFT JOIN user_vouchers uv ON o.applied_voucher_id = uv.id
         LEFT JOIN vouchers v ON uv.voucher_id = v.id
+        LEFT JOIN vouchers pv ON o.promo_voucher_id = pv.id
         WHERE o.id = $1
     `, orderID).Scan(&order.ID, &order.CustomerName, &order.CustomerPhone,
 		&order.ShippingAddress, &order.TotalAmount, &order.DiscountAmount,
-		&order.Status, &order.CreatedAt, &voucherCode)
+		&order.Status, &order.PaymentMethod, &order.PaymentStatus, &order.CreatedAt, &voucherCode)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -285,6 +316,8 @@ func (h *handler) adminExportOrderPDF(w http.ResponseWriter, r *http.Request) {
 	pdf.Cell(190, 6, fmt.Sprintf("Dia chi: %s", removeVietnameseAccents(order.ShippingAddress)))
 	pdf.Ln(6)
 	pdf.Cell(190, 6, fmt.Sprintf("Trang thai: %s", order.Status))
+	pdf.Ln(6)
+	pdf.Cell(190, 6, fmt.Sprintf("Thanh toan: %s", paymentLabel(order)))
 	pdf.Ln(12)
 
 	pdf.SetFont("Arial", "B", 10)
@@ -2,10 +2,12 @@ package api
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
+	"backend/internal/orderstatus"
 	"backend/internal/utils"
 
 	"github.com/gorilla/mux"
@@ -41,3 +43,30 @@ func (h *handler) getOrderStatus(w http.ResponseWriter, r *http.Request) {
 		"customer_name": customerName,
 	})
 }
+
+// allowedTransitions trả về các trạng thái admin có thể chọn cho đơn hàng.
+func allowedTransitions(status string) []string {
+	next := []string{}
+	for _, s := range orderstatus.Status(status).Next() {
+		next = append(next, string(s))
+	}
+	return next
+}
+
+// respondTransitionError chuyển lỗi của orderstatus.Transition thành response HTTP.
+func respondTransitionError(w http.ResponseWriter, err error) {
+	var te *orderstatus.TransitionError
+	switch {
+	case errors.Is(err, orderstatus.ErrOrderNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy đơn hàng")
+	case errors.Is(err, orderstatus.ErrOutOfStock):
+		utils.RespondWithError(w, http.StatusBadRequest, "Sản phẩm trong kho không đủ")
+	case errors.As(err, &te):
+		utils.RespondWithAPIError(w, http.StatusConflict, "invalid_status_transition",
+			fmt.Sprintf("Không thể chuyển đơn hàng từ %s sang %s", te.From, te.To),
+			map[string]string{"from": string(te.From), "to": string(te.To)})
+	default:
+		fmt.Printf("ERROR updating order status: %v\n", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật trạng thái đơn hàng")
+	}
+}
@@ -1,429 +1,137 @@
 package api
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
-	"time"
 
-	"backend/internal/models"
+	"backend/internal/banktransfer"
+	"backend/internal/checkout"
+	"backend/internal/orderstatus"
 	"backend/internal/payment"
+	"backend/internal/refund"
 	"backend/internal/utils"
-)
 
-func (h *handler) createMoMoPayment(w http.ResponseWriter, r *http.Request) {
-	var req models.MoMoRequestPayload
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
-		return
-	}
-
-	fmt.Printf("Received payment request: %+v\n", req)
+	"github.com/gorilla/mux"
+)
 
-	if len(req.CartItems) == 0 {
-		fmt.Println("ERROR: Cart is empty")
-		utils.RespondWithError(w, http.StatusBadRequest, "Giỏ hàng trống")
+// createGatewayPayment đặt hàng và tạo link thanh toán qua cổng {provider} (momo, vnpay...).
+func (h *handler) createGatewayPayment(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.payments[mux.Vars(r)["provider"]]
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "Cổng thanh toán không được hỗ trợ")
 		return
 	}
 
-	tx, err := h.db.Begin()
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi transaction")
+	order, ok := h.placeOrder(w, r, checkout.Gateway{Provider: provider, ClientIP: clientIP(r)})
+	if !ok || respondPaidOrder(w, order) {
 		return
 	}
-	defer tx.Rollback()
-
-	var totalAmount int64
-	productPrices := make(map[int]int64)
-
-	for _, item := range req.CartItems {
-		var price int64
-		var availableQuantity int
-		err := tx.QueryRow("SELECT price, quantity FROM products WHERE id = $1", item.ProductID).
-			Scan(&price, &availableQuantity)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				fmt.Printf("ERROR: Product not found: ID %d\n", item.ProductID)
-				utils.RespondWithError(w, http.StatusBadRequest, "Sản phẩm không tồn tại: ID "+strconv.Itoa(item.ProductID))
-				return
-			}
-			fmt.Printf("ERROR checking product: %v\n", err)
-			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi kiểm tra sản phẩm")
-			return
-		}
-
-		if availableQuantity < item.Quantity {
-			utils.RespondWithError(w, http.StatusBadRequest,
-				fmt.Sprintf("Sản phẩm ID %d chỉ còn %d sản phẩm", item.ProductID, availableQuantity))
-			return
-		}
-
-		totalAmount += price * int64(item.Quantity)
-		productPrices[item.ProductID] = price
-	}
-
-	var discountAmount int64 = 0
-	if req.AppliedUserVoucherID != nil && req.UserID != nil {
-		var uv models.UserVoucher
-		var v models.Voucher
-
-		err := tx.QueryRow(`
-            SELECT uv.is_used, uv.expires_at, v.discount_type, v.discount_value
-            FROM user_vouchers uv
-            JOIN vouchers v ON uv.voucher_id = v.id
-            WHERE uv.id = $1 AND uv.user_id = $2 FOR UPDATE
-        `, *req.AppliedUserVoucherID, req.UserID).Scan(&uv.IsUsed, &uv.ExpiresAt, &v.DiscountType, &v.DiscountValue)
-
-		if err != nil {
-			if err == sql.ErrNoRows {
-				utils.RespondWithError(w, http.StatusBadRequest, "Voucher không tồn tại hoặc không thuộc về bạn")
-				return
-			}
-			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi kiểm tra voucher")
-			return
-		}
-
-		if uv.IsUsed {
-			utils.RespondWithError(w, http.StatusBadRequest, "Voucher này đã được sử dụng")
-			return
-		}
 
-		if time.Now().UTC().After(uv.ExpiresAt) {
-			utils.RespondWithError(w, http.StatusBadRequest, "Voucher đã hết hạn")
-			return
-		}
-
-		if v.DiscountType == "percentage" {
-			discountAmount = (totalAmount * v.DiscountValue) / 100
-		} else if v.DiscountType == "fixed_amount" {
-			discountAmount = v.DiscountValue
-		}
+	fmt.Printf("SUCCESS: %s payment URL created: %s\n", provider.Name(), order.PaymentURL)
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"payUrl": order.PaymentURL})
+}
 
-		if discountAmount > totalAmount {
-			discountAmount = totalAmount
-		}
+// verifyPaymentReturn xác thực kết quả thanh toán cổng gắn vào return URL để trang
+// order-result hiển thị. Chỉ đọc trạng thái đơn; việc cập nhật đơn do IPN đảm nhận.
+func (h *handler) verifyPaymentReturn(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.payments[mux.Vars(r)["provider"]]
+	verifier, canVerify := provider.(payment.ReturnVerifier)
+	if !ok || !canVerify {
+		utils.RespondWithError(w, http.StatusNotFound, "Cổng thanh toán không được hỗ trợ")
+		return
 	}
 
-	finalAmount := totalAmount - discountAmount
-
-	var orderID int
-	// Cập nhật câu query để lưu discount
-	orderQuery := `INSERT INTO orders (
-		user_id, customer_name, customer_phone, shipping_address,
-		total_amount, status, applied_voucher_id, discount_amount
-	) VALUES ($1, $2, $3, $4, $5, 'pending_payment', $6, $7) RETURNING id`
-
-	err = tx.QueryRow(
-		orderQuery,
-		req.UserID, req.CustomerName, req.CustomerPhone, req.ShippingAddress,
-		finalAmount, // Dùng finalAmount
-		req.AppliedUserVoucherID,
-		discountAmount,
-	).Scan(&orderID)
-
+	event, err := verifier.VerifyReturn(r)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo đơn hàng")
+		fmt.Printf("WARNING: invalid %s return URL: %v\n", provider.Name(), err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Kết quả thanh toán không hợp lệ")
 		return
 	}
 
-	// Thêm items vào order_items (Quan trọng cho việc hoàn kho nếu thanh toán thất bại)
-	for _, item := range req.CartItems {
-		_, err = tx.Exec(`
-            INSERT INTO order_items (order_id, product_id, quantity, price_at_purchase)
-            VALUES ($1, $2, $3, $4)`,
-			orderID, item.ProductID, item.Quantity, productPrices[item.ProductID],
-		)
-		if err != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi thêm chi tiết đơn hàng")
-			return
-		}
-	}
-
-	// Đánh dấu voucher đã sử dụng
-	if req.AppliedUserVoucherID != nil {
-		_, err := tx.Exec(
-			"UPDATE user_vouchers SET is_used = true WHERE id = $1",
-			*req.AppliedUserVoucherID,
-		)
-		if err != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật trạng thái voucher")
-			return
-		}
-	}
-
-	if req.UserID != nil {
-		_, err = tx.Exec("DELETE FROM carts WHERE user_id = $1", *req.UserID)
-		if err != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi dọn dẹp giỏ hàng")
-			return
-		}
-	}
-
-	// Gọi MoMo với SỐ TIỀN ĐÃ GIẢM
-	payURL, err := payment.CreateMoMoPayment(orderID, finalAmount)
-	if err != nil {
-		// Nếu tạo MoMo thất bại, rollback tất cả (bao gồm cả việc dùng voucher)
-		fmt.Printf("ERROR creating MoMo payment: %v\n", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Lỗi MoMo: %v", err))
+	var status string
+	err = h.db.QueryRow("SELECT status FROM orders WHERE id = $1", event.OrderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		utils.RespondWithError(w, http.StatusNotFound, "Order not found")
 		return
 	}
-
-	if err := tx.Commit(); err != nil {
-		fmt.Printf("ERROR committing transaction: %v\n", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi commit transaction")
+	if err != nil {
+		fmt.Printf("ERROR fetching order status: %v\n", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
-	fmt.Printf("SUCCESS: Payment URL created: %s\n", payURL)
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"payUrl": payURL})
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"order_id": event.OrderID,
+		"success":  event.Success,
+		"message":  event.Message,
+		"status":   status,
+	})
 }
 
-func (h *handler) handleMoMoIPN(w http.ResponseWriter, r *http.Request) {
-	var ipnData map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&ipnData); err != nil {
-		fmt.Printf("ERROR decoding IPN: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
+// handlePaymentWebhook nhận IPN của cổng {provider}; cổng tự xác thực chữ ký và định dạng phản hồi.
+func (h *handler) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.payments[mux.Vars(r)["provider"]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	fmt.Printf("Received MoMo IPN: %+v\n", ipnData)
-
-	resultCode, _ := ipnData["resultCode"].(float64)
-	orderIDStr, _ := ipnData["orderId"].(string)
-
-	var orderID int
-	fmt.Sscanf(orderIDStr, "BISTROBLISS_%d_", &orderID)
-
-	tx, err := h.db.Begin()
+	event, err := provider.ParseWebhook(r)
 	if err != nil {
-		fmt.Printf("ERROR starting transaction: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Printf("WARNING: rejected %s IPN: %v\n", provider.Name(), err)
+		provider.RespondWebhook(w, err)
 		return
 	}
-	defer tx.Rollback()
-
-	if resultCode == 0 {
-		fmt.Printf("Payment SUCCESS for order: %s (ID: %d)\n", orderIDStr, orderID)
-
-		_, err = tx.Exec("UPDATE orders SET status = 'paid' WHERE id = $1", orderID)
-		if err != nil {
-			fmt.Printf("ERROR updating order status: %v\n", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		rows, err := tx.Query(`SELECT product_id, quantity FROM order_items WHERE order_id = $1`, orderID)
-		if err != nil {
-			fmt.Printf("ERROR fetching order items: %v\n", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var productID, quantity int
-			if err := rows.Scan(&productID, &quantity); err != nil {
-				fmt.Printf("ERROR scanning order item: %v\n", err)
-				continue
-			}
-			_, err = tx.Exec(`UPDATE products SET quantity = quantity - $1 WHERE id = $2`, quantity, productID)
-			if err != nil {
-				fmt.Printf("ERROR updating product quantity: %v\n", err)
-			}
-		}
+	fmt.Printf("Received %s IPN: order=%s resultCode=%s transId=%s amount=%d\n", provider.Name(), event.ExternalOrderID, event.ResultCode, event.TransactionID, event.Amount)
 
-		if err := tx.Commit(); err != nil {
-			fmt.Printf("ERROR committing transaction: %v\n", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		fmt.Printf("Order %d marked as paid and inventory updated\n", orderID)
-	} else {
-		fmt.Printf("Payment FAILED for order: %s, code: %.0f\n", orderIDStr, resultCode)
-
-		_, err = tx.Exec("UPDATE orders SET status = 'cancelled' WHERE id = $1", orderID)
-		if err != nil {
-			fmt.Printf("ERROR updating order status: %v\n", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		_, err = tx.Exec(`
-			UPDATE user_vouchers
-			SET is_used = false
-			WHERE id = (SELECT applied_voucher_id FROM orders WHERE id = $1)
-		`, orderID)
-		if err != nil {
-			fmt.Printf("ERROR restoring voucher: %v\n", err)
-		}
-
-		if err := tx.Commit(); err != nil {
-			fmt.Printf("ERROR committing transaction: %v\n", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		fmt.Printf("Order %d marked as cancelled and voucher restored\n", orderID)
+	err = h.applyPaymentEvent(r.Context(), provider.Name(), event)
+	if err != nil && !errors.Is(err, payment.ErrAlreadyProcessed) && !errors.Is(err, payment.ErrAmountMismatch) && !errors.Is(err, payment.ErrOrderNotFound) {
+		fmt.Printf("ERROR processing %s IPN: %v\n", provider.Name(), err)
 	}
+	provider.RespondWebhook(w, err)
+}
 
-	w.WriteHeader(http.StatusNoContent)
+// applyPaymentEvent áp dụng kết quả thanh toán; tiền về sau khi đơn đã bị hủy (vd hết hạn giữ
+// hàng) được hoàn lại ngay cho khách. Giao dịch đã được ghi nhận nên cổng vẫn nhận phản hồi thành công.
+func (h *handler) applyPaymentEvent(ctx context.Context, provider string, event *payment.WebhookEvent) error {
+	err := payment.ApplyEvent(ctx, h.db, provider, event, h.now())
+	if !errors.Is(err, payment.ErrPaidAfterCancel) {
+		return err
+	}
+	refunded, err := h.refunds.RefundRemaining(ctx, event.OrderID, "Tự động hoàn tiền: thanh toán sau khi đơn hàng đã bị hủy", orderstatus.System)
+	switch {
+	case err != nil:
+		fmt.Printf("ERROR refunding order %d paid after cancellation: %v\n", event.OrderID, err)
+	case refunded == nil || refunded.Status == refund.StatusFailed:
+		fmt.Printf("WARNING: order %d paid after cancellation could not be refunded automatically, manual refund required\n", event.OrderID)
+	}
+	return nil
 }
 
 func (h *handler) createBankTransferPayment(w http.ResponseWriter, r *http.Request) {
-	var req models.MoMoRequestPayload
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
-		return
-	}
-
-	fmt.Printf("Received bank transfer payment request: %+v\n", req)
-
-	if len(req.CartItems) == 0 {
-		fmt.Println("ERROR: Cart is empty")
-		utils.RespondWithError(w, http.StatusBadRequest, "Giỏ hàng trống")
+	order, ok := h.placeOrder(w, r, checkout.BankTransfer)
+	if !ok || respondPaidOrder(w, order) {
 		return
 	}
 
-	tx, err := h.db.Begin()
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi transaction")
-		return
-	}
-	defer tx.Rollback()
-
-	var totalAmount int64
-	productPrices := make(map[int]int64)
-
-	for _, item := range req.CartItems {
-		var price int64
-		var availableQuantity int
-		err := tx.QueryRow("SELECT price, quantity FROM products WHERE id = $1", item.ProductID).
-			Scan(&price, &availableQuantity)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				fmt.Printf("ERROR: Product not found: ID %d\n", item.ProductID)
-				utils.RespondWithError(w, http.StatusBadRequest, "Sản phẩm không tồn tại: ID "+strconv.Itoa(item.ProductID))
-				return
-			}
-			fmt.Printf("ERROR checking product: %v\n", err)
-			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi kiểm tra sản phẩm")
-			return
-		}
-
-		if availableQuantity < item.Quantity {
-			utils.RespondWithError(w, http.StatusBadRequest,
-				fmt.Sprintf("Sản phẩm ID %d chỉ còn %d sản phẩm", item.ProductID, availableQuantity))
-			return
-		}
-
-		totalAmount += price * int64(item.Quantity)
-		productPrices[item.ProductID] = price
-	}
-
-	var discountAmount int64 = 0
-	if req.AppliedUserVoucherID != nil && req.UserID != nil {
-		var uv models.UserVoucher
-		var v models.Voucher
-
-		err := tx.QueryRow(`
-            SELECT uv.is_used, uv.expires_at, v.discount_type, v.discount_value
-            FROM user_vouchers uv
-            JOIN vouchers v ON uv.voucher_id = v.id
-            WHERE uv.id = $1 AND uv.user_id = $2 FOR UPDATE
-        `, *req.AppliedUserVoucherID, req.UserID).Scan(&uv.IsUsed, &uv.ExpiresAt, &v.DiscountType, &v.DiscountValue)
-
-		if err != nil {
-			if err == sql.ErrNoRows {
-				utils.RespondWithError(w, http.StatusBadRequest, "Voucher không tồn tại hoặc không thuộc về bạn")
-				return
-			}
-			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi kiểm tra voucher")
-			return
-		}
-
-		if uv.IsUsed {
-			utils.RespondWithError(w, http.StatusBadRequest, "Voucher này đã được sử dụng")
-			return
-		}
-
-		if time.Now().UTC().After(uv.ExpiresAt) {
-			utils.RespondWithError(w, http.StatusBadRequest, "Voucher đã hết hạn")
-			return
-		}
-
-		if v.DiscountType == "percentage" {
-			discountAmount = (totalAmount * v.DiscountValue) / 100
-		} else if v.DiscountType == "fixed_amount" {
-			discountAmount = v.DiscountValue
-		}
-
-		if discountAmount > totalAmount {
-			discountAmount = totalAmount
-		}
-	}
-
-	finalAmount := totalAmount - discountAmount
-
-	var orderID int
-	orderQuery := `INSERT INTO orders (
-		user_id, customer_name, customer_phone, shipping_address,
-		total_amount, status, applied_voucher_id, discount_amount
-	) VALUES ($1, $2, $3, $4, $5, 'pending_payment', $6, $7) RETURNING id`
-
-	err = tx.QueryRow(
-		orderQuery,
-		req.UserID, req.CustomerName, req.CustomerPhone, req.ShippingAddress,
-		finalAmount,
-		req.AppliedUserVoucherID,
-		discountAmount,
-	).Scan(&orderID)
-
+	qr, err := h.newBankTransferQR(order.ID, order.Quote.Total)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo đơn hàng")
-		return
+		// Đơn đã tạo; khách vẫn có thể chuyển khoản thủ công
+		fmt.Printf("ERROR building VietQR for order %d: %v\n", order.ID, err)
 	}
 
-	for _, item := range req.CartItems {
-		_, err = tx.Exec(`
-            INSERT INTO order_items (order_id, product_id, quantity, price_at_purchase)
-            VALUES ($1, $2, $3, $4)`,
-			orderID, item.ProductID, item.Quantity, productPrices[item.ProductID],
-		)
-		if err != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi thêm chi tiết đơn hàng")
-			return
-		}
+	fmt.Printf("SUCCESS: Bank transfer order created: %d\n", order.ID)
+	response := map[string]interface{}{
+		"orderId": order.ID,
+		"amount":  order.Quote.Total,
+		"memo":    banktransfer.Memo(order.ID),
+		"bank":    h.bankAccount,
 	}
-
-	if req.AppliedUserVoucherID != nil {
-		_, err := tx.Exec(
-			"UPDATE user_vouchers SET is_used = true WHERE id = $1",
-			*req.AppliedUserVoucherID,
-		)
-		if err != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật trạng thái voucher")
-			return
-		}
-	}
-
-	if req.UserID != nil {
-		_, err = tx.Exec("DELETE FROM carts WHERE user_id = $1", *req.UserID)
-		if err != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi dọn dẹp giỏ hàng")
-			return
-		}
+	if qr != nil {
+		response["qrPayload"] = qr.QRPayload
 	}
-
-	if err := tx.Commit(); err != nil {
-		fmt.Printf("ERROR committing transaction: %v\n", err)
-		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi commit transaction")
-		return
-	}
-
-	fmt.Printf("SUCCESS: Bank transfer order created: %d\n", orderID)
-	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"orderId": orderID,
-		"amount":  finalAmount,
-	})
+	utils.RespondWithJSON(w, http.StatusOK, response)
 }
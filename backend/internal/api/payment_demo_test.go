@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestDemoPaymentRouteRequiresFlag(t *testing.T) {
+	for _, enabled := range []string{"", "true"} {
+		t.Setenv("PAYMENT_DEMO_ENABLED", enabled)
+		r := mux.NewRouter()
+		RegisterRoutes(r, nil)
+
+		var match mux.RouteMatch
+		r.Match(httptest.NewRequest(http.MethodPost, "/api/payment/demo", nil), &match)
+		tpl, _ := match.Route.GetPathTemplate()
+		if registered := tpl == "/api/payment/demo"; registered != (enabled == "true") {
+			t.Errorf("PAYMENT_DEMO_ENABLED=%q: route %q", enabled, tpl)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"database/sql/driver"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"backend/internal/dbtest"
+	"backend/internal/payment"
+
+	"github.com/gorilla/mux"
+)
+
+// momoWebhook gửi IPN MoMo đã ký (testdata của package payment) tới handler webhook.
+func momoWebhook(t *testing.T, h *handler) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := ioutil.ReadFile(filepath.Join("..", "payment", "testdata", "momo", "ipn_success.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.payments = map[string]payment.Provider{"momo": &payment.MoMo{
+		PartnerCode: "MOMOTEST",
+		AccessKey:   "MOMOTESTACCESS",
+		SecretKey:   "MOMOTESTSECRET0123456789ABCDEF",
+		Endpoint:    "http://momo.test/v2/gateway/api/create",
+	}}
+	req := httptest.NewRequest(http.MethodPost, "/api/webhook/momo", strings.NewReader(string(body)))
+	req = mux.SetURLVars(req, map[string]string{"provider": "momo"})
+	rec := httptest.NewRecorder()
+	h.handlePaymentWebhook(rec, req)
+	return rec
+}
+
+func TestMoMoWebhookAmountMismatch(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("INSERT INTO payment_transactions", dbtest.Rows([]driver.Value{int64(3)}))
+	// IPN báo 150.000đ nhưng đơn cần 200.000đ
+	fake.On("SELECT total_amount FROM orders", dbtest.Rows([]driver.Value{int64(200000)}))
+	h := &handler{db: db, clock: newTestClock().now}
+
+	rec := momoWebhook(t, h)
+	// MoMo không cần gửi lại IPN: giao dịch đã được ghi để đối soát thủ công
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d, muốn 204", rec.Code)
+	}
+	out := fake.Calls("UPDATE payment_transactions SET outcome")
+	if len(out) != 1 || out[0].Args[0] != payment.OutcomeAmountMismatch {
+		t.Errorf("outcome = %+v, muốn %s", out, payment.OutcomeAmountMismatch)
+	}
+	if len(fake.Calls("UPDATE orders")) != 0 {
+		t.Error("sai số tiền thì không được cập nhật đơn hàng")
+	}
+}
+
+func TestMoMoWebhookPaysOrder(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("INSERT INTO payment_transactions", dbtest.Rows([]driver.Value{int64(3)}))
+	fake.On("SELECT total_amount FROM orders", dbtest.Rows([]driver.Value{int64(150000)}))
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{"pending"}))
+	fake.On("FROM gift_cards WHERE order_id", dbtest.Rows([]driver.Value{false, "momo"}))
+	h := &handler{db: db, clock: newTestClock().now}
+
+	if rec := momoWebhook(t, h); rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d, muốn 204", rec.Code)
+	}
+	if st := fake.Calls("UPDATE orders SET status"); len(st) != 1 || st[0].Args[0] != "paid" {
+		t.Errorf("trạng thái đơn = %+v, muốn paid", st)
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"backend/internal/models"
+	"backend/internal/promotion"
+	"backend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Admin: Danh sách khuyến mãi tự động, theo thứ tự áp dụng
+func (h *handler) getPromotions(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.QueryContext(r.Context(), "SELECT "+promotion.Columns+" FROM promotions ORDER BY priority DESC, id")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi truy vấn khuyến mãi")
+		return
+	}
+	defer rows.Close()
+
+	promos := []models.Promotion{}
+	for rows.Next() {
+		p, err := promotion.Scan(rows)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét dữ liệu khuyến mãi")
+			return
+		}
+		promos = append(promos, p)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, promos)
+}
+
+// decodePromotion đọc và kiểm tra khuyến mãi từ body; trả về false nếu đã gửi lỗi cho client.
+func decodePromotion(w http.ResponseWriter, r *http.Request) (models.Promotion, []byte, bool) {
+	var p models.Promotion
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return p, nil, false
+	}
+	if msg := promotion.Validate(p); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return p, nil, false
+	}
+	config, err := json.Marshal(p.Config)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Cấu hình khuyến mãi không hợp lệ")
+		return p, nil, false
+	}
+	return p, config, true
+}
+
+// Admin: Tạo khuyến mãi tự động
+func (h *handler) createPromotion(w http.ResponseWriter, r *http.Request) {
+	p, config, ok := decodePromotion(w, r)
+	if !ok {
+		return
+	}
+
+	var id int
+	err := h.db.QueryRowContext(r.Context(), `
+		INSERT INTO promotions (name, type, priority, exclusive, allow_voucher, config, starts_at, ends_at, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id
+	`, p.Name, p.Type, p.Priority, p.Exclusive, p.AllowVoucher, config, p.StartsAt, p.EndsAt, p.IsActive).Scan(&id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi tạo khuyến mãi")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, map[string]int{"id": id})
+}
+
+// Admin: Cập nhật khuyến mãi tự động
+func (h *handler) updatePromotion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID khuyến mãi không hợp lệ")
+		return
+	}
+	p, config, ok := decodePromotion(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.db.ExecContext(r.Context(), `
+		UPDATE promotions
+		SET name = $1, type = $2, priority = $3, exclusive = $4, allow_voucher = $5, config = $6,
+		    starts_at = $7, ends_at = $8, is_active = $9, updated_at = NOW()
+		WHERE id = $10
+	`, p.Name, p.Type, p.Priority, p.Exclusive, p.AllowVoucher, config, p.StartsAt, p.EndsAt, p.IsActive, id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật khuyến mãi")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy khuyến mãi")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Cập nhật khuyến mãi thành công"})
+}
+
+// Admin: Xóa khuyến mãi. Các đơn đã áp dụng vẫn giữ chi tiết giảm giá (promotion_id về NULL).
+func (h *handler) deletePromotion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID khuyến mãi không hợp lệ")
+		return
+	}
+
+	result, err := h.db.ExecContext(r.Context(), "DELETE FROM promotions WHERE id = $1", id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi xóa khuyến mãi")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy khuyến mãi")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Xóa khuyến mãi thành công"})
+}
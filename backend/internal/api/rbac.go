@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"backend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Role là vai trò của tài khoản quản trị. Khách hàng thường có role "customer".
+type Role string
+
+const (
+	RoleCustomer     Role = "customer"
+	RoleOwner        Role = "owner"
+	RoleManager      Role = "manager"
+	RoleKitchenStaff Role = "kitchen_staff"
+	RoleSupport      Role = "support"
+)
+
+// Permission là quyền thao tác trên một nhóm route admin.
+type Permission string
+
+const (
+	PermDashboardView   Permission = "dashboard:view"
+	PermUsersView       Permission = "users:view"
+	PermUsersManage     Permission = "users:manage"
+	PermProductsWrite   Permission = "products:write"
+	PermCategoriesWrite Permission = "categories:write"
+	PermOrdersView      Permission = "orders:view"
+	PermOrdersUpdate    Permission = "orders:update_status"
+	PermOrdersExport    Permission = "orders:export"
+	PermReviewsView     Permission = "reviews:view"
+	PermReviewsModerate Permission = "reviews:moderate"
+	PermReviewsReply    Permission = "reviews:reply"
+	PermVouchersView    Permission = "vouchers:view"
+	PermVouchersWrite   Permission = "vouchers:write"
+	PermPaymentsManage  Permission = "payments:manage"
+)
+
+// rolePermissions là ma trận phân quyền. Owner có toàn quyền nên không cần liệt kê.
+var rolePermissions = map[Role][]Permission{
+	RoleManager: {
+		PermDashboardView, PermUsersView,
+		PermProductsWrite, PermCategoriesWrite,
+		PermOrdersView, PermOrdersUpdate, PermOrdersExport,
+		PermReviewsView, PermReviewsModerate, PermReviewsReply,
+		PermVouchersView, PermVouchersWrite,
+		PermPaymentsManage,
+	},
+	RoleKitchenStaff: {
+		PermOrdersView, PermOrdersUpdate, PermOrdersExport,
+	},
+	RoleSupport: {
+		PermUsersView,
+		PermOrdersView, PermOrdersExport,
+		PermReviewsView, PermReviewsReply,
+		PermVouchersView,
+	},
+}
+
+func (r Role) valid() bool {
+	switch r {
+	case RoleCustomer, RoleOwner, RoleManager, RoleKitchenStaff, RoleSupport:
+		return true
+	}
+	return false
+}
+
+// IsStaff cho biết role có được truy cập khu vực /api/admin hay không.
+func (r Role) IsStaff() bool {
+	return r.valid() && r != RoleCustomer
+}
+
+// Can kiểm tra role có quyền perm hay không.
+func (r Role) Can(perm Permission) bool {
+	if r == RoleOwner {
+		return true
+	}
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// requirePermission bọc một handler admin, trả về 403 nếu role hiện tại thiếu quyền.
+// Phải được dùng sau AuthMiddleware để context đã có "role".
+func (h *handler) requirePermission(perm Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role, _ := r.Context().Value("role").(Role)
+		if !role.IsStaff() {
+			utils.RespondWithAPIError(w, http.StatusForbidden, "admin_required",
+				"Bạn không có quyền truy cập khu vực quản trị", map[string]string{"role": string(role)})
+			return
+		}
+		if twoFactorEnabled, _ := r.Context().Value("twoFactorEnabled").(bool); !twoFactorEnabled && twoFactorRequiredRoles()[role] {
+			utils.RespondWithAPIError(w, http.StatusForbidden, "two_factor_setup_required",
+				"Vui lòng bật xác thực hai bước trước khi truy cập khu vực quản trị", map[string]string{"role": string(role)})
+			return
+		}
+		if !role.Can(perm) {
+			utils.RespondWithAPIError(w, http.StatusForbidden, "permission_denied",
+				"Bạn không có quyền thực hiện thao tác này", map[string]string{
+					"role":                string(role),
+					"required_permission": string(perm),
+				})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Admin: Gán role cho một tài khoản
+func (h *handler) updateUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID không hợp lệ")
+		return
+	}
+
+	var payload struct {
+		Role Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || !payload.Role.valid() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Role không hợp lệ")
+		return
+	}
+
+	currentUserID, _ := r.Context().Value("userID").(int)
+	if currentUserID == userID && payload.Role != RoleOwner {
+		utils.RespondWithError(w, http.StatusBadRequest, "Không thể tự hạ quyền của chính mình")
+		return
+	}
+
+	res, err := h.db.Exec(
+		"UPDATE users SET role = $1, is_admin = $2 WHERE id = $3",
+		payload.Role, payload.Role.IsStaff(), userID,
+	)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi cập nhật role")
+		return
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy người dùng")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Cập nhật role thành công"})
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// adminRouteSpec là quyền yêu cầu của từng route admin. Thêm route admin mới phải thêm vào đây.
+var adminRouteSpec = map[string]Permission{
+	"GET /stats":                       PermDashboardView,
+	"GET /users":                       PermUsersView,
+	"PUT /users/{id}/role":             PermUsersManage,
+	"POST /users/{id}/unlock":          PermUsersManage,
+	"GET /users/{id}/loyalty":          PermUsersView,
+	"POST /users/{id}/loyalty/adjust":  PermUsersManage,
+	"GET /users/{id}/wallet":           PermUsersView,
+	"POST /users/{id}/wallet/adjust":   PermPaymentsManage,
+	"GET /referrals":                   PermUsersView,
+	"POST /products":                   PermProductsWrite,
+	"PUT /products/{id}":               PermProductsWrite,
+	"DELETE /products/{id}":            PermProductsWrite,
+	"POST /categories":                 PermCategoriesWrite,
+	"PUT /categories/{id}":             PermCategoriesWrite,
+	"DELETE /categories/{id}":          PermCategoriesWrite,
+	"GET /orders":                      PermOrdersView,
+	"GET /orders/{id}":                 PermOrdersView,
+	"PUT /orders/{id}/status":          PermOrdersUpdate,
+	"POST /orders/{id}/cod-collection": PermOrdersUpdate,
+	"GET /orders/{id}/pdf":             PermOrdersExport,
+	"GET /orders/{id}/refunds":         PermOrdersView,
+	"POST /orders/{id}/refunds":        PermPaymentsManage,
+	"POST /payments/bank-statements":   PermPaymentsManage,
+	"GET /wallet/transactions":         PermPaymentsManage,
+	"GET /wallet/audit":                PermPaymentsManage,
+	"GET /gift-cards":                  PermPaymentsManage,
+	"GET /reviews":                     PermReviewsView,
+	"DELETE /reviews/{reviewId}":       PermReviewsModerate,
+	"PUT /reviews/{reviewId}/reply":    PermReviewsReply,
+	"POST /vouchers":                   PermVouchersWrite,
+	"GET /vouchers":                    PermVouchersView,
+	"GET /vouchers/analytics":          PermVouchersView,
+	"PUT /vouchers/{id}":               PermVouchersWrite,
+	"DELETE /vouchers/{id}":            PermVouchersWrite,
+	"GET /promotions":                  PermVouchersView,
+	"POST /promotions":                 PermVouchersWrite,
+	"PUT /promotions/{id}":             PermVouchersWrite,
+	"DELETE /promotions/{id}":          PermVouchersWrite,
+	"GET /campaigns":                   PermVouchersView,
+	"POST /campaigns":                  PermVouchersWrite,
+	"PUT /campaigns/{id}":              PermVouchersWrite,
+	"DELETE /campaigns/{id}":           PermVouchersWrite,
+	"POST /campaigns/{id}/run":         PermVouchersWrite,
+	"GET /campaigns/{id}/deliveries":   PermVouchersView,
+}
+
+// permissionRoles là các role được cấp từng quyền (owner luôn có toàn quyền).
+var permissionRoles = map[Permission][]Role{
+	PermDashboardView:   {RoleOwner, RoleManager},
+	PermUsersView:       {RoleOwner, RoleManager, RoleSupport},
+	PermUsersManage:     {RoleOwner},
+	PermProductsWrite:   {RoleOwner, RoleManager},
+	PermCategoriesWrite: {RoleOwner, RoleManager},
+	PermOrdersView:      {RoleOwner, RoleManager, RoleKitchenStaff, RoleSupport},
+	PermOrdersUpdate:    {RoleOwner, RoleManager, RoleKitchenStaff},
+	PermOrdersExport:    {RoleOwner, RoleManager, RoleKitchenStaff, RoleSupport},
+	PermReviewsView:     {RoleOwner, RoleManager, RoleSupport},
+	PermReviewsModerate: {RoleOwner, RoleManager},
+	PermReviewsReply:    {RoleOwner, RoleManager, RoleSupport},
+	PermVouchersView:    {RoleOwner, RoleManager, RoleSupport},
+	PermVouchersWrite:   {RoleOwner, RoleManager},
+	PermPaymentsManage:  {RoleOwner, RoleManager},
+}
+
+var allRoles = []Role{RoleCustomer, RoleOwner, RoleManager, RoleKitchenStaff, RoleSupport}
+
+func TestAdminRoutesMatchSpec(t *testing.T) {
+	h := &handler{}
+	seen := map[string]bool{}
+	for _, route := range h.adminRoutes() {
+		key := route.method + " " + route.path
+		if seen[key] {
+			t.Errorf("%s đăng ký hai lần", key)
+		}
+		seen[key] = true
+		want, ok := adminRouteSpec[key]
+		if !ok {
+			t.Errorf("%s chưa có trong adminRouteSpec", key)
+			continue
+		}
+		if route.perm != want {
+			t.Errorf("%s yêu cầu %q, muốn %q", key, route.perm, want)
+		}
+	}
+	for key := range adminRouteSpec {
+		if !seen[key] {
+			t.Errorf("%s có trong adminRouteSpec nhưng không được đăng ký", key)
+		}
+	}
+}
+
+// adminTestRouter đăng ký các route admin như RegisterRoutes, nhưng thay AuthMiddleware bằng
+// middleware gán sẵn role và handler thật bằng handler ghi lại route được gọi.
+func adminTestRouter(h *handler, role Role, twoFactor bool) *mux.Router {
+	r := mux.NewRouter()
+	admin := r.PathPrefix("/api/admin").Subrouter()
+	admin.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			ctx = context.WithValue(ctx, "userID", 1)
+			ctx = context.WithValue(ctx, "role", role)
+			ctx = context.WithValue(ctx, "twoFactorEnabled", twoFactor)
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	})
+	for _, route := range h.adminRoutes() {
+		key := route.method + " " + route.path
+		admin.HandleFunc(route.path, h.requirePermission(route.perm, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("X-Route", key)
+			w.WriteHeader(http.StatusOK)
+		})).Methods(route.method)
+	}
+	return r
+}
+
+var pathVar = regexp.MustCompile(`\{[^}]+\}`)
+
+func TestRequirePermissionAdminRoutes(t *testing.T) {
+	t.Setenv("REQUIRE_2FA_ROLES", "")
+	h := &handler{}
+	for _, role := range allRoles {
+		router := adminTestRouter(h, role, true)
+		for key, perm := range adminRouteSpec {
+			allowed := false
+			for _, r := range permissionRoles[perm] {
+				allowed = allowed || r == role
+			}
+			route := h.routeByKey(t, key)
+			req := httptest.NewRequest(route.method, "/api/admin"+pathVar.ReplaceAllString(route.path, "1"), nil)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			switch {
+			case allowed && rec.Code != http.StatusOK:
+				t.Errorf("%s với role %s: status %d, muốn 200", key, role, rec.Code)
+			case allowed && rec.Header().Get("X-Route") != key:
+				t.Errorf("%s với role %s: khớp nhầm route %q", key, role, rec.Header().Get("X-Route"))
+			case !allowed && rec.Code != http.StatusForbidden:
+				t.Errorf("%s với role %s: status %d, muốn 403", key, role, rec.Code)
+			case !allowed:
+				wantCode := "permission_denied"
+				if role == RoleCustomer {
+					wantCode = "admin_required"
+				}
+				if code := errorCode(t, rec); code != wantCode {
+					t.Errorf("%s với role %s: mã lỗi %q, muốn %q", key, role, code, wantCode)
+				}
+			}
+		}
+	}
+}
+
+func TestRequirePermissionTwoFactor(t *testing.T) {
+	t.Setenv("REQUIRE_2FA_ROLES", "owner,manager")
+	h := &handler{}
+	tests := []struct {
+		role      Role
+		twoFactor bool
+		status    int
+		code      string
+	}{
+		{RoleOwner, false, http.StatusForbidden, "two_factor_setup_required"},
+		{RoleManager, false, http.StatusForbidden, "two_factor_setup_required"},
+		{RoleOwner, true, http.StatusOK, ""},
+		{RoleKitchenStaff, false, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		adminTestRouter(h, tt.role, tt.twoFactor).ServeHTTP(rec, httptest.NewRequest("GET", "/api/admin/orders", nil))
+		if rec.Code != tt.status {
+			t.Errorf("role %s, 2FA %v: status %d, muốn %d", tt.role, tt.twoFactor, rec.Code, tt.status)
+			continue
+		}
+		if tt.code != "" {
+			if code := errorCode(t, rec); code != tt.code {
+				t.Errorf("role %s, 2FA %v: mã lỗi %q, muốn %q", tt.role, tt.twoFactor, code, tt.code)
+			}
+		}
+	}
+}
+
+func (h *handler) routeByKey(t *testing.T, key string) adminRoute {
+	t.Helper()
+	for _, route := range h.adminRoutes() {
+		if route.method+" "+route.path == key {
+			return route
+		}
+	}
+	t.Fatalf("không tìm thấy route %s", key)
+	return adminRoute{}
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response không phải JSON: %v", err)
+	}
+	return body.Code
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/referral"
+	"backend/internal/utils"
+)
+
+// User: Mã giới thiệu của mình và kết quả giới thiệu
+func (h *handler) getMyReferral(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	code, err := referral.EnsureCode(r.Context(), h.db, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy mã giới thiệu")
+		return
+	}
+	summary, err := referral.Summary(r.Context(), h.db, &userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi thống kê giới thiệu")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, models.ReferralInfo{Code: code, Summary: summary})
+}
+
+// Admin: Báo cáo giới thiệu, lọc theo ?status= (pending, rewarded, rejected, revoked)
+func (h *handler) getReferralReport(w http.ResponseWriter, r *http.Request) {
+	page, limit, offset := utils.GetPaginationParams(r, 20)
+
+	conditions := []string{}
+	args := []interface{}{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		if status != referral.StatusPending && status != referral.StatusRewarded && status != referral.StatusRejected && status != referral.StatusRevoked {
+			utils.RespondWithError(w, http.StatusBadRequest, "Trạng thái không hợp lệ")
+			return
+		}
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("rf.status = $%d", len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var totalRecords int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM referrals rf "+where, args...).Scan(&totalRecords); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi đếm lượt giới thiệu")
+		return
+	}
+	totalPages := int(math.Ceil(float64(totalRecords) / float64(limit)))
+
+	args = append(args, limit, offset)
+	rows, err := h.db.Query(fmt.Sprintf(`
+		SELECT rf.id, rf.referrer_id, ur.username, rf.referred_id, ud.username, rf.status,
+		       COALESCE(rf.reject_reason, ''), rf.order_id, rf.created_at, rf.rewarded_at
+		FROM referrals rf
+		JOIN users ur ON ur.id = rf.referrer_id
+		JOIN users ud ON ud.id = rf.referred_id
+		%s
+		ORDER BY rf.created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi truy vấn lượt giới thiệu")
+		return
+	}
+	defer rows.Close()
+
+	referrals := []models.Referral{}
+	for rows.Next() {
+		var rf models.Referral
+		var orderID sql.NullInt64
+		var rewardedAt sql.NullTime
+		if err := rows.Scan(&rf.ID, &rf.ReferrerID, &rf.ReferrerUsername, &rf.ReferredID, &rf.ReferredUsername, &rf.Status,
+			&rf.RejectReason, &orderID, &rf.CreatedAt, &rewardedAt); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét lượt giới thiệu")
+			return
+		}
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			rf.OrderID = &id
+		}
+		if rewardedAt.Valid {
+			rf.RewardedAt = &rewardedAt.Time
+		}
+		referrals = append(referrals, rf)
+	}
+
+	summary, err := referral.Summary(r.Context(), h.db, nil)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi thống kê giới thiệu")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"summary":    summary,
+		"referrals":  referrals,
+		"page":       page,
+		"totalPages": totalPages,
+	})
+}
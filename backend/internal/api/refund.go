@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backend/internal/models"
+	"backend/internal/orderstatus"
+	"backend/internal/refund"
+	"backend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// respondRefundError chuyển lỗi của refund.Service thành response HTTP.
+func respondRefundError(w http.ResponseWriter, err error) {
+	var re *refund.Error
+	switch {
+	case errors.Is(err, refund.ErrOrderNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy đơn hàng")
+	case errors.As(err, &re):
+		utils.RespondWithError(w, http.StatusBadRequest, re.Message)
+	default:
+		fmt.Printf("ERROR creating refund: %v\n", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể hoàn tiền")
+	}
+}
+
+// Admin: hoàn tiền toàn bộ (items rỗng) hoặc theo từng món
+func (h *handler) createRefund(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+	var req models.CreateRefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+
+	staffID, _ := r.Context().Value("userID").(int)
+	result, err := h.refunds.Create(r.Context(), orderID, req, orderstatus.Staff(staffID))
+	if err != nil {
+		respondRefundError(w, err)
+		return
+	}
+	if result.Status == refund.StatusFailed {
+		utils.RespondWithJSON(w, http.StatusBadGateway, result)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, result)
+}
+
+// Admin: danh sách các lần hoàn tiền của đơn hàng
+func (h *handler) getOrderRefunds(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+	refunds, err := h.refunds.List(r.Context(), orderID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy danh sách hoàn tiền")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, refunds)
+}
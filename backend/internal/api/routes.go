@@ -2,62 +2,78 @@ package api
 
 import (
 	"database/sql"
+	"net/http"
+	"time"
+
+	"backend/internal/banktransfer"
+	"backend/internal/checkout"
+	"backend/internal/oidc"
+	"backend/internal/payment"
+	"backend/internal/refund"
 
 	"github.com/gorilla/mux"
 )
 
 func RegisterRoutes(r *mux.Router, db *sql.DB) {
-	h := &handler{db: db}
+	h := &handler{
+		db:            db,
+		clock:         time.Now,
+		throttle:      defaultThrottlePolicy,
+		oidcProviders: oidc.ProvidersFromEnv(),
+		payments:      payment.ProvidersFromEnv(),
+		sandbox:       payment.NewSandbox(),
+		bankAccount:   banktransfer.AccountFromEnv(),
+	}
+	h.checkout = checkout.NewService(db, h.now, checkout.ReservationTTLFromEnv())
+	refundProviders := map[string]payment.Provider{h.sandbox.Name(): h.sandbox}
+	for name, p := range h.payments {
+		refundProviders[name] = p
+	}
+	h.refunds = refund.NewService(db, h.now, refundProviders)
 
 	// Auth api
 	r.HandleFunc("/api/auth/register", h.register).Methods("POST")
 	r.HandleFunc("/api/auth/login", h.login).Methods("POST")
+	r.HandleFunc("/api/auth/login/2fa", h.loginSecondFactor).Methods("POST")
+	r.HandleFunc("/api/auth/oidc/providers", h.getOIDCProviders).Methods("GET")
+	r.HandleFunc("/api/auth/oidc/{provider}/start", h.startOIDCLogin).Methods("GET")
+	r.HandleFunc("/api/auth/oidc/{provider}/callback", h.completeOIDCLogin).Methods("POST")
 	r.HandleFunc("/api/auth/logout", h.logout).Methods("POST")
+	r.HandleFunc("/api/auth/refresh", h.refreshToken).Methods("POST")
 	r.HandleFunc("/api/auth/forgot-password", h.requestPasswordReset).Methods("POST")
 	r.HandleFunc("/api/auth/reset-password", h.resetPassword).Methods("POST")
+	r.HandleFunc("/api/auth/verify-email", h.verifyEmail).Methods("POST")
+	r.HandleFunc("/api/auth/resend-verification", h.resendVerificationEmail).Methods("POST")
 	r.HandleFunc("/api/search", h.searchProductsAI).Methods("GET")
 	r.HandleFunc("/api/products/{id}/related", h.getRelatedProductsAI).Methods("GET")
 
 	// Public api
 	r.HandleFunc("/api/products", h.getProducts).Methods("GET")
 	r.HandleFunc("/api/products/{slug}", h.getProductBySlug).Methods("GET")
-	r.HandleFunc("/api/orders", h.createOrder).Methods("POST")
+	r.Handle("/api/orders", h.OptionalAuthMiddleware(http.HandlerFunc(h.createOrder))).Methods("POST")
+	r.Handle("/api/checkout/quote", h.OptionalAuthMiddleware(http.HandlerFunc(h.quoteCheckout))).Methods("POST")
 	r.HandleFunc("/api/chatbot/conversation", h.analyzeConversation).Methods("POST")
 	r.HandleFunc("/api/categories", h.getCategories).Methods("GET")
 	r.HandleFunc("/api/products/{id}/reviews", h.getReviews).Methods("GET")
 
 	// Payment Routes
-	r.HandleFunc("/api/payment/momo", h.createMoMoPayment).Methods("POST")
-	r.HandleFunc("/api/payment/bank-transfer", h.createBankTransferPayment).Methods("POST")
-	r.HandleFunc("/api/payment/demo", h.createDemoPayment).Methods("POST")
-	r.HandleFunc("/api/webhook/momo", h.handleMoMoIPN).Methods("POST")
+	r.Handle("/api/payment/bank-transfer", h.OptionalAuthMiddleware(http.HandlerFunc(h.createBankTransferPayment))).Methods("POST")
+	if demoPaymentEnabled() {
+		r.Handle("/api/payment/demo", h.OptionalAuthMiddleware(http.HandlerFunc(h.createDemoPayment))).Methods("POST")
+	}
+	r.Handle("/api/payment/{provider}", h.OptionalAuthMiddleware(http.HandlerFunc(h.createGatewayPayment))).Methods("POST")
+	r.HandleFunc("/api/payment/{provider}/return", h.verifyPaymentReturn).Methods("GET")
+	r.HandleFunc("/api/webhook/{provider}", h.handlePaymentWebhook).Methods("GET", "POST")
 	r.HandleFunc("/api/orders/{id}/status", h.getOrderStatus).Methods("GET")
+	r.HandleFunc("/api/orders/{id}/vietqr", h.getOrderVietQR).Methods("GET")
+	r.HandleFunc("/api/orders/{id}/vietqr.png", h.getOrderVietQRImage).Methods("GET")
 
 	// Admin Routes
 	adminRouter := r.PathPrefix("/api/admin").Subrouter()
-	adminRouter.HandleFunc("/stats", h.getDashboardStats).Methods("GET")
-	adminRouter.HandleFunc("/users", h.getAllUsers).Methods("GET")
-	adminRouter.HandleFunc("/products", h.createProduct).Methods("POST")
-	adminRouter.HandleFunc("/products/{id}", h.updateProduct).Methods("PUT")
-	adminRouter.HandleFunc("/products/{id}", h.deleteProduct).Methods("DELETE")
-
-	adminRouter.HandleFunc("/categories", h.createCategory).Methods("POST")
-	adminRouter.HandleFunc("/categories/{id}", h.updateCategory).Methods("PUT")
-	adminRouter.HandleFunc("/categories/{id}", h.deleteCategory).Methods("DELETE")
-
-	adminRouter.HandleFunc("/orders", h.getAllOrders).Methods("GET")
-	adminRouter.HandleFunc("/orders/{id}", h.getAdminOrderDetails).Methods("GET")
-	adminRouter.HandleFunc("/orders/{id}/status", h.updateOrderStatus).Methods("PUT")
-	adminRouter.HandleFunc("/orders/{id}/pdf", h.adminExportOrderPDF).Methods("GET")
-
-	adminRouter.HandleFunc("/reviews", h.adminGetAllReviews).Methods("GET")
-	adminRouter.HandleFunc("/reviews/{reviewId}", h.adminDeleteReview).Methods("DELETE")
-	adminRouter.HandleFunc("/reviews/{reviewId}/reply", h.replyToReview).Methods("PUT")
-
-	adminRouter.HandleFunc("/vouchers", h.createVoucher).Methods("POST")
-    adminRouter.HandleFunc("/vouchers", h.getAllVouchers).Methods("GET")
-    adminRouter.HandleFunc("/vouchers/{id}", h.updateVoucher).Methods("PUT")
-    adminRouter.HandleFunc("/vouchers/{id}", h.deleteVoucher).Methods("DELETE")
+	adminRouter.Use(h.AuthMiddleware)
+	for _, route := range h.adminRoutes() {
+		adminRouter.HandleFunc(route.path, h.requirePermission(route.perm, route.handle)).Methods(route.method)
+	}
 
 	// User Routes (Admin, Client)
 	userRouter := r.PathPrefix("/api/user").Subrouter()
@@ -76,5 +92,84 @@ func RegisterRoutes(r *mux.Router, db *sql.DB) {
     userRouter.HandleFunc("/vouchers", h.getUserVouchers).Methods("GET")
 	userRouter.HandleFunc("/vouchers/{id}", h.deleteUserVoucher).Methods("DELETE")
 	userRouter.HandleFunc("/orders/{id}/pdf", h.exportOrderPDF).Methods("GET")
+	userRouter.HandleFunc("/sessions", h.getUserSessions).Methods("GET")
+	userRouter.HandleFunc("/logout-all", h.logoutAllDevices).Methods("POST")
+	userRouter.HandleFunc("/login-history", h.getLoginHistory).Methods("GET")
+	userRouter.HandleFunc("/loyalty", h.getLoyaltyBalance).Methods("GET")
+	userRouter.HandleFunc("/loyalty/history", h.getLoyaltyHistory).Methods("GET")
+	userRouter.HandleFunc("/wallet", h.getWallet).Methods("GET")
+	userRouter.HandleFunc("/wallet/history", h.getWalletHistory).Methods("GET")
+	userRouter.HandleFunc("/wallet/redeem", h.redeemGiftCard).Methods("POST")
+	userRouter.HandleFunc("/gift-cards", h.getMyGiftCards).Methods("GET")
+	userRouter.HandleFunc("/referral", h.getMyReferral).Methods("GET")
+	userRouter.HandleFunc("/birthday", h.updateBirthday).Methods("PUT")
+	userRouter.HandleFunc("/2fa/setup", h.setupTwoFactor).Methods("POST")
+	userRouter.HandleFunc("/2fa/enable", h.enableTwoFactor).Methods("POST")
+	userRouter.HandleFunc("/2fa/disable", h.disableTwoFactor).Methods("POST")
+	userRouter.HandleFunc("/2fa/recovery-codes", h.regenerateRecoveryCodes).Methods("POST")
+
+}
+
+// adminRoute là một route dưới /api/admin cùng quyền cần có để gọi nó.
+type adminRoute struct {
+	method string
+	path   string
+	perm   Permission
+	handle http.HandlerFunc
+}
+
+// adminRoutes liệt kê mọi route admin theo thứ tự đăng ký (route cụ thể đứng trước route có biến).
+func (h *handler) adminRoutes() []adminRoute {
+	return []adminRoute{
+		{"GET", "/stats", PermDashboardView, h.getDashboardStats},
+		{"GET", "/users", PermUsersView, h.getAllUsers},
+		{"PUT", "/users/{id}/role", PermUsersManage, h.updateUserRole},
+		{"POST", "/users/{id}/unlock", PermUsersManage, h.unlockUser},
+		{"GET", "/users/{id}/loyalty", PermUsersView, h.getUserLoyalty},
+		{"POST", "/users/{id}/loyalty/adjust", PermUsersManage, h.adjustLoyaltyPoints},
+		{"GET", "/users/{id}/wallet", PermUsersView, h.getUserWallet},
+		{"POST", "/users/{id}/wallet/adjust", PermPaymentsManage, h.adjustWallet},
+		{"GET", "/referrals", PermUsersView, h.getReferralReport},
+		{"POST", "/products", PermProductsWrite, h.createProduct},
+		{"PUT", "/products/{id}", PermProductsWrite, h.updateProduct},
+		{"DELETE", "/products/{id}", PermProductsWrite, h.deleteProduct},
+
+		{"POST", "/categories", PermCategoriesWrite, h.createCategory},
+		{"PUT", "/categories/{id}", PermCategoriesWrite, h.updateCategory},
+		{"DELETE", "/categories/{id}", PermCategoriesWrite, h.deleteCategory},
+
+		{"GET", "/orders", PermOrdersView, h.getAllOrders},
+		{"GET", "/orders/{id}", PermOrdersView, h.getAdminOrderDetails},
+		{"PUT", "/orders/{id}/status", PermOrdersUpdate, h.updateOrderStatus},
+		{"POST", "/orders/{id}/cod-collection", PermOrdersUpdate, h.confirmCODCollection},
+		{"GET", "/orders/{id}/pdf", PermOrdersExport, h.adminExportOrderPDF},
+		{"GET", "/orders/{id}/refunds", PermOrdersView, h.getOrderRefunds},
+		{"POST", "/orders/{id}/refunds", PermPaymentsManage, h.createRefund},
+
+		{"POST", "/payments/bank-statements", PermPaymentsManage, h.importBankStatement},
+
+		{"GET", "/wallet/transactions", PermPaymentsManage, h.getWalletTransactions},
+		{"GET", "/wallet/audit", PermPaymentsManage, h.getWalletAudit},
+		{"GET", "/gift-cards", PermPaymentsManage, h.getGiftCards},
+
+		{"GET", "/reviews", PermReviewsView, h.adminGetAllReviews},
+		{"DELETE", "/reviews/{reviewId}", PermReviewsModerate, h.adminDeleteReview},
+		{"PUT", "/reviews/{reviewId}/reply", PermReviewsReply, h.replyToReview},
 
+		{"POST", "/vouchers", PermVouchersWrite, h.createVoucher},
+		{"GET", "/vouchers", PermVouchersView, h.getAllVouchers},
+		{"GET", "/vouchers/analytics", PermVouchersView, h.getVoucherAnalytics},
+		{"PUT", "/vouchers/{id}", PermVouchersWrite, h.updateVoucher},
+		{"DELETE", "/vouchers/{id}", PermVouchersWrite, h.deleteVoucher},
+		{"GET", "/promotions", PermVouchersView, h.getPromotions},
+		{"POST", "/promotions", PermVouchersWrite, h.createPromotion},
+		{"PUT", "/promotions/{id}", PermVouchersWrite, h.updatePromotion},
+		{"DELETE", "/promotions/{id}", PermVouchersWrite, h.deletePromotion},
+		{"GET", "/campaigns", PermVouchersView, h.getCampaigns},
+		{"POST", "/campaigns", PermVouchersWrite, h.createCampaign},
+		{"PUT", "/campaigns/{id}", PermVouchersWrite, h.updateCampaign},
+		{"DELETE", "/campaigns/{id}", PermVouchersWrite, h.deleteCampaign},
+		{"POST", "/campaigns/{id}/run", PermVouchersWrite, h.runCampaign},
+		{"GET", "/campaigns/{id}/deliveries", PermVouchersView, h.getCampaignDeliveries},
+	}
 }
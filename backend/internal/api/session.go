@@ -0,0 +1,372 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/utils"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var errInvalidRefreshToken = errors.New("refresh token không hợp lệ")
+
+// hashToken băm token ngẫu nhiên trước khi lưu vào CSDL (giống password_reset_tokens).
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// maxIPLength là độ dài các cột ip_address/signup_ip (VARCHAR(64)).
+const maxIPLength = 64
+
+// clientIP trả về IP của client. X-Forwarded-For chỉ được tin khi request đến từ một proxy trong
+// TRUSTED_PROXIES (danh sách IP/CIDR, phân tách bằng dấu phẩy); khi đó lấy địa chỉ gần nhất
+// không phải proxy tin cậy, tính từ phải sang. Ngược lại dùng RemoteAddr.
+func clientIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	proxies := trustedProxies()
+	if isTrustedProxy(remote, proxies) {
+		hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			if !isTrustedProxy(ip.String(), proxies) {
+				return ip.String()
+			}
+		}
+	}
+	if len(remote) > maxIPLength {
+		remote = remote[:maxIPLength]
+	}
+	return remote
+}
+
+func trustedProxies() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, v := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		if _, n, err := net.ParseCIDR(v); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+func isTrustedProxy(addr string, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *handler) newAccessToken(user models.User, sessionID int64) (string, error) {
+	if len(jwtKey) == 0 {
+		return "", errors.New("JWT_SECRET_KEY chưa được set")
+	}
+	claims := &Claims{
+		Username:  user.Username,
+		IsAdmin:   user.IsAdmin,
+		Role:      Role(user.Role),
+		SessionID: sessionID,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: h.now().Add(accessTokenTTL).Unix(),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtKey)
+}
+
+// insertRefreshToken tạo refresh token mới cho session và chỉ lưu bản băm.
+func (h *handler) insertRefreshToken(tx *sql.Tx, sessionID int64) (string, error) {
+	token, err := newRandomToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		sessionID, hashToken(token), h.now().Add(refreshTokenTTL),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// issueTokens mở một session mới (mỗi thiết bị một session) và trả về cặp access/refresh token.
+func (h *handler) issueTokens(r *http.Request, user models.User) (models.LoginResponse, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	defer tx.Rollback()
+
+	var sessionID int64
+	err = tx.QueryRow(
+		"INSERT INTO user_sessions (user_id, user_agent, ip_address, expires_at) VALUES ($1, $2, $3, $4) RETURNING id",
+		user.ID, r.UserAgent(), clientIP(r), h.now().Add(refreshTokenTTL),
+	).Scan(&sessionID)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	refreshToken, err := h.insertRefreshToken(tx, sessionID)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	accessToken, err := h.newAccessToken(user, sessionID)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	return models.LoginResponse{
+		Token:                  accessToken,
+		RefreshToken:           refreshToken,
+		ExpiresIn:              int64(accessTokenTTL.Seconds()),
+		Username:               user.Username,
+		IsAdmin:                user.IsAdmin,
+		Role:                   user.Role,
+		ID:                     user.ID,
+		Email:                  user.Email,
+		EmailVerified:          user.EmailVerified,
+		TwoFactorSetupRequired: !user.TwoFactorEnabled && twoFactorRequiredRoles()[Role(user.Role)],
+	}, nil
+}
+
+// rotateRefreshToken đổi refresh token cũ lấy cặp token mới. Nếu một token đã dùng
+// bị gửi lại (dấu hiệu token bị đánh cắp), toàn bộ session bị thu hồi.
+func (h *handler) rotateRefreshToken(refreshToken string) (models.LoginResponse, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	defer tx.Rollback()
+
+	var tokenID, sessionID int64
+	var expiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+	var user models.User
+	err = tx.QueryRow(`
+		SELECT rt.id, rt.session_id, rt.expires_at, rt.used_at, s.revoked_at,
+		       u.id, u.username, u.email, u.is_admin, u.role, u.email_verified_at IS NOT NULL,
+		       u.totp_enabled_at IS NOT NULL
+		FROM refresh_tokens rt
+		JOIN user_sessions s ON rt.session_id = s.id
+		JOIN users u ON s.user_id = u.id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, s
+	`, hashToken(refreshToken)).Scan(&tokenID, &sessionID, &expiresAt, &usedAt, &revokedAt,
+		&user.ID, &user.Username, &user.Email, &user.IsAdmin, &user.Role, &user.EmailVerified,
+		&user.TwoFactorEnabled)
+	if err == sql.ErrNoRows {
+		return models.LoginResponse{}, errInvalidRefreshToken
+	}
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	if revokedAt.Valid || h.now().After(expiresAt) {
+		return models.LoginResponse{}, errInvalidRefreshToken
+	}
+	if usedAt.Valid {
+		fmt.Printf("WARNING: refresh token reuse detected, revoking session %d\n", sessionID)
+		if _, err := tx.Exec("UPDATE user_sessions SET revoked_at = $2 WHERE id = $1", sessionID, h.now()); err != nil {
+			return models.LoginResponse{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return models.LoginResponse{}, err
+		}
+		return models.LoginResponse{}, errInvalidRefreshToken
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = $2 WHERE id = $1", tokenID, h.now()); err != nil {
+		return models.LoginResponse{}, err
+	}
+	// Session được gia hạn cùng refresh token mới
+	_, err = tx.Exec(
+		"UPDATE user_sessions SET last_used_at = $2, expires_at = $3 WHERE id = $1",
+		sessionID, h.now(), h.now().Add(refreshTokenTTL),
+	)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	newRefreshToken, err := h.insertRefreshToken(tx, sessionID)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	accessToken, err := h.newAccessToken(user, sessionID)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	return models.LoginResponse{
+		Token:                  accessToken,
+		RefreshToken:           newRefreshToken,
+		ExpiresIn:              int64(accessTokenTTL.Seconds()),
+		Username:               user.Username,
+		IsAdmin:                user.IsAdmin,
+		Role:                   user.Role,
+		ID:                     user.ID,
+		Email:                  user.Email,
+		EmailVerified:          user.EmailVerified,
+		TwoFactorSetupRequired: !user.TwoFactorEnabled && twoFactorRequiredRoles()[Role(user.Role)],
+	}, nil
+}
+
+func (h *handler) refreshToken(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+
+	resp, err := h.rotateRefreshToken(req.RefreshToken)
+	if err != nil {
+		if err == errInvalidRefreshToken {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Phiên đăng nhập đã hết hạn, vui lòng đăng nhập lại")
+			return
+		}
+		fmt.Printf("ERROR rotating refresh token: %v\n", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể làm mới token")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// sessionIDFromRequest đọc session id từ access token, chấp nhận cả token đã hết hạn
+// (chữ ký vẫn phải hợp lệ) để người dùng luôn đăng xuất được.
+func sessionIDFromRequest(r *http.Request) int64 {
+	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if tokenString == "" {
+		return 0
+	}
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil {
+		ve, ok := err.(*jwt.ValidationError)
+		if !ok || ve.Errors != jwt.ValidationErrorExpired {
+			return 0
+		}
+	}
+	return claims.SessionID
+}
+
+func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshTokenRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	if sessionID := sessionIDFromRequest(r); sessionID != 0 {
+		h.db.Exec("UPDATE user_sessions SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL", sessionID, h.now())
+	}
+	if req.RefreshToken != "" {
+		h.db.Exec(`
+			UPDATE user_sessions SET revoked_at = $2
+			WHERE revoked_at IS NULL
+			AND id = (SELECT session_id FROM refresh_tokens WHERE token_hash = $1)
+		`, hashToken(req.RefreshToken), h.now())
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
+}
+
+// User: Đăng xuất khỏi tất cả thiết bị
+func (h *handler) logoutAllDevices(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	res, err := h.db.Exec("UPDATE user_sessions SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL", userID, h.now())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể đăng xuất các thiết bị")
+		return
+	}
+	revoked, _ := res.RowsAffected()
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":          "Đã đăng xuất khỏi tất cả thiết bị",
+		"revoked_sessions": revoked,
+	})
+}
+
+// User: Danh sách các phiên đăng nhập còn hiệu lực
+func (h *handler) getUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	currentSessionID, _ := r.Context().Value("sessionID").(int64)
+
+	rows, err := h.db.Query(`
+		SELECT id, user_agent, ip_address, created_at, last_used_at
+		FROM user_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_used_at DESC
+	`, userID, h.now())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy danh sách phiên đăng nhập")
+		return
+	}
+	defer rows.Close()
+
+	sessions := []models.UserSession{}
+	for rows.Next() {
+		var s models.UserSession
+		var userAgent, ip sql.NullString
+		if err := rows.Scan(&s.ID, &userAgent, &ip, &s.CreatedAt, &s.LastUsedAt); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét dữ liệu phiên đăng nhập")
+			return
+		}
+		s.UserAgent = userAgent.String
+		s.IPAddress = ip.String
+		s.Current = s.ID == currentSessionID
+		sessions = append(sessions, s)
+	}
+	utils.RespondWithJSON(w, http.StatusOK, sessions)
+}
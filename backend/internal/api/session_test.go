@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+)
+
+func TestClientIPTrustsForwardedForOnlyFromProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.10")
+	cases := []struct {
+		name   string
+		remote string
+		fwd    string
+		want   string
+	}{
+		{"không qua proxy", "203.0.113.7:5123", "", "203.0.113.7"},
+		{"client tự gửi header", "203.0.113.7:5123", "198.51.100.1", "203.0.113.7"},
+		{"qua proxy tin cậy", "10.1.2.3:443", "198.51.100.1", "198.51.100.1"},
+		{"client giả mạo phía trước", "10.1.2.3:443", "1.1.1.1, 198.51.100.1, 192.0.2.10", "198.51.100.1"},
+		{"header rác", "10.1.2.3:443", strings.Repeat("x", 100), "10.1.2.3"},
+		{"IPv6", "[2001:db8::1]:443", "", "2001:db8::1"},
+		{"RemoteAddr quá dài", strings.Repeat("a", 100), "", strings.Repeat("a", maxIPLength)},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		if c.fwd != "" {
+			r.Header.Set("X-Forwarded-For", c.fwd)
+		}
+		if got := clientIP(r); got != c.want {
+			t.Errorf("%s: clientIP = %q, muốn %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRotateRefreshTokenUsesHandlerClock(t *testing.T) {
+	oldKey := jwtKey
+	jwtKey = []byte("test-secret")
+	t.Cleanup(func() { jwtKey = oldKey })
+	clock := newTestClock()
+	for _, reused := range []bool{false, true} {
+		fake, db := dbtest.New()
+		var usedAt driver.Value
+		if reused {
+			usedAt = clock.now().Add(-time.Minute)
+		}
+		fake.On("FROM refresh_tokens rt", dbtest.Rows([]driver.Value{
+			int64(5), int64(9), clock.now().Add(time.Hour), usedAt, nil,
+			int64(7), "lan", "lan@example.com", false, "customer", true, false,
+		}))
+		h := &handler{db: db, clock: clock.now}
+
+		_, err := h.rotateRefreshToken("old-token")
+		if reused {
+			if err != errInvalidRefreshToken {
+				t.Fatalf("err = %v, muốn errInvalidRefreshToken", err)
+			}
+			revokes := fake.Calls("SET revoked_at")
+			if len(revokes) != 1 || revokes[0].Args[0] != int64(9) || revokes[0].Args[1] != clock.now() {
+				t.Errorf("thu hồi session phải dùng giờ của handler, có %+v", revokes)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used := fake.Calls("SET used_at"); len(used) != 1 || used[0].Args[1] != clock.now() {
+			t.Errorf("used_at phải là giờ của handler, có %+v", used)
+		}
+		touched := fake.Calls("SET last_used_at")
+		if len(touched) != 1 || touched[0].Args[1] != clock.now() || touched[0].Args[2] != clock.now().Add(refreshTokenTTL) {
+			t.Errorf("last_used_at/expires_at phải tính từ giờ của handler, có %+v", touched)
+		}
+	}
+}
+
+func TestUserSessionsAndLogoutAllUseHandlerClock(t *testing.T) {
+	clock := newTestClock()
+	fake, db := dbtest.New()
+	h := &handler{db: db, clock: clock.now}
+	ctx := context.WithValue(context.Background(), "userID", 7)
+
+	h.getUserSessions(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/user/sessions", nil).WithContext(ctx))
+	if calls := fake.Calls("FROM user_sessions"); len(calls) != 1 || calls[0].Args[1] != clock.now() {
+		t.Errorf("phiên còn hạn phải so với giờ của handler, có %+v", calls)
+	}
+
+	h.logoutAllDevices(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/user/logout-all", nil).WithContext(ctx))
+	if calls := fake.Calls("SET revoked_at"); len(calls) != 1 || calls[0].Args[1] != clock.now() {
+		t.Errorf("revoked_at phải là giờ của handler, có %+v", calls)
+	}
+}
@@ -0,0 +1,426 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/totp"
+	"backend/internal/utils"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	mfaTokenTTL       = 5 * time.Minute
+	mfaPurpose        = "mfa"
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	totpIssuer        = "Thai Duong's Food"
+)
+
+// mfaClaims là token trung gian giữa bước kiểm tra mật khẩu và bước nhập mã TOTP.
+// Không có SessionID nên AuthMiddleware không chấp nhận nó như access token.
+type mfaClaims struct {
+	UserID  int    `json:"uid"`
+	Purpose string `json:"purpose"`
+	jwt.StandardClaims
+}
+
+// twoFactorRequiredRoles đọc REQUIRE_2FA_ROLES (vd "owner,manager"). Mặc định bắt buộc
+// cho owner và manager.
+func twoFactorRequiredRoles() map[Role]bool {
+	value, ok := os.LookupEnv("REQUIRE_2FA_ROLES")
+	if !ok {
+		value = "owner,manager"
+	}
+	roles := map[Role]bool{}
+	for _, r := range strings.Split(value, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			roles[Role(r)] = true
+		}
+	}
+	return roles
+}
+
+func (h *handler) newMFAToken(userID int) (string, error) {
+	if len(jwtKey) == 0 {
+		return "", errors.New("JWT_SECRET_KEY chưa được set")
+	}
+	claims := &mfaClaims{
+		UserID:  userID,
+		Purpose: mfaPurpose,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: h.now().Add(mfaTokenTTL).Unix(),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtKey)
+}
+
+// respondTwoFactorChallenge trả về mfa_token thay cho LoginResponse khi tài khoản bật 2FA.
+func (h *handler) respondTwoFactorChallenge(w http.ResponseWriter, userID int) {
+	mfaToken, err := h.newMFAToken(userID)
+	if err != nil {
+		fmt.Printf("ERROR issuing mfa token: %v\n", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo token")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, models.TwoFactorChallenge{
+		TwoFactorRequired: true,
+		MFAToken:          mfaToken,
+		ExpiresIn:         int64(mfaTokenTTL.Seconds()),
+	})
+}
+
+func parseMFAToken(tokenString string) (int, bool) {
+	claims := &mfaClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil || !token.Valid || claims.Purpose != mfaPurpose {
+		return 0, false
+	}
+	return claims.UserID, true
+}
+
+// generateRecoveryCodes trả về các mã khôi phục dạng XXXXX-XXXXX (chỉ hiển thị một lần).
+func generateRecoveryCodes() ([]string, error) {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+	for _, c := range codes {
+		if _, err := tx.Exec(
+			"INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, hashToken(c),
+		); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// verifySecondFactor kiểm tra mã TOTP (chặn dùng lại mã cũ) hoặc mã khôi phục.
+func (h *handler) verifySecondFactor(userID int, code, recoveryCode string) (bool, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var secret sql.NullString
+	var lastStep sql.NullInt64
+	err = tx.QueryRow(
+		"SELECT totp_secret, totp_last_step FROM users WHERE id = $1 AND totp_enabled_at IS NOT NULL FOR UPDATE",
+		userID,
+	).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if recoveryCode != "" {
+		res, err := tx.Exec(
+			"UPDATE user_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+			userID, hashToken(normalizeRecoveryCode(recoveryCode)),
+		)
+		if err != nil {
+			return false, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return false, nil
+		}
+		return true, tx.Commit()
+	}
+
+	step, ok := totp.Validate(secret.String, code, h.now(), totpSkew)
+	if !ok || (lastStep.Valid && step <= lastStep.Int64) {
+		return false, nil
+	}
+	if _, err := tx.Exec("UPDATE users SET totp_last_step = $1 WHERE id = $2", step, userID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Bước 2 của đăng nhập: đổi mfa_token + mã TOTP/mã khôi phục lấy access token.
+func (h *handler) loginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+
+	userID, ok := parseMFAToken(req.MFAToken)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Phiên xác thực hai bước đã hết hạn, vui lòng đăng nhập lại")
+		return
+	}
+
+	// Khóa dòng người dùng như login, để các lần nhập mã song song được đếm lần lượt
+	tx, err := h.db.Begin()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi CSDL")
+		return
+	}
+	defer tx.Rollback()
+
+	var user models.User
+	var failedCount int
+	var lastFailedAt, lockedUntil sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, username, is_admin, role, email, email_verified_at IS NOT NULL,
+		       failed_login_count, last_failed_login_at, locked_until
+		FROM users WHERE id = $1
+		FOR UPDATE
+	`, userID).Scan(&user.ID, &user.Username, &user.IsAdmin, &user.Role, &user.Email, &user.EmailVerified,
+		&failedCount, &lastFailedAt, &lockedUntil)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Người dùng không tồn tại")
+		return
+	}
+
+	now := h.now()
+	if lockedUntil.Valid && now.Before(lockedUntil.Time) {
+		respondThrottled(w, "account_locked", lockedMessage(lockedUntil.Time), lockedUntil.Time.Sub(now))
+		return
+	}
+	if lastFailedAt.Valid {
+		if wait := h.throttle.retryAfter(now, failedCount, h.throttle.FreeAttempts, lastFailedAt.Time); wait > 0 {
+			respondThrottled(w, "too_many_attempts", "Bạn đã thử quá nhiều lần. Vui lòng thử lại sau.", wait)
+			return
+		}
+	}
+
+	valid, err := h.verifySecondFactor(user.ID, req.Code, req.RecoveryCode)
+	if err != nil {
+		fmt.Printf("ERROR verifying second factor for user %d: %v\n", user.ID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi xác thực mã")
+		return
+	}
+	if !valid {
+		h.recordAttempt(attemptKindLogin, &user.ID, user.Username, attemptBadTOTP, r)
+		until, lockErr := h.registerLoginFailure(tx, user.ID)
+		if lockErr == nil {
+			lockErr = tx.Commit()
+		}
+		if lockErr != nil {
+			fmt.Printf("ERROR updating failed login count for user %d: %v\n", user.ID, lockErr)
+		}
+		if until != nil {
+			respondThrottled(w, "account_locked", lockedMessage(*until), until.Sub(now))
+			return
+		}
+		utils.RespondWithError(w, http.StatusUnauthorized, "Mã xác thực không đúng")
+		return
+	}
+
+	tx.Exec("UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL WHERE id = $1", user.ID)
+	if err := tx.Commit(); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi CSDL")
+		return
+	}
+	h.recordAttempt(attemptKindLogin, &user.ID, user.Username, attemptSuccess, r)
+
+	resp, err := h.issueTokens(r, user)
+	if err != nil {
+		fmt.Printf("ERROR issuing tokens: %v\n", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo token")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// User: Bắt đầu đăng ký 2FA, trả về secret và URI để tạo mã QR
+func (h *handler) setupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var email string
+	var enabled bool
+	err := h.db.QueryRow("SELECT email, totp_enabled_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&email, &enabled)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi CSDL")
+		return
+	}
+	if enabled {
+		utils.RespondWithError(w, http.StatusConflict, "Xác thực hai bước đã được bật")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo secret")
+		return
+	}
+	if _, err := h.db.Exec("UPDATE users SET totp_pending_secret = $1 WHERE id = $2", secret, userID); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể lưu secret")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, models.TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(totpIssuer, email, secret),
+	})
+}
+
+// User: Xác nhận mã đầu tiên để bật 2FA, trả về mã khôi phục
+func (h *handler) enableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	var pending sql.NullString
+	err = tx.QueryRow("SELECT totp_pending_secret FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&pending)
+	if err != nil || !pending.Valid {
+		utils.RespondWithError(w, http.StatusBadRequest, "Vui lòng bắt đầu đăng ký xác thực hai bước trước")
+		return
+	}
+
+	step, ok := totp.Validate(pending.String, req.Code, h.now(), totpSkew)
+	if !ok {
+		utils.RespondWithError(w, http.StatusBadRequest, "Mã xác thực không đúng")
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET totp_secret = totp_pending_secret, totp_pending_secret = NULL,
+		       totp_enabled_at = NOW(), totp_last_step = $1
+		WHERE id = $2
+	`, step, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể bật xác thực hai bước")
+		return
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo mã khôi phục")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi commit transaction")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// User: Tắt 2FA (cần mã TOTP hoặc mã khôi phục hiện tại)
+func (h *handler) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	role, _ := r.Context().Value("role").(Role)
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+	if twoFactorRequiredRoles()[role] {
+		utils.RespondWithError(w, http.StatusForbidden, "Tài khoản quản trị với role này bắt buộc bật xác thực hai bước")
+		return
+	}
+
+	valid, err := h.verifySecondFactor(userID, req.Code, req.RecoveryCode)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi xác thực mã")
+		return
+	}
+	if !valid {
+		utils.RespondWithError(w, http.StatusBadRequest, "Mã xác thực không đúng")
+		return
+	}
+
+	_, err = h.db.Exec(`
+		UPDATE users SET totp_secret = NULL, totp_pending_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tắt xác thực hai bước")
+		return
+	}
+	h.db.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID)
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Đã tắt xác thực hai bước"})
+}
+
+// User: Tạo lại bộ mã khôi phục (mã cũ mất hiệu lực)
+func (h *handler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+
+	valid, err := h.verifySecondFactor(userID, req.Code, "")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi xác thực mã")
+		return
+	}
+	if !valid {
+		utils.RespondWithError(w, http.StatusBadRequest, "Mã xác thực không đúng")
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể tạo mã khôi phục")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi commit transaction")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+	"backend/internal/totp"
+)
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// newTwoFactorHandler trả về handler có người dùng đã bật 2FA với totp_last_step = lastStep.
+func newTwoFactorHandler(clock *testClock, lastStep interface{}) (*handler, *dbtest.DB) {
+	fake, db := dbtest.New()
+	fake.On("SELECT totp_secret, totp_last_step", func([]driver.Value) ([][]driver.Value, error) {
+		return [][]driver.Value{{testTOTPSecret, lastStep}}, nil
+	})
+	return &handler{db: db, clock: clock.now, throttle: defaultThrottlePolicy}, fake
+}
+
+func TestVerifySecondFactorRecordsStep(t *testing.T) {
+	clock := newTestClock()
+	h, fake := newTwoFactorHandler(clock, nil)
+	code, _ := totp.Code(testTOTPSecret, clock.now())
+
+	ok, err := h.verifySecondFactor(7, code, "")
+	if err != nil || !ok {
+		t.Fatalf("mã đúng: ok = %v, err = %v", ok, err)
+	}
+	updates := fake.Calls("SET totp_last_step")
+	if len(updates) != 1 || updates[0].Args[0] != totp.Step(clock.now()) {
+		t.Fatalf("phải lưu chu kỳ vừa dùng %d, có %+v", totp.Step(clock.now()), updates)
+	}
+	if fake.Commits != 1 {
+		t.Errorf("Commits = %d, muốn 1", fake.Commits)
+	}
+}
+
+func TestVerifySecondFactorRejectsReplayedStep(t *testing.T) {
+	clock := newTestClock()
+	current := totp.Step(clock.now())
+	code, _ := totp.Code(testTOTPSecret, clock.now())
+	previous, _ := totp.Code(testTOTPSecret, clock.now().Add(-totp.Period*time.Second))
+
+	cases := []struct {
+		name     string
+		code     string
+		lastStep int64
+		ok       bool
+	}{
+		{"mã đã dùng ở chu kỳ hiện tại", code, current, false},
+		{"mã cũ hơn chu kỳ đã dùng", previous, current, false},
+		{"mã chu kỳ trước vừa được dùng", previous, current - 1, false},
+		{"mã chu kỳ trước chưa dùng", previous, current - 2, true},
+		{"mã mới sau chu kỳ đã dùng", code, current - 1, true},
+	}
+	for _, c := range cases {
+		h, fake := newTwoFactorHandler(clock, c.lastStep)
+		ok, err := h.verifySecondFactor(7, c.code, "")
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if ok != c.ok {
+			t.Errorf("%s: ok = %v, muốn %v", c.name, ok, c.ok)
+		}
+		if updated := len(fake.Calls("SET totp_last_step")) == 1; updated != c.ok {
+			t.Errorf("%s: cập nhật totp_last_step = %v, muốn %v", c.name, updated, c.ok)
+		}
+	}
+}
+
+func TestVerifySecondFactorUsesInjectedClock(t *testing.T) {
+	clock := newTestClock()
+	code, _ := totp.Code(testTOTPSecret, clock.now())
+
+	// Quá cửa sổ lệch ±1 chu kỳ thì mã hết hiệu lực
+	clock.advance(2 * totp.Period * time.Second)
+	h, _ := newTwoFactorHandler(clock, nil)
+	if ok, err := h.verifySecondFactor(7, code, ""); err != nil || ok {
+		t.Fatalf("mã quá hạn: ok = %v, err = %v; muốn false", ok, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"net/http"
 	"backend/internal/models"
+	"backend/internal/orderstatus"
 	"backend/internal/utils"
 	"strconv"
 	
@@ -18,7 +19,7 @@ func (h *handler) getUserOrders(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := h.db.Query(`
-        SELECT id, customer_name, total_amount, status, created_at
+        SELECT id, customer_name, total_amount, status, payment_method, payment_status, created_at
         FROM orders
         WHERE user_id = $1
         ORDER BY created_at DESC
@@ -32,7 +33,7 @@ func (h *handler) getUserOrders(w http.ResponseWriter, r *http.Request) {
 	orders := []models.Order{}
 	for rows.Next() {
 		var o models.Order
-		if err := rows.Scan(&o.ID, &o.CustomerName, &o.TotalAmount, &o.Status, &o.CreatedAt); err != nil {
+		if err := rows.Scan(&o.ID, &o.CustomerName, &o.TotalAmount, &o.Status, &o.PaymentMethod, &o.PaymentStatus, &o.CreatedAt); err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi quét dữ liệu đơn hàng")
 			return
 		}
@@ -52,10 +53,10 @@ func (h *handler) getOrderDetails(w http.ResponseWriter, r *http.Request) {
 
 	var order models.Order
 	err = h.db.QueryRow(`
-        SELECT id, customer_name, customer_phone, shipping_address, total_amount, status, created_at
+        SELECT id, customer_name, customer_phone, shipping_address, total_amount, discount_amount, promotion_discount, points_redeemed, points_discount, wallet_amount, wallet_refunded, status, payment_method, payment_status, created_at
         FROM orders
         WHERE id = $1 AND user_id = $2
-    `, orderID, userID).Scan(&order.ID, &order.CustomerName, &order.CustomerPhone, &order.ShippingAddress, &order.TotalAmount, &order.Status, &order.CreatedAt)
+    `, orderID, userID).Scan(&order.ID, &order.CustomerName, &order.CustomerPhone, &order.ShippingAddress, &order.TotalAmount, &order.DiscountAmount, &order.PromotionDiscount, &order.PointsRedeemed, &order.PointsDiscount, &order.WalletAmount, &order.WalletRefunded, &order.Status, &order.PaymentMethod, &order.PaymentStatus, &order.CreatedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -67,7 +68,7 @@ func (h *handler) getOrderDetails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := h.db.Query(`
-        SELECT oi.id, oi.product_id, oi.quantity, oi.price_at_purchase, p.name, p.image
+        SELECT oi.id, oi.product_id, oi.quantity, oi.price_at_purchase, oi.discount_amount, p.name, p.image
         FROM order_items oi
         JOIN products p ON oi.product_id = p.id
         WHERE oi.order_id = $1
@@ -82,7 +83,7 @@ func (h *handler) getOrderDetails(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var item models.OrderItem
 		var productImage sql.NullString 
-		if err := rows.Scan(&item.ID, &item.ProductID, &item.Quantity, &item.PriceAtPurchase, &item.ProductName, &productImage); err != nil {
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.Quantity, &item.PriceAtPurchase, &item.DiscountAmount, &item.ProductName, &productImage); err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Error scanning order items")
 			return
 		}
@@ -91,5 +92,11 @@ func (h *handler) getOrderDetails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	order.Items = items
+
+	order.Timeline, err = orderstatus.Timeline(r.Context(), h.db, orderID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Database error while fetching order timeline")
+		return
+	}
 	utils.RespondWithJSON(w, http.StatusOK, order)
 }
\ No newline at end of file
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/utils"
+)
+
+const (
+	emailVerificationTTL      = 24 * time.Hour
+	emailVerificationCooldown = time.Minute
+)
+
+// normalizeEmail kiểm tra định dạng email và trả về dạng chuẩn (chữ thường, không khoảng trắng).
+func normalizeEmail(email string) (string, bool) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", false
+	}
+	return email, true
+}
+
+// sendVerificationEmail tạo token xác thực mới (xóa token cũ) và gửi email cho user.
+func (h *handler) sendVerificationEmail(userID int, email string) error {
+	token, err := newRandomToken()
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM email_verification_tokens WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO email_verification_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, hashToken(token), h.now().Add(emailVerificationTTL),
+	)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	frontendURL := os.Getenv("PUBLIC_FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+	verifyLink := fmt.Sprintf("%s/verify-email/%s", frontendURL, token)
+
+	return utils.SendVerificationEmail(email, verifyLink)
+}
+
+func (h *handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+
+	tokenHashStr := hashToken(req.Token)
+
+	var userID int
+	var expiresAt time.Time
+	err := h.db.QueryRow(
+		"SELECT user_id, expires_at FROM email_verification_tokens WHERE token_hash = $1",
+		tokenHashStr,
+	).Scan(&userID, &expiresAt)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Token không hợp lệ hoặc đã hết hạn.")
+		return
+	}
+
+	if h.now().After(expiresAt) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Token đã hết hạn.")
+		h.db.Exec("DELETE FROM email_verification_tokens WHERE token_hash = $1", tokenHashStr)
+		return
+	}
+
+	_, err = h.db.Exec("UPDATE users SET email_verified_at = $2 WHERE id = $1 AND email_verified_at IS NULL", userID, h.now())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Không thể xác thực email")
+		return
+	}
+
+	h.db.Exec("DELETE FROM email_verification_tokens WHERE user_id = $1", userID)
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Xác thực email thành công."})
+}
+
+func (h *handler) resendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+
+	// Luôn trả về cùng một thông báo để không lộ email nào đã đăng ký
+	genericResponse := map[string]string{"message": "Nếu email tồn tại và chưa được xác thực, một liên kết xác thực đã được gửi."}
+
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		utils.RespondWithJSON(w, http.StatusOK, genericResponse)
+		return
+	}
+
+	var userID int
+	var lastSentAt sql.NullTime
+	err := h.db.QueryRow(`
+		SELECT u.id, (SELECT MAX(created_at) FROM email_verification_tokens WHERE user_id = u.id)
+		FROM users u
+		WHERE LOWER(u.email) = $1 AND u.email_verified_at IS NULL
+	`, email).Scan(&userID, &lastSentAt)
+	if err != nil {
+		utils.RespondWithJSON(w, http.StatusOK, genericResponse)
+		return
+	}
+
+	if lastSentAt.Valid && h.now().Sub(lastSentAt.Time) < emailVerificationCooldown {
+		utils.RespondWithError(w, http.StatusTooManyRequests, "Vui lòng đợi một phút trước khi gửi lại email xác thực.")
+		return
+	}
+
+	if err := h.sendVerificationEmail(userID, email); err != nil {
+		fmt.Printf("ERROR: Could not send verification email to %s: %v\n", email, err)
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, genericResponse)
+}
+
+// requireVerifiedEmail chặn các thao tác cần email đã xác thực (đặt hàng, săn voucher).
+// Trả về false nếu đã ghi response lỗi. Đơn của khách vãng lai (userID nil) không bị chặn.
+func (h *handler) requireVerifiedEmail(w http.ResponseWriter, tx queryer, userID *int) bool {
+	if userID == nil {
+		return true
+	}
+
+	var verified bool
+	err := tx.QueryRow("SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1", *userID).Scan(&verified)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.RespondWithError(w, http.StatusBadRequest, "Người dùng không tồn tại")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi kiểm tra tài khoản")
+		}
+		return false
+	}
+	if !verified {
+		utils.RespondWithAPIError(w, http.StatusForbidden, "email_not_verified",
+			"Vui lòng xác thực email trước khi thực hiện thao tác này", nil)
+		return false
+	}
+	return true
+}
+
+// queryer cho phép dùng chung helper với *sql.DB và *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
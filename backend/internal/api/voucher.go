@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 	"math"
 
@@ -42,7 +43,9 @@ func (h *handler) getAllVouchers(w http.ResponseWriter, r *http.Request) {
 	// Get paginated data
 	rows, err := h.db.Query(`
 		SELECT id, code, description, discount_type, discount_value,
-		       hunt_start_time, hunt_end_time, valid_duration_days, applicable_product_ids, created_at
+		       hunt_start_time, hunt_end_time, valid_duration_days, applicable_product_ids,
+		       applicable_category_ids, min_order_value, max_discount, usage_limit, used_count,
+		       is_public, valid_from, valid_until, per_user_limit, created_at
 		FROM vouchers
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -56,12 +59,24 @@ func (h *handler) getAllVouchers(w http.ResponseWriter, r *http.Request) {
 	var vouchers []models.Voucher
 	for rows.Next() {
 		var v models.Voucher
-		var productIDs pq.Int32Array
-		if err := rows.Scan(&v.ID, &v.Code, &v.Description, &v.DiscountType, &v.DiscountValue, &v.HuntStartTime, &v.HuntEndTime, &v.ValidDurationDays, &productIDs, &v.CreatedAt); err != nil {
+		var productIDs, categoryIDs pq.Int32Array
+		var maxDiscount sql.NullInt64
+		var usageLimit sql.NullInt32
+		if err := rows.Scan(&v.ID, &v.Code, &v.Description, &v.DiscountType, &v.DiscountValue, &v.HuntStartTime, &v.HuntEndTime, &v.ValidDurationDays, &productIDs,
+			&categoryIDs, &v.MinOrderValue, &maxDiscount, &usageLimit, &v.UsedCount,
+			&v.IsPublic, &v.ValidFrom, &v.ValidUntil, &v.PerUserLimit, &v.CreatedAt); err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét dữ liệu voucher")
 			return
 		}
 		v.ApplicableProductIDs = (*[]int32)(&productIDs)
+		v.ApplicableCategoryIDs = (*[]int32)(&categoryIDs)
+		if maxDiscount.Valid {
+			v.MaxDiscount = &maxDiscount.Int64
+		}
+		if usageLimit.Valid {
+			limit := int(usageLimit.Int32)
+			v.UsageLimit = &limit
+		}
 		vouchers = append(vouchers, v)
 	}
 
@@ -73,6 +88,41 @@ func (h *handler) getAllVouchers(w http.ResponseWriter, r *http.Request) {
 	utils.RespondWithJSON(w, http.StatusOK, response)
 }
 
+// validateVoucherPayload kiểm tra các điều kiện áp dụng của voucher, trả về thông báo lỗi hoặc "".
+// Mã công khai không có giờ săn nên được gán giờ săn đã đóng để không hiện trong danh sách săn.
+func validateVoucherPayload(p *models.VoucherPayload) string {
+	if p.IsPublic {
+		if p.PerUserLimit == 0 {
+			p.PerUserLimit = 1
+		}
+		if p.HuntStartTime.IsZero() || p.HuntEndTime.IsZero() {
+			now := time.Now().UTC()
+			p.HuntStartTime, p.HuntEndTime = now, now
+		}
+	} else {
+		p.ValidFrom, p.ValidUntil, p.PerUserLimit = nil, nil, 1
+	}
+	switch {
+	case p.IsPublic && strings.TrimSpace(p.Code) == "":
+		return "Mã khuyến mãi công khai không được để trống"
+	case p.PerUserLimit < 0:
+		return "Số lượt dùng mỗi khách phải lớn hơn 0"
+	case p.ValidFrom != nil && p.ValidUntil != nil && !p.ValidUntil.After(*p.ValidFrom):
+		return "Thời gian kết thúc phải sau thời gian bắt đầu"
+	case p.DiscountType != "percentage" && p.DiscountType != "fixed_amount":
+		return "Loại giảm giá không hợp lệ"
+	case p.DiscountValue <= 0 || (p.DiscountType == "percentage" && p.DiscountValue > 100):
+		return "Giá trị giảm không hợp lệ"
+	case p.MinOrderValue < 0:
+		return "Giá trị đơn tối thiểu không hợp lệ"
+	case p.MaxDiscount != nil && (*p.MaxDiscount <= 0 || p.DiscountType != "percentage"):
+		return "Mức giảm tối đa chỉ dùng cho voucher phần trăm và phải lớn hơn 0"
+	case p.UsageLimit != nil && *p.UsageLimit <= 0:
+		return "Số lượt dùng tối đa phải lớn hơn 0"
+	}
+	return ""
+}
+
 // Admin: Tạo một loại voucher mới
 func (h *handler) createVoucher(w http.ResponseWriter, r *http.Request) {
 	var payload models.VoucherPayload
@@ -80,12 +130,20 @@ func (h *handler) createVoucher(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
 		return
 	}
+	if msg := validateVoucherPayload(&payload); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
 
 	var voucherID int
 	err := h.db.QueryRow(`
-		INSERT INTO vouchers (code, description, discount_type, discount_value, hunt_start_time, hunt_end_time, valid_duration_days, applicable_product_ids)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id
-	`, payload.Code, payload.Description, payload.DiscountType, payload.DiscountValue, payload.HuntStartTime, payload.HuntEndTime, payload.ValidDurationDays, pq.Array(payload.ApplicableProductIDs)).Scan(&voucherID)
+		INSERT INTO vouchers (code, description, discount_type, discount_value, hunt_start_time, hunt_end_time, valid_duration_days, applicable_product_ids,
+		                      applicable_category_ids, min_order_value, max_discount, usage_limit,
+		                      is_public, valid_from, valid_until, per_user_limit)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) RETURNING id
+	`, payload.Code, payload.Description, payload.DiscountType, payload.DiscountValue, payload.HuntStartTime, payload.HuntEndTime, payload.ValidDurationDays, pq.Array(payload.ApplicableProductIDs),
+		pq.Array(payload.ApplicableCategoryIDs), payload.MinOrderValue, payload.MaxDiscount, payload.UsageLimit,
+		payload.IsPublic, payload.ValidFrom, payload.ValidUntil, payload.PerUserLimit).Scan(&voucherID)
 
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi tạo voucher")
@@ -109,14 +167,22 @@ func (h *handler) updateVoucher(w http.ResponseWriter, r *http.Request) {
         utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
         return
     }
+    if msg := validateVoucherPayload(&payload); msg != "" {
+        utils.RespondWithError(w, http.StatusBadRequest, msg)
+        return
+    }
 
     // Update voucher in database
     result, err := h.db.Exec(`
         UPDATE vouchers
-        SET code = $1, description = $2, discount_type = $3, discount_value = $4, hunt_start_time = $5, hunt_end_time = $6, valid_duration_days = $7, applicable_product_ids = $8, updated_at = NOW()
-        WHERE id = $9
+        SET code = $1, description = $2, discount_type = $3, discount_value = $4, hunt_start_time = $5, hunt_end_time = $6, valid_duration_days = $7, applicable_product_ids = $8,
+            applicable_category_ids = $9, min_order_value = $10, max_discount = $11, usage_limit = $12,
+            is_public = $13, valid_from = $14, valid_until = $15, per_user_limit = $16, updated_at = NOW()
+        WHERE id = $17
     `,
-        payload.Code, payload.Description, payload.DiscountType, payload.DiscountValue, payload.HuntStartTime, payload.HuntEndTime, payload.ValidDurationDays, pq.Array(payload.ApplicableProductIDs), voucherID,
+        payload.Code, payload.Description, payload.DiscountType, payload.DiscountValue, payload.HuntStartTime, payload.HuntEndTime, payload.ValidDurationDays, pq.Array(payload.ApplicableProductIDs),
+        pq.Array(payload.ApplicableCategoryIDs), payload.MinOrderValue, payload.MaxDiscount, payload.UsageLimit,
+        payload.IsPublic, payload.ValidFrom, payload.ValidUntil, payload.PerUserLimit, voucherID,
     )
 
     if err != nil {
@@ -197,7 +263,7 @@ func (h *handler) getClaimableVouchers(w http.ResponseWriter, r *http.Request) {
 	rows, err := h.db.Query(`
 		SELECT id, code, description, discount_type, discount_value, hunt_start_time, hunt_end_time
 		FROM vouchers
-		WHERE $1 BETWEEN hunt_start_time AND hunt_end_time
+		WHERE $1 BETWEEN hunt_start_time AND hunt_end_time AND NOT is_public
 		AND NOT EXISTS (
 			SELECT 1 FROM user_vouchers WHERE voucher_id = vouchers.id AND user_id = $2
 		)
@@ -225,8 +291,12 @@ func (h *handler) claimVoucher(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(int)
 	voucherID, _ := strconv.Atoi(mux.Vars(r)["id"])
 
+	if !h.requireVerifiedEmail(w, h.db, &userID) {
+		return
+	}
+
 	var validDurationDays int
-	err := h.db.QueryRow("SELECT valid_duration_days FROM vouchers WHERE id = $1 AND now() BETWEEN hunt_start_time AND hunt_end_time", voucherID).Scan(&validDurationDays)
+	err := h.db.QueryRow("SELECT valid_duration_days FROM vouchers WHERE id = $1 AND NOT is_public AND now() BETWEEN hunt_start_time AND hunt_end_time", voucherID).Scan(&validDurationDays)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			utils.RespondWithError(w, http.StatusNotFound, "Voucher không tồn tại hoặc đã hết hạn săn")
@@ -240,7 +310,7 @@ func (h *handler) claimVoucher(w http.ResponseWriter, r *http.Request) {
 
 	_, err = h.db.Exec(`
 		INSERT INTO user_vouchers (user_id, voucher_id, expires_at) VALUES ($1, $2, $3)
-		ON CONFLICT (user_id, voucher_id) DO NOTHING
+		ON CONFLICT (user_id, voucher_id) WHERE source = 'claim' DO NOTHING
 	`, userID, voucherID, expiresAt)
 
 	if err != nil {
@@ -260,7 +330,7 @@ func (h *handler) getUserVouchers(w http.ResponseWriter, r *http.Request) {
 
 	query := `
 		SELECT uv.id, uv.voucher_id, uv.expires_at, uv.is_used,
-		       v.code, v.description, v.discount_type, v.discount_value
+		       v.code, v.description, v.discount_type, v.discount_value, v.min_order_value, v.max_discount
 		FROM user_vouchers uv
 		JOIN vouchers v ON uv.voucher_id = v.id
 		WHERE uv.user_id = $1
@@ -280,11 +350,16 @@ func (h *handler) getUserVouchers(w http.ResponseWriter, r *http.Request) {
 	var userVouchers []models.UserVoucher
 	for rows.Next() {
 		var uv models.UserVoucher
+		var maxDiscount sql.NullInt64
 		if err := rows.Scan(&uv.ID, &uv.VoucherID, &uv.ExpiresAt, &uv.IsUsed,
-		                   &uv.VoucherInfo.Code, &uv.VoucherInfo.Description, &uv.VoucherInfo.DiscountType, &uv.VoucherInfo.DiscountValue); err != nil {
+		                   &uv.VoucherInfo.Code, &uv.VoucherInfo.Description, &uv.VoucherInfo.DiscountType, &uv.VoucherInfo.DiscountValue,
+		                   &uv.VoucherInfo.MinOrderValue, &maxDiscount); err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét dữ liệu voucher")
 			return
 		}
+		if maxDiscount.Valid {
+			uv.VoucherInfo.MaxDiscount = &maxDiscount.Int64
+		}
 		userVouchers = append(userVouchers, uv)
 	}
 	utils.RespondWithJSON(w, http.StatusOK, userVouchers)
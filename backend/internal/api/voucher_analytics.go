@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/utils"
+)
+
+// voucherOrdersQuery là các đơn được tính vào báo cáo voucher, đặt trong [$1, $2): đơn đã xác
+// nhận/thanh toán và chưa hủy/hoàn toàn bộ. revenue gồm phần trả bằng ví và trừ tiền đã hoàn,
+// voucher_discount là phần giảm giá do voucher (không gồm khuyến mãi tự động và điểm thưởng).
+const voucherOrdersQuery = `
+	SELECT COALESCE(uv.voucher_id, o.promo_voucher_id) AS voucher_id,
+	       o.total_amount + o.wallet_amount - COALESCE(rf.refunded, 0) AS revenue,
+	       o.discount_amount - o.promotion_discount - o.points_discount AS voucher_discount
+	FROM orders o
+	LEFT JOIN user_vouchers uv ON uv.id = o.applied_voucher_id
+	LEFT JOIN (
+		SELECT order_id, SUM(amount) AS refunded FROM refunds WHERE status = 'succeeded' GROUP BY order_id
+	) rf ON rf.order_id = o.id
+	WHERE o.status NOT IN ('pending', 'cancelled', 'refunded')
+	  AND o.created_at >= $1 AND o.created_at < $2`
+
+// parseAnalyticsRange đọc from/to (YYYY-MM-DD, giờ Việt Nam, tính cả ngày to); mặc định là 30
+// ngày gần nhất. Trả về ngày đầu, ngày cuối và thời điểm kết thúc (đầu ngày sau to).
+func (h *handler) parseAnalyticsRange(r *http.Request) (from, to, end time.Time, errMsg string) {
+	loc := vietnamLocation()
+	now := h.now().In(loc)
+	to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	from = to.AddDate(0, 0, -29)
+
+	var err error
+	if s := r.URL.Query().Get("from"); s != "" {
+		if from, err = time.ParseInLocation("2006-01-02", s, loc); err != nil {
+			return from, to, end, "Ngày bắt đầu không hợp lệ (định dạng YYYY-MM-DD)"
+		}
+	}
+	if s := r.URL.Query().Get("to"); s != "" {
+		if to, err = time.ParseInLocation("2006-01-02", s, loc); err != nil {
+			return from, to, end, "Ngày kết thúc không hợp lệ (định dạng YYYY-MM-DD)"
+		}
+	}
+	if to.Before(from) {
+		return from, to, end, "Ngày bắt đầu phải trước ngày kết thúc"
+	}
+	return from, to, to.AddDate(0, 0, 1), ""
+}
+
+// Admin: Hiệu quả của từng voucher (lượt nhận, lượt dùng, giảm giá, doanh thu) và so sánh giá trị
+// đơn trung bình có/không dùng voucher. ?format=csv để xuất file CSV.
+func (h *handler) getVoucherAnalytics(w http.ResponseWriter, r *http.Request) {
+	from, to, end, errMsg := h.parseAnalyticsRange(r)
+	if errMsg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, errMsg)
+		return
+	}
+	report := models.VoucherAnalytics{From: from, To: to, Vouchers: []models.VoucherMetrics{}}
+
+	rows, err := h.db.Query(`
+		WITH voucher_orders AS (`+voucherOrdersQuery+`),
+		claims AS (
+			SELECT voucher_id, COUNT(*) AS claims, COUNT(*) FILTER (WHERE is_used) AS redeemed_claims
+			FROM user_vouchers
+			WHERE claimed_at >= $1 AND claimed_at < $2
+			GROUP BY voucher_id
+		),
+		usage AS (
+			SELECT voucher_id, COUNT(*) AS redemptions, SUM(voucher_discount) AS discount, SUM(revenue) AS revenue
+			FROM voucher_orders
+			WHERE voucher_id IS NOT NULL
+			GROUP BY voucher_id
+		)
+		SELECT v.id, v.code, v.description, v.is_public,
+		       COALESCE(c.claims, 0), COALESCE(c.redeemed_claims, 0),
+		       COALESCE(u.redemptions, 0), COALESCE(u.discount, 0), COALESCE(u.revenue, 0)
+		FROM vouchers v
+		LEFT JOIN claims c ON c.voucher_id = v.id
+		LEFT JOIN usage u ON u.voucher_id = v.id
+		ORDER BY COALESCE(u.redemptions, 0) DESC, COALESCE(c.claims, 0) DESC, v.id
+	`, from, end)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi thống kê voucher")
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m models.VoucherMetrics
+		if err := rows.Scan(&m.VoucherID, &m.Code, &m.Description, &m.IsPublic, &m.Claims, &m.RedeemedClaims,
+			&m.Redemptions, &m.TotalDiscount, &m.Revenue); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét dữ liệu thống kê voucher")
+			return
+		}
+		if m.Claims > 0 {
+			m.RedemptionRate = float64(m.RedeemedClaims) * 100 / float64(m.Claims)
+		}
+		if m.Redemptions > 0 {
+			m.AverageOrderValue = m.Revenue / int64(m.Redemptions)
+		}
+		report.Vouchers = append(report.Vouchers, m)
+	}
+	if err := rows.Err(); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét dữ liệu thống kê voucher")
+		return
+	}
+
+	// So sánh đơn có và không dùng voucher
+	rows, err = h.db.Query(`
+		SELECT voucher_id IS NOT NULL, COUNT(*), COALESCE(SUM(revenue), 0)
+		FROM (`+voucherOrdersQuery+`) o
+		GROUP BY 1
+	`, from, end)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi thống kê đơn hàng")
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var withVoucher bool
+		var stats models.OrderValueStats
+		if err := rows.Scan(&withVoucher, &stats.Orders, &stats.Revenue); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét dữ liệu thống kê đơn hàng")
+			return
+		}
+		if stats.Orders > 0 {
+			stats.AverageOrderValue = stats.Revenue / int64(stats.Orders)
+		}
+		if withVoucher {
+			report.WithVoucher = stats
+		} else {
+			report.WithoutVoucher = stats
+		}
+	}
+	if err := rows.Err(); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi quét dữ liệu thống kê đơn hàng")
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		writeVoucherAnalyticsCSV(w, report)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// writeVoucherAnalyticsCSV xuất báo cáo: mỗi voucher một dòng, cuối file là hai dòng tổng hợp đơn
+// có/không dùng voucher.
+func writeVoucherAnalyticsCSV(w http.ResponseWriter, report models.VoucherAnalytics) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=voucher_analytics_%s_%s.csv",
+		report.From.Format("20060102"), report.To.Format("20060102")))
+	// BOM để Excel đọc đúng tiếng Việt
+	w.Write([]byte("\xEF\xBB\xBF"))
+
+	out := csv.NewWriter(w)
+	out.Write([]string{
+		"ID", "Mã", "Mô tả", "Công khai", "Lượt nhận", "Lượt nhận đã dùng", "Tỷ lệ sử dụng (%)",
+		"Số đơn dùng", "Tổng giảm giá", "Doanh thu", "Giá trị đơn TB",
+	})
+	itoa := func(n int64) string { return strconv.FormatInt(n, 10) }
+	for _, m := range report.Vouchers {
+		out.Write([]string{
+			strconv.Itoa(m.VoucherID), csvText(m.Code), csvText(m.Description), strconv.FormatBool(m.IsPublic),
+			strconv.Itoa(m.Claims), strconv.Itoa(m.RedeemedClaims), strconv.FormatFloat(m.RedemptionRate, 'f', 2, 64),
+			strconv.Itoa(m.Redemptions), itoa(m.TotalDiscount), itoa(m.Revenue), itoa(m.AverageOrderValue),
+		})
+	}
+	for _, row := range []struct {
+		label string
+		stats models.OrderValueStats
+	}{
+		{"Đơn có dùng voucher", report.WithVoucher},
+		{"Đơn không dùng voucher", report.WithoutVoucher},
+	} {
+		out.Write([]string{
+			"", "", csvText(row.label), "", "", "", "",
+			strconv.Itoa(row.stats.Orders), "", itoa(row.stats.Revenue), itoa(row.stats.AverageOrderValue),
+		})
+	}
+	out.Flush()
+}
+
+// csvText chặn CSV formula injection: ô văn bản bắt đầu bằng =, +, -, @ (hoặc tab, CR) được thêm
+// dấu ' ở đầu để Excel/Sheets hiển thị như chữ thay vì chạy công thức.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
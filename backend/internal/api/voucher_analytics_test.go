@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+)
+
+func TestVoucherAnalyticsCSVEscapesFormulas(t *testing.T) {
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	report := models.VoucherAnalytics{
+		From: day, To: day.AddDate(0, 1, 0),
+		Vouchers: []models.VoucherMetrics{
+			{VoucherID: 1, Code: "=HYPERLINK(\"http://x\")", Description: "@SUM(A1)"},
+			{VoucherID: 2, Code: "SALE10", Description: "-10% món chính"},
+			{VoucherID: 3, Code: "FREESHIP", Description: "Miễn phí giao hàng"},
+		},
+	}
+	rec := httptest.NewRecorder()
+	writeVoucherAnalyticsCSV(rec, report)
+
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(rec.Body.String(), "\xEF\xBB\xBF"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{
+		{"'=HYPERLINK(\"http://x\")", "'@SUM(A1)"},
+		{"SALE10", "'-10% món chính"},
+		{"FREESHIP", "Miễn phí giao hàng"},
+	}
+	for i, w := range want {
+		if got := [2]string{rows[i+1][1], rows[i+1][2]}; got != w {
+			t.Errorf("dòng %d = %q, muốn %q", i+1, got, w)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/utils"
+	"backend/internal/wallet"
+
+	"github.com/gorilla/mux"
+)
+
+// User: Số dư ví
+func (h *handler) getWallet(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	balance, err := wallet.Balance(r.Context(), h.db, userID, false)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy số dư ví")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, models.WalletBalance{Balance: balance})
+}
+
+// User: Lịch sử giao dịch ví
+func (h *handler) getWalletHistory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	page, limit, offset := utils.GetPaginationParams(r, 20)
+
+	var totalRecords int
+	h.db.QueryRow(`
+		SELECT COUNT(*) FROM wallet_entries e JOIN wallet_accounts a ON a.id = e.account_id WHERE a.user_id = $1
+	`, userID).Scan(&totalRecords)
+	totalPages := int(math.Ceil(float64(totalRecords) / float64(limit)))
+
+	entries, err := wallet.History(r.Context(), h.db, userID, limit, offset)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy lịch sử ví")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"entries":    entries,
+		"page":       page,
+		"totalPages": totalPages,
+	})
+}
+
+// User: Nạp thẻ quà tặng vào ví
+func (h *handler) redeemGiftCard(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	var req models.RedeemGiftCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Vui lòng nhập mã thẻ quà tặng")
+		return
+	}
+
+	card, balance, err := wallet.Redeem(r.Context(), h.db, userID, req.Code, h.now())
+	switch {
+	case errors.Is(err, wallet.ErrGiftCardNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Mã thẻ quà tặng không tồn tại")
+		return
+	case errors.Is(err, wallet.ErrGiftCardUnavailable):
+		utils.RespondWithError(w, http.StatusBadRequest, "Thẻ quà tặng đã được sử dụng hoặc đã bị hủy")
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi nạp thẻ quà tặng")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":   "Nạp thẻ quà tặng thành công",
+		"amount":    card.InitialValue,
+		"gift_card": card,
+		"balance":   balance,
+	})
+}
+
+// User: Các thẻ quà tặng đã mua
+func (h *handler) getMyGiftCards(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	cards, err := h.queryGiftCards(" WHERE o.user_id = $1", "", userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy thẻ quà tặng")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, cards)
+}
+
+// queryGiftCards lấy thẻ quà tặng kèm số dư chưa nạp; where có thể tham chiếu gc (gift_cards) và
+// o (đơn mua thẻ), page (LIMIT/OFFSET) được thêm sau ORDER BY.
+func (h *handler) queryGiftCards(where, page string, args ...interface{}) ([]models.GiftCard, error) {
+	rows, err := h.db.Query(`
+		SELECT gc.id, gc.code, gc.initial_value, a.balance, gc.status, gc.order_id, gc.redeemed_by, gc.redeemed_at, gc.created_at
+		FROM gift_cards gc
+		JOIN wallet_accounts a ON a.id = gc.account_id
+		LEFT JOIN orders o ON o.id = gc.order_id`+where+`
+		ORDER BY gc.created_at DESC, gc.id DESC`+page, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cards := []models.GiftCard{}
+	for rows.Next() {
+		var c models.GiftCard
+		var orderID, redeemedBy sql.NullInt64
+		var redeemedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.Code, &c.InitialValue, &c.Balance, &c.Status, &orderID, &redeemedBy, &redeemedAt, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			c.OrderID = &id
+		}
+		if redeemedBy.Valid {
+			id := int(redeemedBy.Int64)
+			c.RedeemedBy = &id
+		}
+		if redeemedAt.Valid {
+			c.RedeemedAt = &redeemedAt.Time
+		}
+		cards = append(cards, c)
+	}
+	return cards, rows.Err()
+}
+
+// Admin: Danh sách thẻ quà tặng, lọc theo trạng thái / đơn hàng
+func (h *handler) getGiftCards(w http.ResponseWriter, r *http.Request) {
+	page, limit, offset := utils.GetPaginationParams(r, 20)
+
+	var conditions []string
+	var args []interface{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		args = append(args, status)
+		conditions = append(conditions, "gc.status = $"+strconv.Itoa(len(args)))
+	}
+	if orderID, err := strconv.Atoi(r.URL.Query().Get("order_id")); err == nil {
+		args = append(args, orderID)
+		conditions = append(conditions, "gc.order_id = $"+strconv.Itoa(len(args)))
+	}
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var totalRecords int
+	h.db.QueryRow("SELECT COUNT(*) FROM gift_cards gc"+whereClause, args...).Scan(&totalRecords)
+	totalPages := int(math.Ceil(float64(totalRecords) / float64(limit)))
+
+	cards, err := h.queryGiftCards(whereClause,
+		" LIMIT $"+strconv.Itoa(len(args)+1)+" OFFSET $"+strconv.Itoa(len(args)+2), append(args, limit, offset)...)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy thẻ quà tặng")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"gift_cards": cards,
+		"page":       page,
+		"totalPages": totalPages,
+	})
+}
+
+// Admin: Sổ giao dịch ví, lọc theo loại, người dùng, đơn hàng và khoảng ngày (YYYY-MM-DD)
+func (h *handler) getWalletTransactions(w http.ResponseWriter, r *http.Request) {
+	page, limit, offset := utils.GetPaginationParams(r, 20)
+	query := r.URL.Query()
+
+	var conditions []string
+	var args []interface{}
+	if typ := query.Get("type"); typ != "" {
+		args = append(args, typ)
+		conditions = append(conditions, "t.type = $"+strconv.Itoa(len(args)))
+	}
+	if userID, err := strconv.Atoi(query.Get("user_id")); err == nil {
+		args = append(args, userID)
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM wallet_entries e JOIN wallet_accounts a ON a.id = e.account_id
+			WHERE e.transaction_id = t.id AND a.user_id = $`+strconv.Itoa(len(args))+`)`)
+	}
+	if orderID, err := strconv.Atoi(query.Get("order_id")); err == nil {
+		args = append(args, orderID)
+		conditions = append(conditions, "t.order_id = $"+strconv.Itoa(len(args)))
+	}
+	for _, f := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+		value := query.Get(f.param)
+		if value == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Ngày không hợp lệ (định dạng YYYY-MM-DD)")
+			return
+		}
+		if f.param == "to" {
+			day = day.AddDate(0, 0, 1)
+		}
+		args = append(args, day)
+		conditions = append(conditions, "t.created_at "+f.op+" $"+strconv.Itoa(len(args)))
+	}
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var totalRecords int
+	h.db.QueryRow("SELECT COUNT(*) FROM wallet_transactions t"+whereClause, args...).Scan(&totalRecords)
+	totalPages := int(math.Ceil(float64(totalRecords) / float64(limit)))
+
+	rows, err := h.db.Query(`
+		SELECT t.id, t.type, t.order_id, t.gift_card_id, t.refund_id, t.actor_user_id, COALESCE(u.username, ''), t.note, t.created_at
+		FROM wallet_transactions t
+		LEFT JOIN users u ON u.id = t.actor_user_id`+whereClause+`
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT $`+strconv.Itoa(len(args)+1)+` OFFSET $`+strconv.Itoa(len(args)+2),
+		append(args, limit, offset)...)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi truy vấn giao dịch ví")
+		return
+	}
+	defer rows.Close()
+
+	transactions := []models.WalletTransaction{}
+	var ids []int64
+	for rows.Next() {
+		var t models.WalletTransaction
+		var orderID, actorID, giftCardID, refundID sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.Type, &orderID, &giftCardID, &refundID, &actorID, &t.ActorUsername, &t.Note, &t.CreatedAt); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi quét dữ liệu giao dịch ví")
+			return
+		}
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			t.OrderID = &id
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			t.ActorUserID = &id
+		}
+		if giftCardID.Valid {
+			t.GiftCardID = &giftCardID.Int64
+		}
+		if refundID.Valid {
+			t.RefundID = &refundID.Int64
+		}
+		transactions = append(transactions, t)
+		ids = append(ids, t.ID)
+	}
+	if err := rows.Err(); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi quét dữ liệu giao dịch ví")
+		return
+	}
+
+	entries, err := wallet.Entries(r.Context(), h.db, ids)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi truy vấn bút toán ví")
+		return
+	}
+	for i := range transactions {
+		transactions[i].Entries = entries[transactions[i].ID]
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"transactions": transactions,
+		"page":         page,
+		"totalPages":   totalPages,
+	})
+}
+
+// Admin: Đối soát sổ kép của ví
+func (h *handler) getWalletAudit(w http.ResponseWriter, r *http.Request) {
+	audit, err := wallet.Audit(r.Context(), h.db)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi đối soát ví")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, audit)
+}
+
+// Admin: Xem số dư và lịch sử ví gần đây của một người dùng
+func (h *handler) getUserWallet(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID không hợp lệ")
+		return
+	}
+	balance, err := wallet.Balance(r.Context(), h.db, userID, false)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy số dư ví")
+		return
+	}
+	entries, err := wallet.History(r.Context(), h.db, userID, 50, 0)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy lịch sử ví")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"balance": models.WalletBalance{Balance: balance},
+		"entries": entries,
+	})
+}
+
+// Admin: Cộng/trừ số dư ví thủ công, bắt buộc ghi lý do
+func (h *handler) adjustWallet(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "ID không hợp lệ")
+		return
+	}
+	var req models.WalletAdjustRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Dữ liệu không hợp lệ")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Amount == 0 || req.Reason == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Cần nhập số tiền khác 0 và lý do điều chỉnh")
+		return
+	}
+
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil || !exists {
+		utils.RespondWithError(w, http.StatusNotFound, "Không tìm thấy người dùng")
+		return
+	}
+
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi bắt đầu giao dịch")
+		return
+	}
+	defer tx.Rollback()
+
+	staffID := r.Context().Value("userID").(int)
+	err = wallet.Adjust(r.Context(), tx, userID, req.Amount, req.Reason, staffID)
+	if errors.Is(err, wallet.ErrInsufficientBalance) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Số dư ví không đủ để trừ")
+		return
+	}
+	if err != nil || tx.Commit() != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi điều chỉnh số dư ví")
+		return
+	}
+
+	balance, err := wallet.Balance(r.Context(), h.db, userID, false)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Lỗi khi lấy số dư ví")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, models.WalletBalance{Balance: balance})
+}
@@ -0,0 +1,49 @@
+// Package banktransfer chứa thông tin tài khoản nhận chuyển khoản của cửa hàng và quy ước
+// nội dung chuyển khoản cho từng đơn hàng.
+package banktransfer
+
+import (
+	"fmt"
+	"os"
+
+	"backend/internal/vietqr"
+)
+
+// Account là tài khoản ngân hàng nhận tiền, cấu hình qua biến môi trường BANK_*.
+type Account struct {
+	BankName      string `json:"bank_name"`
+	BankBIN       string `json:"bank_bin"`
+	AccountNumber string `json:"account_number"`
+	AccountName   string `json:"account_name"`
+}
+
+func AccountFromEnv() Account {
+	return Account{
+		BankName:      envOr("BANK_NAME", "Techcombank"),
+		BankBIN:       envOr("BANK_BIN", "970407"),
+		AccountNumber: envOr("BANK_ACCOUNT_NUMBER", "19072027706012"),
+		AccountName:   envOr("BANK_ACCOUNT_NAME", "NGUYEN THAI DUONG"),
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// Memo là nội dung chuyển khoản của đơn hàng, vd DH123.
+func Memo(orderID int) string {
+	return fmt.Sprintf("DH%d", orderID)
+}
+
+// QRPayload trả về payload VietQR chuyển amount tới tài khoản với nội dung Memo(orderID).
+func (a Account) QRPayload(orderID int, amount int64) (string, error) {
+	return vietqr.Payload(vietqr.Transfer{
+		BankBIN:       a.BankBIN,
+		AccountNumber: a.AccountNumber,
+		Amount:        amount,
+		Memo:          Memo(orderID),
+	})
+}
@@ -0,0 +1,275 @@
+package banktransfer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"backend/internal/orderstatus"
+	"backend/internal/payment"
+
+	"github.com/lib/pq"
+)
+
+// Kết quả đối soát của một dòng sao kê.
+const (
+	LineMatched          = "matched"
+	LineUnmatched        = "unmatched"
+	LineAmbiguous        = "ambiguous"
+	LineAlreadyProcessed = "already_processed"
+	// LineNeedsReview: tiền đã vào nhưng đơn khớp đổi trạng thái (vd bị hủy) trong lúc đối soát;
+	// dòng được ghi nhận nhưng đơn không được đánh dấu đã thanh toán, cần xử lý thủ công.
+	LineNeedsReview = "needs_review"
+)
+
+// memoPattern tìm mã đơn DH<id> trong diễn giải. Ngân hàng hay chèn thêm ký tự phân cách
+// (DH-123, DH 123) hoặc dính liền với chữ khác (MBVCB.123.DH45.CT) nên chỉ yêu cầu trước DH
+// không phải chữ/số.
+var memoPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])DH[\s\-_.]*(\d+)`)
+
+// ParseMemo trả về các id đơn hàng (không trùng) được nhắc tới trong diễn giải.
+func ParseMemo(description string) []int {
+	var ids []int
+	seen := map[int]bool{}
+	for _, m := range memoPattern.FindAllStringSubmatch(description, -1) {
+		id, err := strconv.Atoi(m[1])
+		if err != nil || id <= 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// LineResult là kết quả đối soát của một dòng tiền vào.
+type LineResult struct {
+	StatementLine
+	Status  string `json:"status"`
+	OrderID *int   `json:"order_id,omitempty"`
+	// Candidates là các đơn chờ thanh toán có thể khớp, để người đối soát kiểm tra thủ công.
+	Candidates []int  `json:"candidates,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+type Report struct {
+	DryRun           bool         `json:"dry_run"`
+	TotalLines       int          `json:"total_lines"`
+	Matched          int          `json:"matched"`
+	Unmatched        int          `json:"unmatched"`
+	Ambiguous        int          `json:"ambiguous"`
+	AlreadyProcessed int          `json:"already_processed"`
+	NeedsReview      int          `json:"needs_review"`
+	Lines            []LineResult `json:"lines"`
+}
+
+type pendingOrder struct {
+	id     int
+	amount int64
+}
+
+// Reconcile khớp các dòng tiền vào với đơn chờ thanh toán theo mã DH<id> trong diễn giải và
+// số tiền, rồi chuyển các đơn khớp sang paid qua orderstatus.Transition. Mỗi dòng được ghi vào
+// payment_transactions (provider bank_transfer) nên import lại cùng sao kê không có tác dụng.
+// Với dryRun, chỉ trả về báo cáo mà không thay đổi dữ liệu. now là thời điểm đối soát.
+func Reconcile(ctx context.Context, db *sql.DB, lines []StatementLine, actor orderstatus.Actor, now time.Time, dryRun bool) (*Report, error) {
+	report := &Report{DryRun: dryRun, TotalLines: len(lines), Lines: []LineResult{}}
+
+	processed, err := processedKeys(ctx, db, lines)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := pendingOrders(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mỗi đơn chỉ được khớp với một dòng trong lần import
+	claimed := map[int]int{}
+	for _, line := range lines {
+		result := LineResult{StatementLine: line}
+		if processed[line.Key()] {
+			result.Status = LineAlreadyProcessed
+			result.Reason = "Dòng sao kê đã được đối soát trước đó"
+		} else {
+			match(&result, pending, claimed)
+		}
+
+		if result.Status == LineMatched && !dryRun {
+			outcome, err := applyLine(ctx, db, line, *result.OrderID, actor, now)
+			if err != nil {
+				return nil, fmt.Errorf("dòng %d: %w", line.Row, err)
+			}
+			switch outcome {
+			case "":
+				result.Status = LineAlreadyProcessed
+				result.Reason = "Dòng sao kê đã được đối soát trước đó"
+			case payment.OutcomeIgnored:
+				result.Status = LineNeedsReview
+				result.Reason = fmt.Sprintf("Đơn #%d đã đổi trạng thái trong lúc đối soát, cần kiểm tra và hoàn tiền thủ công", *result.OrderID)
+			}
+		}
+
+		switch result.Status {
+		case LineMatched:
+			report.Matched++
+		case LineUnmatched:
+			report.Unmatched++
+		case LineAmbiguous:
+			report.Ambiguous++
+		case LineAlreadyProcessed:
+			report.AlreadyProcessed++
+		case LineNeedsReview:
+			report.NeedsReview++
+		}
+		report.Lines = append(report.Lines, result)
+	}
+	return report, nil
+}
+
+func match(result *LineResult, pending map[int]pendingOrder, claimed map[int]int) {
+	refs := ParseMemo(result.Description)
+	if len(refs) == 0 {
+		result.Status = LineUnmatched
+		result.Reason = "Không tìm thấy mã đơn hàng trong nội dung chuyển khoản"
+		// Gợi ý các đơn cùng số tiền để đối soát thủ công
+		for id, o := range pending {
+			if o.amount == result.Amount {
+				result.Candidates = append(result.Candidates, id)
+			}
+		}
+		sort.Ints(result.Candidates)
+		return
+	}
+
+	var matches []int
+	for _, id := range refs {
+		if o, ok := pending[id]; ok && o.amount == result.Amount {
+			matches = append(matches, id)
+		}
+	}
+	switch {
+	case len(matches) > 1:
+		result.Status = LineAmbiguous
+		result.Candidates = matches
+		result.Reason = "Nội dung chuyển khoản khớp với nhiều đơn hàng"
+		return
+	case len(matches) == 0:
+		result.Status = LineUnmatched
+		result.Candidates = refs
+		if len(refs) == 1 {
+			if o, ok := pending[refs[0]]; ok {
+				result.Reason = fmt.Sprintf("Số tiền không khớp (đơn #%d cần %d)", o.id, o.amount)
+			} else {
+				result.Reason = fmt.Sprintf("Đơn #%d không tồn tại hoặc không chờ thanh toán", refs[0])
+			}
+		} else {
+			result.Reason = "Không có đơn chờ thanh toán nào khớp mã và số tiền"
+		}
+		return
+	}
+
+	orderID := matches[0]
+	if row, ok := claimed[orderID]; ok {
+		result.Status = LineAmbiguous
+		result.Candidates = matches
+		result.Reason = fmt.Sprintf("Đơn #%d đã khớp với dòng %d trong cùng sao kê", orderID, row)
+		return
+	}
+	claimed[orderID] = result.Row
+	result.Status = LineMatched
+	result.OrderID = &orderID
+}
+
+func processedKeys(ctx context.Context, db *sql.DB, lines []StatementLine) (map[string]bool, error) {
+	keys := make([]string, len(lines))
+	for i, l := range lines {
+		keys[i] = l.Key()
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT external_order_id FROM payment_transactions
+		WHERE provider = 'bank_transfer' AND external_order_id = ANY($1)
+	`, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	processed := map[string]bool{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		processed[key] = true
+	}
+	return processed, rows.Err()
+}
+
+func pendingOrders(ctx context.Context, db *sql.DB) (map[int]pendingOrder, error) {
+	// Chỉ đơn chọn chuyển khoản: tiền chuyển nhầm nội dung trùng mã đơn COD/cổng không được ghi nhận
+	rows, err := db.QueryContext(ctx, "SELECT id, total_amount FROM orders WHERE status = $1 AND payment_method = $2",
+		string(orderstatus.Pending), payment.MethodBankTransfer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := map[int]pendingOrder{}
+	for rows.Next() {
+		var o pendingOrder
+		if err := rows.Scan(&o.id, &o.amount); err != nil {
+			return nil, err
+		}
+		pending[o.id] = o
+	}
+	return pending, rows.Err()
+}
+
+// applyLine ghi dòng sao kê và chuyển đơn sang paid. Đơn không chuyển được sang paid thì dòng vẫn
+// được ghi (outcome ignored) nhưng payment_status giữ nguyên. Trả về outcome rỗng nếu dòng đã được
+// xử lý (import song song).
+func applyLine(ctx context.Context, db *sql.DB, line StatementLine, orderID int, actor orderstatus.Actor, now time.Time) (string, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var txnID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO payment_transactions (provider, external_order_id, provider_transaction_id, order_id, amount, result_code, message)
+		VALUES ('bank_transfer', $1, $2, $3, $4, '0', $5)
+		ON CONFLICT (provider, external_order_id) DO NOTHING
+		RETURNING id
+	`, line.Key(), line.Reference, orderID, line.Amount, line.Description).Scan(&txnID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	outcome := payment.OutcomeApplied
+	reason := fmt.Sprintf("Đối soát sao kê ngân hàng (dòng %d, %s)", line.Row, line.Date)
+	_, err = orderstatus.Transition(ctx, tx, orderID, orderstatus.Paid, actor, reason, now)
+	var te *orderstatus.TransitionError
+	if errors.As(err, &te) {
+		// Đơn vừa bị hủy/xử lý trong lúc import; để lại cho người đối soát
+		outcome = payment.OutcomeIgnored
+	} else if err != nil {
+		return "", err
+	} else if err := payment.SetOrderPaymentStatus(ctx, tx, orderID, payment.PaymentPaid); err != nil {
+		return "", err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE payment_transactions SET outcome = $1 WHERE id = $2", outcome, txnID); err != nil {
+		return "", err
+	}
+	return outcome, tx.Commit()
+}
@@ -0,0 +1,136 @@
+package banktransfer
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+	"backend/internal/orderstatus"
+	"backend/internal/payment"
+)
+
+var testNow = time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+func TestParseMemo(t *testing.T) {
+	cases := map[string][]int{
+		"CK DH12 thanh toan":        {12},
+		"MBVCB.123.DH-45.CT":        {45},
+		"dh 7 va DH7, DH 8":         {7, 8},
+		"NGUYEN VAN A chuyen tien":  nil,
+		"SDH12 khong phai ma don":   nil,
+		"Thanh toan don DH_0 va DH": nil,
+	}
+	for memo, want := range cases {
+		if got := ParseMemo(memo); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseMemo(%q) = %v, muốn %v", memo, got, want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	pending := map[int]pendingOrder{
+		12: {12, 150000},
+		13: {13, 150000},
+		14: {14, 90000},
+	}
+	cases := []struct {
+		name       string
+		memo       string
+		amount     int64
+		status     string
+		orderID    int
+		candidates []int
+	}{
+		{"khớp mã và số tiền", "CK DH14", 90000, LineMatched, 14, nil},
+		{"sai số tiền", "CK DH14", 100000, LineUnmatched, 0, []int{14}},
+		{"đơn không chờ thanh toán", "CK DH99", 150000, LineUnmatched, 0, []int{99}},
+		{"không có mã, gợi ý theo số tiền", "chuyen tien an", 150000, LineUnmatched, 0, []int{12, 13}},
+		{"nhắc tới nhiều đơn cùng số tiền", "DH12 DH13", 150000, LineAmbiguous, 0, []int{12, 13}},
+	}
+	for _, c := range cases {
+		result := LineResult{StatementLine: StatementLine{Row: 2, Description: c.memo, Amount: c.amount}}
+		match(&result, pending, map[int]int{})
+		if result.Status != c.status || !reflect.DeepEqual(result.Candidates, c.candidates) {
+			t.Errorf("%s: %s %v, muốn %s %v", c.name, result.Status, result.Candidates, c.status, c.candidates)
+		}
+		if c.orderID != 0 && (result.OrderID == nil || *result.OrderID != c.orderID) {
+			t.Errorf("%s: OrderID = %v, muốn %d", c.name, result.OrderID, c.orderID)
+		}
+	}
+}
+
+func TestMatchClaimsOrderOnce(t *testing.T) {
+	pending := map[int]pendingOrder{12: {12, 150000}}
+	claimed := map[int]int{}
+	first := LineResult{StatementLine: StatementLine{Row: 2, Description: "DH12", Amount: 150000}}
+	second := LineResult{StatementLine: StatementLine{Row: 5, Description: "DH12 lan 2", Amount: 150000}}
+	match(&first, pending, claimed)
+	match(&second, pending, claimed)
+	if first.Status != LineMatched || second.Status != LineAmbiguous {
+		t.Errorf("dòng đầu %s, dòng sau %s; muốn matched rồi ambiguous", first.Status, second.Status)
+	}
+}
+
+func reconcileFixture(orderStatus string) (*dbtest.DB, *sql.DB) {
+	fake, db := dbtest.New()
+	fake.On("FROM orders WHERE status = $1 AND payment_method", dbtest.Rows([]driver.Value{int64(12), int64(150000)}))
+	fake.On("INSERT INTO payment_transactions", dbtest.Rows([]driver.Value{int64(3)}))
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{orderStatus}))
+	fake.On("FROM gift_cards WHERE order_id", dbtest.Rows([]driver.Value{false, payment.MethodBankTransfer}))
+	return fake, db
+}
+
+func TestReconcileMarksMatchedOrderPaid(t *testing.T) {
+	fake, db := reconcileFixture(string(orderstatus.Pending))
+	line := StatementLine{Row: 2, Date: "10/03/2025", Description: "CK DH12", Amount: 150000, Reference: "FT001"}
+
+	report, err := Reconcile(context.Background(), db, []StatementLine{line}, orderstatus.Staff(3), testNow, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Matched != 1 || report.Lines[0].Status != LineMatched {
+		t.Fatalf("report = %+v, muốn khớp 1 dòng", report)
+	}
+	if st := fake.Calls("UPDATE orders SET payment_status"); len(st) != 1 || st[0].Args[0] != payment.PaymentPaid {
+		t.Errorf("payment_status = %+v, muốn paid", st)
+	}
+	if out := fake.Calls("SET outcome"); len(out) != 1 || out[0].Args[0] != payment.OutcomeApplied {
+		t.Errorf("outcome = %+v, muốn applied", out)
+	}
+}
+
+func TestReconcileOrderChangedDuringImportNeedsReview(t *testing.T) {
+	fake, db := reconcileFixture(string(orderstatus.Cancelled))
+	line := StatementLine{Row: 2, Date: "10/03/2025", Description: "CK DH12", Amount: 150000, Reference: "FT001"}
+
+	report, err := Reconcile(context.Background(), db, []StatementLine{line}, orderstatus.Staff(3), testNow, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NeedsReview != 1 || report.Matched != 0 || report.Lines[0].Status != LineNeedsReview {
+		t.Fatalf("report = %+v, muốn 1 dòng cần kiểm tra", report)
+	}
+	if len(fake.Calls("UPDATE orders SET payment_status")) != 0 {
+		t.Error("đơn đã hủy không được đánh dấu đã thanh toán")
+	}
+	if out := fake.Calls("SET outcome"); len(out) != 1 || out[0].Args[0] != payment.OutcomeIgnored {
+		t.Errorf("outcome = %+v, muốn ignored", out)
+	}
+}
+
+func TestReconcileDryRunWritesNothing(t *testing.T) {
+	fake, db := reconcileFixture(string(orderstatus.Pending))
+	line := StatementLine{Row: 2, Description: "CK DH12", Amount: 150000, Reference: "FT001"}
+
+	report, err := Reconcile(context.Background(), db, []StatementLine{line}, orderstatus.Staff(3), testNow, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Matched != 1 || len(fake.Calls("INSERT")) != 0 || len(fake.Calls("UPDATE")) != 0 {
+		t.Errorf("dry run chỉ báo cáo, report = %+v", report)
+	}
+}
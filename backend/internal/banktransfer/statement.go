@@ -0,0 +1,248 @@
+package banktransfer
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ColumnMapping cho biết tên cột (theo dòng tiêu đề) của từng trường trong file sao kê CSV.
+// Mỗi ngân hàng xuất sao kê một kiểu nên mapping được truyền khi import.
+type ColumnMapping struct {
+	Date        string `json:"date"`
+	Description string `json:"description"`
+	// Credit là cột tiền vào. Nếu sao kê chỉ có một cột số tiền (âm là tiền ra) thì để Credit
+	// trống và dùng Amount.
+	Credit string `json:"credit"`
+	Amount string `json:"amount"`
+	// Reference là mã giao dịch của ngân hàng, dùng để không xử lý một dòng hai lần.
+	Reference string `json:"reference"`
+	// Delimiter mặc định là dấu phẩy.
+	Delimiter string `json:"delimiter"`
+	// SkipRows là số dòng bỏ qua trước dòng tiêu đề (tên ngân hàng, kỳ sao kê...).
+	SkipRows int `json:"skip_rows"`
+}
+
+// DefaultMapping khớp với file CSV xuất từ internet banking Techcombank.
+var DefaultMapping = ColumnMapping{
+	Date:        "Ngày giao dịch",
+	Description: "Diễn giải",
+	Credit:      "Ghi có",
+	Reference:   "Số tham chiếu",
+}
+
+// MappingFromEnv đọc mapping dạng JSON từ BANK_STATEMENT_MAPPING, mặc định là DefaultMapping.
+func MappingFromEnv() (ColumnMapping, error) {
+	raw := os.Getenv("BANK_STATEMENT_MAPPING")
+	if raw == "" {
+		return DefaultMapping, nil
+	}
+	return ParseMapping(raw)
+}
+
+// ParseMapping đọc mapping dạng JSON; các trường bỏ trống lấy theo DefaultMapping.
+func ParseMapping(raw string) (ColumnMapping, error) {
+	m := ColumnMapping{}
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		return m, fmt.Errorf("mapping không hợp lệ: %w", err)
+	}
+	if m.Date == "" {
+		m.Date = DefaultMapping.Date
+	}
+	if m.Description == "" {
+		m.Description = DefaultMapping.Description
+	}
+	if m.Credit == "" && m.Amount == "" {
+		m.Credit = DefaultMapping.Credit
+	}
+	return m, nil
+}
+
+// StatementLine là một dòng tiền vào trong sao kê.
+type StatementLine struct {
+	// Row là số dòng trong file (tính từ 1) để người đối soát tra lại.
+	Row         int    `json:"row"`
+	Date        string `json:"date"`
+	Description string `json:"description"`
+	Amount      int64  `json:"amount"`
+	Reference   string `json:"reference,omitempty"`
+	// Occurrence là thứ tự (từ 1) của dòng trong các dòng không có mã tham chiếu trùng ngày, số
+	// tiền và diễn giải trong cùng file, để hai giao dịch giống hệt nhau không bị coi là một.
+	Occurrence int `json:"-"`
+}
+
+// Key là khóa duy nhất của dòng sao kê: mã tham chiếu của ngân hàng nếu có, nếu không thì
+// băm ngày, số tiền, diễn giải và thứ tự xuất hiện của dòng giống hệt.
+func (l StatementLine) Key() string {
+	if l.Reference != "" {
+		return "BANK_" + l.Reference
+	}
+	text := fmt.Sprintf("%s|%d|%s", l.Date, l.Amount, l.Description)
+	if l.Occurrence > 1 {
+		text += fmt.Sprintf("|%d", l.Occurrence)
+	}
+	sum := sha1.Sum([]byte(text))
+	return "BANK_" + hex.EncodeToString(sum[:])
+}
+
+// ParseStatement đọc file CSV và trả về các dòng tiền vào (số tiền > 0).
+func ParseStatement(r io.Reader, m ColumnMapping) ([]StatementLine, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if m.Delimiter != "" {
+		reader.Comma = []rune(m.Delimiter)[0]
+	}
+
+	row := 0
+	next := func() ([]string, error) {
+		row++
+		return reader.Read()
+	}
+	for i := 0; i < m.SkipRows; i++ {
+		if _, err := next(); err != nil {
+			return nil, fmt.Errorf("dòng %d: %w", row, err)
+		}
+	}
+
+	header, err := next()
+	if err != nil {
+		return nil, fmt.Errorf("không đọc được dòng tiêu đề: %w", err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		// Bỏ BOM UTF-8 mà Excel hay thêm vào đầu file
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		index[strings.ToLower(name)] = i
+	}
+	column := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := index[strings.ToLower(name)]
+		if !ok {
+			return -1, fmt.Errorf("không tìm thấy cột %q trong sao kê", name)
+		}
+		return i, nil
+	}
+
+	dateCol, err := column(m.Date)
+	if err != nil {
+		return nil, err
+	}
+	descCol, err := column(m.Description)
+	if err != nil {
+		return nil, err
+	}
+	amountName := m.Credit
+	if amountName == "" {
+		amountName = m.Amount
+	}
+	amountCol, err := column(amountName)
+	if err != nil {
+		return nil, err
+	}
+	if amountCol < 0 || descCol < 0 {
+		return nil, fmt.Errorf("mapping phải có cột diễn giải và số tiền")
+	}
+	refCol, err := column(m.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []StatementLine
+	occurrences := map[string]int{}
+	for {
+		record, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dòng %d: %w", row, err)
+		}
+		cell := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		rawAmount := cell(amountCol)
+		if rawAmount == "" {
+			continue
+		}
+		amount, err := ParseAmount(rawAmount)
+		if err != nil {
+			return nil, fmt.Errorf("dòng %d: %w", row, err)
+		}
+		if amount <= 0 {
+			// Tiền ra không liên quan tới đối soát đơn hàng
+			continue
+		}
+		line := StatementLine{
+			Row:         row,
+			Date:        cell(dateCol),
+			Description: cell(descCol),
+			Amount:      amount,
+			Reference:   cell(refCol),
+		}
+		if line.Reference == "" {
+			same := fmt.Sprintf("%s|%d|%s", line.Date, line.Amount, line.Description)
+			occurrences[same]++
+			line.Occurrence = occurrences[same]
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// ParseAmount đọc số tiền VND dạng "1.500.000", "1,500,000", "1500000.00" hoặc "+150,000 VND".
+// Dấu phân cách cuối cùng theo sau bởi 1-2 chữ số là dấu thập phân; phần lẻ được làm tròn tới đồng.
+func ParseAmount(s string) (int64, error) {
+	raw := s
+	negative := strings.HasPrefix(strings.TrimSpace(s), "-")
+	var digits strings.Builder
+	lastSep, digitsAfterSep := -1, 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+			if lastSep >= 0 {
+				digitsAfterSep++
+			}
+		case r == '.' || r == ',':
+			lastSep = digits.Len()
+			digitsAfterSep = 0
+		}
+	}
+	value := digits.String()
+	if value == "" {
+		return 0, fmt.Errorf("số tiền không hợp lệ: %q", raw)
+	}
+	// Phần thập phân (",00" / ".5") không có nghĩa với VND
+	roundUp := false
+	if lastSep >= 0 && (digitsAfterSep == 1 || digitsAfterSep == 2) {
+		roundUp = value[lastSep] >= '5'
+		value = value[:lastSep]
+	}
+	if value == "" {
+		value = "0"
+	}
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("số tiền không hợp lệ: %q", raw)
+	}
+	if roundUp {
+		amount++
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
@@ -0,0 +1,109 @@
+package banktransfer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int64
+	}{
+		{"1.500.000", 1500000},
+		{"1,500,000", 1500000},
+		{"1,500,000.00", 1500000},
+		{"1.500.000,00", 1500000},
+		{"1500000", 1500000},
+		{"+150,000 VND", 150000},
+		{"150.5", 151},
+		{"150.4", 150},
+		{"-200.000", -200000},
+	}
+	for _, c := range cases {
+		got, err := ParseAmount(c.in)
+		if err != nil || got != c.want {
+			t.Errorf("ParseAmount(%q) = %d, %v; muốn %d", c.in, got, err, c.want)
+		}
+	}
+	if _, err := ParseAmount("N/A"); err == nil {
+		t.Error("ParseAmount(\"N/A\") phải báo lỗi")
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	cases := []struct {
+		name    string
+		mapping ColumnMapping
+		csv     string
+		want    []StatementLine
+	}{
+		{
+			name:    "mapping mặc định, bỏ dòng tiền ra và dòng trống",
+			mapping: DefaultMapping,
+			csv: "\ufeffNgày giao dịch,Diễn giải,Ghi nợ,Ghi có,Số tham chiếu\n" +
+				"10/03/2025,CK DH12 thanh toan,,\"150,000\",FT001\n" +
+				"10/03/2025,Phi SMS,\"11,000\",,FT002\n" +
+				"11/03/2025,CK DH13,,\"1.500.000\",FT003\n",
+			want: []StatementLine{
+				{Row: 2, Date: "10/03/2025", Description: "CK DH12 thanh toan", Amount: 150000, Reference: "FT001"},
+				{Row: 4, Date: "11/03/2025", Description: "CK DH13", Amount: 1500000, Reference: "FT003"},
+			},
+		},
+		{
+			name:    "một cột số tiền có dấu, dấu chấm phẩy, bỏ dòng đầu",
+			mapping: ColumnMapping{Date: "Ngay", Description: "Noi dung", Amount: "So tien", Delimiter: ";", SkipRows: 1},
+			csv: "Sao ke thang 3\n" +
+				"Ngay;Noi dung;So tien\n" +
+				"10/03/2025;DH12;+150.000\n" +
+				"10/03/2025;Rut tien;-500.000\n",
+			want: []StatementLine{
+				{Row: 3, Date: "10/03/2025", Description: "DH12", Amount: 150000, Occurrence: 1},
+			},
+		},
+	}
+	for _, c := range cases {
+		got, err := ParseStatement(strings.NewReader(c.csv), c.mapping)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(got) != len(c.want) {
+			t.Fatalf("%s: %d dòng %+v, muốn %d", c.name, len(got), got, len(c.want))
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%s: dòng %d = %+v, muốn %+v", c.name, i, got[i], c.want[i])
+			}
+		}
+	}
+}
+
+func TestParseStatementMissingColumn(t *testing.T) {
+	_, err := ParseStatement(strings.NewReader("Ngày,Nội dung\n"), DefaultMapping)
+	if err == nil || !strings.Contains(err.Error(), "Ngày giao dịch") {
+		t.Fatalf("err = %v, muốn báo thiếu cột", err)
+	}
+}
+
+func TestStatementLineKeyKeepsIdenticalTransfers(t *testing.T) {
+	csv := "Ngay,Noi dung,So tien\n" +
+		"10/03/2025,Ung ho,50000\n" +
+		"10/03/2025,Ung ho,50000\n"
+	lines, err := ParseStatement(strings.NewReader(csv), ColumnMapping{Date: "Ngay", Description: "Noi dung", Amount: "So tien"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0].Key() == lines[1].Key() {
+		t.Fatalf("hai giao dịch giống hệt nhau phải có khóa khác nhau: %+v", lines)
+	}
+	// Khóa của lần xuất hiện đầu không đổi, nên sao kê đã import trước đây không bị xử lý lại
+	first := lines[0]
+	first.Occurrence = 0
+	if first.Key() != lines[0].Key() {
+		t.Error("khóa của dòng đầu tiên phải giữ nguyên")
+	}
+	// Có mã tham chiếu thì dùng mã tham chiếu
+	if key := (StatementLine{Reference: "FT001", Occurrence: 2}).Key(); key != "BANK_FT001" {
+		t.Errorf("Key = %q, muốn BANK_FT001", key)
+	}
+}
@@ -0,0 +1,268 @@
+// Package campaign chạy các chiến dịch tự động tặng voucher: theo lịch (next_run_at), chọn người
+// dùng thuộc nhóm của chiến dịch, cấp user_vouchers và gửi email báo. Mỗi lần tặng được ghi vào
+// voucher_campaign_deliveries để một người không bao giờ nhận cùng một chiến dịch hai lần.
+package campaign
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/utils"
+)
+
+// Các nhóm người dùng.
+const (
+	SegmentInactive      = "inactive"
+	SegmentBirthdayMonth = "birthday_month"
+)
+
+// SourceCampaign là user_vouchers.source của voucher tặng theo chiến dịch.
+const SourceCampaign = "campaign"
+
+// ErrNotFound: chiến dịch không tồn tại.
+var ErrNotFound = errors.New("campaign not found")
+
+// Runner chạy các chiến dịch đến hạn.
+type Runner struct {
+	db  *sql.DB
+	now func() time.Time
+	// send gửi email báo voucher; thay được khi chạy thử.
+	send func(toEmail, subject, message, voucherCode string, expiresAt time.Time) error
+}
+
+func NewRunner(db *sql.DB, now func() time.Time) *Runner {
+	if now == nil {
+		now = time.Now
+	}
+	return &Runner{db: db, now: now, send: utils.SendCampaignEmail}
+}
+
+// grant là một voucher vừa được cấp, chờ gửi email.
+type grant struct {
+	deliveryID int64
+	email      string
+}
+
+// segmentQuery trả về câu SELECT id, email của người dùng thuộc nhóm và chưa nhận chiến dịch $1;
+// $2 là thời điểm chạy.
+func segmentQuery(segment string, inactiveDays int) (string, []interface{}, error) {
+	base := `
+		SELECT u.id, u.email FROM users u
+		WHERE NOT EXISTS (SELECT 1 FROM voucher_campaign_deliveries d WHERE d.campaign_id = $1 AND d.user_id = u.id)`
+	switch segment {
+	case SegmentInactive:
+		// Tài khoản đã tạo đủ lâu và không có đơn nào trong inactiveDays ngày
+		return base + `
+		AND u.created_at <= $2::timestamptz - make_interval(days => $3)
+		AND NOT EXISTS (
+			SELECT 1 FROM orders o WHERE o.user_id = u.id AND o.created_at > $2::timestamptz - make_interval(days => $3)
+		)
+		ORDER BY u.id`, []interface{}{inactiveDays}, nil
+	case SegmentBirthdayMonth:
+		return base + `
+		AND u.birthday IS NOT NULL
+		AND EXTRACT(MONTH FROM u.birthday) = EXTRACT(MONTH FROM $2::timestamptz AT TIME ZONE 'Asia/Ho_Chi_Minh')
+		ORDER BY u.id`, nil, nil
+	}
+	return "", nil, fmt.Errorf("unknown segment %q", segment)
+}
+
+// Run chạy ngay chiến dịch campaignID (kể cả khi chưa đến lịch): cấp voucher cho người dùng thuộc
+// nhóm chưa từng nhận, dời next_run_at và gửi email báo.
+func (r *Runner) Run(ctx context.Context, campaignID int) (models.CampaignRunResult, error) {
+	var result models.CampaignRunResult
+	now := r.now()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	var c models.VoucherCampaign
+	var validDays int
+	err = tx.QueryRowContext(ctx, `
+		SELECT c.voucher_id, v.code, v.valid_duration_days, c.segment, c.inactive_days, c.interval_hours,
+		       c.email_subject, c.email_message
+		FROM voucher_campaigns c
+		JOIN vouchers v ON v.id = c.voucher_id
+		WHERE c.id = $1
+		FOR UPDATE OF c
+	`, campaignID).Scan(&c.VoucherID, &c.VoucherCode, &validDays, &c.Segment, &c.InactiveDays, &c.IntervalHours,
+		&c.EmailSubject, &c.EmailMessage)
+	if err == sql.ErrNoRows {
+		return result, ErrNotFound
+	}
+	if err != nil {
+		return result, err
+	}
+
+	query, extra, err := segmentQuery(c.Segment, c.InactiveDays)
+	if err != nil {
+		return result, err
+	}
+	rows, err := tx.QueryContext(ctx, query, append([]interface{}{campaignID, now}, extra...)...)
+	if err != nil {
+		return result, fmt.Errorf("select segment: %w", err)
+	}
+	type recipient struct {
+		userID int
+		email  string
+	}
+	var recipients []recipient
+	for rows.Next() {
+		var rc recipient
+		if err := rows.Scan(&rc.userID, &rc.email); err != nil {
+			rows.Close()
+			return result, err
+		}
+		recipients = append(recipients, rc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	expiresAt := now.AddDate(0, 0, validDays)
+	var grants []grant
+	for _, rc := range recipients {
+		var deliveryID int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO voucher_campaign_deliveries (campaign_id, user_id) VALUES ($1, $2)
+			ON CONFLICT (campaign_id, user_id) DO NOTHING
+			RETURNING id
+		`, campaignID, rc.userID).Scan(&deliveryID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("record delivery: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			WITH uv AS (
+				INSERT INTO user_vouchers (user_id, voucher_id, expires_at, source) VALUES ($1, $2, $3, $4) RETURNING id
+			)
+			UPDATE voucher_campaign_deliveries SET user_voucher_id = (SELECT id FROM uv) WHERE id = $5
+		`, rc.userID, c.VoucherID, expiresAt, SourceCampaign, deliveryID)
+		if err != nil {
+			return result, fmt.Errorf("grant voucher: %w", err)
+		}
+		grants = append(grants, grant{deliveryID: deliveryID, email: rc.email})
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE voucher_campaigns
+		SET last_run_at = $2, next_run_at = $2::timestamptz + make_interval(hours => interval_hours)
+		WHERE id = $1
+	`, campaignID, now)
+	if err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+	result.Granted = len(grants)
+
+	// Email gửi sau khi commit: voucher đã nằm trong ví dù email lỗi; lỗi được ghi lại để xem
+	for _, g := range grants {
+		if err := r.send(g.email, c.EmailSubject, c.EmailMessage, c.VoucherCode, expiresAt); err != nil {
+			result.EmailFailed++
+			_, _ = r.db.ExecContext(ctx, "UPDATE voucher_campaign_deliveries SET email_error = $2 WHERE id = $1", g.deliveryID, err.Error())
+			continue
+		}
+		result.Emailed++
+		_, _ = r.db.ExecContext(ctx, "UPDATE voucher_campaign_deliveries SET email_sent_at = $2 WHERE id = $1", g.deliveryID, r.now())
+	}
+	return result, nil
+}
+
+// RunDue chạy các chiến dịch đang bật đã đến lịch.
+func (r *Runner) RunDue(ctx context.Context) (int, error) {
+	now := r.now()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id FROM voucher_campaigns
+		WHERE is_active AND next_run_at <= $1 AND starts_at <= $1 AND (ends_at IS NULL OR ends_at > $1)
+		ORDER BY next_run_at
+	`, now)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	granted := 0
+	for _, id := range ids {
+		res, err := r.Run(ctx, id)
+		if err != nil {
+			log.Printf("ERROR running voucher campaign %d: %v", id, err)
+			continue
+		}
+		granted += res.Granted
+		if res.EmailFailed > 0 {
+			log.Printf("WARNING voucher campaign %d: %d emails failed", id, res.EmailFailed)
+		}
+	}
+	return granted, nil
+}
+
+// RunScheduler chạy RunDue định kỳ cho tới khi ctx bị hủy.
+func (r *Runner) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := r.RunDue(ctx); err != nil {
+			log.Printf("ERROR running voucher campaigns: %v", err)
+		} else if n > 0 {
+			log.Printf("Voucher campaigns granted %d vouchers", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Validate kiểm tra dữ liệu chiến dịch; trả về thông báo lỗi (rỗng nếu hợp lệ).
+func Validate(c models.VoucherCampaign) string {
+	if strings.TrimSpace(c.Name) == "" {
+		return "Tên chiến dịch không được để trống"
+	}
+	if c.VoucherID <= 0 {
+		return "Chưa chọn voucher cho chiến dịch"
+	}
+	if c.Segment != SegmentInactive && c.Segment != SegmentBirthdayMonth {
+		return "Nhóm người dùng không hợp lệ"
+	}
+	if c.Segment == SegmentInactive && c.InactiveDays <= 0 {
+		return "Số ngày không hoạt động phải lớn hơn 0"
+	}
+	if c.IntervalHours <= 0 {
+		return "Chu kỳ chạy phải lớn hơn 0 giờ"
+	}
+	if strings.TrimSpace(c.EmailSubject) == "" {
+		return "Tiêu đề email không được để trống"
+	}
+	if c.EndsAt != nil && !c.EndsAt.After(c.StartsAt) {
+		return "Thời gian kết thúc phải sau thời gian bắt đầu"
+	}
+	return ""
+}
@@ -0,0 +1,163 @@
+package campaign
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+)
+
+var testNow = time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+type sentEmail struct {
+	to        string
+	code      string
+	expiresAt time.Time
+}
+
+// runnerFixture là chiến dịch tặng VIP10 (hạn 30 ngày) cho người dùng không hoạt động 60 ngày;
+// nhóm gồm người dùng 7 và 8, trong đó người dùng 8 đã nhận chiến dịch (ON CONFLICT không trả id).
+func runnerFixture(segment string) (*dbtest.DB, *Runner, *[]sentEmail) {
+	fake, db := dbtest.New()
+	fake.On("FROM voucher_campaigns c", dbtest.Rows([]driver.Value{
+		int64(4), "VIP10", int64(30), segment, int64(60), int64(24), "Quà cho bạn", "Tặng bạn voucher",
+	}))
+	fake.On("SELECT u.id, u.email FROM users u", dbtest.Rows(
+		[]driver.Value{int64(7), "lan@example.com"},
+		[]driver.Value{int64(8), "minh@example.com"},
+	))
+	fake.On("INSERT INTO voucher_campaign_deliveries", func(args []driver.Value) ([][]driver.Value, error) {
+		if args[1] == int64(8) {
+			return nil, nil
+		}
+		return [][]driver.Value{{int64(100) + args[1].(int64)}}, nil
+	})
+
+	var sent []sentEmail
+	r := NewRunner(db, func() time.Time { return testNow })
+	r.send = func(to, subject, message, code string, expiresAt time.Time) error {
+		sent = append(sent, sentEmail{to, code, expiresAt})
+		return nil
+	}
+	return fake, r, &sent
+}
+
+func TestRunGrantsSegmentOnce(t *testing.T) {
+	fake, r, sent := runnerFixture(SegmentInactive)
+
+	result, err := r.Run(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Granted != 1 || result.Emailed != 1 || result.EmailFailed != 0 {
+		t.Errorf("result = %+v, muốn cấp và gửi email cho một người", result)
+	}
+
+	segment := fake.Calls("SELECT u.id, u.email FROM users u")
+	if len(segment) != 1 || !strings.Contains(segment[0].Query, "voucher_campaign_deliveries d") {
+		t.Fatalf("phải loại người đã nhận chiến dịch khi chọn nhóm, có %+v", segment)
+	}
+	if args := segment[0].Args; len(args) != 3 || args[0] != int64(3) || args[1] != testNow || args[2] != int64(60) {
+		t.Errorf("tham số chọn nhóm = %+v, muốn (3, now, 60)", args)
+	}
+
+	grants := fake.Calls("INSERT INTO user_vouchers")
+	expiresAt := testNow.AddDate(0, 0, 30)
+	if len(grants) != 1 || grants[0].Args[0] != int64(7) || grants[0].Args[2] != expiresAt || grants[0].Args[4] != int64(107) {
+		t.Fatalf("chỉ người dùng 7 được cấp voucher, có %+v", grants)
+	}
+	if len(*sent) != 1 || (*sent)[0] != (sentEmail{"lan@example.com", "VIP10", expiresAt}) {
+		t.Errorf("email = %+v", *sent)
+	}
+	if calls := fake.Calls("SET email_sent_at"); len(calls) != 1 || calls[0].Args[0] != int64(107) || calls[0].Args[1] != testNow {
+		t.Errorf("email_sent_at phải là giờ của runner, có %+v", calls)
+	}
+}
+
+func TestRunAdvancesNextRun(t *testing.T) {
+	fake, r, _ := runnerFixture(SegmentInactive)
+
+	if _, err := r.Run(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.Calls("UPDATE voucher_campaigns")
+	if len(calls) != 1 || !strings.Contains(calls[0].Query, "next_run_at = $2::timestamptz + make_interval(hours => interval_hours)") {
+		t.Fatalf("phải dời next_run_at theo chu kỳ, có %+v", calls)
+	}
+	if calls[0].Args[0] != int64(3) || calls[0].Args[1] != testNow {
+		t.Errorf("tham số = %+v, muốn (3, now)", calls[0].Args)
+	}
+	if fake.Commits != 1 {
+		t.Errorf("commits = %d, muốn 1", fake.Commits)
+	}
+}
+
+func TestRunBirthdaySegmentUsesRunTime(t *testing.T) {
+	fake, r, _ := runnerFixture(SegmentBirthdayMonth)
+
+	if _, err := r.Run(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+	segment := fake.Calls("SELECT u.id, u.email FROM users u")
+	if len(segment) != 1 || !strings.Contains(segment[0].Query, "EXTRACT(MONTH FROM u.birthday)") {
+		t.Fatalf("phải chọn theo tháng sinh, có %+v", segment)
+	}
+	if args := segment[0].Args; len(args) != 2 || args[1] != testNow {
+		t.Errorf("tham số chọn nhóm = %+v, muốn (3, now)", args)
+	}
+}
+
+func TestRunRecordsEmailFailure(t *testing.T) {
+	fake, r, _ := runnerFixture(SegmentInactive)
+	r.send = func(string, string, string, string, time.Time) error {
+		return errors.New("smtp: 550 mailbox unavailable")
+	}
+
+	result, err := r.Run(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Granted != 1 || result.Emailed != 0 || result.EmailFailed != 1 {
+		t.Errorf("result = %+v, voucher vẫn phải được cấp khi email lỗi", result)
+	}
+	calls := fake.Calls("SET email_error")
+	if len(calls) != 1 || calls[0].Args[0] != int64(107) || calls[0].Args[1] != "smtp: 550 mailbox unavailable" {
+		t.Errorf("phải ghi lỗi email vào dòng tặng, có %+v", calls)
+	}
+	if len(fake.Calls("SET email_sent_at")) != 0 {
+		t.Error("không được ghi email_sent_at khi gửi lỗi")
+	}
+}
+
+func TestRunUnknownCampaign(t *testing.T) {
+	_, db := dbtest.New()
+	r := NewRunner(db, func() time.Time { return testNow })
+
+	if _, err := r.Run(context.Background(), 3); err != ErrNotFound {
+		t.Fatalf("err = %v, muốn ErrNotFound", err)
+	}
+}
+
+func TestRunDueRunsScheduledCampaigns(t *testing.T) {
+	fake, r, _ := runnerFixture(SegmentInactive)
+	fake.On("WHERE is_active AND next_run_at <= $1", dbtest.Rows([]driver.Value{int64(3)}, []driver.Value{int64(5)}))
+
+	granted, err := r.RunDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due := fake.Calls("WHERE is_active AND next_run_at <= $1"); len(due) != 1 || due[0].Args[0] != testNow {
+		t.Fatalf("phải chọn chiến dịch đến hạn tại now, có %+v", due)
+	}
+	if granted != 2 {
+		t.Errorf("granted = %d, muốn 2", granted)
+	}
+	runs := fake.Calls("UPDATE voucher_campaigns")
+	if len(runs) != 2 || runs[0].Args[0] != int64(3) || runs[1].Args[0] != int64(5) {
+		t.Errorf("phải chạy chiến dịch 3 và 5, có %+v", runs)
+	}
+}
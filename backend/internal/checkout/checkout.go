@@ -0,0 +1,761 @@
+// Package checkout gom toàn bộ logic đặt hàng: tính giá, kiểm tra tồn kho, áp voucher,
+// ghi orders/order_items và dọn giỏ hàng. Các phương thức thanh toán cắm vào qua PaymentMethod.
+package checkout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/inventory"
+	"backend/internal/loyalty"
+	"backend/internal/models"
+	"backend/internal/orderstatus"
+	"backend/internal/payment"
+	"backend/internal/promotion"
+	"backend/internal/wallet"
+
+	"github.com/lib/pq"
+)
+
+// Error là lỗi do dữ liệu đặt hàng không hợp lệ; Message có thể hiển thị thẳng cho người dùng.
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func invalid(format string, args ...interface{}) error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}
+
+// Voucher là voucher người dùng muốn áp dụng (user_vouchers JOIN vouchers).
+type Voucher struct {
+	UserVoucherID int
+	VoucherID     int
+	DiscountType  string
+	DiscountValue int64
+	IsUsed        bool
+	ExpiresAt     time.Time
+	// ProductIDs và CategoryIDs giới hạn các món được giảm; cả hai rỗng là áp dụng cho cả giỏ.
+	ProductIDs    []int
+	CategoryIDs   []int
+	MinOrderValue int64
+	// MaxDiscount là mức giảm tối đa của voucher phần trăm, 0 là không giới hạn.
+	MaxDiscount int64
+	// UsageLimit là tổng số lượt dùng, 0 là không giới hạn.
+	UsageLimit int
+	UsedCount  int
+	// Code, StartsAt, PerUserLimit và UserRedemptions chỉ dùng cho mã khuyến mãi công khai
+	// (UserVoucherID = 0). ExpiresAt rỗng là không hết hạn.
+	Code            string
+	StartsAt        time.Time
+	PerUserLimit    int
+	UserRedemptions int
+}
+
+// Order là đơn hàng vừa được tạo trong transaction.
+type Order struct {
+	ID     int
+	UserID *int
+	Status orderstatus.Status
+	Method string
+	Quote  models.CheckoutQuote
+	// PaymentURL và PaymentRef do PaymentMethod điền nếu khách cần được chuyển sang cổng thanh toán.
+	PaymentURL string
+	PaymentRef string
+	// ReservedUntil là hạn giữ hàng của đơn chờ thanh toán, nil nếu không giữ hàng có hạn.
+	ReservedUntil *time.Time
+}
+
+// PaymentMethod quyết định trạng thái ban đầu của đơn và khởi tạo thanh toán.
+type PaymentMethod interface {
+	Name() string
+	InitialStatus() orderstatus.Status
+	// RequiresPrepayment: đơn chỉ được giữ hàng trong ReservationTTL chờ khách thanh toán.
+	RequiresPrepayment() bool
+	// Start được gọi sau khi đơn đã được commit; trả về lỗi thì đơn bị hủy.
+	Start(ctx context.Context, order *Order) error
+}
+
+// Price tính tiền cho giỏ hàng: áp các khuyến mãi tự động trước, voucher sau (trên phần tiền
+// còn lại của mỗi món). Hàm thuần, không truy cập CSDL.
+func Price(items []models.CartItemRequest, products map[int]inventory.Product, promos []models.Promotion, voucher *Voucher, now time.Time) (models.CheckoutQuote, error) {
+	if len(items) == 0 {
+		return models.CheckoutQuote{}, invalid("Giỏ hàng trống")
+	}
+
+	quote := models.CheckoutQuote{Items: make([]models.QuoteItem, 0, len(items))}
+	requested := make(map[int]int)
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return models.CheckoutQuote{}, invalid("Số lượng sản phẩm ID %d không hợp lệ", item.ProductID)
+		}
+		p, ok := products[item.ProductID]
+		if !ok {
+			return models.CheckoutQuote{}, invalid("Sản phẩm không tồn tại: ID %d", item.ProductID)
+		}
+		requested[item.ProductID] += item.Quantity
+		if p.Available < requested[item.ProductID] {
+			return models.CheckoutQuote{}, invalid("Sản phẩm ID %d chỉ còn %d sản phẩm", item.ProductID, max(p.Available, 0))
+		}
+
+		line := models.QuoteItem{
+			ProductID:   p.ID,
+			ProductName: p.Name,
+			Quantity:    item.Quantity,
+			UnitPrice:   p.Price,
+			LineTotal:   p.Price * int64(item.Quantity),
+		}
+		quote.Items = append(quote.Items, line)
+		quote.Subtotal += line.LineTotal
+	}
+
+	blockedBy := applyPromotions(&quote, promos, products, now)
+
+	if voucher != nil {
+		check := applyVoucher(&quote, *voucher, products, now)
+		if check.Applicable && blockedBy != "" {
+			check.Applicable = false
+			check.Reason = fmt.Sprintf("Voucher không dùng chung được với khuyến mãi %q", blockedBy)
+		}
+		if check.Applicable {
+			applyVoucherDiscount(&quote, *voucher, check)
+		} else {
+			for i := range quote.Items {
+				quote.Items[i].VoucherEligible = false
+			}
+		}
+		quote.Voucher = &check
+		if check.Applicable && voucher.UserVoucherID != 0 {
+			id := voucher.UserVoucherID
+			quote.AppliedUserVoucherID = &id
+		} else if check.Applicable {
+			id := voucher.VoucherID
+			quote.PromoVoucherID = &id
+		}
+	}
+	quote.Total = quote.Subtotal - quote.DiscountAmount
+	return quote, nil
+}
+
+// applyPromotions áp các khuyến mãi tự động và ghi phần giảm vào từng món. Trả về tên khuyến mãi
+// không cho dùng kèm voucher, rỗng nếu voucher vẫn được dùng.
+func applyPromotions(quote *models.CheckoutQuote, promos []models.Promotion, products map[int]inventory.Product, now time.Time) string {
+	if len(promos) == 0 {
+		return ""
+	}
+	lines := make([]promotion.Line, len(quote.Items))
+	for i, item := range quote.Items {
+		lines[i] = promotion.Line{
+			ProductID:  item.ProductID,
+			CategoryID: products[item.ProductID].CategoryID,
+			Quantity:   item.Quantity,
+			UnitPrice:  item.UnitPrice,
+		}
+	}
+
+	result := promotion.Evaluate(promos, lines, now)
+	for _, adj := range result.Adjustments {
+		id := adj.Promotion.ID
+		item := &quote.Items[adj.Line]
+		item.Discount += adj.Amount
+		item.Adjustments = append(item.Adjustments, models.LineAdjustment{
+			Source: "promotion", PromotionID: &id, Label: adj.Promotion.Name, Amount: adj.Amount,
+		})
+		quote.PromotionDiscount += adj.Amount
+	}
+	quote.Promotions = result.Applied
+	quote.DiscountAmount = quote.PromotionDiscount
+	return result.BlockedVoucherBy
+}
+
+// applyVoucher kiểm tra điều kiện của voucher trên phần tiền còn lại sau khuyến mãi và đánh dấu
+// các món thuộc phạm vi voucher. Voucher không áp dụng được thì check có lý do.
+func applyVoucher(quote *models.CheckoutQuote, v Voucher, products map[int]inventory.Product, now time.Time) models.VoucherCheck {
+	check := models.VoucherCheck{UserVoucherID: v.UserVoucherID, Code: v.Code}
+	for i := range quote.Items {
+		if voucherCovers(v, products[quote.Items[i].ProductID]) {
+			quote.Items[i].VoucherEligible = true
+			check.EligibleSubtotal += quote.Items[i].LineTotal - quote.Items[i].Discount
+		}
+	}
+	payable := quote.Subtotal - quote.DiscountAmount
+
+	switch {
+	case v.IsUsed:
+		check.Reason = "Voucher này đã được sử dụng"
+	case !v.StartsAt.IsZero() && now.Before(v.StartsAt):
+		check.Reason = "Mã khuyến mãi chưa đến thời gian áp dụng"
+	case !v.ExpiresAt.IsZero() && now.After(v.ExpiresAt):
+		check.Reason = "Voucher đã hết hạn"
+	case v.PerUserLimit > 0 && v.UserRedemptions >= v.PerUserLimit:
+		check.Reason = "Bạn đã dùng hết lượt của mã khuyến mãi này"
+	case v.UsageLimit > 0 && v.UsedCount >= v.UsageLimit:
+		check.Reason = "Voucher đã hết lượt sử dụng"
+	case payable < v.MinOrderValue:
+		check.Reason = fmt.Sprintf("Đơn hàng cần tối thiểu %s để dùng voucher này (còn thiếu %s)",
+			formatVND(v.MinOrderValue), formatVND(v.MinOrderValue-payable))
+	case check.EligibleSubtotal == 0:
+		check.Reason = "Giỏ hàng không có món nào thuộc phạm vi áp dụng của voucher"
+	}
+	if check.Reason == "" {
+		check.Applicable = true
+	}
+	return check
+}
+
+// applyVoucherDiscount tính giảm giá của voucher đã qua kiểm tra và phân bổ vào từng món.
+func applyVoucherDiscount(quote *models.CheckoutQuote, v Voucher, check models.VoucherCheck) {
+	var discount int64
+	switch v.DiscountType {
+	case "percentage":
+		discount = check.EligibleSubtotal * v.DiscountValue / 100
+		if v.MaxDiscount > 0 && discount > v.MaxDiscount {
+			discount = v.MaxDiscount
+		}
+	case "fixed_amount":
+		discount = v.DiscountValue
+	}
+	if discount > check.EligibleSubtotal {
+		discount = check.EligibleSubtotal
+	}
+	if discount < 0 {
+		discount = 0
+	}
+
+	label := "Voucher"
+	if v.Code != "" {
+		label += " " + v.Code
+	}
+	quote.DiscountAmount += discount
+	allocateDiscount(quote.Items, discount, func(item models.QuoteItem) bool { return item.VoucherEligible }, "voucher", label)
+}
+
+// voucherCovers: voucher không giới hạn sản phẩm/danh mục thì áp dụng cho mọi món.
+func voucherCovers(v Voucher, p inventory.Product) bool {
+	if len(v.ProductIDs) == 0 && len(v.CategoryIDs) == 0 {
+		return true
+	}
+	for _, id := range v.ProductIDs {
+		if id == p.ID {
+			return true
+		}
+	}
+	for _, id := range v.CategoryIDs {
+		if p.CategoryID != 0 && id == p.CategoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// allocateDiscount chia giảm giá cho các món eligible theo tỷ lệ số tiền còn lại của món; phần lẻ
+// do làm tròn dồn vào món đủ điều kiện cuối cùng. Mỗi món được giảm có thêm một dòng Adjustments.
+func allocateDiscount(items []models.QuoteItem, discount int64, eligible func(models.QuoteItem) bool, source, label string) {
+	var base int64
+	for _, item := range items {
+		if eligible(item) {
+			base += item.LineTotal - item.Discount
+		}
+	}
+	if base <= 0 {
+		return
+	}
+
+	shares := make([]int64, len(items))
+	last, allocated := -1, int64(0)
+	for i := range items {
+		if !eligible(items[i]) || items[i].LineTotal == items[i].Discount {
+			continue
+		}
+		shares[i] = discount * (items[i].LineTotal - items[i].Discount) / base
+		allocated += shares[i]
+		last = i
+	}
+	shares[last] += discount - allocated
+	for i, share := range shares {
+		if share <= 0 {
+			continue
+		}
+		items[i].Discount += share
+		items[i].Adjustments = append(items[i].Adjustments, models.LineAdjustment{Source: source, Label: label, Amount: share})
+	}
+}
+
+// applyPoints dùng tối đa points điểm thưởng để giảm giá, giới hạn theo MaxRedeemPercent của
+// tổng tiền còn phải trả, và phân bổ phần giảm vào từng món.
+func applyPoints(quote *models.CheckoutQuote, points int, policy models.LoyaltyPolicy) {
+	maxDiscount := quote.Total * policy.MaxRedeemPercent / 100
+	points = min(points, int(maxDiscount/policy.PointValue))
+	if points <= 0 {
+		return
+	}
+	discount := int64(points) * policy.PointValue
+	allocateDiscount(quote.Items, discount, func(models.QuoteItem) bool { return true }, "points", "Điểm thưởng")
+	quote.PointsRedeemed = points
+	quote.PointsDiscount = discount
+	quote.DiscountAmount += discount
+	quote.Total -= discount
+}
+
+// applyWallet trả tối đa amount bằng ví, không vượt quá số tiền còn phải trả. Tiền ví là một
+// khoản thanh toán chứ không phải giảm giá nên không phân bổ vào từng món.
+func applyWallet(quote *models.CheckoutQuote, amount int64) {
+	amount = min(amount, quote.Total)
+	if amount <= 0 {
+		return
+	}
+	quote.WalletAmount = amount
+	quote.Total -= amount
+}
+
+// formatVND định dạng số tiền kiểu 150.000đ cho thông báo.
+func formatVND(amount int64) string {
+	s := strconv.FormatInt(amount, 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "." + s[i:]
+	}
+	return s + "đ"
+}
+
+// DefaultReservationTTL là thời gian giữ hàng mặc định cho đơn chờ thanh toán.
+const DefaultReservationTTL = 30 * time.Minute
+
+// ReservationTTLFromEnv đọc STOCK_RESERVATION_TTL (vd "30m"), mặc định DefaultReservationTTL.
+func ReservationTTLFromEnv() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("STOCK_RESERVATION_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return DefaultReservationTTL
+}
+
+// Service tạo báo giá và đơn hàng.
+type Service struct {
+	db             *sql.DB
+	now            func() time.Time
+	reservationTTL time.Duration
+}
+
+func NewService(db *sql.DB, now func() time.Time, reservationTTL time.Duration) *Service {
+	if now == nil {
+		now = time.Now
+	}
+	return &Service{db: db, now: now, reservationTTL: reservationTTL}
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Quote tính giá giỏ hàng mà không tạo đơn.
+func (s *Service) Quote(ctx context.Context, req models.CreateOrderRequest) (models.CheckoutQuote, error) {
+	return s.quote(ctx, s.db, req, false)
+}
+
+// quote với lock = true khóa các dòng products và user_vouchers liên quan tới hết transaction.
+func (s *Service) quote(ctx context.Context, q querier, req models.CreateOrderRequest, lock bool) (models.CheckoutQuote, error) {
+	ids := make([]int, 0, len(req.CartItems))
+	for _, item := range req.CartItems {
+		ids = append(ids, item.ProductID)
+	}
+	products, err := inventory.LoadProducts(ctx, q, ids, s.now(), lock)
+	if err != nil {
+		return models.CheckoutQuote{}, fmt.Errorf("load products: %w", err)
+	}
+	if req.UserID == nil {
+		// Mã thẻ quà tặng chỉ xem được trong tài khoản người mua
+		for _, p := range products {
+			if p.Type == wallet.ProductTypeGiftCard {
+				return models.CheckoutQuote{}, invalid("Vui lòng đăng nhập để mua thẻ quà tặng")
+			}
+		}
+	}
+
+	var voucher *Voucher
+	switch {
+	case req.AppliedUserVoucherID != nil && req.PromoCode != "":
+		return models.CheckoutQuote{}, invalid("Chỉ được dùng một voucher hoặc một mã khuyến mãi cho mỗi đơn")
+	case req.AppliedUserVoucherID != nil:
+		v, err := loadVoucher(ctx, q, *req.AppliedUserVoucherID, req.UserID, lock)
+		if err != nil {
+			return models.CheckoutQuote{}, err
+		}
+		voucher = &v
+	case req.PromoCode != "":
+		v, err := loadPromo(ctx, q, req.PromoCode, req.UserID, lock)
+		if err != nil {
+			return models.CheckoutQuote{}, err
+		}
+		voucher = &v
+	}
+
+	promos, err := promotion.LoadActive(ctx, q, s.now())
+	if err != nil {
+		return models.CheckoutQuote{}, fmt.Errorf("load promotions: %w", err)
+	}
+	quote, err := Price(req.CartItems, products, promos, voucher, s.now())
+	if err != nil {
+		return quote, err
+	}
+
+	if req.RedeemPoints != 0 {
+		switch {
+		case req.RedeemPoints < 0:
+			return models.CheckoutQuote{}, invalid("Số điểm thưởng không hợp lệ")
+		case req.UserID == nil:
+			return models.CheckoutQuote{}, invalid("Vui lòng đăng nhập để dùng điểm thưởng")
+		}
+		balance, err := loyalty.Balance(ctx, q, *req.UserID, s.now(), lock)
+		if err != nil {
+			return models.CheckoutQuote{}, fmt.Errorf("load loyalty balance: %w", err)
+		}
+		// Không trả lại số dư trong thông báo lỗi; khách xem điểm của mình ở trang tài khoản
+		if req.RedeemPoints > balance {
+			return models.CheckoutQuote{}, invalid("Không đủ điểm thưởng")
+		}
+		applyPoints(&quote, req.RedeemPoints, loyalty.PolicyFromEnv())
+	}
+
+	// Ví trả sau cùng, trên số tiền còn lại sau mọi khoản giảm giá
+	if req.WalletAmount != 0 {
+		switch {
+		case req.WalletAmount < 0:
+			return models.CheckoutQuote{}, invalid("Số tiền trả bằng ví không hợp lệ")
+		case req.UserID == nil:
+			return models.CheckoutQuote{}, invalid("Vui lòng đăng nhập để thanh toán bằng ví")
+		}
+		balance, err := wallet.Balance(ctx, q, *req.UserID, lock)
+		if err != nil {
+			return models.CheckoutQuote{}, fmt.Errorf("load wallet balance: %w", err)
+		}
+		if req.WalletAmount > balance {
+			return models.CheckoutQuote{}, invalid("Số dư ví không đủ")
+		}
+		applyWallet(&quote, req.WalletAmount)
+	}
+	return quote, nil
+}
+
+func loadVoucher(ctx context.Context, q querier, userVoucherID int, userID *int, forUpdate bool) (Voucher, error) {
+	if userID == nil {
+		return Voucher{}, invalid("Vui lòng đăng nhập để sử dụng voucher")
+	}
+	query := `
+		SELECT uv.id, v.id, uv.is_used, uv.expires_at, v.discount_type, v.discount_value,
+		       v.applicable_product_ids, v.applicable_category_ids, v.min_order_value,
+		       COALESCE(v.max_discount, 0), COALESCE(v.usage_limit, 0), v.used_count
+		FROM user_vouchers uv
+		JOIN vouchers v ON uv.voucher_id = v.id
+		WHERE uv.id = $1 AND uv.user_id = $2`
+	if forUpdate {
+		query += " FOR UPDATE OF uv"
+	}
+	var v Voucher
+	var productIDs, categoryIDs pq.Int64Array
+	err := q.QueryRowContext(ctx, query, userVoucherID, *userID).
+		Scan(&v.UserVoucherID, &v.VoucherID, &v.IsUsed, &v.ExpiresAt, &v.DiscountType, &v.DiscountValue,
+			&productIDs, &categoryIDs, &v.MinOrderValue, &v.MaxDiscount, &v.UsageLimit, &v.UsedCount)
+	if err == sql.ErrNoRows {
+		return Voucher{}, invalid("Voucher không tồn tại hoặc không thuộc về bạn")
+	}
+	if err != nil {
+		return Voucher{}, fmt.Errorf("load voucher: %w", err)
+	}
+	for _, id := range productIDs {
+		v.ProductIDs = append(v.ProductIDs, int(id))
+	}
+	for _, id := range categoryIDs {
+		v.CategoryIDs = append(v.CategoryIDs, int(id))
+	}
+	return v, nil
+}
+
+// loadPromo đọc mã khuyến mãi công khai và số lần người dùng đã dùng mã. Với forUpdate, dòng
+// vouchers bị khóa tới hết transaction nên các lần dùng đồng thời của cùng một mã được xếp hàng
+// và số lượt đếm được luôn chính xác.
+func loadPromo(ctx context.Context, q querier, code string, userID *int, forUpdate bool) (Voucher, error) {
+	if userID == nil {
+		return Voucher{}, invalid("Vui lòng đăng nhập để sử dụng mã khuyến mãi")
+	}
+	query := `
+		SELECT id, code, discount_type, discount_value, applicable_product_ids, applicable_category_ids,
+		       min_order_value, COALESCE(max_discount, 0), COALESCE(usage_limit, 0), used_count,
+		       valid_from, valid_until, per_user_limit
+		FROM vouchers
+		WHERE is_public AND UPPER(code) = UPPER($1)`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var v Voucher
+	var productIDs, categoryIDs pq.Int64Array
+	var startsAt, expiresAt sql.NullTime
+	err := q.QueryRowContext(ctx, query, strings.TrimSpace(code)).
+		Scan(&v.VoucherID, &v.Code, &v.DiscountType, &v.DiscountValue, &productIDs, &categoryIDs,
+			&v.MinOrderValue, &v.MaxDiscount, &v.UsageLimit, &v.UsedCount,
+			&startsAt, &expiresAt, &v.PerUserLimit)
+	if err == sql.ErrNoRows {
+		return Voucher{}, invalid("Mã khuyến mãi không tồn tại")
+	}
+	if err != nil {
+		return Voucher{}, fmt.Errorf("load promo code: %w", err)
+	}
+	v.StartsAt, v.ExpiresAt = startsAt.Time, expiresAt.Time
+	for _, id := range productIDs {
+		v.ProductIDs = append(v.ProductIDs, int(id))
+	}
+	for _, id := range categoryIDs {
+		v.CategoryIDs = append(v.CategoryIDs, int(id))
+	}
+
+	err = q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM voucher_redemptions WHERE voucher_id = $1 AND user_id = $2
+	`, v.VoucherID, *userID).Scan(&v.UserRedemptions)
+	if err != nil {
+		return Voucher{}, fmt.Errorf("count promo redemptions: %w", err)
+	}
+	return v, nil
+}
+
+// PlaceOrder tính giá, ghi đơn hàng, giữ hàng, đánh dấu voucher đã dùng, trừ điểm thưởng và số dư
+// ví, dọn giỏ hàng trong cùng một transaction rồi mới gọi method.Start, để lời gọi cổng thanh toán
+// không giữ khóa products/vouchers. Start lỗi thì đơn bị hủy.
+func (s *Service) PlaceOrder(ctx context.Context, req models.CreateOrderRequest, method PaymentMethod) (*Order, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	quote, err := s.quote(ctx, tx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	if quote.Voucher != nil && !quote.Voucher.Applicable {
+		return nil, invalid("%s", quote.Voucher.Reason)
+	}
+	// Đơn không còn tiền phải thu thì không cần thu qua phương thức khách chọn
+	if quote.Total == 0 {
+		method = Free
+		if quote.WalletAmount > 0 {
+			method = Wallet
+		}
+	}
+
+	order := &Order{
+		UserID: req.UserID,
+		Status: method.InitialStatus(),
+		Method: method.Name(),
+		Quote:  quote,
+	}
+	paymentStatus := payment.PaymentUnpaid
+	if order.Status == orderstatus.Paid {
+		paymentStatus = payment.PaymentPaid
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO orders (
+			user_id, customer_name, customer_phone, shipping_address,
+			total_amount, status, applied_voucher_id, discount_amount,
+			payment_method, payment_status, promo_voucher_id, promotion_discount,
+			points_redeemed, points_discount, wallet_amount
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id`,
+		req.UserID, req.CustomerName, req.CustomerPhone, req.ShippingAddress,
+		quote.Total, string(order.Status), quote.AppliedUserVoucherID, quote.DiscountAmount,
+		method.Name(), paymentStatus, quote.PromoVoucherID, quote.PromotionDiscount,
+		quote.PointsRedeemed, quote.PointsDiscount, quote.WalletAmount,
+	).Scan(&order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("insert order: %w", err)
+	}
+
+	err = orderstatus.Record(ctx, tx, order.ID, "", order.Status, orderstatus.Customer(req.UserID), "Đặt hàng qua "+method.Name())
+	if err != nil {
+		return nil, fmt.Errorf("record status: %w", err)
+	}
+
+	for _, item := range quote.Items {
+		var itemID int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO order_items (order_id, product_id, quantity, price_at_purchase, discount_amount)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`,
+			order.ID, item.ProductID, item.Quantity, item.UnitPrice, item.Discount,
+		).Scan(&itemID)
+		if err != nil {
+			return nil, fmt.Errorf("insert order item: %w", err)
+		}
+		for _, adj := range item.Adjustments {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO order_item_adjustments (order_item_id, source, promotion_id, label, amount)
+				VALUES ($1, $2, $3, $4, $5)`,
+				itemID, adj.Source, adj.PromotionID, adj.Label, adj.Amount,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("insert order item adjustment: %w", err)
+			}
+		}
+	}
+
+	if quote.AppliedUserVoucherID != nil {
+		if _, err := tx.ExecContext(ctx, "UPDATE user_vouchers SET is_used = true WHERE id = $1", *quote.AppliedUserVoucherID); err != nil {
+			return nil, fmt.Errorf("mark voucher used: %w", err)
+		}
+		// Tăng lượt dùng có điều kiện để hai đơn đồng thời không vượt usage_limit
+		res, err := tx.ExecContext(ctx, `
+			UPDATE vouchers SET used_count = used_count + 1
+			WHERE id = (SELECT voucher_id FROM user_vouchers WHERE id = $1)
+			AND (usage_limit IS NULL OR used_count < usage_limit)
+		`, *quote.AppliedUserVoucherID)
+		if err != nil {
+			return nil, fmt.Errorf("count voucher usage: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil, invalid("Voucher đã hết lượt sử dụng")
+		}
+	}
+	if quote.PromoVoucherID != nil {
+		if err := redeemPromo(ctx, tx, *quote.PromoVoucherID, *req.UserID, order.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if quote.PointsRedeemed > 0 {
+		err := loyalty.Redeem(ctx, tx, *req.UserID, order.ID, quote.PointsRedeemed, s.now())
+		if errors.Is(err, loyalty.ErrInsufficientPoints) {
+			return nil, invalid("Không đủ điểm thưởng")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("redeem points: %w", err)
+		}
+	}
+
+	if quote.WalletAmount > 0 {
+		err := wallet.Pay(ctx, tx, *req.UserID, order.ID, quote.WalletAmount)
+		if errors.Is(err, wallet.ErrInsufficientBalance) {
+			return nil, invalid("Số dư ví không đủ")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pay with wallet: %w", err)
+		}
+	}
+
+	var expiresAt *time.Time
+	if method.RequiresPrepayment() {
+		t := s.now().Add(s.reservationTTL)
+		expiresAt = &t
+	}
+	order.ReservedUntil = expiresAt
+	quantities := make(map[int]int)
+	for _, item := range quote.Items {
+		quantities[item.ProductID] += item.Quantity
+	}
+	if err := inventory.Reserve(ctx, tx, order.ID, quantities, expiresAt); err != nil {
+		return nil, fmt.Errorf("reserve stock: %w", err)
+	}
+	// Đơn đã thanh toán ngay khi tạo không đi qua orderstatus.Transition sang paid
+	if order.Status == orderstatus.Paid {
+		if err := wallet.IssueGiftCards(ctx, tx, order.ID); err != nil {
+			return nil, fmt.Errorf("issue gift cards: %w", err)
+		}
+	}
+
+	if req.UserID != nil {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM carts WHERE user_id = $1", *req.UserID); err != nil {
+			return nil, fmt.Errorf("clear cart: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if err := s.startPayment(ctx, order, method); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// startPayment gọi method.Start cho đơn đã commit và ghi payment_attempts. Không tạo được giao dịch
+// thì hủy đơn (trả hàng, voucher, điểm thưởng, tiền ví); nếu việc hủy cũng lỗi, reaper sẽ hủy đơn
+// khi hết hạn giữ hàng.
+func (s *Service) startPayment(ctx context.Context, order *Order, method PaymentMethod) error {
+	err := method.Start(ctx, order)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", method.Name(), err)
+	} else if order.PaymentRef != "" {
+		_, err = s.db.ExecContext(ctx, `
+			INSERT INTO payment_attempts (order_id, provider, external_order_id, amount, payment_url)
+			VALUES ($1, $2, $3, $4, $5)
+		`, order.ID, method.Name(), order.PaymentRef, order.Quote.Total, order.PaymentURL)
+		if err != nil {
+			err = fmt.Errorf("record payment attempt: %w", err)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	if cerr := s.cancelUnpaid(ctx, order.ID); cerr != nil {
+		log.Printf("ERROR cancelling order %d after payment start failed: %v", order.ID, cerr)
+	}
+	return err
+}
+
+func (s *Service) cancelUnpaid(ctx context.Context, orderID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = orderstatus.Transition(ctx, tx, orderID, orderstatus.Cancelled, orderstatus.System, "Không tạo được giao dịch thanh toán", s.now())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// redeemPromo tăng lượt dùng của mã khuyến mãi (có điều kiện để không vượt usage_limit khi nhiều
+// đơn cùng đặt) và ghi voucher_redemptions để đếm giới hạn theo người dùng. Lượt của người dùng
+// được đếm lại sau UPDATE, khi dòng vouchers đã bị khóa, nên hai đơn đồng thời của cùng một người
+// không vượt per_user_limit kể cả khi số lượt đọc lúc tính giá đã cũ.
+func redeemPromo(ctx context.Context, tx *sql.Tx, voucherID, userID, orderID int) error {
+	var perUserLimit int
+	err := tx.QueryRowContext(ctx, `
+		UPDATE vouchers SET used_count = used_count + 1
+		WHERE id = $1 AND (usage_limit IS NULL OR used_count < usage_limit)
+		RETURNING per_user_limit
+	`, voucherID).Scan(&perUserLimit)
+	if err == sql.ErrNoRows {
+		return invalid("Mã khuyến mãi đã hết lượt sử dụng")
+	}
+	if err != nil {
+		return fmt.Errorf("count promo usage: %w", err)
+	}
+	if perUserLimit > 0 {
+		var used int
+		err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM voucher_redemptions WHERE voucher_id = $1 AND user_id = $2
+		`, voucherID, userID).Scan(&used)
+		if err != nil {
+			return fmt.Errorf("count promo redemptions: %w", err)
+		}
+		if used >= perUserLimit {
+			return invalid("Bạn đã dùng hết lượt của mã khuyến mãi này")
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO voucher_redemptions (voucher_id, user_id, order_id) VALUES ($1, $2, $3)
+	`, voucherID, userID, orderID)
+	if err != nil {
+		return fmt.Errorf("record promo redemption: %w", err)
+	}
+	return nil
+}
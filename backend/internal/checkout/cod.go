@@ -0,0 +1,63 @@
+package checkout
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"backend/internal/orderstatus"
+	"backend/internal/payment"
+)
+
+// ConfirmCollection ghi nhận shipper/admin đã thu tiền mặt của đơn COD: thêm giao dịch 'cod'
+// vào payment_transactions (mỗi đơn một lần) và chuyển payment_status sang paid. Trạng thái
+// giao hàng của đơn không đổi.
+func (s *Service) ConfirmCollection(ctx context.Context, orderID int, note string, actor orderstatus.Actor) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var method, paymentStatus, status string
+	var total int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT payment_method, payment_status, status, total_amount FROM orders WHERE id = $1 FOR UPDATE
+	`, orderID).Scan(&method, &paymentStatus, &status, &total)
+	if err == sql.ErrNoRows {
+		return orderstatus.ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if method != payment.MethodCOD {
+		return invalid("Đơn hàng không thanh toán khi nhận hàng")
+	}
+	if paymentStatus != payment.PaymentUnpaid {
+		return invalid("Đơn hàng đã được ghi nhận thanh toán")
+	}
+	if st := orderstatus.Status(status); st != orderstatus.Shipped && st != orderstatus.Completed {
+		return invalid("Chỉ xác nhận thu tiền khi đơn đang giao hoặc đã hoàn thành")
+	}
+
+	message := "Đã thu tiền mặt khi giao hàng"
+	if note != "" {
+		message += ": " + note
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO payment_transactions (provider, external_order_id, order_id, amount, result_code, message, outcome)
+		VALUES ($1, $2, $3, $4, '0', $5, $6)
+	`, payment.MethodCOD, fmt.Sprintf("COD_%d", orderID), orderID, total, message, payment.OutcomeApplied)
+	if err != nil {
+		return fmt.Errorf("record collection: %w", err)
+	}
+	if err := payment.SetOrderPaymentStatus(ctx, tx, orderID, payment.PaymentPaid); err != nil {
+		return err
+	}
+	// Ghi vào lịch sử (trạng thái giữ nguyên) để timeline cho biết ai đã thu tiền
+	st := orderstatus.Status(status)
+	if err := orderstatus.Record(ctx, tx, orderID, st, st, actor, message); err != nil {
+		return fmt.Errorf("record status: %w", err)
+	}
+	return tx.Commit()
+}
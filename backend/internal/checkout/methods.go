@@ -0,0 +1,62 @@
+package checkout
+
+import (
+	"context"
+	"fmt"
+
+	"backend/internal/orderstatus"
+	"backend/internal/payment"
+)
+
+// offlineMethod là phương thức không cần gọi cổng thanh toán khi tạo đơn.
+type offlineMethod struct {
+	name       string
+	status     orderstatus.Status
+	prepayment bool
+}
+
+func (m offlineMethod) Name() string                        { return m.name }
+func (m offlineMethod) InitialStatus() orderstatus.Status   { return m.status }
+func (m offlineMethod) RequiresPrepayment() bool            { return m.prepayment }
+func (m offlineMethod) Start(context.Context, *Order) error { return nil }
+
+var (
+	// CashOnDelivery: thanh toán khi nhận hàng.
+	CashOnDelivery PaymentMethod = offlineMethod{name: payment.MethodCOD, status: orderstatus.Pending}
+	// BankTransfer: khách tự chuyển khoản, admin xác nhận sau.
+	BankTransfer PaymentMethod = offlineMethod{name: payment.MethodBankTransfer, status: orderstatus.Pending, prepayment: true}
+	// Wallet: số dư ví trả hết tiền đơn, PlaceOrder tự chọn thay cho phương thức khách chọn.
+	Wallet PaymentMethod = offlineMethod{name: "wallet", status: orderstatus.Paid}
+	// Free: voucher/điểm thưởng trả hết tiền đơn, PlaceOrder tự chọn và không gọi cổng thanh toán.
+	Free PaymentMethod = offlineMethod{name: "free", status: orderstatus.Paid}
+)
+
+// Gateway thanh toán qua cổng trực tuyến (MoMo, VNPay, sandbox...) với số tiền sau giảm giá.
+type Gateway struct {
+	Provider payment.Provider
+	ClientIP string
+}
+
+func (g Gateway) Name() string                      { return g.Provider.Name() }
+func (g Gateway) InitialStatus() orderstatus.Status { return orderstatus.Pending }
+func (g Gateway) RequiresPrepayment() bool          { return true }
+
+func (g Gateway) Start(ctx context.Context, order *Order) error {
+	req := payment.CreateRequest{
+		OrderID:     order.ID,
+		Amount:      order.Quote.Total,
+		Description: fmt.Sprintf("Thanh toán đơn hàng #%d", order.ID),
+		ClientIP:    g.ClientIP,
+	}
+	// Link thanh toán hết hạn cùng lúc với hàng được giữ, tránh khách trả tiền cho đơn đã bị hủy
+	if order.ReservedUntil != nil {
+		req.ExpiresAt = *order.ReservedUntil
+	}
+	res, err := g.Provider.CreatePayment(ctx, req)
+	if err != nil {
+		return err
+	}
+	order.PaymentURL = res.PaymentURL
+	order.PaymentRef = res.ExternalOrderID
+	return nil
+}
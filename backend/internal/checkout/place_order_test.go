@@ -0,0 +1,112 @@
+package checkout
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"backend/internal/dbtest"
+	"backend/internal/orderstatus"
+	"backend/internal/payment"
+)
+
+// stubProvider là cổng thanh toán giả; create được gọi thay cho CreatePayment.
+type stubProvider struct {
+	payment.Provider
+	create func() (*payment.CreateResult, error)
+	calls  int
+}
+
+func (p *stubProvider) Name() string { return "stub" }
+
+func (p *stubProvider) CreatePayment(context.Context, payment.CreateRequest) (*payment.CreateResult, error) {
+	p.calls++
+	return p.create()
+}
+
+// placeOrderFixture là quoteFixture với các câu lệnh ghi đơn #42 và hủy đơn.
+func placeOrderFixture() (*dbtest.DB, *Service) {
+	fake, s := quoteFixture()
+	fake.On("INSERT INTO orders", dbtest.Rows([]driver.Value{int64(42)}))
+	fake.On("INSERT INTO order_items", dbtest.Rows([]driver.Value{int64(1)}))
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{string(orderstatus.Pending)}))
+	// Đơn chưa được cộng hay dùng điểm
+	fake.On("SELECT id, user_id, points, remaining, expires_at FROM loyalty_ledger", dbtest.Rows())
+	fake.On("SELECT user_id, expires_at, -SUM(points) FROM loyalty_ledger", dbtest.Rows())
+	fake.On("SELECT wallet_amount - wallet_refunded", dbtest.Rows([]driver.Value{int64(0)}))
+	fake.On("FROM gift_cards WHERE order_id", dbtest.Rows([]driver.Value{false, "stub"}))
+	return fake, s
+}
+
+func TestPlaceOrderCallsGatewayAfterCommit(t *testing.T) {
+	fake, s := placeOrderFixture()
+	provider := &stubProvider{}
+	provider.create = func() (*payment.CreateResult, error) {
+		if fake.Commits != 1 {
+			t.Errorf("cổng được gọi khi transaction đặt hàng chưa commit (commits = %d)", fake.Commits)
+		}
+		return &payment.CreateResult{ExternalOrderID: "ORDER_42", PaymentURL: "https://pay.example/42"}, nil
+	}
+
+	order, err := s.PlaceOrder(context.Background(), quoteRequest(nil), Gateway{Provider: provider})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.PaymentURL != "https://pay.example/42" || order.Status != orderstatus.Pending {
+		t.Errorf("order = %+v", order)
+	}
+	calls := fake.Calls("INSERT INTO payment_attempts")
+	if len(calls) != 1 || calls[0].Args[2] != "ORDER_42" {
+		t.Errorf("phải ghi payment_attempts, có %+v", calls)
+	}
+	if len(fake.Calls("UPDATE orders SET status")) != 0 {
+		t.Error("không được đổi trạng thái đơn khi tạo giao dịch thành công")
+	}
+}
+
+func TestPlaceOrderCancelsOrderWhenGatewayFails(t *testing.T) {
+	fake, s := placeOrderFixture()
+	provider := &stubProvider{create: func() (*payment.CreateResult, error) {
+		return nil, errors.New("timeout")
+	}}
+
+	_, err := s.PlaceOrder(context.Background(), quoteRequest(nil), Gateway{Provider: provider})
+	if err == nil {
+		t.Fatal("phải trả lỗi khi cổng thanh toán lỗi")
+	}
+	calls := fake.Calls("UPDATE orders SET status")
+	if len(calls) != 1 || calls[0].Args[0] != string(orderstatus.Cancelled) || calls[0].Args[1] != int64(42) {
+		t.Fatalf("phải hủy đơn #42, có %+v", calls)
+	}
+	if fake.Commits != 2 {
+		t.Errorf("commits = %d, muốn 2 (đặt hàng, hủy đơn)", fake.Commits)
+	}
+	if len(fake.Calls("INSERT INTO payment_attempts")) != 0 {
+		t.Error("không được ghi payment_attempts khi cổng lỗi")
+	}
+}
+
+func TestPlaceOrderZeroTotalSkipsGateway(t *testing.T) {
+	fake, s := placeOrderFixture()
+	// Món 0đ: không còn tiền phải thu
+	fake.On("WHERE p.id = $1", dbtest.Rows([]driver.Value{int64(1), "Quà tặng", int64(0), int64(2), int64(10), "food"}))
+	provider := &stubProvider{create: func() (*payment.CreateResult, error) {
+		return &payment.CreateResult{ExternalOrderID: "ORDER_42"}, nil
+	}}
+
+	order, err := s.PlaceOrder(context.Background(), quoteRequest(nil), Gateway{Provider: provider})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.calls != 0 {
+		t.Error("không được gọi cổng thanh toán cho đơn 0đ")
+	}
+	if order.Status != orderstatus.Paid || order.Method != Free.Name() {
+		t.Errorf("status = %s, method = %s, muốn paid qua %s", order.Status, order.Method, Free.Name())
+	}
+	calls := fake.Calls("INSERT INTO orders")
+	if len(calls) != 1 || calls[0].Args[9] != payment.PaymentPaid {
+		t.Errorf("đơn phải được ghi là đã thanh toán, có %+v", calls)
+	}
+}
@@ -0,0 +1,409 @@
+package checkout
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/inventory"
+	"backend/internal/models"
+)
+
+var priceNow = time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+var priceProducts = map[int]inventory.Product{
+	1: {ID: 1, Name: "Phở bò", Price: 50000, CategoryID: 1, Available: 10, Type: "food"},
+	2: {ID: 2, Name: "Bún chả", Price: 40000, CategoryID: 1, Available: 5, Type: "food"},
+	3: {ID: 3, Name: "Trà đá", Price: 20000, CategoryID: 2, Available: 3, Type: "food"},
+	4: {ID: 4, Name: "Hết hàng", Price: 30000, CategoryID: 2, Available: 0, Type: "food"},
+}
+
+func cartOf(pairs ...int) []models.CartItemRequest {
+	items := make([]models.CartItemRequest, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		items = append(items, models.CartItemRequest{ProductID: pairs[i], Quantity: pairs[i+1]})
+	}
+	return items
+}
+
+// checkTotals kiểm tra các bất biến của báo giá: tổng tiền, phân bổ giảm giá vào từng món.
+func checkTotals(t *testing.T, name string, q models.CheckoutQuote) {
+	t.Helper()
+	var subtotal, discounts int64
+	for _, item := range q.Items {
+		if item.LineTotal != item.UnitPrice*int64(item.Quantity) {
+			t.Errorf("%s: món %d LineTotal = %d, muốn %d", name, item.ProductID, item.LineTotal, item.UnitPrice*int64(item.Quantity))
+		}
+		if item.Discount < 0 || item.Discount > item.LineTotal {
+			t.Errorf("%s: món %d giảm %d vượt giá món %d", name, item.ProductID, item.Discount, item.LineTotal)
+		}
+		var adjusted int64
+		for _, adj := range item.Adjustments {
+			adjusted += adj.Amount
+		}
+		if adjusted != item.Discount {
+			t.Errorf("%s: món %d Adjustments cộng lại %d, Discount %d", name, item.ProductID, adjusted, item.Discount)
+		}
+		subtotal += item.LineTotal
+		discounts += item.Discount
+	}
+	if q.Subtotal != subtotal {
+		t.Errorf("%s: Subtotal = %d, muốn %d", name, q.Subtotal, subtotal)
+	}
+	if discounts != q.DiscountAmount {
+		t.Errorf("%s: giảm giá phân bổ %d, DiscountAmount %d", name, discounts, q.DiscountAmount)
+	}
+	if q.Total != q.Subtotal-q.DiscountAmount {
+		t.Errorf("%s: Total = %d, muốn %d", name, q.Total, q.Subtotal-q.DiscountAmount)
+	}
+}
+
+func TestPriceValidatesQuantityAndStock(t *testing.T) {
+	cases := []struct {
+		name  string
+		items []models.CartItemRequest
+		err   string // rỗng là hợp lệ
+	}{
+		{"giỏ trống", nil, "Giỏ hàng trống"},
+		{"số lượng 0", cartOf(1, 0), "Số lượng sản phẩm ID 1 không hợp lệ"},
+		{"số lượng âm", cartOf(1, -2), "Số lượng sản phẩm ID 1 không hợp lệ"},
+		{"sản phẩm không tồn tại", cartOf(99, 1), "Sản phẩm không tồn tại: ID 99"},
+		{"vượt tồn kho", cartOf(3, 4), "Sản phẩm ID 3 chỉ còn 3 sản phẩm"},
+		{"hết hàng", cartOf(4, 1), "Sản phẩm ID 4 chỉ còn 0 sản phẩm"},
+		{"cộng dồn dòng trùng vượt tồn kho", cartOf(3, 2, 1, 1, 3, 2), "Sản phẩm ID 3 chỉ còn 3 sản phẩm"},
+		{"vừa đủ tồn kho", cartOf(3, 3), ""},
+		{"dòng trùng vừa đủ tồn kho", cartOf(3, 1, 3, 2), ""},
+	}
+	for _, c := range cases {
+		q, err := Price(c.items, priceProducts, nil, nil, priceNow)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: lỗi %v", c.name, err)
+				continue
+			}
+			checkTotals(t, c.name, q)
+			continue
+		}
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%s: lỗi %v, muốn *checkout.Error %q", c.name, err, c.err)
+		} else if e.Message != c.err {
+			t.Errorf("%s: lỗi %q, muốn %q", c.name, e.Message, c.err)
+		}
+	}
+}
+
+func TestPriceWithoutDiscounts(t *testing.T) {
+	q, err := Price(cartOf(1, 2, 3, 1), priceProducts, nil, nil, priceNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTotals(t, "không giảm giá", q)
+	if q.Subtotal != 120000 || q.DiscountAmount != 0 || q.Total != 120000 || q.Voucher != nil {
+		t.Errorf("quote = %+v, muốn 120000 không giảm", q)
+	}
+	if q.Items[0].ProductName != "Phở bò" || q.Items[0].UnitPrice != 50000 {
+		t.Errorf("món đầu = %+v", q.Items[0])
+	}
+}
+
+func TestPriceVoucherScope(t *testing.T) {
+	// Giỏ: 2 phở (100.000đ, danh mục 1) + 1 trà (20.000đ, danh mục 2)
+	items := cartOf(1, 2, 3, 1)
+	cases := []struct {
+		name       string
+		voucher    Voucher
+		applicable bool
+		reason     string
+		discount   int64
+		eligible   []int // sản phẩm được đánh dấu thuộc phạm vi voucher
+	}{
+		{
+			name:       "cả giỏ theo phần trăm",
+			voucher:    Voucher{UserVoucherID: 1, DiscountType: "percentage", DiscountValue: 10},
+			applicable: true, discount: 12000, eligible: []int{1, 3},
+		},
+		{
+			name:       "theo sản phẩm, giảm cố định bị chặn ở giá trị món",
+			voucher:    Voucher{UserVoucherID: 1, DiscountType: "fixed_amount", DiscountValue: 50000, ProductIDs: []int{3}},
+			applicable: true, discount: 20000, eligible: []int{3},
+		},
+		{
+			name:       "theo danh mục",
+			voucher:    Voucher{UserVoucherID: 1, DiscountType: "percentage", DiscountValue: 10, CategoryIDs: []int{1}},
+			applicable: true, discount: 10000, eligible: []int{1},
+		},
+		{
+			name:       "sản phẩm hoặc danh mục",
+			voucher:    Voucher{UserVoucherID: 1, DiscountType: "percentage", DiscountValue: 10, ProductIDs: []int{3}, CategoryIDs: []int{1}},
+			applicable: true, discount: 12000, eligible: []int{1, 3},
+		},
+		{
+			name:       "phần trăm có mức giảm tối đa",
+			voucher:    Voucher{UserVoucherID: 1, DiscountType: "percentage", DiscountValue: 50, MaxDiscount: 30000},
+			applicable: true, discount: 30000, eligible: []int{1, 3},
+		},
+		{
+			name:    "không có món nào thuộc phạm vi",
+			voucher: Voucher{UserVoucherID: 1, DiscountType: "percentage", DiscountValue: 10, ProductIDs: []int{2}},
+			reason:  "Giỏ hàng không có món nào thuộc phạm vi áp dụng của voucher",
+		},
+		{
+			name:    "chưa đạt giá trị tối thiểu",
+			voucher: Voucher{UserVoucherID: 1, DiscountType: "fixed_amount", DiscountValue: 10000, MinOrderValue: 150000},
+			reason:  "Đơn hàng cần tối thiểu 150.000đ để dùng voucher này (còn thiếu 30.000đ)",
+		},
+		{
+			name:       "vừa đạt giá trị tối thiểu",
+			voucher:    Voucher{UserVoucherID: 1, DiscountType: "fixed_amount", DiscountValue: 10000, MinOrderValue: 120000},
+			applicable: true, discount: 10000, eligible: []int{1, 3},
+		},
+		{
+			name:    "đã sử dụng",
+			voucher: Voucher{UserVoucherID: 1, DiscountType: "fixed_amount", DiscountValue: 10000, IsUsed: true},
+			reason:  "Voucher này đã được sử dụng",
+		},
+		{
+			name:    "hết hạn",
+			voucher: Voucher{UserVoucherID: 1, DiscountType: "fixed_amount", DiscountValue: 10000, ExpiresAt: priceNow.Add(-time.Minute)},
+			reason:  "Voucher đã hết hạn",
+		},
+		{
+			name:    "mã chưa đến thời gian áp dụng",
+			voucher: Voucher{VoucherID: 9, Code: "SALE", DiscountType: "fixed_amount", DiscountValue: 10000, StartsAt: priceNow.Add(time.Hour)},
+			reason:  "Mã khuyến mãi chưa đến thời gian áp dụng",
+		},
+		{
+			name:    "hết lượt của người dùng",
+			voucher: Voucher{VoucherID: 9, Code: "SALE", DiscountType: "fixed_amount", DiscountValue: 10000, PerUserLimit: 1, UserRedemptions: 1},
+			reason:  "Bạn đã dùng hết lượt của mã khuyến mãi này",
+		},
+		{
+			name:    "hết tổng lượt",
+			voucher: Voucher{VoucherID: 9, Code: "SALE", DiscountType: "fixed_amount", DiscountValue: 10000, UsageLimit: 100, UsedCount: 100},
+			reason:  "Voucher đã hết lượt sử dụng",
+		},
+	}
+
+	for _, c := range cases {
+		v := c.voucher
+		q, err := Price(items, priceProducts, nil, &v, priceNow)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		checkTotals(t, c.name, q)
+		if q.Voucher == nil {
+			t.Fatalf("%s: thiếu kết quả kiểm tra voucher", c.name)
+		}
+		if q.Voucher.Applicable != c.applicable || q.Voucher.Reason != c.reason {
+			t.Errorf("%s: applicable=%v reason=%q, muốn %v %q", c.name, q.Voucher.Applicable, q.Voucher.Reason, c.applicable, c.reason)
+		}
+		if q.DiscountAmount != c.discount {
+			t.Errorf("%s: giảm %d, muốn %d", c.name, q.DiscountAmount, c.discount)
+		}
+		eligible := map[int]bool{}
+		for _, id := range c.eligible {
+			eligible[id] = true
+		}
+		for _, item := range q.Items {
+			if item.VoucherEligible != eligible[item.ProductID] {
+				t.Errorf("%s: món %d VoucherEligible = %v", c.name, item.ProductID, item.VoucherEligible)
+			}
+			if !eligible[item.ProductID] && item.Discount != 0 {
+				t.Errorf("%s: món %d ngoài phạm vi mà được giảm %d", c.name, item.ProductID, item.Discount)
+			}
+		}
+
+		switch {
+		case !c.applicable:
+			if q.AppliedUserVoucherID != nil || q.PromoVoucherID != nil {
+				t.Errorf("%s: voucher không áp dụng mà vẫn được ghi vào đơn", c.name)
+			}
+		case v.UserVoucherID != 0:
+			if q.AppliedUserVoucherID == nil || *q.AppliedUserVoucherID != v.UserVoucherID || q.PromoVoucherID != nil {
+				t.Errorf("%s: voucher của người dùng phải ghi vào AppliedUserVoucherID", c.name)
+			}
+		default:
+			if q.PromoVoucherID == nil || *q.PromoVoucherID != v.VoucherID || q.AppliedUserVoucherID != nil {
+				t.Errorf("%s: mã công khai phải ghi vào PromoVoucherID", c.name)
+			}
+		}
+	}
+}
+
+func TestPriceAllocatesVoucherRoundingToLastItem(t *testing.T) {
+	// Giá lẻ để chia theo tỷ lệ không hết, phần dư dồn vào món cuối
+	products := map[int]inventory.Product{
+		1: {ID: 1, Price: 33333, Available: 5},
+		2: {ID: 2, Price: 33333, Available: 5},
+		3: {ID: 3, Price: 33334, Available: 5},
+	}
+	v := Voucher{UserVoucherID: 1, DiscountType: "fixed_amount", DiscountValue: 10000}
+	q, err := Price(cartOf(1, 1, 2, 1, 3, 1), products, nil, &v, priceNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTotals(t, "làm tròn", q)
+	if q.DiscountAmount != 10000 || q.Items[0].Discount != 3333 || q.Items[1].Discount != 3333 || q.Items[2].Discount != 3334 {
+		t.Errorf("phân bổ = %d/%d/%d, muốn 3333/3333/3334", q.Items[0].Discount, q.Items[1].Discount, q.Items[2].Discount)
+	}
+}
+
+func promo(id int, typ string, priority int, cfg models.PromotionConfig) models.Promotion {
+	return models.Promotion{ID: id, Name: typ, Type: typ, Priority: priority, Config: cfg, IsActive: true, AllowVoucher: true}
+}
+
+func TestPricePromotionStacking(t *testing.T) {
+	buy2get1 := promo(1, "buy_x_get_y", 20, models.PromotionConfig{CategoryIDs: []int{1}, BuyQuantity: 2, GetQuantity: 1})
+	combo := promo(2, "combo", 10, models.PromotionConfig{ProductIDs: []int{2, 3}, ComboPrice: 50000})
+	tier := promo(3, "tiered_spend", 0, models.PromotionConfig{Tiers: []models.PromotionTier{
+		{MinSubtotal: 50000, DiscountType: "fixed_amount", DiscountValue: 5000},
+		{MinSubtotal: 100000, DiscountType: "percentage", DiscountValue: 10},
+	}})
+	exclusive := buy2get1
+	exclusive.Exclusive = true
+	lateExclusive := tier
+	lateExclusive.Exclusive = true
+	inactive := tier
+	inactive.IsActive = false
+	ended := tier
+	endedAt := priceNow.Add(-time.Hour)
+	ended.EndsAt = &endedAt
+
+	// Giỏ: 2 phở (50.000đ) + 1 bún (40.000đ) + 1 trà (20.000đ) = 160.000đ
+	items := cartOf(1, 2, 2, 1, 3, 1)
+	cases := []struct {
+		name     string
+		promos   []models.Promotion
+		applied  []int // id khuyến mãi được áp dụng, theo thứ tự
+		discount int64
+		perItem  []int64
+	}{
+		{
+			name: "mua 2 tặng 1: tặng món rẻ nhất trong nhóm", promos: []models.Promotion{buy2get1},
+			applied: []int{1}, discount: 40000, perItem: []int64{0, 40000, 0},
+		},
+		{
+			// Bún đã dùng cho mua 2 tặng 1 nên không còn để ghép combo với trà
+			name: "món đã dùng cho quy tắc theo số lượng không được tính lại", promos: []models.Promotion{combo, buy2get1},
+			applied: []int{1}, discount: 40000, perItem: []int64{0, 40000, 0},
+		},
+		{
+			name: "combo giá cố định", promos: []models.Promotion{combo},
+			applied: []int{2}, discount: 10000, perItem: []int64{0, 6666, 3334},
+		},
+		{
+			// Bậc tính trên phần còn lại sau mua 2 tặng 1: 120.000đ -> 10%
+			name: "giảm theo bậc sau mua 2 tặng 1", promos: []models.Promotion{tier, buy2get1},
+			applied: []int{1, 3}, discount: 52000, perItem: []int64{10000, 40000, 2000},
+		},
+		{
+			name: "khuyến mãi độc quyền ưu tiên cao chặn các quy tắc sau", promos: []models.Promotion{tier, exclusive},
+			applied: []int{1}, discount: 40000, perItem: []int64{0, 40000, 0},
+		},
+		{
+			name: "khuyến mãi độc quyền bị bỏ qua khi đã có khuyến mãi khác", promos: []models.Promotion{buy2get1, lateExclusive},
+			applied: []int{1}, discount: 40000, perItem: []int64{0, 40000, 0},
+		},
+		{
+			name: "khuyến mãi tắt hoặc hết hạn không áp dụng", promos: []models.Promotion{inactive, ended},
+			discount: 0, perItem: []int64{0, 0, 0},
+		},
+	}
+
+	for _, c := range cases {
+		q, err := Price(items, priceProducts, c.promos, nil, priceNow)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		checkTotals(t, c.name, q)
+		if q.PromotionDiscount != c.discount || q.DiscountAmount != c.discount {
+			t.Errorf("%s: giảm %d (khuyến mãi %d), muốn %d", c.name, q.DiscountAmount, q.PromotionDiscount, c.discount)
+		}
+		var applied []int
+		for _, p := range q.Promotions {
+			applied = append(applied, p.ID)
+		}
+		if len(applied) != len(c.applied) {
+			t.Errorf("%s: áp dụng %v, muốn %v", c.name, applied, c.applied)
+		} else {
+			for i := range applied {
+				if applied[i] != c.applied[i] {
+					t.Errorf("%s: áp dụng %v, muốn %v", c.name, applied, c.applied)
+					break
+				}
+			}
+		}
+		for i, want := range c.perItem {
+			if q.Items[i].Discount != want {
+				t.Errorf("%s: món %d giảm %d, muốn %d", c.name, q.Items[i].ProductID, q.Items[i].Discount, want)
+			}
+		}
+	}
+}
+
+func TestPriceVoucherAfterPromotions(t *testing.T) {
+	buy2get1 := promo(1, "buy_x_get_y", 0, models.PromotionConfig{CategoryIDs: []int{1}, BuyQuantity: 2, GetQuantity: 1})
+	items := cartOf(1, 2, 2, 1, 3, 1)
+
+	// Voucher tính trên phần còn lại của món sau khuyến mãi: bún đã được tặng nên không còn gì để giảm
+	v := Voucher{UserVoucherID: 1, DiscountType: "percentage", DiscountValue: 10, CategoryIDs: []int{1}}
+	q, err := Price(items, priceProducts, []models.Promotion{buy2get1}, &v, priceNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTotals(t, "voucher sau khuyến mãi", q)
+	if !q.Voucher.Applicable || q.Voucher.EligibleSubtotal != 100000 {
+		t.Fatalf("voucher = %+v, muốn áp dụng trên 100.000đ", q.Voucher)
+	}
+	if q.DiscountAmount != 50000 || q.Items[0].Discount != 10000 || q.Items[1].Discount != 40000 {
+		t.Errorf("giảm %d, món = %+v", q.DiscountAmount, q.Items)
+	}
+
+	// Giá trị tối thiểu xét trên số tiền sau khuyến mãi (120.000đ)
+	v = Voucher{UserVoucherID: 1, DiscountType: "fixed_amount", DiscountValue: 10000, MinOrderValue: 130000}
+	q, _ = Price(items, priceProducts, []models.Promotion{buy2get1}, &v, priceNow)
+	if q.Voucher.Applicable || !strings.Contains(q.Voucher.Reason, "còn thiếu 10.000đ") {
+		t.Errorf("voucher = %+v, muốn thiếu 10.000đ", q.Voucher)
+	}
+
+	// Khuyến mãi không cho dùng kèm voucher
+	blocking := buy2get1
+	blocking.AllowVoucher = false
+	blocking.Name = "Mua 2 tặng 1"
+	v = Voucher{UserVoucherID: 1, DiscountType: "fixed_amount", DiscountValue: 10000}
+	q, _ = Price(items, priceProducts, []models.Promotion{blocking}, &v, priceNow)
+	checkTotals(t, "voucher bị chặn", q)
+	if q.Voucher.Applicable || q.Voucher.Reason != `Voucher không dùng chung được với khuyến mãi "Mua 2 tặng 1"` {
+		t.Errorf("voucher = %+v, muốn bị chặn", q.Voucher)
+	}
+	if q.DiscountAmount != 40000 || q.AppliedUserVoucherID != nil {
+		t.Errorf("giảm %d, muốn chỉ 40.000đ của khuyến mãi", q.DiscountAmount)
+	}
+	for _, item := range q.Items {
+		if item.VoucherEligible {
+			t.Errorf("món %d vẫn đánh dấu thuộc voucher dù voucher bị chặn", item.ProductID)
+		}
+	}
+}
+
+func TestApplyPointsAndWallet(t *testing.T) {
+	policy := models.LoyaltyPolicy{PointValue: 1000, MaxRedeemPercent: 50}
+	q, err := Price(cartOf(1, 2), priceProducts, nil, nil, priceNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tối đa 50% của 100.000đ = 50 điểm dù khách muốn dùng 80
+	applyPoints(&q, 80, policy)
+	checkTotals(t, "điểm thưởng", q)
+	if q.PointsRedeemed != 50 || q.PointsDiscount != 50000 || q.Total != 50000 {
+		t.Errorf("điểm = %d (%d), total %d; muốn 50 điểm, còn 50.000đ", q.PointsRedeemed, q.PointsDiscount, q.Total)
+	}
+
+	// Ví không vượt quá số còn phải trả và không tính là giảm giá
+	applyWallet(&q, 70000)
+	if q.WalletAmount != 50000 || q.Total != 0 || q.DiscountAmount != 50000 {
+		t.Errorf("ví = %d, total %d, giảm %d; muốn ví 50.000đ, total 0", q.WalletAmount, q.Total, q.DiscountAmount)
+	}
+}
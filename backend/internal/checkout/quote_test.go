@@ -0,0 +1,105 @@
+package checkout
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+	"backend/internal/models"
+)
+
+// quoteFixture là giỏ một món 100.000đ; người dùng 7 có 500 điểm thưởng.
+func quoteFixture() (*dbtest.DB, *Service) {
+	fake, db := dbtest.New()
+	fake.On("WHERE p.id = $1", dbtest.Rows([]driver.Value{int64(1), "Phở bò", int64(100000), int64(2), int64(10), "food"}))
+	fake.On("FROM loyalty_ledger", dbtest.Rows([]driver.Value{int64(500)}))
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	return fake, NewService(db, func() time.Time { return now }, DefaultReservationTTL)
+}
+
+func quoteRequest(userID *int) models.CreateOrderRequest {
+	return models.CreateOrderRequest{
+		UserID:    userID,
+		CartItems: []models.CartItemRequest{{ProductID: 1, Quantity: 1}},
+	}
+}
+
+func assertInvalid(t *testing.T, err error, want string) {
+	t.Helper()
+	var e *Error
+	if !errors.As(err, &e) || e.Message != want {
+		t.Fatalf("err = %v, muốn %q", err, want)
+	}
+}
+
+func TestQuotePointsRequireSession(t *testing.T) {
+	fake, s := quoteFixture()
+	req := quoteRequest(nil)
+	req.RedeemPoints = 100
+
+	_, err := s.Quote(context.Background(), req)
+	assertInvalid(t, err, "Vui lòng đăng nhập để dùng điểm thưởng")
+	if len(fake.Calls("FROM loyalty_ledger")) != 0 {
+		t.Error("không được đọc số dư điểm khi chưa đăng nhập")
+	}
+}
+
+func TestQuotePointsUseSessionBalanceWithoutLeakingIt(t *testing.T) {
+	fake, s := quoteFixture()
+	userID := 7
+	req := quoteRequest(&userID)
+	req.RedeemPoints = 600
+
+	_, err := s.Quote(context.Background(), req)
+	assertInvalid(t, err, "Không đủ điểm thưởng")
+	if calls := fake.Calls("FROM loyalty_ledger"); len(calls) != 1 || calls[0].Args[0] != int64(7) {
+		t.Errorf("phải đọc điểm của người dùng trong session, có %+v", calls)
+	}
+
+	req.RedeemPoints = 500
+	quote, err := s.Quote(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.PointsRedeemed != 500 {
+		t.Errorf("PointsRedeemed = %d, muốn 500", quote.PointsRedeemed)
+	}
+}
+
+func TestQuoteWalletRequiresSession(t *testing.T) {
+	fake, s := quoteFixture()
+	req := quoteRequest(nil)
+	req.WalletAmount = 50000
+
+	_, err := s.Quote(context.Background(), req)
+	assertInvalid(t, err, "Vui lòng đăng nhập để thanh toán bằng ví")
+	if len(fake.Calls("FROM wallet_accounts")) != 0 {
+		t.Error("không được đọc số dư ví khi chưa đăng nhập")
+	}
+}
+
+func TestQuoteWalletUsesSessionBalanceWithoutLeakingIt(t *testing.T) {
+	fake, s := quoteFixture()
+	fake.On("SELECT balance FROM wallet_accounts", dbtest.Rows([]driver.Value{int64(30000)}))
+	userID := 7
+	req := quoteRequest(&userID)
+	req.WalletAmount = 50000
+
+	_, err := s.Quote(context.Background(), req)
+	assertInvalid(t, err, "Số dư ví không đủ")
+	if calls := fake.Calls("FROM wallet_accounts"); len(calls) != 1 || calls[0].Args[0] != int64(7) {
+		t.Errorf("phải đọc số dư ví của người dùng trong session, có %+v", calls)
+	}
+
+	req.WalletAmount = 30000
+	quote, err := s.Quote(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.WalletAmount != 30000 || quote.Total != 70000 {
+		t.Errorf("WalletAmount = %d, Total = %d, muốn 30000 và 70000", quote.WalletAmount, quote.Total)
+	}
+}
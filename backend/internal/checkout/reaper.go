@@ -0,0 +1,93 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"backend/internal/inventory"
+	"backend/internal/orderstatus"
+)
+
+// ReapExpired hủy các đơn pending đã hết hạn giữ hàng (hoàn voucher và trả hàng về kho như
+// khi IPN báo thanh toán thất bại) rồi đóng các dòng giữ hàng hết hạn còn lại.
+func (s *Service) ReapExpired(ctx context.Context) (cancelled int, err error) {
+	now := s.now()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT o.id
+		FROM orders o
+		JOIN stock_reservations r ON r.order_id = o.id
+		WHERE o.status = $1 AND r.released_at IS NULL AND r.expires_at <= $2
+	`, string(orderstatus.Pending), now)
+	if err != nil {
+		return 0, err
+	}
+	var orderIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orderIDs = append(orderIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, orderID := range orderIDs {
+		ok, err := s.cancelExpired(ctx, orderID)
+		if err != nil {
+			log.Printf("ERROR cancelling expired order %d: %v", orderID, err)
+			continue
+		}
+		if ok {
+			cancelled++
+		}
+	}
+
+	if _, err := inventory.ReleaseExpired(ctx, s.db, now); err != nil {
+		return cancelled, err
+	}
+	return cancelled, nil
+}
+
+func (s *Service) cancelExpired(ctx context.Context, orderID int) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = orderstatus.Transition(ctx, tx, orderID, orderstatus.Cancelled, orderstatus.System, "Hết thời gian giữ hàng chờ thanh toán", s.now())
+	var te *orderstatus.TransitionError
+	if errors.As(err, &te) {
+		// Đơn vừa được thanh toán/xử lý trong lúc quét
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// RunReaper chạy ReapExpired định kỳ cho tới khi ctx bị hủy.
+func (s *Service) RunReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := s.ReapExpired(ctx); err != nil {
+			log.Printf("ERROR reaping expired reservations: %v", err)
+		} else if n > 0 {
+			log.Printf("Cancelled %d unpaid orders with expired stock reservations", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
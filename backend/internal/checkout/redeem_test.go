@@ -0,0 +1,63 @@
+package checkout
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"backend/internal/dbtest"
+)
+
+func TestRedeemPromoRecountsPerUserUsageAfterLock(t *testing.T) {
+	cases := []struct {
+		name    string
+		limit   int64
+		used    int64
+		wantErr string
+	}{
+		{"còn lượt", 2, 1, ""},
+		{"hết lượt", 1, 1, "Bạn đã dùng hết lượt của mã khuyến mãi này"},
+	}
+	for _, c := range cases {
+		fake, db := dbtest.New()
+		fake.On("UPDATE vouchers SET used_count", dbtest.Rows([]driver.Value{c.limit}))
+		fake.On("FROM voucher_redemptions", dbtest.Rows([]driver.Value{c.used}))
+		tx, _ := db.Begin()
+
+		err := redeemPromo(context.Background(), tx, 5, 7, 12)
+		tx.Rollback()
+		if c.wantErr == "" {
+			if err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			if len(fake.Calls("INSERT INTO voucher_redemptions")) != 1 {
+				t.Errorf("%s: phải ghi lượt dùng", c.name)
+			}
+			continue
+		}
+		var e *Error
+		if !errors.As(err, &e) || e.Message != c.wantErr {
+			t.Fatalf("%s: err = %v, muốn %q", c.name, err, c.wantErr)
+		}
+		if len(fake.Calls("INSERT INTO voucher_redemptions")) != 0 {
+			t.Errorf("%s: không được ghi lượt dùng", c.name)
+		}
+	}
+}
+
+func TestRedeemPromoRejectsExhaustedCode(t *testing.T) {
+	// UPDATE có điều kiện không khớp dòng nào khi đã đạt usage_limit
+	fake, db := dbtest.New()
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+
+	err := redeemPromo(context.Background(), tx, 5, 7, 12)
+	var e *Error
+	if !errors.As(err, &e) || e.Message != "Mã khuyến mãi đã hết lượt sử dụng" {
+		t.Fatalf("err = %v, muốn mã hết lượt", err)
+	}
+	if len(fake.Calls("FROM voucher_redemptions")) != 0 {
+		t.Error("không cần đếm lượt của người dùng khi mã đã hết lượt")
+	}
+}
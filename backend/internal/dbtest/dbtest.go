@@ -0,0 +1,190 @@
+// Package dbtest là một driver database/sql giả cho unit test: mỗi câu lệnh được ghi lại, câu
+// SELECT/RETURNING trả về các dòng do test khai báo theo một đoạn của câu SQL.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Call là một câu lệnh đã chạy cùng tham số của nó.
+type Call struct {
+	Query string
+	Args  []driver.Value
+}
+
+// Responder trả về các dòng kết quả cho một câu truy vấn, hoặc lỗi.
+type Responder func(args []driver.Value) ([][]driver.Value, error)
+
+type rule struct {
+	fragment string
+	respond  Responder
+}
+
+// DB ghi lại mọi câu lệnh và trả lời truy vấn theo các rule đã khai báo.
+type DB struct {
+	mu    sync.Mutex
+	rules []rule
+	calls []Call
+	// Commits và Rollbacks đếm số transaction đã kết thúc.
+	Commits   int
+	Rollbacks int
+}
+
+// New tạo DB giả và *sql.DB dùng nó.
+func New() (*DB, *sql.DB) {
+	f := &DB{}
+	return f, sql.OpenDB(connector{f})
+}
+
+// On khai báo kết quả cho các câu truy vấn chứa fragment. Rule khai báo sau được ưu tiên, nên
+// test có thể ghi đè rule chung. Câu không khớp rule nào trả về 0 dòng.
+func (f *DB) On(fragment string, respond Responder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, rule{fragment, respond})
+}
+
+// Rows là Responder luôn trả về cùng các dòng.
+func Rows(rows ...[]driver.Value) Responder {
+	return func([]driver.Value) ([][]driver.Value, error) { return rows, nil }
+}
+
+// Calls trả về các câu lệnh đã chạy có chứa fragment, theo thứ tự.
+func (f *DB) Calls(fragment string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []Call
+	for _, c := range f.calls {
+		if strings.Contains(c.Query, fragment) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (f *DB) run(query string, args []driver.NamedValue) ([][]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Query: query, Args: values})
+	var match *rule
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		if strings.Contains(query, f.rules[i].fragment) {
+			match = &f.rules[i]
+			break
+		}
+	}
+	f.mu.Unlock()
+	if match == nil {
+		return nil, nil
+	}
+	return match.respond(values)
+}
+
+type connector struct{ db *DB }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return &conn{c.db}, nil }
+func (c connector) Driver() driver.Driver                        { return drv{} }
+
+type drv struct{}
+
+func (drv) Open(string) (driver.Conn, error) { return nil, driver.ErrSkip }
+
+type conn struct{ db *DB }
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) { return &stmt{c.db, query}, nil }
+func (c *conn) Close() error                              { return nil }
+func (c *conn) Begin() (driver.Tx, error)                 { return tx{c.db}, nil }
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	// Tên cột không quan trọng với Scan, chỉ cần đúng số cột
+	var columns []string
+	if len(rows) > 0 {
+		for i := range rows[0] {
+			columns = append(columns, fmt.Sprintf("c%d", i))
+		}
+	}
+	return &resultRows{columns: columns, rows: rows}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	affected := int64(1)
+	if rows != nil {
+		affected = int64(len(rows))
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+type tx struct{ db *DB }
+
+func (t tx) Commit() error {
+	t.db.mu.Lock()
+	t.db.Commits++
+	t.db.mu.Unlock()
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.db.mu.Lock()
+	t.db.Rollbacks++
+	t.db.mu.Unlock()
+	return nil
+}
+
+type stmt struct {
+	db    *DB
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return (&conn{s.db}).ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return (&conn{s.db}).QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	out := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		out[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return out
+}
+
+type resultRows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *resultRows) Columns() []string { return r.columns }
+func (r *resultRows) Close() error      { return nil }
+
+func (r *resultRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
@@ -0,0 +1,176 @@
+// Package inventory quản lý tồn kho và việc giữ hàng (stock_reservations) cho đơn chưa giao.
+//
+// Vòng đời của một dòng giữ hàng:
+//   - tạo lúc đặt hàng, có expires_at nếu đơn phải thanh toán trước;
+//   - Keep bỏ hạn khi đơn đã thanh toán/xác nhận;
+//   - Deduct trừ kho thật và đóng dòng giữ hàng khi giao hàng;
+//   - Release đóng dòng giữ hàng khi đơn bị hủy hoặc hết hạn.
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+var ErrOutOfStock = errors.New("sản phẩm trong kho không đủ")
+
+// Product là tồn kho khả dụng của một sản phẩm (đã trừ phần đang được giữ).
+type Product struct {
+	ID         int
+	Name       string
+	Price      int64
+	CategoryID int // 0 nếu sản phẩm chưa có danh mục
+	Available  int
+	// Type là products.product_type: food hoặc gift_card.
+	Type string
+}
+
+const availableQuery = `
+	SELECT p.id, p.name, p.price, COALESCE(p.category_id, 0),
+	       p.quantity - COALESCE((
+	           SELECT SUM(r.quantity) FROM stock_reservations r
+	           WHERE r.product_id = p.id AND r.released_at IS NULL
+	           AND (r.expires_at IS NULL OR r.expires_at > $2)
+	       ), 0),
+	       p.product_type
+	FROM products p
+	WHERE p.id = $1`
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// LoadProducts đọc giá và tồn kho khả dụng. Với lock = true các dòng products bị khóa
+// (theo thứ tự id để tránh deadlock) cho tới hết transaction. Sản phẩm không tồn tại bị bỏ qua.
+func LoadProducts(ctx context.Context, q querier, ids []int, now time.Time, lock bool) (map[int]Product, error) {
+	unique := make([]int, 0, len(ids))
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	sort.Ints(unique)
+
+	query := availableQuery
+	if lock {
+		query += " FOR UPDATE OF p"
+	}
+	products := make(map[int]Product, len(unique))
+	for _, id := range unique {
+		var p Product
+		err := q.QueryRowContext(ctx, query, id, now).Scan(&p.ID, &p.Name, &p.Price, &p.CategoryID, &p.Available, &p.Type)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		products[p.ID] = p
+	}
+	return products, nil
+}
+
+// Reserve giữ hàng cho đơn. expiresAt = nil nghĩa là giữ tới khi giao hoặc hủy.
+// Phải gọi sau LoadProducts(lock = true) trong cùng transaction.
+func Reserve(ctx context.Context, tx *sql.Tx, orderID int, quantities map[int]int, expiresAt *time.Time) error {
+	for productID, quantity := range quantities {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO stock_reservations (order_id, product_id, quantity, expires_at)
+			VALUES ($1, $2, $3, $4)
+		`, orderID, productID, quantity, expiresAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keep bỏ hạn giữ hàng của đơn (đơn đã thanh toán hoặc đã được xác nhận).
+func Keep(ctx context.Context, tx *sql.Tx, orderID int) error {
+	_, err := tx.ExecContext(ctx,
+		"UPDATE stock_reservations SET expires_at = NULL WHERE order_id = $1 AND released_at IS NULL",
+		orderID,
+	)
+	return err
+}
+
+// Release trả lại phần hàng đang giữ của đơn.
+func Release(ctx context.Context, tx *sql.Tx, orderID int) error {
+	_, err := tx.ExecContext(ctx,
+		"UPDATE stock_reservations SET released_at = NOW() WHERE order_id = $1 AND released_at IS NULL",
+		orderID,
+	)
+	return err
+}
+
+// Deduct trừ kho theo order_items khi hàng rời kho và đóng các dòng giữ hàng của đơn.
+func Deduct(ctx context.Context, tx *sql.Tx, orderID int) error {
+	lines, err := orderLines(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE products SET quantity = quantity - $1 WHERE id = $2 AND quantity >= $1",
+			l.quantity, l.productID,
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrOutOfStock
+		}
+	}
+	return Release(ctx, tx, orderID)
+}
+
+// Restock cộng lại kho cho đơn đã trừ kho nhưng bị hủy/hoàn tiền.
+func Restock(ctx context.Context, tx *sql.Tx, orderID int) error {
+	lines, err := orderLines(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if _, err := tx.ExecContext(ctx, "UPDATE products SET quantity = quantity + $1 WHERE id = $2", l.quantity, l.productID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseExpired đóng các dòng giữ hàng đã hết hạn, trả về số dòng đã đóng.
+func ReleaseExpired(ctx context.Context, db *sql.DB, now time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		"UPDATE stock_reservations SET released_at = $1 WHERE released_at IS NULL AND expires_at <= $1",
+		now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+type orderLine struct{ productID, quantity int }
+
+func orderLines(ctx context.Context, tx *sql.Tx, orderID int) ([]orderLine, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT product_id, quantity FROM order_items WHERE order_id = $1", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []orderLine
+	for rows.Next() {
+		var l orderLine
+		if err := rows.Scan(&l.productID, &l.quantity); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
@@ -0,0 +1,441 @@
+// Package loyalty quản lý điểm thưởng: cộng điểm khi đơn hoàn thành, dùng điểm khi đặt hàng,
+// thu hồi điểm khi đơn bị hủy/hoàn tiền và hết hạn điểm. Mọi thay đổi được ghi vào loyalty_ledger;
+// điểm khả dụng là tổng remaining của các lô cộng điểm chưa hết hạn.
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"backend/internal/models"
+)
+
+// Các loại dòng trong sổ điểm.
+const (
+	TypeEarn     = "earn"
+	TypeRedeem   = "redeem"
+	TypeRestore  = "restore"
+	TypeClawback = "clawback"
+	TypeExpire   = "expire"
+	TypeAdjust   = "adjust"
+)
+
+// Chính sách mặc định: 1 điểm cho mỗi 10.000đ, 1 điểm = 100đ, tối đa 50% đơn, hạn 365 ngày.
+const (
+	DefaultSpendPerPoint    = 10000
+	DefaultPointValue       = 100
+	DefaultMaxRedeemPercent = 50
+	DefaultValidDays        = 365
+)
+
+// ErrInsufficientPoints: người dùng không đủ điểm khả dụng.
+var ErrInsufficientPoints = errors.New("không đủ điểm thưởng")
+
+// PolicyFromEnv đọc LOYALTY_SPEND_PER_POINT, LOYALTY_POINT_VALUE, LOYALTY_MAX_REDEEM_PERCENT và
+// LOYALTY_VALID_DAYS; giá trị thiếu hoặc không hợp lệ dùng mặc định.
+func PolicyFromEnv() models.LoyaltyPolicy {
+	policy := models.LoyaltyPolicy{
+		SpendPerPoint:    envInt("LOYALTY_SPEND_PER_POINT", DefaultSpendPerPoint),
+		PointValue:       envInt("LOYALTY_POINT_VALUE", DefaultPointValue),
+		MaxRedeemPercent: envInt("LOYALTY_MAX_REDEEM_PERCENT", DefaultMaxRedeemPercent),
+		ValidDays:        int(envInt("LOYALTY_VALID_DAYS", DefaultValidDays)),
+	}
+	if policy.MaxRedeemPercent > 100 {
+		policy.MaxRedeemPercent = DefaultMaxRedeemPercent
+	}
+	return policy
+}
+
+func envInt(key string, def int64) int64 {
+	if v, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// EarnedPoints là số điểm nhận được cho đơn đã trả amount.
+func EarnedPoints(policy models.LoyaltyPolicy, amount int64) int {
+	if amount <= 0 {
+		return 0
+	}
+	return int(amount / policy.SpendPerPoint)
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Balance trả về số điểm khả dụng tại now. Với lock = true các lô điểm bị khóa tới hết transaction.
+func Balance(ctx context.Context, q querier, userID int, now time.Time, lock bool) (int, error) {
+	query := `
+		SELECT COALESCE(SUM(remaining), 0) FROM (
+			SELECT remaining FROM loyalty_ledger
+			WHERE user_id = $1 AND remaining > 0 AND (expires_at IS NULL OR expires_at > $2)`
+	if lock {
+		query += " FOR UPDATE"
+	}
+	query += ") lots"
+	var points int
+	err := q.QueryRowContext(ctx, query, userID, now).Scan(&points)
+	return points, err
+}
+
+// Expiring trả về số điểm sẽ hết hạn trong khoảng (now, before].
+func Expiring(ctx context.Context, q querier, userID int, now, before time.Time) (int, error) {
+	var points int
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(remaining), 0) FROM loyalty_ledger
+		WHERE user_id = $1 AND remaining > 0 AND expires_at > $2 AND expires_at <= $3
+	`, userID, now, before).Scan(&points)
+	return points, err
+}
+
+// entry là một dòng cần ghi vào sổ điểm.
+type entry struct {
+	userID  int
+	orderID *int
+	typ     string
+	points  int
+	// lot: dòng cộng điểm có hạn dùng, remaining = points.
+	lot bool
+	// expiresAt: hạn của lô (nil thì tính theo policy.ValidDays), hoặc hạn của lô bị trừ với dòng redeem.
+	expiresAt *time.Time
+	reason    string
+	actor     *int
+}
+
+func insert(ctx context.Context, tx *sql.Tx, e entry, policy models.LoyaltyPolicy, now time.Time) error {
+	var remaining int
+	expiresAt := e.expiresAt
+	if e.lot {
+		remaining = e.points
+		if expiresAt == nil {
+			t := now.AddDate(0, 0, policy.ValidDays)
+			expiresAt = &t
+		}
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO loyalty_ledger (user_id, order_id, type, points, remaining, expires_at, reason, actor_user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, e.userID, e.orderID, e.typ, e.points, remaining, expiresAt, e.reason, e.actor)
+	return err
+}
+
+// lotUse là phần điểm consume đã trừ từ một lô.
+type lotUse struct {
+	id        int64
+	expiresAt sql.NullTime
+	points    int
+}
+
+// consume trừ tối đa points từ các lô còn hạn, lô hết hạn sớm nhất trước. Trả về số điểm đã trừ
+// và phần đã trừ từ từng lô.
+func consume(ctx context.Context, tx *sql.Tx, userID, points int, now time.Time) (int, []lotUse, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, remaining, expires_at FROM loyalty_ledger
+		WHERE user_id = $1 AND remaining > 0 AND (expires_at IS NULL OR expires_at > $2)
+		ORDER BY expires_at NULLS LAST, id
+		FOR UPDATE
+	`, userID, now)
+	if err != nil {
+		return 0, nil, err
+	}
+	var lots []lotUse
+	for rows.Next() {
+		var l lotUse
+		if err := rows.Scan(&l.id, &l.points, &l.expiresAt); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	taken := 0
+	var used []lotUse
+	for _, l := range lots {
+		if taken == points {
+			break
+		}
+		n := min(l.points, points-taken)
+		if _, err := tx.ExecContext(ctx, "UPDATE loyalty_ledger SET remaining = remaining - $1 WHERE id = $2", n, l.id); err != nil {
+			return taken, used, err
+		}
+		taken += n
+		l.points = n
+		used = append(used, l)
+	}
+	return taken, used, nil
+}
+
+// Earn cộng điểm cho đơn vừa hoàn thành theo số tiền khách đã trả. Đơn của khách vãng lai hoặc
+// đơn đã được cộng điểm thì bỏ qua.
+func Earn(ctx context.Context, tx *sql.Tx, orderID int, now time.Time) error {
+	var userID sql.NullInt64
+	var total int64
+	err := tx.QueryRowContext(ctx, "SELECT user_id, total_amount FROM orders WHERE id = $1", orderID).Scan(&userID, &total)
+	if err != nil {
+		return fmt.Errorf("load order: %w", err)
+	}
+	policy := PolicyFromEnv()
+	points := EarnedPoints(policy, total)
+	if !userID.Valid || points == 0 {
+		return nil
+	}
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM loyalty_ledger WHERE order_id = $1 AND type = $2)
+	`, orderID, TypeEarn).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	return insert(ctx, tx, entry{
+		userID: int(userID.Int64), orderID: &orderID, typ: TypeEarn, points: points, lot: true,
+		reason: fmt.Sprintf("Hoàn thành đơn hàng #%d", orderID),
+	}, policy, now)
+}
+
+// Redeem trừ points điểm của người dùng cho đơn orderID. Phải gọi sau Balance(lock = true)
+// trong cùng transaction. Mỗi lô bị trừ được ghi thành một dòng redeem mang hạn của lô, để
+// RestoreRedeemed trả điểm về với đúng hạn cũ.
+func Redeem(ctx context.Context, tx *sql.Tx, userID, orderID, points int, now time.Time) error {
+	taken, used, err := consume(ctx, tx, userID, points, now)
+	if err != nil {
+		return err
+	}
+	if taken < points {
+		return ErrInsufficientPoints
+	}
+	for _, u := range used {
+		e := entry{
+			userID: userID, orderID: &orderID, typ: TypeRedeem, points: -u.points,
+			reason: fmt.Sprintf("Dùng điểm cho đơn hàng #%d", orderID),
+		}
+		if u.expiresAt.Valid {
+			e.expiresAt = &u.expiresAt.Time
+		}
+		if err := insert(ctx, tx, e, models.LoyaltyPolicy{}, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreRedeemed trả lại điểm đã dùng cho đơn bị hủy/hoàn tiền thành các lô mới giữ nguyên hạn
+// của lô đã bị trừ, để việc đặt rồi hủy đơn không kéo dài hạn điểm. Lô đã quá hạn sẽ bị
+// ExpireLots đóng lại. Dòng redeem cũ không ghi hạn thì điểm được trả với hạn mới.
+func RestoreRedeemed(ctx context.Context, tx *sql.Tx, orderID int, now time.Time) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT user_id, expires_at, -SUM(points) FROM loyalty_ledger
+		WHERE order_id = $1 AND type IN ($2, $3)
+		GROUP BY user_id, expires_at
+		ORDER BY expires_at NULLS LAST
+	`, orderID, TypeRedeem, TypeRestore)
+	if err != nil {
+		return err
+	}
+	type group struct {
+		userID    int
+		expiresAt sql.NullTime
+		net       int
+	}
+	var groups []group
+	total := 0
+	for rows.Next() {
+		var g group
+		if err := rows.Scan(&g.userID, &g.expiresAt, &g.net); err != nil {
+			rows.Close()
+			return err
+		}
+		groups = append(groups, g)
+		total += g.net
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// Đã trả đủ (kể cả khi lần trả trước dùng hạn mới cho dòng redeem không ghi hạn)
+	if total <= 0 {
+		return nil
+	}
+
+	policy := PolicyFromEnv()
+	for _, g := range groups {
+		if g.net <= 0 {
+			continue
+		}
+		e := entry{
+			userID: g.userID, orderID: &orderID, typ: TypeRestore, points: g.net, lot: true,
+			reason: fmt.Sprintf("Hoàn điểm đã dùng cho đơn hàng #%d", orderID),
+		}
+		if g.expiresAt.Valid {
+			e.expiresAt = &g.expiresAt.Time
+		}
+		if err := insert(ctx, tx, e, policy, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clawback thu hồi phần điểm đã cộng cho đơn tương ứng với tỷ lệ refunded/paid (1/1 khi hủy
+// hoặc hoàn toàn bộ). Điểm được trừ từ lô của đơn trước, sau đó tới các lô khác; nếu người dùng
+// đã tiêu hết điểm thì chỉ thu hồi được phần còn lại.
+func Clawback(ctx context.Context, tx *sql.Tx, orderID int, refunded, paid int64, now time.Time) error {
+	var lotID int64
+	var userID, earned, lotRemaining int
+	var lotExpires sql.NullTime
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, user_id, points, remaining, expires_at FROM loyalty_ledger
+		WHERE order_id = $1 AND type = $2
+		FOR UPDATE
+	`, orderID, TypeEarn).Scan(&lotID, &userID, &earned, &lotRemaining, &lotExpires)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	target := earned
+	if paid > 0 && refunded < paid {
+		target = int(int64(earned) * refunded / paid)
+	}
+	var already int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(-SUM(points), 0) FROM loyalty_ledger WHERE order_id = $1 AND type = $2
+	`, orderID, TypeClawback).Scan(&already)
+	if err != nil {
+		return err
+	}
+	want := target - already
+	if want <= 0 {
+		return nil
+	}
+
+	taken := 0
+	if lotRemaining > 0 && (!lotExpires.Valid || lotExpires.Time.After(now)) {
+		taken = min(lotRemaining, want)
+		if _, err := tx.ExecContext(ctx, "UPDATE loyalty_ledger SET remaining = remaining - $1 WHERE id = $2", taken, lotID); err != nil {
+			return err
+		}
+	}
+	if taken < want {
+		n, _, err := consume(ctx, tx, userID, want-taken, now)
+		if err != nil {
+			return err
+		}
+		taken += n
+	}
+	if taken < want {
+		log.Printf("WARNING loyalty clawback for order %d: user %d only had %d of %d points", orderID, userID, taken, want)
+	}
+	if taken == 0 {
+		return nil
+	}
+	return insert(ctx, tx, entry{
+		userID: userID, orderID: &orderID, typ: TypeClawback, points: -taken,
+		reason: fmt.Sprintf("Thu hồi điểm của đơn hàng #%d", orderID),
+	}, models.LoyaltyPolicy{}, now)
+}
+
+// Adjust cộng (points > 0) hoặc trừ (points < 0) điểm thủ công. Trừ quá số điểm khả dụng trả về
+// ErrInsufficientPoints.
+func Adjust(ctx context.Context, tx *sql.Tx, userID, points int, reason string, actorID int, now time.Time) error {
+	if points < 0 {
+		taken, _, err := consume(ctx, tx, userID, -points, now)
+		if err != nil {
+			return err
+		}
+		if taken < -points {
+			return ErrInsufficientPoints
+		}
+	}
+	return insert(ctx, tx, entry{
+		userID: userID, typ: TypeAdjust, points: points, lot: points > 0, reason: reason, actor: &actorID,
+	}, PolicyFromEnv(), now)
+}
+
+// ExpireLots đóng các lô điểm đã hết hạn và ghi một dòng expire cho mỗi lô.
+func ExpireLots(ctx context.Context, db *sql.DB, now time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, `
+		WITH old AS (
+			SELECT id, user_id, remaining FROM loyalty_ledger
+			WHERE remaining > 0 AND expires_at <= $1
+			FOR UPDATE
+		), expired AS (
+			UPDATE loyalty_ledger l SET remaining = 0
+			FROM old WHERE l.id = old.id
+			RETURNING old.id, old.user_id, old.remaining
+		)
+		INSERT INTO loyalty_ledger (user_id, type, points, reason)
+		SELECT user_id, $2, -remaining, 'Điểm hết hạn (lô #' || id || ')' FROM expired
+	`, now, TypeExpire)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunExpirer chạy ExpireLots định kỳ cho tới khi ctx bị hủy.
+func RunExpirer(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := ExpireLots(ctx, db, time.Now()); err != nil {
+			log.Printf("ERROR expiring loyalty points: %v", err)
+		} else if n > 0 {
+			log.Printf("Expired %d loyalty point lots", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// History trả về các dòng sổ điểm của người dùng, mới nhất trước.
+func History(ctx context.Context, db *sql.DB, userID, limit, offset int) ([]models.LoyaltyEntry, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, order_id, type, points, remaining, expires_at, reason, created_at
+		FROM loyalty_ledger
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.LoyaltyEntry{}
+	for rows.Next() {
+		var e models.LoyaltyEntry
+		var orderID sql.NullInt64
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&e.ID, &orderID, &e.Type, &e.Points, &e.Remaining, &expiresAt, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			e.OrderID = &id
+		}
+		if expiresAt.Valid {
+			e.ExpiresAt = &expiresAt.Time
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,185 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+)
+
+var testNow = time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+func TestEarnIsIdempotent(t *testing.T) {
+	for _, earned := range []bool{false, true} {
+		fake, db := dbtest.New()
+		fake.On("SELECT user_id, total_amount FROM orders", dbtest.Rows([]driver.Value{int64(7), int64(200000)}))
+		fake.On("SELECT EXISTS", dbtest.Rows([]driver.Value{earned}))
+		tx, _ := db.Begin()
+
+		if err := Earn(context.Background(), tx, 12, testNow); err != nil {
+			t.Fatal(err)
+		}
+		tx.Rollback()
+		lots := fake.Calls("INSERT INTO loyalty_ledger")
+		if earned {
+			if len(lots) != 0 {
+				t.Error("đơn đã được cộng điểm thì không được cộng lần nữa")
+			}
+			continue
+		}
+		if len(lots) != 1 || lots[0].Args[2] != TypeEarn || lots[0].Args[3] != int64(20) || lots[0].Args[4] != int64(20) {
+			t.Fatalf("phải cộng một lô 20 điểm, có %+v", lots)
+		}
+		want := testNow.AddDate(0, 0, PolicyFromEnv().ValidDays)
+		if got, ok := lots[0].Args[5].(time.Time); !ok || !got.Equal(want) {
+			t.Errorf("expires_at = %v, muốn %v", lots[0].Args[5], want)
+		}
+	}
+}
+
+func TestRedeemTakesSoonestExpiringLotsFirst(t *testing.T) {
+	soon, later := testNow.AddDate(0, 1, 0), testNow.AddDate(0, 6, 0)
+	fake, db := dbtest.New()
+	// Các lô trả về theo ORDER BY expires_at
+	fake.On("SELECT id, remaining, expires_at FROM loyalty_ledger", dbtest.Rows(
+		[]driver.Value{int64(3), int64(30), soon},
+		[]driver.Value{int64(5), int64(50), later},
+		[]driver.Value{int64(8), int64(40), nil},
+	))
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+
+	if err := Redeem(context.Background(), tx, 7, 12, 60, testNow); err != nil {
+		t.Fatal(err)
+	}
+	lots := fake.Calls("SELECT id, remaining, expires_at FROM loyalty_ledger")
+	if len(lots) != 1 || lots[0].Args[1] != testNow {
+		t.Fatalf("phải chỉ lấy lô còn hạn tại now, có %+v", lots)
+	}
+	updates := fake.Calls("SET remaining = remaining -")
+	if len(updates) != 2 ||
+		updates[0].Args[0] != int64(30) || updates[0].Args[1] != int64(3) ||
+		updates[1].Args[0] != int64(30) || updates[1].Args[1] != int64(5) {
+		t.Fatalf("phải trừ hết lô #3 rồi 30 điểm của lô #5, có %+v", updates)
+	}
+	redeems := fake.Calls("INSERT INTO loyalty_ledger")
+	if len(redeems) != 2 || redeems[0].Args[3] != int64(-30) || redeems[0].Args[5] != soon || redeems[1].Args[5] != later {
+		t.Errorf("mỗi lô bị trừ phải có một dòng redeem mang hạn của lô, có %+v", redeems)
+	}
+}
+
+func TestRedeemRejectsInsufficientPoints(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("SELECT id, remaining, expires_at FROM loyalty_ledger", dbtest.Rows([]driver.Value{int64(3), int64(30), testNow.AddDate(0, 1, 0)}))
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+
+	if err := Redeem(context.Background(), tx, 7, 12, 60, testNow); err != ErrInsufficientPoints {
+		t.Fatalf("err = %v, muốn ErrInsufficientPoints", err)
+	}
+	if len(fake.Calls("INSERT INTO loyalty_ledger")) != 0 {
+		t.Error("không được ghi dòng redeem khi không đủ điểm")
+	}
+}
+
+func TestClawbackIsProportionalToRefund(t *testing.T) {
+	cases := []struct {
+		name     string
+		refunded int64
+		already  int64
+		want     int64
+	}{
+		{"hoàn 1/4", 50000, 0, 5},
+		{"hoàn thêm tới 1/2", 100000, 5, 5},
+		{"đã thu hồi đủ", 100000, 10, 0},
+		{"hoàn toàn bộ", 200000, 10, 10},
+	}
+	for _, c := range cases {
+		fake, db := dbtest.New()
+		// Đơn 200.000đ được cộng 20 điểm, lô còn nguyên
+		fake.On("SELECT id, user_id, points, remaining, expires_at FROM loyalty_ledger", dbtest.Rows(
+			[]driver.Value{int64(9), int64(7), int64(20), int64(20), testNow.AddDate(1, 0, 0)},
+		))
+		fake.On("SELECT COALESCE(-SUM(points), 0) FROM loyalty_ledger", dbtest.Rows([]driver.Value{c.already}))
+		tx, _ := db.Begin()
+
+		err := Clawback(context.Background(), tx, 12, c.refunded, 200000, testNow)
+		tx.Rollback()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		clawbacks := fake.Calls("INSERT INTO loyalty_ledger")
+		if c.want == 0 {
+			if len(clawbacks) != 0 {
+				t.Errorf("%s: không được thu hồi thêm, có %+v", c.name, clawbacks)
+			}
+			continue
+		}
+		updates := fake.Calls("SET remaining = remaining -")
+		if len(updates) != 1 || updates[0].Args[0] != c.want || updates[0].Args[1] != int64(9) {
+			t.Errorf("%s: phải trừ %d điểm từ lô của đơn, có %+v", c.name, c.want, updates)
+		}
+		if len(clawbacks) != 1 || clawbacks[0].Args[2] != TypeClawback || clawbacks[0].Args[3] != -c.want {
+			t.Errorf("%s: phải ghi thu hồi %d điểm, có %+v", c.name, c.want, clawbacks)
+		}
+	}
+}
+
+func TestRestoreRedeemedKeepsLotExpiry(t *testing.T) {
+	soon, later := testNow.AddDate(0, 1, 0), testNow.AddDate(0, 6, 0)
+	fake, db := dbtest.New()
+	fake.On("SELECT user_id, expires_at, -SUM(points) FROM loyalty_ledger", dbtest.Rows(
+		[]driver.Value{int64(7), soon, int64(30)},
+		[]driver.Value{int64(7), later, int64(30)},
+	))
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+
+	if err := RestoreRedeemed(context.Background(), tx, 12, testNow.AddDate(0, 0, 10)); err != nil {
+		t.Fatal(err)
+	}
+	lots := fake.Calls("INSERT INTO loyalty_ledger")
+	if len(lots) != 2 {
+		t.Fatalf("phải trả lại hai lô, có %+v", lots)
+	}
+	for i, want := range []time.Time{soon, later} {
+		if lots[i].Args[2] != TypeRestore || lots[i].Args[4] != int64(30) || lots[i].Args[5] != want {
+			t.Errorf("lô %d = %+v, muốn 30 điểm hạn %v", i, lots[i].Args, want)
+		}
+	}
+}
+
+func TestRestoreRedeemedIsIdempotent(t *testing.T) {
+	fake, db := dbtest.New()
+	// Đơn đã được trả điểm: redeem và restore cùng hạn triệt tiêu nhau
+	fake.On("SELECT user_id, expires_at, -SUM(points) FROM loyalty_ledger", dbtest.Rows(
+		[]driver.Value{int64(7), testNow.AddDate(0, 1, 0), int64(0)},
+	))
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+
+	if err := RestoreRedeemed(context.Background(), tx, 12, testNow); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Calls("INSERT INTO loyalty_ledger")) != 0 {
+		t.Error("không được trả điểm lần nữa")
+	}
+}
+
+func TestExpireLotsUsesCallerTime(t *testing.T) {
+	fake, db := dbtest.New()
+
+	n, err := ExpireLots(context.Background(), db, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.Calls("WITH old AS")
+	if len(calls) != 1 || calls[0].Args[0] != testNow || calls[0].Args[1] != TypeExpire {
+		t.Fatalf("phải đóng các lô hết hạn trước now, có %+v", calls)
+	}
+	if n != 1 {
+		t.Errorf("n = %d, muốn 1", n)
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// VoucherCampaign là chiến dịch tự động tặng voucher cho một nhóm người dùng.
+type VoucherCampaign struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	VoucherID   int    `json:"voucher_id"`
+	VoucherCode string `json:"voucher_code,omitempty"`
+	// Segment: inactive (không đặt hàng trong InactiveDays ngày) | birthday_month
+	Segment       string     `json:"segment"`
+	InactiveDays  int        `json:"inactive_days"`
+	IntervalHours int        `json:"interval_hours"`
+	EmailSubject  string     `json:"email_subject"`
+	EmailMessage  string     `json:"email_message"`
+	StartsAt      time.Time  `json:"starts_at"`
+	EndsAt        *time.Time `json:"ends_at"`
+	IsActive      bool       `json:"is_active"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt     time.Time  `json:"next_run_at"`
+	Deliveries    int        `json:"deliveries"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// CampaignDelivery là một lần tặng voucher của chiến dịch cho một người dùng.
+type CampaignDelivery struct {
+	ID            int64      `json:"id"`
+	UserID        int        `json:"user_id"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email"`
+	UserVoucherID *int       `json:"user_voucher_id,omitempty"`
+	EmailSentAt   *time.Time `json:"email_sent_at,omitempty"`
+	EmailError    string     `json:"email_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// CampaignRunResult là kết quả một lần chạy chiến dịch.
+type CampaignRunResult struct {
+	Granted     int `json:"granted"`
+	Emailed     int `json:"emailed"`
+	EmailFailed int `json:"email_failed"`
+}
+
+// BirthdayRequest cập nhật ngày sinh (YYYY-MM-DD, rỗng để xóa).
+type BirthdayRequest struct {
+	Birthday string `json:"birthday"`
+}
@@ -0,0 +1,47 @@
+package models
+
+// CheckoutQuote là kết quả tính giá cho một giỏ hàng, dùng chung cho mọi phương thức thanh toán.
+type CheckoutQuote struct {
+	Items                []QuoteItem `json:"items"`
+	Subtotal             int64       `json:"subtotal"`
+	DiscountAmount       int64       `json:"discount_amount"`
+	Total                int64       `json:"total"`
+	AppliedUserVoucherID *int        `json:"applied_user_voucher_id,omitempty"`
+	// PromotionDiscount là phần giảm giá từ khuyến mãi tự động, đã tính trong DiscountAmount.
+	PromotionDiscount int64 `json:"promotion_discount"`
+	// PromoVoucherID là voucher của mã khuyến mãi công khai được áp dụng.
+	PromoVoucherID *int `json:"promo_voucher_id,omitempty"`
+	// Voucher là kết quả kiểm tra voucher khách chọn, kể cả khi voucher không áp dụng được.
+	Voucher *VoucherCheck `json:"voucher,omitempty"`
+	// Promotions là các khuyến mãi tự động đã áp dụng, theo thứ tự áp dụng.
+	Promotions []AppliedPromotion `json:"promotions,omitempty"`
+	// PointsRedeemed là số điểm thưởng thực sự được dùng (có thể ít hơn số khách yêu cầu do giới
+	// hạn theo giá trị đơn), PointsDiscount là số tiền tương ứng, đã tính trong DiscountAmount.
+	PointsRedeemed int   `json:"points_redeemed,omitempty"`
+	PointsDiscount int64 `json:"points_discount,omitempty"`
+	// WalletAmount là phần trả bằng ví, đã trừ khỏi Total (Total là số tiền còn phải thanh toán).
+	WalletAmount int64 `json:"wallet_amount,omitempty"`
+}
+
+type QuoteItem struct {
+	ProductID   int    `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+	UnitPrice   int64  `json:"unit_price"`
+	LineTotal   int64  `json:"line_total"`
+	// VoucherEligible cho biết món thuộc phạm vi của voucher; Discount là phần giảm giá phân bổ cho món.
+	VoucherEligible bool  `json:"voucher_eligible,omitempty"`
+	Discount        int64 `json:"discount,omitempty"`
+	// Adjustments liệt kê từng khoản giảm (khuyến mãi, voucher) tạo nên Discount.
+	Adjustments []LineAdjustment `json:"adjustments,omitempty"`
+}
+
+// VoucherCheck giải thích voucher có được áp dụng cho giỏ hàng hay không.
+type VoucherCheck struct {
+	UserVoucherID int    `json:"user_voucher_id,omitempty"`
+	Code          string `json:"code,omitempty"`
+	Applicable    bool   `json:"applicable"`
+	Reason        string `json:"reason,omitempty"`
+	// EligibleSubtotal là tổng tiền các món thuộc phạm vi voucher.
+	EligibleSubtotal int64 `json:"eligible_subtotal"`
+}
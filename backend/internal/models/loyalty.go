@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// LoyaltyEntry là một dòng trong sổ điểm thưởng.
+type LoyaltyEntry struct {
+	ID      int64  `json:"id"`
+	OrderID *int   `json:"order_id,omitempty"`
+	Type    string `json:"type"` // earn | redeem | restore | clawback | expire | adjust
+	Points  int    `json:"points"`
+	// Remaining và ExpiresAt chỉ có ý nghĩa với các dòng cộng điểm.
+	Remaining int        `json:"remaining,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// LoyaltyBalance là số điểm khả dụng của người dùng và chính sách quy đổi hiện tại.
+type LoyaltyBalance struct {
+	Points int `json:"points"`
+	// Value là số tiền tương ứng nếu dùng hết điểm.
+	Value int64 `json:"value"`
+	// ExpiringPoints hết hạn trước ExpiringBefore (trong 30 ngày tới).
+	ExpiringPoints int           `json:"expiring_points"`
+	ExpiringBefore time.Time     `json:"expiring_before"`
+	Policy         LoyaltyPolicy `json:"policy"`
+}
+
+// LoyaltyPolicy là quy tắc tích và dùng điểm.
+type LoyaltyPolicy struct {
+	// SpendPerPoint: số tiền (sau giảm giá) để được 1 điểm.
+	SpendPerPoint int64 `json:"spend_per_point"`
+	// PointValue: số tiền được giảm cho 1 điểm khi thanh toán.
+	PointValue int64 `json:"point_value"`
+	// MaxRedeemPercent: tỷ lệ tối đa của đơn hàng được trả bằng điểm.
+	MaxRedeemPercent int64 `json:"max_redeem_percent"`
+	// ValidDays: số ngày điểm còn hạn kể từ lúc được cộng.
+	ValidDays int `json:"valid_days"`
+}
+
+// LoyaltyAdjustRequest là yêu cầu cộng/trừ điểm thủ công của admin.
+type LoyaltyAdjustRequest struct {
+	Points int    `json:"points"`
+	Reason string `json:"reason"`
+}
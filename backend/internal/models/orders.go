@@ -3,37 +3,72 @@ package models
 import "time"
 
 type Order struct {
-	ID              int         `json:"id"`
-	UserID          *int        `json:"user_id,omitempty"`
-	Username        string      `json:"username,omitempty"`
-	CustomerName    string      `json:"customer_name"`
-	CustomerPhone   string      `json:"customer_phone"`
-	ShippingAddress string      `json:"shipping_address"`
-	TotalAmount     int64       `json:"total_amount"`
-	DiscountAmount  int64       `json:"discount_amount"`      
-	VoucherCode     string      `json:"voucher_code,omitempty"` 
-	Status          string      `json:"status"`
-	CreatedAt       time.Time   `json:"created_at"`
-	Items           []OrderItem `json:"items,omitempty"`
+	ID              int                 `json:"id"`
+	UserID          *int                `json:"user_id,omitempty"`
+	Username        string              `json:"username,omitempty"`
+	CustomerName    string              `json:"customer_name"`
+	CustomerPhone   string              `json:"customer_phone"`
+	ShippingAddress string              `json:"shipping_address"`
+	TotalAmount     int64               `json:"total_amount"`
+	DiscountAmount  int64               `json:"discount_amount"`
+	VoucherCode     string              `json:"voucher_code,omitempty"`
+	Status          string              `json:"status"`
+	PaymentMethod   string              `json:"payment_method"`
+	PaymentStatus   string              `json:"payment_status"`
+	CreatedAt       time.Time           `json:"created_at"`
+	Items           []OrderItem         `json:"items,omitempty"`
+	Timeline        []OrderStatusChange `json:"timeline,omitempty"`
+	// AllowedTransitions và Refunds chỉ trả về cho admin
+	AllowedTransitions []string `json:"allowed_transitions,omitempty"`
+	Refunds            []Refund `json:"refunds,omitempty"`
+	// PromotionDiscount là phần giảm giá từ khuyến mãi tự động, đã tính trong DiscountAmount.
+	PromotionDiscount int64 `json:"promotion_discount"`
+	// PointsRedeemed điểm thưởng đã dùng, tương ứng PointsDiscount (đã tính trong DiscountAmount).
+	PointsRedeemed int   `json:"points_redeemed"`
+	PointsDiscount int64 `json:"points_discount"`
+	// WalletAmount là phần khách trả bằng ví (ngoài TotalAmount), WalletRefunded là phần đã trả lại ví.
+	WalletAmount   int64 `json:"wallet_amount"`
+	WalletRefunded int64 `json:"wallet_refunded"`
+}
+
+// OrderStatusChange là một dòng trong order_status_history.
+type OrderStatusChange struct {
+	ID          int       `json:"id"`
+	FromStatus  string    `json:"from_status,omitempty"`
+	ToStatus    string    `json:"to_status"`
+	ActorType   string    `json:"actor_type"`
+	ActorUserID *int      `json:"actor_user_id,omitempty"`
+	ActorName   string    `json:"actor_name,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 type OrderItem struct {
-	ID              int     `json:"id"`
-	OrderID         int     `json:"order_id"`
-	ProductID       int     `json:"product_id"`
-	ProductName     string  `json:"product_name"`
-	ProductImage    string  `json:"product_image"`
-	Quantity        int     `json:"quantity"`
-	PriceAtPurchase int64   `json:"price_at_purchase"`
+	ID              int    `json:"id"`
+	OrderID         int    `json:"order_id"`
+	ProductID       int    `json:"product_id"`
+	ProductName     string `json:"product_name"`
+	ProductImage    string `json:"product_image"`
+	Quantity        int    `json:"quantity"`
+	PriceAtPurchase int64  `json:"price_at_purchase"`
+	// DiscountAmount là tổng giảm giá (khuyến mãi + voucher) phân bổ cho món này.
+	DiscountAmount int64 `json:"discount_amount"`
 }
 
 type CreateOrderRequest struct {
-	UserID          *int               `json:"user_id"`
-	CustomerName    string             `json:"customer_name"`
-	CustomerPhone   string             `json:"customer_phone"`
-	ShippingAddress string             `json:"shipping_address"`
-	CartItems       []CartItemRequest  `json:"cart_items"`
+	// UserID là người dùng của session đăng nhập (nil với khách vãng lai), không đọc từ body.
+	UserID               *int              `json:"-"`
+	CustomerName         string            `json:"customer_name"`
+	CustomerPhone        string            `json:"customer_phone"`
+	ShippingAddress      string            `json:"shipping_address"`
+	CartItems            []CartItemRequest `json:"cart_items"`
 	AppliedUserVoucherID *int              `json:"applied_user_voucher_id"`
+	// PromoCode là mã khuyến mãi công khai khách tự nhập (không dùng chung với voucher đã săn).
+	PromoCode string `json:"promo_code"`
+	// RedeemPoints là số điểm thưởng khách muốn dùng để giảm giá.
+	RedeemPoints int `json:"redeem_points"`
+	// WalletAmount là số tiền khách muốn trả bằng số dư ví.
+	WalletAmount int64 `json:"wallet_amount"`
 }
 
 type CartItemRequest struct {
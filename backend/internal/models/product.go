@@ -19,6 +19,7 @@ type Product struct {
 	ProteinGrams  int       `json:"protein_grams,omitempty"`
 	CarbGrams     int       `json:"carb_grams,omitempty"`
 	FatGrams      int       `json:"fat_grams,omitempty"`     
+	ProductType   string    `json:"product_type,omitempty"` // food | gift_card
 	CreatedAt     time.Time `json:"created_at"`
 }
 
@@ -35,6 +36,7 @@ type ProductPayload struct {
 	ProteinGrams int     `json:"protein_grams"`
 	CarbGrams    int     `json:"carb_grams"`   
 	FatGrams     int     `json:"fat_grams"` 
+	ProductType  string  `json:"product_type"`
 }
 
 type PaginatedProductsResponse struct {
@@ -57,4 +59,5 @@ type NullableProduct struct {
 	ProteinGrams sql.NullInt64
 	CarbGrams    sql.NullInt64
 	FatGrams     sql.NullInt64
+	ProductType  string
 }
\ No newline at end of file
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Promotion là một quy tắc khuyến mãi tự động do admin cấu hình.
+type Promotion struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Priority int    `json:"priority"`
+	// Exclusive: khi được áp dụng thì không xét các quy tắc ưu tiên thấp hơn, và bị bỏ qua nếu
+	// giỏ hàng đã có khuyến mãi khác.
+	Exclusive bool `json:"exclusive"`
+	// AllowVoucher: đơn được áp khuyến mãi này vẫn dùng được voucher/mã khuyến mãi.
+	AllowVoucher bool            `json:"allow_voucher"`
+	Config       PromotionConfig `json:"config"`
+	StartsAt     *time.Time      `json:"starts_at"`
+	EndsAt       *time.Time      `json:"ends_at"`
+	IsActive     bool            `json:"is_active"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// PromotionConfig chứa tham số theo loại quy tắc; các trường không thuộc loại đó bị bỏ qua.
+type PromotionConfig struct {
+	// buy_x_get_y và tiered_spend: phạm vi món (rỗng là mọi món). combo: bộ sản phẩm.
+	ProductIDs  []int `json:"product_ids,omitempty"`
+	CategoryIDs []int `json:"category_ids,omitempty"`
+	// buy_x_get_y: mua BuyQuantity tặng GetQuantity, món tặng là món rẻ nhất trong nhóm và được
+	// giảm GetDiscountPercent (mặc định 100%).
+	BuyQuantity        int   `json:"buy_quantity,omitempty"`
+	GetQuantity        int   `json:"get_quantity,omitempty"`
+	GetDiscountPercent int64 `json:"get_discount_percent,omitempty"`
+	// combo: giá cố định cho mỗi bộ gồm một món của từng sản phẩm trong ProductIDs.
+	ComboPrice int64 `json:"combo_price,omitempty"`
+	// tiered_spend: các bậc theo tổng tiền, áp dụng bậc cao nhất đạt được.
+	Tiers []PromotionTier `json:"tiers,omitempty"`
+}
+
+type PromotionTier struct {
+	MinSubtotal   int64  `json:"min_subtotal"`
+	DiscountType  string `json:"discount_type"`
+	DiscountValue int64  `json:"discount_value"`
+	MaxDiscount   int64  `json:"max_discount,omitempty"`
+}
+
+// AppliedPromotion là khuyến mãi đã áp dụng cho giỏ hàng và tổng tiền được giảm.
+type AppliedPromotion struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Discount int64  `json:"discount"`
+}
+
+// LineAdjustment là một khoản giảm giá trên một món.
+type LineAdjustment struct {
+	Source      string `json:"source"` // promotion | voucher
+	PromotionID *int   `json:"promotion_id,omitempty"`
+	Label       string `json:"label"`
+	Amount      int64  `json:"amount"`
+}
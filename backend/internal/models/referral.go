@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Referral là một lượt giới thiệu: người được giới thiệu đăng ký bằng mã của người giới thiệu.
+type Referral struct {
+	ID               int        `json:"id"`
+	ReferrerID       int        `json:"referrer_id"`
+	ReferrerUsername string     `json:"referrer_username"`
+	ReferredID       int        `json:"referred_id"`
+	ReferredUsername string     `json:"referred_username"`
+	Status           string     `json:"status"` // pending | rewarded | rejected | revoked
+	RejectReason     string     `json:"reject_reason,omitempty"`
+	OrderID          *int       `json:"order_id,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	RewardedAt       *time.Time `json:"rewarded_at,omitempty"`
+}
+
+// ReferralSummary thống kê số lượt giới thiệu theo trạng thái.
+type ReferralSummary struct {
+	Total    int `json:"total"`
+	Pending  int `json:"pending"`
+	Rewarded int `json:"rewarded"`
+	Rejected int `json:"rejected"`
+	// Revoked là lượt đã được thưởng nhưng bị thu hồi do đơn bị hoàn tiền.
+	Revoked int `json:"revoked"`
+	// ConversionRate = Rewarded / (Total - Rejected), tính theo phần trăm.
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// ReferralInfo là mã giới thiệu của người dùng và kết quả giới thiệu của họ.
+type ReferralInfo struct {
+	Code    string          `json:"code"`
+	Summary ReferralSummary `json:"summary"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+type Refund struct {
+	ID               int64        `json:"id"`
+	OrderID          int          `json:"order_id"`
+	Provider         string       `json:"provider"`
+	ExternalRefundID string       `json:"external_refund_id"`
+	ProviderRefundID string       `json:"provider_refund_id,omitempty"`
+	Amount           int64        `json:"amount"`
+	Status           string       `json:"status"`
+	Reason           string       `json:"reason,omitempty"`
+	Message          string       `json:"message,omitempty"`
+	CreatedBy        *int         `json:"created_by,omitempty"`
+	CreatedAt        time.Time    `json:"created_at"`
+	Items            []RefundItem `json:"items"`
+	// WalletRefund là phần hoàn vào ví tạo cùng yêu cầu này, chỉ có trong kết quả tạo refund.
+	WalletRefund *Refund `json:"wallet_refund,omitempty"`
+}
+
+type RefundItem struct {
+	OrderItemID int    `json:"order_item_id"`
+	ProductName string `json:"product_name,omitempty"`
+	Quantity    int    `json:"quantity"`
+	Amount      int64  `json:"amount"`
+}
+
+// CreateRefundRequest: Items rỗng nghĩa là hoàn toàn bộ số tiền còn lại của đơn.
+type CreateRefundRequest struct {
+	Items  []RefundItemRequest `json:"items"`
+	Reason string              `json:"reason"`
+}
+
+type RefundItemRequest struct {
+	OrderItemID int `json:"order_item_id"`
+	Quantity    int `json:"quantity"`
+}
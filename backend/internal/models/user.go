@@ -3,18 +3,25 @@ package models
 import "time"
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	IsAdmin      bool      `json:"is_admin"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID               int        `json:"id"`
+	Username         string     `json:"username"`
+	Email            string     `json:"email"`
+	PasswordHash     string     `json:"-"`
+	IsAdmin          bool       `json:"is_admin"`
+	Role             string     `json:"role"`
+	EmailVerified    bool       `json:"email_verified"`
+	LockedUntil      *time.Time `json:"locked_until,omitempty"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	CreatedAt        time.Time  `json:"created_at"`
 }
 
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// ReferralCode là mã giới thiệu (không bắt buộc); khi có mã thì DeviceID là bắt buộc.
+	ReferralCode string `json:"referral_code"`
+	DeviceID     string `json:"device_id"`
 }
 
 type LoginRequest struct {
@@ -23,11 +30,57 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	ID       int    `json:"id"`
-	Email    string `json:"email"`
-	Token    string `json:"token"`
-	Username string `json:"username"`
-	IsAdmin  bool   `json:"is_admin"`
+	ID            int    `json:"id"`
+	Email         string `json:"email"`
+	Token         string `json:"token"`
+	RefreshToken  string `json:"refresh_token"`
+	ExpiresIn     int64  `json:"expires_in"`
+	Username      string `json:"username"`
+	IsAdmin       bool   `json:"is_admin"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+	// TwoFactorSetupRequired: role bắt buộc 2FA nhưng tài khoản chưa bật, khu vực admin sẽ bị chặn
+	TwoFactorSetupRequired bool `json:"two_factor_setup_required"`
+}
+
+// TwoFactorChallenge được trả về từ /login thay cho LoginResponse khi tài khoản bật 2FA.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	MFAToken          string `json:"mfa_token"`
+	ExpiresIn         int64  `json:"expires_in"`
+}
+
+type TwoFactorLoginRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type UserSession struct {
+	ID         int64     `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
 }
 
 type ForgotPasswordRequest struct {
@@ -35,8 +88,12 @@ type ForgotPasswordRequest struct {
 }
 
 type ResetPasswordRequest struct {
-	Token       string `json:"token"`
-	Password    string `json:"password"`
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
 }
 
 type PasswordResetToken struct {
@@ -45,3 +102,17 @@ type PasswordResetToken struct {
 	TokenHash string
 	ExpiresAt time.Time
 }
+
+type LoginAttempt struct {
+	ID        int64     `json:"id"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Result    string    `json:"result"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
@@ -13,6 +13,19 @@ type Voucher struct {
 	HuntEndTime          time.Time  `json:"hunt_end_time"`
 	ValidDurationDays    int        `json:"valid_duration_days"`
 	ApplicableProductIDs *[]int32   `json:"applicable_product_ids"`
+	ApplicableCategoryIDs *[]int32  `json:"applicable_category_ids"`
+	MinOrderValue        int64      `json:"min_order_value"`
+	// MaxDiscount chỉ dùng cho voucher phần trăm; nil là không giới hạn.
+	MaxDiscount          *int64     `json:"max_discount"`
+	// UsageLimit là tổng số lượt dùng của voucher; nil là không giới hạn.
+	UsageLimit           *int       `json:"usage_limit"`
+	UsedCount            int        `json:"used_count"`
+	// IsPublic: mã khuyến mãi khách tự nhập khi thanh toán, dùng được trong [ValidFrom, ValidUntil]
+	// và tối đa PerUserLimit lần mỗi người.
+	IsPublic             bool       `json:"is_public"`
+	ValidFrom            *time.Time `json:"valid_from"`
+	ValidUntil           *time.Time `json:"valid_until"`
+	PerUserLimit         int        `json:"per_user_limit"`
 	CreatedAt            time.Time  `json:"created_at"`
 }
 
@@ -37,4 +50,12 @@ type VoucherPayload struct {
 	HuntEndTime          time.Time `json:"hunt_end_time"`
 	ValidDurationDays    int       `json:"valid_duration_days"`
 	ApplicableProductIDs []int32   `json:"applicable_product_ids"`
+	ApplicableCategoryIDs []int32  `json:"applicable_category_ids"`
+	MinOrderValue        int64     `json:"min_order_value"`
+	MaxDiscount          *int64    `json:"max_discount"`
+	UsageLimit           *int      `json:"usage_limit"`
+	IsPublic             bool       `json:"is_public"`
+	ValidFrom            *time.Time `json:"valid_from"`
+	ValidUntil           *time.Time `json:"valid_until"`
+	PerUserLimit         int        `json:"per_user_limit"`
 }
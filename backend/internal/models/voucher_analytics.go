@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// VoucherMetrics là hiệu quả của một voucher trong khoảng ngày báo cáo. Chỉ tính các đơn đã
+// xác nhận hoặc thanh toán, chưa bị hủy hay hoàn toàn bộ.
+type VoucherMetrics struct {
+	VoucherID   int    `json:"voucher_id"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	IsPublic    bool   `json:"is_public"`
+	// Claims là số lượt nhận voucher trong khoảng ngày, RedeemedClaims là số lượt trong đó đã dùng.
+	Claims         int `json:"claims"`
+	RedeemedClaims int `json:"redeemed_claims"`
+	// RedemptionRate = RedeemedClaims / Claims, tính theo phần trăm.
+	RedemptionRate float64 `json:"redemption_rate"`
+	// Redemptions là số đơn đặt trong khoảng ngày có dùng voucher (cả mã công khai).
+	Redemptions   int   `json:"redemptions"`
+	TotalDiscount int64 `json:"total_discount"`
+	// Revenue là giá trị các đơn đó (gồm phần trả bằng ví) trừ tiền đã hoàn.
+	Revenue           int64 `json:"revenue"`
+	AverageOrderValue int64 `json:"average_order_value"`
+}
+
+// OrderValueStats là số đơn, doanh thu và giá trị đơn trung bình của một nhóm đơn.
+type OrderValueStats struct {
+	Orders            int   `json:"orders"`
+	Revenue           int64 `json:"revenue"`
+	AverageOrderValue int64 `json:"average_order_value"`
+}
+
+// VoucherAnalytics là báo cáo hiệu quả voucher trong [From, To] (theo ngày, giờ Việt Nam).
+type VoucherAnalytics struct {
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	WithVoucher    OrderValueStats  `json:"with_voucher"`
+	WithoutVoucher OrderValueStats  `json:"without_voucher"`
+	Vouchers       []VoucherMetrics `json:"vouchers"`
+}
@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+// WalletBalance là số dư ví của người dùng.
+type WalletBalance struct {
+	Balance int64 `json:"balance"`
+}
+
+// WalletEntry là một bút toán trên ví người dùng, kèm thông tin giao dịch chứa nó.
+type WalletEntry struct {
+	ID            int64     `json:"id"`
+	TransactionID int64     `json:"transaction_id"`
+	Type          string    `json:"type"` // gift_card_redeem | order_payment | order_refund | adjust
+	Amount        int64     `json:"amount"`
+	OrderID       *int      `json:"order_id,omitempty"`
+	GiftCardCode  string    `json:"gift_card_code,omitempty"`
+	Note          string    `json:"note,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// WalletTransaction là một giao dịch trong sổ kép; tổng Amount của Entries luôn bằng 0.
+type WalletTransaction struct {
+	ID            int64               `json:"id"`
+	Type          string              `json:"type"`
+	OrderID       *int                `json:"order_id,omitempty"`
+	GiftCardID    *int64              `json:"gift_card_id,omitempty"`
+	RefundID      *int64              `json:"refund_id,omitempty"`
+	ActorUserID   *int                `json:"actor_user_id,omitempty"`
+	ActorUsername string              `json:"actor_username,omitempty"`
+	Note          string              `json:"note,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	Entries       []WalletLedgerEntry `json:"entries"`
+}
+
+// WalletLedgerEntry là một bút toán trong giao dịch. Account mô tả tài khoản: username với ví
+// người dùng, mã thẻ với thẻ quà tặng, mã tài khoản với tài khoản hệ thống.
+type WalletLedgerEntry struct {
+	AccountID   int64  `json:"account_id"`
+	AccountKind string `json:"account_kind"` // user | gift_card | system
+	Account     string `json:"account"`
+	Amount      int64  `json:"amount"`
+}
+
+// WalletAudit là kết quả đối soát sổ kép: tổng số dư mọi tài khoản phải bằng 0 và số dư lưu
+// của mỗi tài khoản phải bằng tổng bút toán của nó.
+type WalletAudit struct {
+	Balanced bool `json:"balanced"`
+	// TotalBalance là tổng số dư của mọi tài khoản.
+	TotalBalance int64 `json:"total_balance"`
+	// UserBalances là tổng số dư ví người dùng, GiftCardBalances là tổng số dư thẻ chưa nạp.
+	UserBalances     int64 `json:"user_balances"`
+	GiftCardBalances int64 `json:"gift_card_balances"`
+	// UnbalancedTransactions là các giao dịch có tổng bút toán khác 0.
+	UnbalancedTransactions []int64 `json:"unbalanced_transactions"`
+	// MismatchedAccounts là các tài khoản có số dư lưu khác tổng bút toán.
+	MismatchedAccounts []int64 `json:"mismatched_accounts"`
+}
+
+// GiftCard là thẻ quà tặng. Balance là số dư chưa nạp vào ví.
+type GiftCard struct {
+	ID           int64      `json:"id"`
+	Code         string     `json:"code"`
+	InitialValue int64      `json:"initial_value"`
+	Balance      int64      `json:"balance"`
+	Status       string     `json:"status"` // active | redeemed | void
+	OrderID      *int       `json:"order_id,omitempty"`
+	RedeemedBy   *int       `json:"redeemed_by,omitempty"`
+	RedeemedAt   *time.Time `json:"redeemed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RedeemGiftCardRequest là yêu cầu nạp thẻ quà tặng vào ví.
+type RedeemGiftCardRequest struct {
+	Code string `json:"code"`
+}
+
+// WalletAdjustRequest là yêu cầu cộng/trừ số dư ví thủ công của admin.
+type WalletAdjustRequest struct {
+	Amount int64  `json:"amount"`
+	Reason string `json:"reason"`
+}
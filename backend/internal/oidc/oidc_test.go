@@ -0,0 +1,133 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/oidc"
+	"backend/internal/oidc/oidctest"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func newServer(t *testing.T) *oidctest.Server {
+	t.Helper()
+	s, err := oidctest.NewServer("shop-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	s := newServer(t)
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := s.Provider("google").AuthCodeURL(context.Background(), "st", "no", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, s.URL+"/authorize?") {
+		t.Errorf("URL = %s, muốn authorization_endpoint của discovery", raw)
+	}
+	q := u.Query()
+	for k, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "shop-client",
+		"state":                 "st",
+		"nonce":                 "no",
+		"code_challenge":        challenge,
+		"code_challenge_method": "S256",
+		"scope":                 "openid email profile",
+	} {
+		if got := q.Get(k); got != want {
+			t.Errorf("%s = %q, muốn %q", k, got, want)
+		}
+	}
+	if challenge == verifier {
+		t.Error("code_challenge không được là verifier (phải là S256)")
+	}
+}
+
+func TestExchangeReturnsVerifiedIdentity(t *testing.T) {
+	s := newServer(t)
+	s.IssueCode("good", jwt.MapClaims{
+		"sub": "g-123", "email": "alice@example.com", "email_verified": true, "name": "Alice", "nonce": "n1",
+	})
+
+	id, err := s.Provider("google").Exchange(context.Background(), "good", "verifier-1", "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := oidc.Identity{Subject: "g-123", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if *id != want {
+		t.Errorf("identity = %+v, muốn %+v", *id, want)
+	}
+	form := s.TokenRequests[0]
+	if form.Get("code_verifier") != "verifier-1" || form.Get("grant_type") != "authorization_code" ||
+		form.Get("redirect_uri") != "http://localhost:3000/auth/callback/google" {
+		t.Errorf("token request = %v", form)
+	}
+}
+
+func TestExchangeEmailVerifiedAsString(t *testing.T) {
+	s := newServer(t)
+	s.IssueCode("c", jwt.MapClaims{"sub": "s", "email": "a@b.vn", "email_verified": "true", "nonce": "n"})
+	id, err := s.Provider("p").Exchange(context.Background(), "c", "v", "n")
+	if err != nil || !id.EmailVerified {
+		t.Fatalf("email_verified dạng chuỗi: %+v, %v", id, err)
+	}
+}
+
+func TestExchangeRejectsInvalidTokens(t *testing.T) {
+	s := newServer(t)
+	cases := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"sai nonce", jwt.MapClaims{"sub": "s", "nonce": "other"}},
+		{"sai audience", jwt.MapClaims{"sub": "s", "nonce": "n", "aud": "another-client"}},
+		{"sai issuer", jwt.MapClaims{"sub": "s", "nonce": "n", "iss": "https://evil.example.com"}},
+		{"hết hạn", jwt.MapClaims{"sub": "s", "nonce": "n", "exp": time.Now().Add(-time.Minute).Unix()}},
+		{"thiếu sub", jwt.MapClaims{"nonce": "n"}},
+	}
+	for _, c := range cases {
+		s.IssueCode(c.name, c.claims)
+		if id, err := s.Provider("p").Exchange(context.Background(), c.name, "v", "n"); err == nil {
+			t.Errorf("%s: phải lỗi, có %+v", c.name, id)
+		}
+	}
+
+	if _, err := s.Provider("p").Exchange(context.Background(), "unknown-code", "v", "n"); err == nil {
+		t.Error("code không hợp lệ phải lỗi")
+	}
+}
+
+func TestVerifyIDTokenRejectsForeignSignature(t *testing.T) {
+	s := newServer(t)
+	other := newServer(t)
+
+	// Cùng kid, cùng claims nhưng ký bằng khóa của nhà cung cấp khác
+	forged, err := other.Sign(jwt.MapClaims{"iss": s.URL, "sub": "s", "nonce": "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Provider("p").VerifyIDToken(context.Background(), forged, "n"); err == nil {
+		t.Fatal("token ký bằng khóa khác phải bị từ chối")
+	}
+
+	genuine, _ := s.Sign(jwt.MapClaims{"sub": "s", "nonce": "n"})
+	if _, err := s.Provider("p").VerifyIDToken(context.Background(), genuine, "n"); err != nil {
+		t.Fatalf("token hợp lệ: %v", err)
+	}
+}
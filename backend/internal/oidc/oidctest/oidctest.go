@@ -0,0 +1,129 @@
+// Package oidctest là nhà cung cấp OpenID Connect giả chạy trên httptest cho unit test:
+// discovery, JWKS và token endpoint trả về ID token RS256 do test khai báo theo code.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"backend/internal/oidc"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// KeyID là kid của khóa ký ID token.
+const KeyID = "test-key"
+
+// Server là nhà cung cấp giả. Đóng bằng Close như httptest.Server.
+type Server struct {
+	*httptest.Server
+	ClientID string
+
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]jwt.MapClaims
+	// TokenRequests là các form đã gửi tới token endpoint, theo thứ tự.
+	TokenRequests []url.Values
+}
+
+// NewServer khởi động nhà cung cấp giả cấp token cho clientID.
+func NewServer(clientID string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{ClientID: clientID, key: key, codes: map[string]jwt.MapClaims{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.URL,
+			"authorization_endpoint": s.URL + "/authorize",
+			"token_endpoint":         s.URL + "/token",
+			"jwks_uri":               s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": KeyID,
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	return s, nil
+}
+
+// Provider trả về client OIDC trỏ tới nhà cung cấp giả.
+func (s *Server) Provider(name string) *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		Name:        name,
+		Issuer:      s.URL,
+		ClientID:    s.ClientID,
+		RedirectURL: "http://localhost:3000/auth/callback/" + name,
+	}, s.Client())
+}
+
+// IssueCode khai báo ID token mà token endpoint trả về khi đổi code. iss, aud và exp được
+// điền mặc định nếu claims không có.
+func (s *Server) IssueCode(code string, claims jwt.MapClaims) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code] = claims
+}
+
+// Sign ký claims bằng khóa của nhà cung cấp (điền iss, aud, exp mặc định như IssueCode).
+func (s *Server) Sign(claims jwt.MapClaims) (string, error) {
+	full := jwt.MapClaims{
+		"iss": s.URL,
+		"aud": s.ClientID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, full)
+	token.Header["kid"] = KeyID
+	return token.SignedString(s.key)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.TokenRequests = append(s.TokenRequests, r.PostForm)
+	claims, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := s.Sign(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access-" + r.PostForm.Get("code"),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
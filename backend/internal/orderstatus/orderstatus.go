@@ -0,0 +1,273 @@
+// Package orderstatus khai báo máy trạng thái của đơn hàng: các chuyển trạng thái hợp lệ,
+// quy tắc trừ/hoàn kho đi kèm và lịch sử chuyển trạng thái (order_status_history).
+package orderstatus
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/internal/inventory"
+	"backend/internal/loyalty"
+	"backend/internal/models"
+	"backend/internal/referral"
+	"backend/internal/wallet"
+)
+
+type Status string
+
+const (
+	Pending   Status = "pending"
+	Paid      Status = "paid"
+	Confirmed Status = "confirmed"
+	Preparing Status = "preparing"
+	Shipped   Status = "shipped"
+	Completed Status = "completed"
+	Cancelled Status = "cancelled"
+	Refunded  Status = "refunded"
+)
+
+// transitions liệt kê các trạng thái có thể chuyển tới từ mỗi trạng thái.
+// cancelled và refunded là trạng thái cuối.
+var transitions = map[Status][]Status{
+	Pending:   {Paid, Confirmed, Cancelled},
+	Paid:      {Confirmed, Refunded},
+	Confirmed: {Preparing, Cancelled, Refunded},
+	Preparing: {Shipped, Cancelled, Refunded},
+	Shipped:   {Completed, Cancelled, Refunded},
+	Completed: {Refunded},
+	Cancelled: {},
+	Refunded:  {},
+}
+
+// Parse kiểm tra s có phải trạng thái đã khai báo hay không.
+func Parse(s string) (Status, bool) {
+	_, ok := transitions[Status(s)]
+	return Status(s), ok
+}
+
+// Next trả về các trạng thái có thể chuyển tới từ s.
+func (s Status) Next() []Status {
+	return transitions[s]
+}
+
+func CanTransition(from, to Status) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// holdsStock cho biết hàng đã rời kho ở trạng thái s hay chưa.
+func (s Status) holdsStock() bool {
+	return s == Shipped || s == Completed
+}
+
+// Loại người thực hiện chuyển trạng thái.
+const (
+	ActorCustomer = "customer"
+	ActorStaff    = "staff"
+	ActorSystem   = "system"
+)
+
+type Actor struct {
+	Type   string
+	UserID *int
+}
+
+func Customer(userID *int) Actor { return Actor{Type: ActorCustomer, UserID: userID} }
+func Staff(userID int) Actor     { return Actor{Type: ActorStaff, UserID: &userID} }
+
+// System là thay đổi do hệ thống tự thực hiện (IPN cổng thanh toán, job nền...).
+var System = Actor{Type: ActorSystem}
+
+var (
+	ErrOrderNotFound = errors.New("không tìm thấy đơn hàng")
+	ErrOutOfStock    = inventory.ErrOutOfStock
+)
+
+// TransitionError là lỗi khi chuyển sang trạng thái không hợp lệ.
+type TransitionError struct {
+	From, To Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("không thể chuyển đơn hàng từ %q sang %q", e.From, e.To)
+}
+
+// Record ghi một dòng lịch sử. from rỗng nghĩa là đơn vừa được tạo.
+func Record(ctx context.Context, tx *sql.Tx, orderID int, from, to Status, actor Actor, reason string) error {
+	var fromValue interface{}
+	if from != "" {
+		fromValue = string(from)
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor_type, actor_user_id, reason)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, orderID, fromValue, string(to), actor.Type, actor.UserID, reason)
+	return err
+}
+
+// Transition chuyển đơn hàng sang trạng thái to trong transaction tx: khóa đơn, kiểm tra
+// chuyển trạng thái hợp lệ, cập nhật giữ hàng/tồn kho, hoàn voucher khi hủy, cộng/thu hồi điểm
+// thưởng, phát hành/hủy thẻ quà tặng, trả lại tiền ví và ghi lịch sử. now là thời điểm chuyển
+// trạng thái dùng cho điểm thưởng (hạn điểm, thưởng giới thiệu), do nơi gọi truyền vào.
+func Transition(ctx context.Context, tx *sql.Tx, orderID int, to Status, actor Actor, reason string, now time.Time) (Status, error) {
+	var current string
+	err := tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return "", ErrOrderNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	from := Status(current)
+	if !CanTransition(from, to) {
+		return from, &TransitionError{From: from, To: to}
+	}
+
+	if err := applyStock(ctx, tx, orderID, from, to); err != nil {
+		return from, err
+	}
+
+	if to == Cancelled {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE user_vouchers SET is_used = false
+			WHERE id = (SELECT applied_voucher_id FROM orders WHERE id = $1)
+		`, orderID)
+		if err != nil {
+			return from, err
+		}
+		// Trả lại lượt dùng cho voucher có giới hạn tổng số lượt
+		_, err = tx.ExecContext(ctx, `
+			UPDATE vouchers SET used_count = GREATEST(used_count - 1, 0)
+			WHERE id = (
+				SELECT uv.voucher_id FROM orders o JOIN user_vouchers uv ON uv.id = o.applied_voucher_id
+				WHERE o.id = $1
+			)
+		`, orderID)
+		if err != nil {
+			return from, err
+		}
+		// Mã khuyến mãi công khai: trả lượt cho người dùng và tổng lượt của mã
+		_, err = tx.ExecContext(ctx, `
+			UPDATE vouchers SET used_count = GREATEST(used_count - 1, 0)
+			WHERE id = (SELECT promo_voucher_id FROM orders WHERE id = $1)
+		`, orderID)
+		if err != nil {
+			return from, err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM voucher_redemptions WHERE order_id = $1", orderID); err != nil {
+			return from, err
+		}
+	}
+
+	if err := applyRewards(ctx, tx, orderID, to, now); err != nil {
+		return from, err
+	}
+	if err := applyWallet(ctx, tx, orderID, to); err != nil {
+		return from, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE orders SET status = $1 WHERE id = $2", string(to), orderID); err != nil {
+		return from, err
+	}
+	return from, Record(ctx, tx, orderID, from, to, actor, reason)
+}
+
+// applyRewards cộng điểm thưởng và phát thưởng giới thiệu khi đơn hoàn thành; khi đơn bị hủy hoặc
+// hoàn tiền thì thu hồi thưởng giới thiệu, điểm đã cộng và trả lại điểm khách đã dùng.
+func applyRewards(ctx context.Context, tx *sql.Tx, orderID int, to Status, now time.Time) error {
+	switch to {
+	case Completed:
+		if err := referral.Reward(ctx, tx, orderID, now); err != nil {
+			return fmt.Errorf("referral reward: %w", err)
+		}
+		if err := loyalty.Earn(ctx, tx, orderID, now); err != nil {
+			return fmt.Errorf("earn points: %w", err)
+		}
+	case Cancelled, Refunded:
+		if err := referral.Revoke(ctx, tx, orderID, now); err != nil {
+			return fmt.Errorf("revoke referral reward: %w", err)
+		}
+		if err := loyalty.Clawback(ctx, tx, orderID, 1, 1, now); err != nil {
+			return fmt.Errorf("claw back points: %w", err)
+		}
+		if err := loyalty.RestoreRedeemed(ctx, tx, orderID, now); err != nil {
+			return fmt.Errorf("restore points: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyWallet phát hành thẻ quà tặng khi đơn đã được thanh toán (trả trước) hoặc hoàn thành (COD);
+// khi đơn bị hủy hoặc hoàn tiền thì hủy các thẻ chưa nạp và trả lại phần tiền khách đã trả bằng ví.
+func applyWallet(ctx context.Context, tx *sql.Tx, orderID int, to Status) error {
+	switch to {
+	case Paid, Completed:
+		if err := wallet.IssueGiftCards(ctx, tx, orderID); err != nil {
+			return fmt.Errorf("issue gift cards: %w", err)
+		}
+	case Cancelled, Refunded:
+		if err := wallet.VoidGiftCards(ctx, tx, orderID); err != nil {
+			return fmt.Errorf("void gift cards: %w", err)
+		}
+		if err := wallet.ReleaseOrder(ctx, tx, orderID); err != nil {
+			return fmt.Errorf("release wallet payment: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyStock cập nhật giữ hàng/tồn kho tương ứng với việc chuyển trạng thái.
+func applyStock(ctx context.Context, tx *sql.Tx, orderID int, from, to Status) error {
+	switch {
+	case to.holdsStock() && !from.holdsStock():
+		return inventory.Deduct(ctx, tx, orderID)
+	case from.holdsStock() && !to.holdsStock():
+		return inventory.Restock(ctx, tx, orderID)
+	case to == Cancelled || to == Refunded:
+		return inventory.Release(ctx, tx, orderID)
+	case to == Paid || to == Confirmed:
+		return inventory.Keep(ctx, tx, orderID)
+	}
+	return nil
+}
+
+// Timeline trả về lịch sử trạng thái của đơn hàng theo thứ tự thời gian.
+func Timeline(ctx context.Context, db *sql.DB, orderID int) ([]models.OrderStatusChange, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT h.id, h.from_status, h.to_status, h.actor_type, h.actor_user_id, u.username, h.reason, h.created_at
+		FROM order_status_history h
+		LEFT JOIN users u ON h.actor_user_id = u.id
+		WHERE h.order_id = $1
+		ORDER BY h.created_at, h.id
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	timeline := []models.OrderStatusChange{}
+	for rows.Next() {
+		var c models.OrderStatusChange
+		var from, username, reason sql.NullString
+		var actorUserID sql.NullInt64
+		if err := rows.Scan(&c.ID, &from, &c.ToStatus, &c.ActorType, &actorUserID, &username, &reason, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.FromStatus = from.String
+		c.ActorName = username.String
+		c.Reason = reason.String
+		if actorUserID.Valid {
+			id := int(actorUserID.Int64)
+			c.ActorUserID = &id
+		}
+		timeline = append(timeline, c)
+	}
+	return timeline, rows.Err()
+}
@@ -0,0 +1,61 @@
+package orderstatus
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+	"backend/internal/loyalty"
+)
+
+func TestTransitionUsesCallerTime(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{"shipped"}))
+	fake.On("SELECT user_id FROM orders", dbtest.Rows([]driver.Value{int64(7)}))
+	fake.On("SELECT user_id, total_amount FROM orders", dbtest.Rows([]driver.Value{int64(7), int64(200000)}))
+	fake.On("SELECT EXISTS", dbtest.Rows([]driver.Value{false}))
+	fake.On("FROM gift_cards WHERE order_id", dbtest.Rows([]driver.Value{false, "cod"}))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	now := time.Date(2024, 12, 31, 23, 30, 0, 0, time.UTC)
+	from, err := Transition(context.Background(), tx, 12, Completed, System, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != Shipped {
+		t.Errorf("from = %s, muốn shipped", from)
+	}
+
+	// Lô điểm được cộng có hạn tính từ thời điểm nơi gọi truyền vào, không phải đồng hồ hệ thống
+	lots := fake.Calls("INSERT INTO loyalty_ledger")
+	if len(lots) != 1 {
+		t.Fatalf("phải cộng một lô điểm, có %d", len(lots))
+	}
+	want := now.AddDate(0, 0, loyalty.PolicyFromEnv().ValidDays)
+	if got, ok := lots[0].Args[5].(time.Time); !ok || !got.Equal(want) {
+		t.Errorf("expires_at = %v, muốn %v", lots[0].Args[5], want)
+	}
+}
+
+func TestTransitionRejectsInvalidMove(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{"cancelled"}))
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+
+	_, err := Transition(context.Background(), tx, 12, Paid, System, "", time.Now())
+	te, ok := err.(*TransitionError)
+	if !ok || te.From != Cancelled || te.To != Paid {
+		t.Fatalf("err = %v, muốn TransitionError cancelled -> paid", err)
+	}
+	if len(fake.Calls("UPDATE orders SET status")) != 0 {
+		t.Error("chuyển trạng thái không hợp lệ thì không được cập nhật đơn")
+	}
+}
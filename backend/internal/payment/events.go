@@ -0,0 +1,113 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/internal/orderstatus"
+)
+
+// Kết quả xử lý một callback/kết quả tra cứu, lưu trong payment_transactions.outcome.
+const (
+	OutcomeApplied        = "applied"
+	OutcomeIgnored        = "ignored"
+	OutcomeAmountMismatch = "amount_mismatch"
+	OutcomeOrderNotFound  = "order_not_found"
+	// OutcomePaidAfterCancel: khách thanh toán thành công nhưng đơn đã bị hủy (thường do hết hạn
+	// giữ hàng); tiền phải được hoàn lại cho khách.
+	OutcomePaidAfterCancel = "paid_after_cancel"
+)
+
+// ApplyEvent ghi giao dịch vào payment_transactions và cập nhật đơn hàng. Mỗi
+// ExternalOrderID chỉ được xử lý một lần; lần sau trả ErrAlreadyProcessed.
+// ErrAmountMismatch / ErrOrderNotFound / ErrPaidAfterCancel vẫn được ghi lại và commit. now là
+// thời điểm nhận kết quả.
+func ApplyEvent(ctx context.Context, db *sql.DB, provider string, event *WebhookEvent, now time.Time) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var txnID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO payment_transactions (provider, external_order_id, provider_transaction_id, order_id, amount, result_code, message)
+		VALUES ($1, $2, $3, (SELECT id FROM orders WHERE id = $4), $5, $6, $7)
+		ON CONFLICT (provider, external_order_id) DO NOTHING
+		RETURNING id
+	`, provider, event.ExternalOrderID, event.TransactionID, event.OrderID, event.Amount, event.ResultCode, event.Message).Scan(&txnID)
+	if err == sql.ErrNoRows {
+		log.Printf("Duplicate %s IPN for %s, skipping", provider, event.ExternalOrderID)
+		return ErrAlreadyProcessed
+	}
+	if err != nil {
+		return fmt.Errorf("record transaction: %w", err)
+	}
+
+	outcome, err := applyEvent(ctx, tx, provider, event, now)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE payment_transactions SET outcome = $1 WHERE id = $2", outcome, txnID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("%s IPN for order %d processed: %s", provider, event.OrderID, outcome)
+
+	switch outcome {
+	case OutcomeAmountMismatch:
+		return ErrAmountMismatch
+	case OutcomeOrderNotFound:
+		return ErrOrderNotFound
+	case OutcomePaidAfterCancel:
+		return ErrPaidAfterCancel
+	}
+	return nil
+}
+
+// applyEvent kiểm tra số tiền rồi chuyển đơn sang paid hoặc cancelled.
+func applyEvent(ctx context.Context, tx *sql.Tx, provider string, event *WebhookEvent, now time.Time) (string, error) {
+	orderID := event.OrderID
+	var totalAmount int64
+	err := tx.QueryRowContext(ctx, "SELECT total_amount FROM orders WHERE id = $1", orderID).Scan(&totalAmount)
+	if err == sql.ErrNoRows {
+		return OutcomeOrderNotFound, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	status, reason := orderstatus.Paid, fmt.Sprintf("Thanh toán %s thành công (mã giao dịch %s)", provider, event.TransactionID)
+	if !event.Success {
+		status, reason = orderstatus.Cancelled, fmt.Sprintf("Thanh toán %s thất bại (mã %s: %s)", provider, event.ResultCode, event.Message)
+	} else if event.Amount != totalAmount {
+		log.Printf("WARNING: %s amount %d does not match order %d total %d", provider, event.Amount, orderID, totalAmount)
+		return OutcomeAmountMismatch, nil
+	} else if err := SetOrderPaymentStatus(ctx, tx, orderID, PaymentPaid); err != nil {
+		// Tiền đã vào tài khoản cửa hàng kể cả khi đơn không còn chuyển sang paid được
+		return "", err
+	}
+
+	_, err = orderstatus.Transition(ctx, tx, orderID, status, orderstatus.System, reason, now)
+	var te *orderstatus.TransitionError
+	if errors.As(err, &te) {
+		if te.From == orderstatus.Cancelled && status == orderstatus.Paid {
+			// Khách thanh toán sau khi đơn đã bị hủy do hết hạn giữ hàng
+			log.Printf("WARNING: order %d was paid via %s after cancellation, refund required", orderID, provider)
+			return OutcomePaidAfterCancel, nil
+		}
+		log.Printf("Ignoring %s IPN for order %d: %v", provider, orderID, err)
+		return OutcomeIgnored, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return OutcomeApplied, nil
+}
@@ -0,0 +1,74 @@
+package payment
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+)
+
+func paidEvent() *WebhookEvent {
+	return &WebhookEvent{
+		ExternalOrderID: "ORD12_1",
+		OrderID:         12,
+		TransactionID:   "T1",
+		Amount:          150000,
+		Success:         true,
+		ResultCode:      "0",
+	}
+}
+
+func TestApplyEventFlagsPaymentAfterCancellation(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("INSERT INTO payment_transactions", dbtest.Rows([]driver.Value{int64(3)}))
+	fake.On("SELECT total_amount FROM orders", dbtest.Rows([]driver.Value{int64(150000)}))
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{"cancelled"}))
+
+	err := ApplyEvent(context.Background(), db, "momo", paidEvent(), time.Now())
+	if !errors.Is(err, ErrPaidAfterCancel) {
+		t.Fatalf("err = %v, muốn ErrPaidAfterCancel", err)
+	}
+	if fake.Commits != 1 {
+		t.Error("giao dịch phải được ghi lại")
+	}
+	updates := fake.Calls("UPDATE payment_transactions SET outcome")
+	if len(updates) != 1 || updates[0].Args[0] != OutcomePaidAfterCancel {
+		t.Errorf("outcome = %+v, muốn %s", updates, OutcomePaidAfterCancel)
+	}
+	// Tiền đã thu nên đơn vẫn phải ghi nhận đã thanh toán để hoàn tiền được
+	if paid := fake.Calls("UPDATE orders SET payment_status"); len(paid) != 1 || paid[0].Args[0] != PaymentPaid {
+		t.Errorf("payment_status = %+v, muốn paid", paid)
+	}
+}
+
+func TestApplyEventPaysPendingOrder(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("INSERT INTO payment_transactions", dbtest.Rows([]driver.Value{int64(3)}))
+	fake.On("SELECT total_amount FROM orders", dbtest.Rows([]driver.Value{int64(150000)}))
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{"pending"}))
+	fake.On("FROM gift_cards WHERE order_id", dbtest.Rows([]driver.Value{false, "momo"}))
+
+	if err := ApplyEvent(context.Background(), db, "momo", paidEvent(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	updates := fake.Calls("UPDATE payment_transactions SET outcome")
+	if len(updates) != 1 || updates[0].Args[0] != OutcomeApplied {
+		t.Errorf("outcome = %+v, muốn %s", updates, OutcomeApplied)
+	}
+}
+
+func TestApplyEventSkipsDuplicate(t *testing.T) {
+	fake, db := dbtest.New()
+	// ON CONFLICT DO NOTHING không trả dòng nào
+
+	err := ApplyEvent(context.Background(), db, "momo", paidEvent(), time.Now())
+	if !errors.Is(err, ErrAlreadyProcessed) {
+		t.Fatalf("err = %v, muốn ErrAlreadyProcessed", err)
+	}
+	if len(fake.Calls("UPDATE orders")) != 0 {
+		t.Error("giao dịch trùng không được cập nhật đơn")
+	}
+}
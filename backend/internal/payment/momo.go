@@ -2,15 +2,18 @@ package payment
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -33,76 +36,302 @@ type MoMoResponse struct {
 	RequestID    string `json:"requestId"`
 	OrderID      string `json:"orderId"`
 	Amount       int64  `json:"amount"`
+	TransID      int64  `json:"transId"`
 	ResponseTime int64  `json:"responseTime"`
 	Message      string `json:"message"`
 	ResultCode   int    `json:"resultCode"`
 	PayURL       string `json:"payUrl"`
 }
 
-func CreateMoMoPayment(orderID int, amount int64) (string, error) {
-	partnerCode := os.Getenv("MOMO_PARTNER_CODE")
-	accessKey := os.Getenv("MOMO_ACCESS_KEY")
-	secretKey := os.Getenv("MOMO_SECRET_KEY")
-	endpoint := os.Getenv("MOMO_ENDPOINT")
+// MoMo là cổng thanh toán ví MoMo (API v2, requestType captureWallet).
+type MoMo struct {
+	PartnerCode string
+	AccessKey   string
+	SecretKey   string
+	// Endpoint là URL API tạo giao dịch, vd https://test-payment.momo.vn/v2/gateway/api/create.
+	// API query/refund nằm cùng thư mục.
+	Endpoint    string
+	RedirectURL string
+	IPNURL      string
+	Client      *http.Client
+}
 
-	frontendURL := os.Getenv("PUBLIC_FRONTEND_URL")
-	if frontendURL == "" {
-		frontendURL = "http://localhost:3000"
+func NewMoMoFromEnv() *MoMo {
+	frontend := frontendURL()
+	return &MoMo{
+		PartnerCode: os.Getenv("MOMO_PARTNER_CODE"),
+		AccessKey:   os.Getenv("MOMO_ACCESS_KEY"),
+		SecretKey:   os.Getenv("MOMO_SECRET_KEY"),
+		Endpoint:    os.Getenv("MOMO_ENDPOINT"),
+		RedirectURL: frontend + "/order-result",
+		IPNURL:      frontend + "/api/webhook/momo",
+		Client:      newHTTPClient(),
 	}
+}
+
+func (m *MoMo) Name() string { return "momo" }
 
+// configured báo đã có đủ partner code, access key, secret key và endpoint.
+func (m *MoMo) configured() bool {
+	return m.PartnerCode != "" && m.AccessKey != "" && m.SecretKey != "" && m.Endpoint != ""
+}
+
+func (m *MoMo) apiURL(action string) string {
+	return strings.TrimSuffix(m.Endpoint, "/create") + "/" + action
+}
+
+func (m *MoMo) CreatePayment(ctx context.Context, req CreateRequest) (*CreateResult, error) {
 	requestID := strconv.FormatInt(time.Now().Unix(), 10)
-	orderIDStr := fmt.Sprintf("BISTROBLISS_%d_%s", orderID, requestID)
-	orderInfo := "Payment for your order"
-	redirectURL := frontendURL + "/order-result"
-	ipnURL := frontendURL + "/api/webhook/momo"
+	orderIDStr := fmt.Sprintf("BISTROBLISS_%d_%s", req.OrderID, requestID)
+	orderInfo := req.Description
+	if orderInfo == "" {
+		orderInfo = "Payment for your order"
+	}
 	extraData := ""
 
 	rawSignature := fmt.Sprintf("accessKey=%s&amount=%d&extraData=%s&ipnUrl=%s&orderId=%s&orderInfo=%s&partnerCode=%s&redirectUrl=%s&requestId=%s&requestType=%s",
-		accessKey, amount, extraData, ipnURL, orderIDStr, orderInfo, partnerCode, redirectURL, requestID, "captureWallet",
+		m.AccessKey, req.Amount, extraData, m.IPNURL, orderIDStr, orderInfo, m.PartnerCode, m.RedirectURL, requestID, "captureWallet",
 	)
 
-	h := hmac.New(sha256.New, []byte(secretKey))
-	h.Write([]byte(rawSignature))
-	signature := hex.EncodeToString(h.Sum(nil))
-
 	requestBody := MoMoRequest{
-		PartnerCode: partnerCode,
+		PartnerCode: m.PartnerCode,
 		RequestID:   requestID,
-		Amount:      amount,
+		Amount:      req.Amount,
 		OrderID:     orderIDStr,
 		OrderInfo:   orderInfo,
-		RedirectURL: redirectURL,
-		IpnURL:      ipnURL,
+		RedirectURL: m.RedirectURL,
+		IpnURL:      m.IPNURL,
 		RequestType: "captureWallet",
 		Lang:        "vi",
-		Signature:   signature,
+		Signature:   signMoMo(m.SecretKey, rawSignature),
 		ExtraData:   extraData,
 	}
 
-	jsonBody, err := json.Marshal(requestBody)
+	var momoResp MoMoResponse
+	if err := m.post(ctx, m.Endpoint, requestBody, &momoResp); err != nil {
+		return nil, err
+	}
+	if momoResp.ResultCode != 0 {
+		return nil, fmt.Errorf("MoMo payment creation failed: %s", momoResp.Message)
+	}
+
+	return &CreateResult{ExternalOrderID: orderIDStr, PaymentURL: momoResp.PayURL}, nil
+}
+
+func (m *MoMo) QueryPayment(ctx context.Context, externalOrderID string) (*QueryResult, error) {
+	requestID := strconv.FormatInt(time.Now().UnixNano(), 10)
+	rawSignature := fmt.Sprintf("accessKey=%s&orderId=%s&partnerCode=%s&requestId=%s",
+		m.AccessKey, externalOrderID, m.PartnerCode, requestID,
+	)
+	body := map[string]string{
+		"partnerCode": m.PartnerCode,
+		"requestId":   requestID,
+		"orderId":     externalOrderID,
+		"lang":        "vi",
+		"signature":   signMoMo(m.SecretKey, rawSignature),
+	}
+
+	var momoResp MoMoResponse
+	if err := m.post(ctx, m.apiURL("query"), body, &momoResp); err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{
+		ExternalOrderID: externalOrderID,
+		Amount:          momoResp.Amount,
+		Message:         momoResp.Message,
+	}
+	if momoResp.TransID != 0 {
+		result.TransactionID = strconv.FormatInt(momoResp.TransID, 10)
+	}
+	switch momoResp.ResultCode {
+	case 0:
+		result.Status = StatusPaid
+	case 1000, 7000, 7002:
+		// Khách chưa xác nhận hoặc giao dịch đang được xử lý
+		result.Status = StatusPending
+	default:
+		result.Status = StatusFailed
+	}
+	return result, nil
+}
+
+func (m *MoMo) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	requestID := strconv.FormatInt(time.Now().UnixNano(), 10)
+	description := req.Description
+	rawSignature := fmt.Sprintf("accessKey=%s&amount=%d&description=%s&orderId=%s&partnerCode=%s&requestId=%s&transId=%s",
+		m.AccessKey, req.Amount, description, req.RefundID, m.PartnerCode, requestID, req.TransactionID,
+	)
+	transID, err := strconv.ParseInt(req.TransactionID, 10, 64)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("MoMo transId không hợp lệ: %q", req.TransactionID)
+	}
+	body := map[string]interface{}{
+		"partnerCode": m.PartnerCode,
+		"orderId":     req.RefundID,
+		"requestId":   requestID,
+		"amount":      req.Amount,
+		"transId":     transID,
+		"lang":        "vi",
+		"description": description,
+		"signature":   signMoMo(m.SecretKey, rawSignature),
 	}
 
-	resp, err := http.Post(endpoint, "application/json", bytes.NewBuffer(jsonBody))
+	var momoResp MoMoResponse
+	if err := m.post(ctx, m.apiURL("refund"), body, &momoResp); err != nil {
+		return nil, err
+	}
+
+	return momoRefundResult(momoResp), nil
+}
+
+// QueryRefund tra cứu kết quả giao dịch hoàn tiền theo orderId đã gửi khi hoàn (req.RefundID).
+func (m *MoMo) QueryRefund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	requestID := strconv.FormatInt(time.Now().UnixNano(), 10)
+	rawSignature := fmt.Sprintf("accessKey=%s&orderId=%s&partnerCode=%s&requestId=%s",
+		m.AccessKey, req.RefundID, m.PartnerCode, requestID,
+	)
+	body := map[string]string{
+		"partnerCode": m.PartnerCode,
+		"requestId":   requestID,
+		"orderId":     req.RefundID,
+		"lang":        "vi",
+		"signature":   signMoMo(m.SecretKey, rawSignature),
+	}
+
+	var momoResp MoMoResponse
+	if err := m.post(ctx, m.apiURL("refund/query"), body, &momoResp); err != nil {
+		return nil, err
+	}
+	return momoRefundResult(momoResp), nil
+}
+
+func momoRefundResult(resp MoMoResponse) *RefundResult {
+	result := &RefundResult{Message: resp.Message, Status: StatusFailed}
+	if resp.TransID != 0 {
+		result.TransactionID = strconv.FormatInt(resp.TransID, 10)
+	}
+	switch resp.ResultCode {
+	case 0:
+		result.Status = StatusRefunded
+	case 1000, 7000, 7002:
+		result.Status = StatusPending
+	}
+	return result
+}
+
+func (m *MoMo) ParseWebhook(r *http.Request) (*WebhookEvent, error) {
+	var ipn MoMoIPN
+	if err := json.NewDecoder(r.Body).Decode(&ipn); err != nil {
+		return nil, fmt.Errorf("decode MoMo IPN: %w", err)
+	}
+	if ipn.PartnerCode != m.PartnerCode || !ipn.VerifySignature(m.AccessKey, m.SecretKey) {
+		return nil, ErrInvalidSignature
+	}
+	orderID, ok := ParseMoMoOrderID(ipn.OrderID)
+	if !ok {
+		return nil, fmt.Errorf("unexpected MoMo orderId %q", ipn.OrderID)
+	}
+	return &WebhookEvent{
+		ExternalOrderID: ipn.OrderID,
+		OrderID:         orderID,
+		TransactionID:   strconv.FormatInt(ipn.TransID, 10),
+		Amount:          ipn.Amount,
+		Success:         ipn.Succeeded(),
+		ResultCode:      strconv.Itoa(ipn.ResultCode),
+		Message:         ipn.Message,
+	}, nil
+}
+
+// RespondWebhook: MoMo chỉ cần HTTP 204; trả 5xx để MoMo gửi lại IPN khi lỗi hệ thống.
+func (m *MoMo) RespondWebhook(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil, errors.Is(err, ErrAlreadyProcessed), errors.Is(err, ErrAmountMismatch), errors.Is(err, ErrOrderNotFound):
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrInvalidSignature):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (m *MoMo) post(ctx context.Context, url string, body, out interface{}) error {
+	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer resp.Body.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
 
-	body, err := ioutil.ReadAll(resp.Body)
+	client := m.Client
+	if client == nil {
+		client = newHTTPClient()
+	}
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
+	defer resp.Body.Close()
 
-	var momoResp MoMoResponse
-	if err := json.Unmarshal(body, &momoResp); err != nil {
-		return "", err
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
 	}
+	return json.Unmarshal(respBody, out)
+}
 
-	if momoResp.ResultCode != 0 {
-		return "", fmt.Errorf("MoMo payment creation failed: %s", momoResp.Message)
+func signMoMo(secretKey, rawSignature string) string {
+	h := hmac.New(sha256.New, []byte(secretKey))
+	h.Write([]byte(rawSignature))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MoMoIPN là dữ liệu MoMo gửi về ipnUrl sau khi khách thanh toán.
+type MoMoIPN struct {
+	PartnerCode  string `json:"partnerCode"`
+	OrderID      string `json:"orderId"`
+	RequestID    string `json:"requestId"`
+	Amount       int64  `json:"amount"`
+	OrderInfo    string `json:"orderInfo"`
+	OrderType    string `json:"orderType"`
+	TransID      int64  `json:"transId"`
+	ResultCode   int    `json:"resultCode"`
+	Message      string `json:"message"`
+	PayType      string `json:"payType"`
+	ResponseTime int64  `json:"responseTime"`
+	ExtraData    string `json:"extraData"`
+	Signature    string `json:"signature"`
+}
+
+// Succeeded cho biết giao dịch đã thanh toán thành công.
+func (ipn MoMoIPN) Succeeded() bool {
+	return ipn.ResultCode == 0
+}
+
+// rawSignature nối các trường theo thứ tự alphabet như tài liệu IPN của MoMo.
+func (ipn MoMoIPN) rawSignature(accessKey string) string {
+	return fmt.Sprintf("accessKey=%s&amount=%d&extraData=%s&message=%s&orderId=%s&orderInfo=%s&orderType=%s&partnerCode=%s&payType=%s&requestId=%s&responseTime=%d&resultCode=%d&transId=%d",
+		accessKey, ipn.Amount, ipn.ExtraData, ipn.Message, ipn.OrderID, ipn.OrderInfo, ipn.OrderType,
+		ipn.PartnerCode, ipn.PayType, ipn.RequestID, ipn.ResponseTime, ipn.ResultCode, ipn.TransID,
+	)
+}
+
+// VerifySignature kiểm tra chữ ký HMAC-SHA256 của IPN bằng access key và secret key của MoMo.
+func (ipn MoMoIPN) VerifySignature(accessKey, secretKey string) bool {
+	if secretKey == "" || ipn.Signature == "" {
+		return false
 	}
+	expected := signMoMo(secretKey, ipn.rawSignature(accessKey))
+	return hmac.Equal([]byte(expected), []byte(ipn.Signature))
+}
 
-	return momoResp.PayURL, nil
+// ParseMoMoOrderID lấy id đơn hàng từ orderId dạng BISTROBLISS_<id>_<requestId>.
+func ParseMoMoOrderID(momoOrderID string) (int, bool) {
+	var orderID int
+	var requestID string
+	n, _ := fmt.Sscanf(strings.Replace(momoOrderID, "_", " ", 2), "BISTROBLISS %d %s", &orderID, &requestID)
+	return orderID, n == 2 && orderID > 0
 }
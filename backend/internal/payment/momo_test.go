@@ -0,0 +1,121 @@
+package payment
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Các fixture trong testdata/momo được ký bằng testMoMoSecret theo tài liệu IPN của MoMo (API v2),
+// độc lập với code ký ở đây.
+const (
+	testMoMoPartner = "MOMOTEST"
+	testMoMoAccess  = "MOMOTESTACCESS"
+	testMoMoSecret  = "MOMOTESTSECRET0123456789ABCDEF"
+)
+
+func newTestMoMo() *MoMo {
+	return &MoMo{PartnerCode: testMoMoPartner, AccessKey: testMoMoAccess, SecretKey: testMoMoSecret, Endpoint: "http://momo.test/v2/gateway/api/create"}
+}
+
+func readMoMoFixture(t *testing.T, name string) map[string]interface{} {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "momo", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ipn map[string]interface{}
+	if err := json.Unmarshal(b, &ipn); err != nil {
+		t.Fatal(err)
+	}
+	return ipn
+}
+
+func momoIPNRequest(t *testing.T, ipn map[string]interface{}) *http.Request {
+	t.Helper()
+	b, err := json.Marshal(ipn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewRequest(http.MethodPost, "/api/webhook/momo", strings.NewReader(string(b)))
+}
+
+func TestMoMoParseWebhook(t *testing.T) {
+	event, err := newTestMoMo().ParseWebhook(momoIPNRequest(t, readMoMoFixture(t, "ipn_success.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := WebhookEvent{
+		ExternalOrderID: "BISTROBLISS_12_1741597200",
+		OrderID:         12,
+		TransactionID:   "4088878653",
+		Amount:          150000,
+		Success:         true,
+		ResultCode:      "0",
+		Message:         "Thành công.",
+	}
+	if *event != want {
+		t.Errorf("event = %+v, muốn %+v", *event, want)
+	}
+
+	event, err = newTestMoMo().ParseWebhook(momoIPNRequest(t, readMoMoFixture(t, "ipn_rejected.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Success || event.ResultCode != "1006" {
+		t.Errorf("IPN bị từ chối: event = %+v", *event)
+	}
+}
+
+func TestMoMoParseWebhookRejectsTamperedIPN(t *testing.T) {
+	cases := map[string]func(ipn map[string]interface{}){
+		"chữ ký giả":       func(ipn map[string]interface{}) { ipn["signature"] = strings.Repeat("0", 64) },
+		"thiếu chữ ký":     func(ipn map[string]interface{}) { delete(ipn, "signature") },
+		"sửa số tiền":      func(ipn map[string]interface{}) { ipn["amount"] = 1000 },
+		"sửa kết quả":      func(ipn map[string]interface{}) { ipn["resultCode"] = 0; ipn["message"] = "Thành công." },
+		"sai partner code": func(ipn map[string]interface{}) { ipn["partnerCode"] = "OTHERSHOP" },
+	}
+	for name, tamper := range cases {
+		fixture := "ipn_success.json"
+		if name == "sửa kết quả" {
+			fixture = "ipn_rejected.json"
+		}
+		ipn := readMoMoFixture(t, fixture)
+		tamper(ipn)
+		_, err := newTestMoMo().ParseWebhook(momoIPNRequest(t, ipn))
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, muốn ErrInvalidSignature", name, err)
+		}
+	}
+
+	// Chữ ký đúng nhưng cửa hàng khác: partner code phải khớp cấu hình
+	m := newTestMoMo()
+	m.PartnerCode = "OTHERSHOP"
+	if _, err := m.ParseWebhook(momoIPNRequest(t, readMoMoFixture(t, "ipn_success.json"))); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("sai partner code cấu hình: err = %v, muốn ErrInvalidSignature", err)
+	}
+}
+
+func TestMoMoRespondWebhook(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{nil, http.StatusNoContent},
+		{ErrAmountMismatch, http.StatusNoContent},
+		{ErrInvalidSignature, http.StatusBadRequest},
+		{errors.New("db down"), http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		newTestMoMo().RespondWebhook(rec, c.err)
+		if rec.Code != c.code {
+			t.Errorf("RespondWebhook(%v) = %d, muốn %d", c.err, rec.Code, c.code)
+		}
+	}
+}
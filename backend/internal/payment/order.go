@@ -0,0 +1,35 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Trạng thái thanh toán của đơn (orders.payment_status), độc lập với trạng thái giao hàng.
+const (
+	PaymentUnpaid            = "unpaid"
+	PaymentPaid              = "paid"
+	PaymentPartiallyRefunded = "partially_refunded"
+	PaymentRefunded          = "refunded"
+)
+
+// MethodCOD là phương thức thanh toán khi nhận hàng; tiền được ghi nhận khi shipper/admin xác
+// nhận đã thu.
+const MethodCOD = "cod"
+
+// MethodBankTransfer là phương thức khách tự chuyển khoản theo nội dung/VietQR của đơn; tiền được
+// ghi nhận khi đối soát sao kê hoặc khi admin xác nhận.
+const MethodBankTransfer = "bank_transfer"
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// SetOrderPaymentStatus cập nhật orders.payment_status trong transaction của người gọi.
+func SetOrderPaymentStatus(ctx context.Context, ex execer, orderID int, status string) error {
+	if _, err := ex.ExecContext(ctx, "UPDATE orders SET payment_status = $1 WHERE id = $2", status, orderID); err != nil {
+		return fmt.Errorf("update payment status: %w", err)
+	}
+	return nil
+}
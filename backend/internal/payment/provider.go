@@ -0,0 +1,141 @@
+// Package payment chứa các cổng thanh toán. Mỗi cổng cài đặt Provider; handler chỉ làm việc
+// qua interface này nên thêm cổng mới không cần sửa handler.
+package payment
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Trạng thái giao dịch trả về từ QueryPayment / Refund.
+const (
+	StatusPending  = "pending"
+	StatusPaid     = "paid"
+	StatusFailed   = "failed"
+	StatusRefunded = "refunded"
+)
+
+var (
+	ErrInvalidSignature = errors.New("chữ ký không hợp lệ")
+	ErrOrderNotFound    = errors.New("không tìm thấy đơn hàng")
+	ErrAmountMismatch   = errors.New("số tiền không khớp với đơn hàng")
+	ErrAlreadyProcessed = errors.New("giao dịch đã được xử lý")
+	ErrNotSupported     = errors.New("cổng thanh toán không hỗ trợ thao tác này")
+	// ErrPaidAfterCancel: giao dịch đã được ghi nhận nhưng đơn đã bị hủy, nơi gọi phải hoàn tiền.
+	ErrPaidAfterCancel = errors.New("đơn hàng đã bị hủy trước khi thanh toán")
+)
+
+// DefaultTimeout là timeout cho mọi lời gọi HTTP tới cổng thanh toán.
+const DefaultTimeout = 15 * time.Second
+
+type CreateRequest struct {
+	OrderID     int
+	Amount      int64
+	Description string
+	ClientIP    string
+	// ExpiresAt là hạn giữ hàng của đơn; cổng hỗ trợ sẽ không cho thanh toán sau thời điểm này.
+	// Zero nếu đơn không có hạn.
+	ExpiresAt time.Time
+}
+
+type CreateResult struct {
+	// ExternalOrderID là mã giao dịch phía cửa hàng gửi cho cổng, dùng cho query/refund/webhook.
+	ExternalOrderID string
+	PaymentURL      string
+}
+
+type QueryResult struct {
+	ExternalOrderID string
+	TransactionID   string
+	Amount          int64
+	Status          string
+	Message         string
+}
+
+type RefundRequest struct {
+	// RefundID là mã duy nhất phía cửa hàng cho lần hoàn tiền này.
+	RefundID        string
+	ExternalOrderID string
+	TransactionID   string
+	Amount          int64
+	// TotalAmount là số tiền của giao dịch gốc (để phân biệt hoàn toàn phần / một phần).
+	TotalAmount int64
+	Description string
+}
+
+type RefundResult struct {
+	TransactionID string
+	Status        string
+	Message       string
+}
+
+// WebhookEvent là callback (IPN) đã được xác thực chữ ký.
+type WebhookEvent struct {
+	ExternalOrderID string
+	OrderID         int
+	TransactionID   string
+	Amount          int64
+	Success         bool
+	ResultCode      string
+	Message         string
+}
+
+type Provider interface {
+	Name() string
+	CreatePayment(ctx context.Context, req CreateRequest) (*CreateResult, error)
+	QueryPayment(ctx context.Context, externalOrderID string) (*QueryResult, error)
+	Refund(ctx context.Context, req RefundRequest) (*RefundResult, error)
+	// ParseWebhook đọc callback và trả ErrInvalidSignature nếu chữ ký sai.
+	ParseWebhook(r *http.Request) (*WebhookEvent, error)
+	// RespondWebhook ghi phản hồi cổng mong đợi; err là kết quả xử lý (nil nếu thành công).
+	RespondWebhook(w http.ResponseWriter, err error)
+}
+
+// ReturnVerifier được cài đặt bởi các cổng gắn kết quả thanh toán có chữ ký vào return URL
+// (vd VNPay). Kết quả chỉ dùng để hiển thị; trạng thái đơn vẫn do IPN cập nhật.
+type ReturnVerifier interface {
+	VerifyReturn(r *http.Request) (*WebhookEvent, error)
+}
+
+// RefundQuerier được cài đặt bởi các cổng tra cứu được kết quả của một yêu cầu hoàn tiền đang
+// xử lý (Refund trả StatusPending). req giống như khi gọi Refund.
+type RefundQuerier interface {
+	QueryRefund(ctx context.Context, req RefundRequest) (*RefundResult, error)
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: DefaultTimeout}
+}
+
+func frontendURL() string {
+	if url := os.Getenv("PUBLIC_FRONTEND_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:3000"
+}
+
+// ProvidersFromEnv trả về các cổng thanh toán được cấu hình, key là tên trong URL /api/payment/{provider}.
+// Cổng thiếu partner code / key / secret không được đăng ký, tránh tạo giao dịch với chữ ký rỗng
+// hoặc chấp nhận IPN ký bằng secret rỗng.
+func ProvidersFromEnv() map[string]Provider {
+	providers := map[string]Provider{}
+	momo, vnpay := NewMoMoFromEnv(), NewVNPayFromEnv()
+	for _, p := range []struct {
+		provider   Provider
+		configured bool
+	}{
+		{momo, momo.configured()},
+		{vnpay, vnpay.configured()},
+	} {
+		if !p.configured {
+			log.Printf("Payment provider %s is not configured, skipping", p.provider.Name())
+			continue
+		}
+		providers[p.provider.Name()] = p.provider
+	}
+	return providers
+}
@@ -0,0 +1,63 @@
+package payment
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestProvidersFromEnvRequiresCredentials(t *testing.T) {
+	momo := map[string]string{
+		"MOMO_PARTNER_CODE": "MOMO",
+		"MOMO_ACCESS_KEY":   "access",
+		"MOMO_SECRET_KEY":   "secret",
+		"MOMO_ENDPOINT":     "https://test-payment.momo.vn/v2/gateway/api/create",
+	}
+	vnpay := map[string]string{
+		"VNPAY_TMN_CODE":    "TMN01",
+		"VNPAY_HASH_SECRET": "secret",
+	}
+	cases := []struct {
+		name  string
+		env   []map[string]string
+		unset string
+		want  []string
+	}{
+		{"chưa cấu hình", nil, "", nil},
+		{"chỉ momo", []map[string]string{momo}, "", []string{"momo"}},
+		{"chỉ vnpay", []map[string]string{vnpay}, "", []string{"vnpay"}},
+		{"cả hai", []map[string]string{momo, vnpay}, "", []string{"momo", "vnpay"}},
+		{"momo thiếu secret", []map[string]string{momo, vnpay}, "MOMO_SECRET_KEY", []string{"vnpay"}},
+		{"momo thiếu partner code", []map[string]string{momo}, "MOMO_PARTNER_CODE", nil},
+		{"vnpay thiếu secret", []map[string]string{momo, vnpay}, "VNPAY_HASH_SECRET", []string{"momo"}},
+		{"vnpay thiếu mã website", []map[string]string{vnpay}, "VNPAY_TMN_CODE", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, key := range []string{"MOMO_PARTNER_CODE", "MOMO_ACCESS_KEY", "MOMO_SECRET_KEY", "MOMO_ENDPOINT", "VNPAY_TMN_CODE", "VNPAY_HASH_SECRET"} {
+				t.Setenv(key, "")
+			}
+			for _, env := range c.env {
+				for k, v := range env {
+					t.Setenv(k, v)
+				}
+			}
+			if c.unset != "" {
+				t.Setenv(c.unset, "")
+			}
+
+			var got []string
+			for name := range ProvidersFromEnv() {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if len(got) != len(c.want) {
+				t.Fatalf("providers = %v, muốn %v", got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Fatalf("providers = %v, muốn %v", got, c.want)
+				}
+			}
+		})
+	}
+}
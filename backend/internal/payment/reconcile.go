@@ -0,0 +1,176 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"backend/internal/orderstatus"
+)
+
+// DefaultReconcileAfter là thời gian chờ IPN trước khi chủ động tra cứu trạng thái giao dịch.
+const DefaultReconcileAfter = 10 * time.Minute
+
+// ReconcileAfterFromEnv đọc PAYMENT_RECONCILE_AFTER (vd "10m"), mặc định DefaultReconcileAfter.
+func ReconcileAfterFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("PAYMENT_RECONCILE_AFTER")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultReconcileAfter
+}
+
+// PendingRefunds tra cứu lại các lần hoàn tiền cổng báo đang xử lý (refund.Service), chỉ những
+// lần tạo trước before, và trả về số lần đã có kết quả.
+type PendingRefunds interface {
+	ReconcilePending(ctx context.Context, before time.Time) (int, error)
+}
+
+// Reconciler tra cứu trạng thái các giao dịch chưa nhận được IPN (vd ipnUrl cấu hình sai)
+// và áp dụng kết quả qua ApplyEvent như một IPN bình thường.
+type Reconciler struct {
+	db        *sql.DB
+	providers map[string]Provider
+	now       func() time.Time
+	// After là tuổi tối thiểu của giao dịch trước khi được tra cứu.
+	After time.Duration
+	// Refunds nếu khác nil được tra cứu cùng lượt, với cùng After.
+	Refunds PendingRefunds
+}
+
+func NewReconciler(db *sql.DB, providers map[string]Provider, now func() time.Time, after time.Duration) *Reconciler {
+	return &Reconciler{db: db, providers: providers, now: now, After: after}
+}
+
+// ReconcileResult thống kê một lượt tra cứu.
+type ReconcileResult struct {
+	Checked int `json:"checked"`
+	Paid    int `json:"paid"`
+	Pending int `json:"pending"`
+	Failed  int `json:"failed"`
+	Errors  int `json:"errors"`
+	// Refunds là số lần hoàn tiền đang xử lý đã có kết quả.
+	Refunds int `json:"refunds"`
+}
+
+type pendingAttempt struct {
+	orderID         int
+	provider        string
+	externalOrderID string
+}
+
+// ReconcilePending tra cứu các giao dịch của đơn còn pending, tạo trước After và chưa có
+// callback nào được ghi nhận. Chỉ kết quả đã thanh toán được áp dụng: giao dịch thất bại
+// hoặc chưa thanh toán để nguyên cho job hết hạn giữ hàng hủy, tránh chặn một IPN thành công
+// đến muộn (ApplyEvent chỉ xử lý mỗi giao dịch một lần).
+func (rc *Reconciler) ReconcilePending(ctx context.Context) (ReconcileResult, error) {
+	var result ReconcileResult
+	rows, err := rc.db.QueryContext(ctx, `
+		SELECT pa.order_id, pa.provider, pa.external_order_id
+		FROM payment_attempts pa
+		JOIN orders o ON o.id = pa.order_id
+		WHERE o.status = $1 AND pa.created_at <= $2
+		  AND NOT EXISTS (
+		      SELECT 1 FROM payment_transactions pt
+		      WHERE pt.provider = pa.provider AND pt.external_order_id = pa.external_order_id
+		  )
+		ORDER BY pa.created_at
+	`, string(orderstatus.Pending), rc.now().Add(-rc.After))
+	if err != nil {
+		return result, err
+	}
+	var attempts []pendingAttempt
+	for rows.Next() {
+		var a pendingAttempt
+		if err := rows.Scan(&a.orderID, &a.provider, &a.externalOrderID); err != nil {
+			rows.Close()
+			return result, err
+		}
+		attempts = append(attempts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	for _, a := range attempts {
+		provider, ok := rc.providers[a.provider]
+		if !ok {
+			continue
+		}
+		result.Checked++
+
+		status, err := provider.QueryPayment(ctx, a.externalOrderID)
+		if err != nil {
+			log.Printf("ERROR querying %s payment %s: %v", a.provider, a.externalOrderID, err)
+			result.Errors++
+			continue
+		}
+		switch status.Status {
+		case StatusPaid:
+		case StatusPending:
+			result.Pending++
+			continue
+		default:
+			result.Failed++
+			continue
+		}
+
+		err = ApplyEvent(ctx, rc.db, a.provider, &WebhookEvent{
+			ExternalOrderID: a.externalOrderID,
+			OrderID:         a.orderID,
+			TransactionID:   status.TransactionID,
+			Amount:          status.Amount,
+			Success:         true,
+			ResultCode:      "query",
+			Message:         status.Message,
+		}, rc.now())
+		switch {
+		case err == nil:
+			result.Paid++
+			log.Printf("Reconciled %s payment %s: order %d paid", a.provider, a.externalOrderID, a.orderID)
+		case errors.Is(err, ErrAlreadyProcessed):
+			// IPN vừa tới trong lúc tra cứu
+		case errors.Is(err, ErrPaidAfterCancel):
+			// Đơn bị hủy trong lúc tra cứu; giao dịch đã được đánh dấu để admin hoàn tiền
+			log.Printf("WARNING: %s payment %s captured after order %d was cancelled, refund required", a.provider, a.externalOrderID, a.orderID)
+		default:
+			log.Printf("ERROR applying %s payment %s: %v", a.provider, a.externalOrderID, err)
+			result.Errors++
+		}
+	}
+
+	if rc.Refunds != nil {
+		result.Refunds, err = rc.Refunds.ReconcilePending(ctx, rc.now().Add(-rc.After))
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// Run chạy ReconcilePending định kỳ cho tới khi ctx bị hủy.
+func (rc *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if res, err := rc.ReconcilePending(ctx); err != nil {
+			log.Printf("ERROR reconciling pending payments: %v", err)
+		} else {
+			if res.Paid > 0 {
+				log.Printf("Reconciled %d payments with lost IPNs", res.Paid)
+			}
+			if res.Refunds > 0 {
+				log.Printf("Reconciled %d pending refunds", res.Refunds)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
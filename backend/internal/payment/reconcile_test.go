@@ -0,0 +1,138 @@
+package payment
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+)
+
+var testReconcileNow = time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+// queryProvider là cổng giả trả kết quả tra cứu cố định.
+type queryProvider struct {
+	Provider
+	result  QueryResult
+	queried []string
+}
+
+func (p *queryProvider) Name() string { return "momo" }
+
+func (p *queryProvider) QueryPayment(_ context.Context, externalOrderID string) (*QueryResult, error) {
+	p.queried = append(p.queried, externalOrderID)
+	res := p.result
+	res.ExternalOrderID = externalOrderID
+	return &res, nil
+}
+
+// pendingRefunds ghi lại mốc thời gian được tra cứu.
+type pendingRefunds struct {
+	settled int
+	before  []time.Time
+}
+
+func (p *pendingRefunds) ReconcilePending(_ context.Context, before time.Time) (int, error) {
+	p.before = append(p.before, before)
+	return p.settled, nil
+}
+
+// reconcileFixture là đơn 12 chờ thanh toán 150.000đ qua MoMo, chưa nhận được IPN.
+func reconcileFixture(result QueryResult) (*dbtest.DB, *Reconciler, *queryProvider) {
+	fake, db := dbtest.New()
+	fake.On("FROM payment_attempts pa", dbtest.Rows([]driver.Value{int64(12), "momo", "BISTROBLISS_12_1"}))
+	// Lần đầu ghi được giao dịch; lần sau trùng external_order_id nên ON CONFLICT không trả dòng nào
+	inserted := false
+	fake.On("INSERT INTO payment_transactions", func([]driver.Value) ([][]driver.Value, error) {
+		if inserted {
+			return nil, nil
+		}
+		inserted = true
+		return [][]driver.Value{{int64(3)}}, nil
+	})
+	fake.On("SELECT total_amount FROM orders", dbtest.Rows([]driver.Value{int64(150000)}))
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{"pending"}))
+	fake.On("FROM gift_cards WHERE order_id", dbtest.Rows([]driver.Value{false, "momo"}))
+
+	provider := &queryProvider{result: result}
+	rc := NewReconciler(db, map[string]Provider{"momo": provider}, func() time.Time { return testReconcileNow }, 10*time.Minute)
+	return fake, rc, provider
+}
+
+func TestReconcilePendingQueriesOldAttempts(t *testing.T) {
+	fake, rc, provider := reconcileFixture(QueryResult{Status: StatusPending})
+
+	if _, err := rc.ReconcilePending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	q := fake.Calls("FROM payment_attempts pa")
+	if len(q) != 1 || q[0].Args[0] != "pending" || q[0].Args[1] != testReconcileNow.Add(-10*time.Minute) {
+		t.Errorf("chỉ tra cứu giao dịch của đơn pending tạo trước After, có %+v", q)
+	}
+	if len(provider.queried) != 1 || provider.queried[0] != "BISTROBLISS_12_1" {
+		t.Errorf("QueryPayment = %v", provider.queried)
+	}
+}
+
+func TestReconcilePendingAppliesPaidResultOnce(t *testing.T) {
+	fake, rc, _ := reconcileFixture(QueryResult{Status: StatusPaid, TransactionID: "4088", Amount: 150000})
+
+	res, err := rc.ReconcilePending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Checked != 1 || res.Paid != 1 {
+		t.Fatalf("result = %+v, muốn 1 đơn được thanh toán", res)
+	}
+	ins := fake.Calls("INSERT INTO payment_transactions")
+	if len(ins) != 1 || ins[0].Args[1] != "BISTROBLISS_12_1" || ins[0].Args[2] != "4088" || ins[0].Args[5] != "query" {
+		t.Errorf("giao dịch ghi = %+v", ins)
+	}
+	if st := fake.Calls("UPDATE orders SET status"); len(st) != 1 || st[0].Args[0] != "paid" {
+		t.Fatalf("trạng thái đơn = %+v, muốn paid", st)
+	}
+
+	// Chạy lại: giao dịch đã được ghi nên không có tác dụng
+	res, err = rc.ReconcilePending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Paid != 0 || res.Errors != 0 || len(fake.Calls("UPDATE orders SET status")) != 1 {
+		t.Errorf("lần chạy thứ hai phải không làm gì, result = %+v", res)
+	}
+}
+
+func TestReconcilePendingLeavesUnpaidOrders(t *testing.T) {
+	for _, status := range []string{StatusPending, StatusFailed} {
+		fake, rc, _ := reconcileFixture(QueryResult{Status: status})
+
+		res, err := rc.ReconcilePending(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Checked != 1 || res.Paid != 0 {
+			t.Errorf("%s: result = %+v", status, res)
+		}
+		if len(fake.Calls("INSERT INTO payment_transactions")) != 0 || len(fake.Calls("UPDATE orders")) != 0 {
+			t.Errorf("%s: không được ghi giao dịch hay cập nhật đơn", status)
+		}
+	}
+}
+
+func TestReconcilePendingSettlesRefunds(t *testing.T) {
+	_, rc, _ := reconcileFixture(QueryResult{Status: StatusPending})
+	refunds := &pendingRefunds{settled: 2}
+	rc.Refunds = refunds
+
+	res, err := rc.ReconcilePending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Refunds != 2 {
+		t.Errorf("Refunds = %d, muốn 2", res.Refunds)
+	}
+	if len(refunds.before) != 1 || !refunds.before[0].Equal(testReconcileNow.Add(-10*time.Minute)) {
+		t.Errorf("hoàn tiền được tra cứu với mốc %v", refunds.before)
+	}
+}
@@ -0,0 +1,178 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sandbox là cổng thanh toán giả chạy trong tiến trình, dùng cho chế độ demo và khi phát triển.
+// Giao dịch chỉ nằm trong bộ nhớ; callback được ký bằng khóa ngẫu nhiên sinh lúc khởi động
+// nên không thể giả mạo từ bên ngoài.
+type Sandbox struct {
+	mu       sync.Mutex
+	key      []byte
+	seq      int64
+	payments map[string]*sandboxPayment
+}
+
+type sandboxPayment struct {
+	orderID       int
+	amount        int64
+	refunded      int64
+	status        string
+	transactionID string
+}
+
+// SandboxCallback là payload webhook mà Sandbox gửi (hoặc Pay trả về).
+type SandboxCallback struct {
+	ExternalOrderID string `json:"externalOrderId"`
+	TransactionID   string `json:"transactionId"`
+	Amount          int64  `json:"amount"`
+	Success         bool   `json:"success"`
+	Signature       string `json:"signature"`
+}
+
+func NewSandbox() *Sandbox {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return &Sandbox{key: key, payments: map[string]*sandboxPayment{}}
+}
+
+func (s *Sandbox) Name() string { return "sandbox" }
+
+func (s *Sandbox) CreatePayment(ctx context.Context, req CreateRequest) (*CreateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	ref := fmt.Sprintf("SANDBOX_%d_%d", req.OrderID, s.seq)
+	s.payments[ref] = &sandboxPayment{orderID: req.OrderID, amount: req.Amount, status: StatusPending}
+	return &CreateResult{
+		ExternalOrderID: ref,
+		PaymentURL:      frontendURL() + "/order-result?sandbox=1&orderId=" + url.QueryEscape(ref),
+	}, nil
+}
+
+func (s *Sandbox) QueryPayment(ctx context.Context, externalOrderID string) (*QueryResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[externalOrderID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	return &QueryResult{
+		ExternalOrderID: externalOrderID,
+		TransactionID:   p.transactionID,
+		Amount:          p.amount,
+		Status:          p.status,
+	}, nil
+}
+
+func (s *Sandbox) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[req.ExternalOrderID]
+	if !ok || p.status != StatusPaid {
+		return &RefundResult{Status: StatusFailed, Message: "Giao dịch chưa được thanh toán"}, nil
+	}
+	if p.refunded+req.Amount > p.amount {
+		return &RefundResult{Status: StatusFailed, Message: "Số tiền hoàn vượt quá số tiền đã thanh toán"}, nil
+	}
+	p.refunded += req.Amount
+	s.seq++
+	return &RefundResult{TransactionID: "SBRF" + strconv.FormatInt(s.seq, 10), Status: StatusRefunded}, nil
+}
+
+// Pay giả lập khách thanh toán (success = false là thanh toán thất bại) và trả về callback
+// đã ký, giống như cổng thật gửi tới webhook.
+func (s *Sandbox) Pay(externalOrderID string, success bool) (*SandboxCallback, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[externalOrderID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	p.status = StatusFailed
+	if success {
+		p.status = StatusPaid
+		p.transactionID = "SB" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+
+	cb := &SandboxCallback{
+		ExternalOrderID: externalOrderID,
+		TransactionID:   p.transactionID,
+		Amount:          p.amount,
+		Success:         success,
+	}
+	cb.Signature = s.sign(cb)
+	return cb, nil
+}
+
+// Event xác thực callback và chuyển thành WebhookEvent.
+func (s *Sandbox) Event(cb SandboxCallback) (*WebhookEvent, error) {
+	if !hmac.Equal([]byte(s.sign(&cb)), []byte(cb.Signature)) {
+		return nil, ErrInvalidSignature
+	}
+	s.mu.Lock()
+	p, ok := s.payments[cb.ExternalOrderID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+
+	code := "0"
+	if !cb.Success {
+		code = "1"
+	}
+	return &WebhookEvent{
+		ExternalOrderID: cb.ExternalOrderID,
+		OrderID:         p.orderID,
+		TransactionID:   cb.TransactionID,
+		Amount:          cb.Amount,
+		Success:         cb.Success,
+		ResultCode:      code,
+	}, nil
+}
+
+func (s *Sandbox) ParseWebhook(r *http.Request) (*WebhookEvent, error) {
+	var cb SandboxCallback
+	if err := json.NewDecoder(r.Body).Decode(&cb); err != nil {
+		return nil, fmt.Errorf("decode sandbox callback: %w", err)
+	}
+	return s.Event(cb)
+}
+
+func (s *Sandbox) RespondWebhook(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil || errors.Is(err, ErrAlreadyProcessed):
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrInvalidSignature):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+}
+
+func (s *Sandbox) sign(cb *SandboxCallback) string {
+	raw := fmt.Sprintf("amount=%d&externalOrderId=%s&success=%t&transactionId=%s",
+		cb.Amount, cb.ExternalOrderID, cb.Success, cb.TransactionID)
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(raw))
+	return hex.EncodeToString(h.Sum(nil))
+}
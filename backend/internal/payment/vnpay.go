@@ -0,0 +1,440 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// vnpayDefaultExpiry là thời hạn thanh toán khi đơn không có hạn giữ hàng.
+	vnpayDefaultExpiry = 15 * time.Minute
+	vnpayVersion       = "2.1.0"
+	vnpayDateLayout    = "20060102150405"
+	defaultVNPayPayURL = "https://sandbox.vnpayment.vn/paymentv2/vpcpay.html"
+	defaultVNPayAPIURL = "https://sandbox.vnpayment.vn/merchant_webapi/api/transaction"
+)
+
+// VNPay giờ Việt Nam (GMT+7) cho mọi trường ngày giờ.
+var vnpayLocation = time.FixedZone("GMT+7", 7*60*60)
+
+// VNPay là cổng thanh toán VNPay (API 2.1.0). IPN URL được cấu hình trên trang quản trị
+// merchant của VNPay, trỏ tới /api/webhook/vnpay.
+type VNPay struct {
+	TmnCode    string
+	HashSecret string
+	// PayURL là trang thanh toán, APIURL là API querydr/refund.
+	PayURL    string
+	APIURL    string
+	ReturnURL string
+	Client    *http.Client
+	// now mặc định là time.Now; test thay để chữ ký và mã request cố định.
+	now func() time.Time
+}
+
+func NewVNPayFromEnv() *VNPay {
+	v := &VNPay{
+		TmnCode:    os.Getenv("VNPAY_TMN_CODE"),
+		HashSecret: os.Getenv("VNPAY_HASH_SECRET"),
+		PayURL:     os.Getenv("VNPAY_PAY_URL"),
+		APIURL:     os.Getenv("VNPAY_API_URL"),
+		ReturnURL:  frontendURL() + "/order-result",
+		Client:     newHTTPClient(),
+	}
+	if v.PayURL == "" {
+		v.PayURL = defaultVNPayPayURL
+	}
+	if v.APIURL == "" {
+		v.APIURL = defaultVNPayAPIURL
+	}
+	return v
+}
+
+func (v *VNPay) Name() string { return "vnpay" }
+
+// configured báo đã có đủ mã website (vnp_TmnCode) và secret ký giao dịch.
+func (v *VNPay) configured() bool {
+	return v.TmnCode != "" && v.HashSecret != ""
+}
+
+func (v *VNPay) timestamp() time.Time {
+	if v.now != nil {
+		return v.now().In(vnpayLocation)
+	}
+	return time.Now().In(vnpayLocation)
+}
+
+// vnp_TxnRef có dạng <id đơn>_<vnp_CreateDate>; API querydr/refund cần lại ngày tạo giao dịch.
+func vnpayTxnRef(orderID int, created string) string {
+	return fmt.Sprintf("%d_%s", orderID, created)
+}
+
+// ParseVNPayTxnRef lấy id đơn hàng và ngày tạo giao dịch từ vnp_TxnRef.
+func ParseVNPayTxnRef(ref string) (orderID int, created string, ok bool) {
+	parts := strings.SplitN(ref, "_", 2)
+	if len(parts) != 2 || len(parts[1]) != len(vnpayDateLayout) {
+		return 0, "", false
+	}
+	orderID, err := strconv.Atoi(parts[0])
+	if err != nil || orderID <= 0 {
+		return 0, "", false
+	}
+	return orderID, parts[1], true
+}
+
+func (v *VNPay) CreatePayment(ctx context.Context, req CreateRequest) (*CreateResult, error) {
+	now := v.timestamp()
+	created := now.Format(vnpayDateLayout)
+	txnRef := vnpayTxnRef(req.OrderID, created)
+	orderInfo := req.Description
+	if orderInfo == "" {
+		orderInfo = fmt.Sprintf("Thanh toan don hang %d", req.OrderID)
+	}
+	ip := req.ClientIP
+	if ip == "" {
+		ip = "127.0.0.1"
+	}
+
+	params := url.Values{}
+	params.Set("vnp_Version", vnpayVersion)
+	params.Set("vnp_Command", "pay")
+	params.Set("vnp_TmnCode", v.TmnCode)
+	// VNPay nhận số tiền nhân 100
+	params.Set("vnp_Amount", strconv.FormatInt(req.Amount*100, 10))
+	params.Set("vnp_CurrCode", "VND")
+	params.Set("vnp_TxnRef", txnRef)
+	params.Set("vnp_OrderInfo", orderInfo)
+	params.Set("vnp_OrderType", "other")
+	params.Set("vnp_Locale", "vn")
+	params.Set("vnp_ReturnUrl", v.ReturnURL)
+	params.Set("vnp_IpAddr", ip)
+	params.Set("vnp_CreateDate", created)
+	expires := now.Add(vnpayDefaultExpiry)
+	if !req.ExpiresAt.IsZero() {
+		expires = req.ExpiresAt.In(vnpayLocation)
+	}
+	params.Set("vnp_ExpireDate", expires.Format(vnpayDateLayout))
+
+	query := vnpayHashData(params)
+	payURL := v.PayURL + "?" + query + "&vnp_SecureHash=" + v.sign(query)
+	return &CreateResult{ExternalOrderID: txnRef, PaymentURL: payURL}, nil
+}
+
+// vnpayHashData sắp xếp tham số vnp_* theo tên và nối thành chuỗi query đã encode, bỏ qua
+// vnp_SecureHash / vnp_SecureHashType và giá trị rỗng, đúng như VNPay tính chữ ký.
+func vnpayHashData(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if !strings.HasPrefix(k, "vnp_") || k == "vnp_SecureHash" || k == "vnp_SecureHashType" || params.Get(k) == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(k))
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(params.Get(k)))
+	}
+	return b.String()
+}
+
+func (v *VNPay) sign(data string) string {
+	h := hmac.New(sha512.New, []byte(v.HashSecret))
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verify kiểm tra vnp_SecureHash của các tham số VNPay gửi về (return URL hoặc IPN).
+func (v *VNPay) verify(params url.Values) bool {
+	if v.HashSecret == "" {
+		return false
+	}
+	expected := v.sign(vnpayHashData(params))
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(params.Get("vnp_SecureHash"))))
+}
+
+// event xác thực tham số VNPay gửi về và chuyển thành WebhookEvent.
+func (v *VNPay) event(params url.Values) (*WebhookEvent, error) {
+	if params.Get("vnp_TmnCode") != v.TmnCode || !v.verify(params) {
+		return nil, ErrInvalidSignature
+	}
+	txnRef := params.Get("vnp_TxnRef")
+	orderID, _, ok := ParseVNPayTxnRef(txnRef)
+	if !ok {
+		return nil, fmt.Errorf("%w: vnp_TxnRef %q", ErrOrderNotFound, txnRef)
+	}
+	amount, err := strconv.ParseInt(params.Get("vnp_Amount"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vnp_Amount %q", params.Get("vnp_Amount"))
+	}
+
+	code := params.Get("vnp_ResponseCode")
+	return &WebhookEvent{
+		ExternalOrderID: txnRef,
+		OrderID:         orderID,
+		TransactionID:   params.Get("vnp_TransactionNo"),
+		Amount:          amount / 100,
+		Success:         code == "00" && params.Get("vnp_TransactionStatus") == "00",
+		ResultCode:      code,
+		Message:         vnpayResponseMessage(code),
+	}, nil
+}
+
+// ParseWebhook đọc IPN; VNPay gửi IPN bằng GET với tham số trên query string.
+func (v *VNPay) ParseWebhook(r *http.Request) (*WebhookEvent, error) {
+	return v.event(r.URL.Query())
+}
+
+// VerifyReturn xác thực tham số VNPay gắn vào return URL khi chuyển khách về cửa hàng.
+func (v *VNPay) VerifyReturn(r *http.Request) (*WebhookEvent, error) {
+	return v.event(r.URL.Query())
+}
+
+// RespondWebhook trả HTTP 200 với RspCode theo tài liệu IPN của VNPay; VNPay gửi lại IPN
+// khi nhận mã 99 hoặc không nhận được phản hồi.
+func (v *VNPay) RespondWebhook(w http.ResponseWriter, err error) {
+	code, message := "00", "Confirm Success"
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrInvalidSignature):
+		code, message = "97", "Invalid signature"
+	case errors.Is(err, ErrOrderNotFound):
+		code, message = "01", "Order not found"
+	case errors.Is(err, ErrAlreadyProcessed):
+		code, message = "02", "Order already confirmed"
+	case errors.Is(err, ErrAmountMismatch):
+		code, message = "04", "Invalid amount"
+	default:
+		code, message = "99", "Unknown error"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"RspCode": code, "Message": message})
+}
+
+type vnpayAPIResponse struct {
+	ResponseCode      string `json:"vnp_ResponseCode"`
+	Message           string `json:"vnp_Message"`
+	TxnRef            string `json:"vnp_TxnRef"`
+	Amount            string `json:"vnp_Amount"`
+	TransactionNo     string `json:"vnp_TransactionNo"`
+	TransactionType   string `json:"vnp_TransactionType"`
+	TransactionStatus string `json:"vnp_TransactionStatus"`
+}
+
+// querydr gọi API tra cứu giao dịch vnp_TxnRef = externalOrderID.
+func (v *VNPay) querydr(ctx context.Context, externalOrderID string) (*vnpayAPIResponse, error) {
+	_, created, ok := ParseVNPayTxnRef(externalOrderID)
+	if !ok {
+		return nil, fmt.Errorf("unexpected vnp_TxnRef %q", externalOrderID)
+	}
+	now := v.timestamp()
+	requestID := strconv.FormatInt(now.UnixNano(), 10)
+	createDate := now.Format(vnpayDateLayout)
+	orderInfo := "Truy van giao dich " + externalOrderID
+	ip := "127.0.0.1"
+
+	hashData := strings.Join([]string{requestID, vnpayVersion, "querydr", v.TmnCode, externalOrderID, created, createDate, ip, orderInfo}, "|")
+	body := map[string]string{
+		"vnp_RequestId":       requestID,
+		"vnp_Version":         vnpayVersion,
+		"vnp_Command":         "querydr",
+		"vnp_TmnCode":         v.TmnCode,
+		"vnp_TxnRef":          externalOrderID,
+		"vnp_OrderInfo":       orderInfo,
+		"vnp_TransactionDate": created,
+		"vnp_CreateDate":      createDate,
+		"vnp_IpAddr":          ip,
+		"vnp_SecureHash":      v.sign(hashData),
+	}
+
+	var resp vnpayAPIResponse
+	if err := v.post(ctx, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (v *VNPay) QueryPayment(ctx context.Context, externalOrderID string) (*QueryResult, error) {
+	resp, err := v.querydr(ctx, externalOrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{
+		ExternalOrderID: externalOrderID,
+		TransactionID:   resp.TransactionNo,
+		Message:         resp.Message,
+	}
+	if amount, err := strconv.ParseInt(resp.Amount, 10, 64); err == nil {
+		result.Amount = amount / 100
+	}
+	switch {
+	case resp.ResponseCode != "00":
+		// 91: không tìm thấy giao dịch (khách chưa thanh toán)
+		if resp.ResponseCode == "91" {
+			result.Status = StatusPending
+		} else {
+			return nil, fmt.Errorf("VNPay querydr failed: %s %s", resp.ResponseCode, resp.Message)
+		}
+	case resp.TransactionStatus == "00":
+		result.Status = StatusPaid
+	case resp.TransactionStatus == "01":
+		result.Status = StatusPending
+	case resp.TransactionStatus == "05", resp.TransactionStatus == "06":
+		result.Status = StatusRefunded
+	default:
+		result.Status = StatusFailed
+	}
+	return result, nil
+}
+
+func (v *VNPay) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	_, created, ok := ParseVNPayTxnRef(req.ExternalOrderID)
+	if !ok {
+		return nil, fmt.Errorf("unexpected vnp_TxnRef %q", req.ExternalOrderID)
+	}
+	now := v.timestamp()
+	requestID := strconv.FormatInt(now.UnixNano(), 10)
+	createDate := now.Format(vnpayDateLayout)
+	amount := strconv.FormatInt(req.Amount*100, 10)
+	// 02: hoàn toàn phần, 03: hoàn một phần
+	transactionType := "03"
+	if req.TotalAmount > 0 && req.Amount == req.TotalAmount {
+		transactionType = "02"
+	}
+	orderInfo := req.Description
+	if orderInfo == "" {
+		orderInfo = "Hoan tien " + req.ExternalOrderID
+	}
+	createBy := "system"
+	ip := "127.0.0.1"
+
+	hashData := strings.Join([]string{requestID, vnpayVersion, "refund", v.TmnCode, transactionType, req.ExternalOrderID, amount, req.TransactionID, created, createBy, createDate, ip, orderInfo}, "|")
+	body := map[string]string{
+		"vnp_RequestId":       requestID,
+		"vnp_Version":         vnpayVersion,
+		"vnp_Command":         "refund",
+		"vnp_TmnCode":         v.TmnCode,
+		"vnp_TransactionType": transactionType,
+		"vnp_TxnRef":          req.ExternalOrderID,
+		"vnp_Amount":          amount,
+		"vnp_OrderInfo":       orderInfo,
+		"vnp_TransactionNo":   req.TransactionID,
+		"vnp_TransactionDate": created,
+		"vnp_CreateBy":        createBy,
+		"vnp_CreateDate":      createDate,
+		"vnp_IpAddr":          ip,
+		"vnp_SecureHash":      v.sign(hashData),
+	}
+
+	var resp vnpayAPIResponse
+	if err := v.post(ctx, body, &resp); err != nil {
+		return nil, err
+	}
+
+	result := &RefundResult{TransactionID: resp.TransactionNo, Message: resp.Message, Status: StatusFailed}
+	switch resp.ResponseCode {
+	case "00":
+		result.Status = StatusRefunded
+	case "94":
+		// Yêu cầu hoàn tiền đang được VNPay xử lý
+		result.Status = StatusPending
+	}
+	return result, nil
+}
+
+// QueryRefund tra cứu giao dịch gốc bằng querydr; VNPay trả trạng thái hoàn tiền trên chính giao
+// dịch thanh toán (vnp_TransactionType 02/03 khi đã hoàn).
+func (v *VNPay) QueryRefund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	resp, err := v.querydr(ctx, req.ExternalOrderID)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ResponseCode != "00" {
+		return nil, fmt.Errorf("VNPay querydr failed: %s %s", resp.ResponseCode, resp.Message)
+	}
+	result := &RefundResult{Message: resp.Message, Status: StatusPending}
+	switch {
+	case resp.TransactionStatus == "09":
+		// Yêu cầu hoàn tiền bị từ chối
+		result.Status = StatusFailed
+	case resp.TransactionStatus == "05", resp.TransactionStatus == "06":
+		// VNPay / ngân hàng đang xử lý
+	case resp.TransactionStatus == "00" && (resp.TransactionType == "02" || resp.TransactionType == "03"):
+		result.Status = StatusRefunded
+		result.TransactionID = resp.TransactionNo
+	}
+	return result, nil
+}
+
+func (v *VNPay) post(ctx context.Context, body, out interface{}) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.APIURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := v.Client
+	if client == nil {
+		client = newHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// vnpayResponseMessage mô tả một số vnp_ResponseCode thường gặp.
+func vnpayResponseMessage(code string) string {
+	switch code {
+	case "00":
+		return "Giao dịch thành công"
+	case "07":
+		return "Giao dịch bị nghi ngờ gian lận"
+	case "09":
+		return "Thẻ/Tài khoản chưa đăng ký Internet Banking"
+	case "11":
+		return "Đã hết hạn chờ thanh toán"
+	case "12":
+		return "Thẻ/Tài khoản bị khóa"
+	case "24":
+		return "Khách hàng hủy giao dịch"
+	case "51":
+		return "Tài khoản không đủ số dư"
+	case "65":
+		return "Tài khoản vượt quá hạn mức giao dịch trong ngày"
+	default:
+		return "Giao dịch không thành công"
+	}
+}
@@ -0,0 +1,312 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Các fixture trong testdata/vnpay được ký bằng testVNPaySecret theo tài liệu VNPay 2.1.0,
+// độc lập với code ký ở đây.
+const (
+	testVNPayTmnCode = "SHOPTEST"
+	testVNPaySecret  = "VNPAYTESTSECRET0123456789ABCDEF"
+)
+
+// 2025-03-10 16:00:00 giờ Việt Nam
+var testVNPayNow = time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+func newTestVNPay(apiURL string) *VNPay {
+	return &VNPay{
+		TmnCode:    testVNPayTmnCode,
+		HashSecret: testVNPaySecret,
+		PayURL:     defaultVNPayPayURL,
+		APIURL:     apiURL,
+		ReturnURL:  "http://localhost:3000/order-result",
+		now:        func() time.Time { return testVNPayNow },
+	}
+}
+
+func readVNPayFixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "vnpay", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func vnpayCallback(t *testing.T, query string) *http.Request {
+	t.Helper()
+	return httptest.NewRequest(http.MethodGet, "/api/webhook/vnpay?"+query, nil)
+}
+
+func TestVNPayCreatePaymentSignedURL(t *testing.T) {
+	v := newTestVNPay("")
+	res, err := v.CreatePayment(context.Background(), CreateRequest{
+		OrderID:     12,
+		Amount:      150000,
+		Description: "Thanh toán đơn hàng #12",
+		ClientIP:    "203.0.113.5",
+		ExpiresAt:   testVNPayNow.Add(30 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExternalOrderID != "12_20250310160000" {
+		t.Errorf("ExternalOrderID = %s", res.ExternalOrderID)
+	}
+	if want := readVNPayFixture(t, "pay_url.golden"); res.PaymentURL != want {
+		t.Errorf("PaymentURL =\n%s\nmuốn\n%s", res.PaymentURL, want)
+	}
+}
+
+func TestVNPayExpireDateFollowsReservation(t *testing.T) {
+	v := newTestVNPay("")
+	cases := []struct {
+		name      string
+		expiresAt time.Time
+		want      string
+	}{
+		{"theo hạn giữ hàng", testVNPayNow.Add(45 * time.Minute), "20250310164500"},
+		{"không có hạn giữ hàng", time.Time{}, "20250310161500"},
+	}
+	for _, c := range cases {
+		res, err := v.CreatePayment(context.Background(), CreateRequest{OrderID: 12, Amount: 1000, ExpiresAt: c.expiresAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, _ := url.Parse(res.PaymentURL)
+		if got := u.Query().Get("vnp_ExpireDate"); got != c.want {
+			t.Errorf("%s: vnp_ExpireDate = %s, muốn %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestVNPayParseWebhook(t *testing.T) {
+	v := newTestVNPay("")
+
+	event, err := v.ParseWebhook(vnpayCallback(t, readVNPayFixture(t, "ipn_success.query")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := WebhookEvent{
+		ExternalOrderID: "12_20250310160000",
+		OrderID:         12,
+		TransactionID:   "14851234",
+		Amount:          150000,
+		Success:         true,
+		ResultCode:      "00",
+		Message:         "Giao dịch thành công",
+	}
+	if *event != want {
+		t.Errorf("event = %+v, muốn %+v", *event, want)
+	}
+
+	// Tham số rỗng không nằm trong chuỗi ký
+	event, err = v.ParseWebhook(vnpayCallback(t, readVNPayFixture(t, "ipn_cancelled.query")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Success || event.ResultCode != "24" {
+		t.Errorf("giao dịch khách hủy: %+v", *event)
+	}
+}
+
+func TestVNPayVerifyReturn(t *testing.T) {
+	v := newTestVNPay("")
+	// vnp_SecureHashType không tính vào chữ ký
+	event, err := v.VerifyReturn(vnpayCallback(t, readVNPayFixture(t, "return_success.query")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !event.Success || event.OrderID != 12 || event.Amount != 150000 {
+		t.Errorf("event = %+v", *event)
+	}
+}
+
+func TestVNPayRejectsTamperedCallback(t *testing.T) {
+	genuine, err := url.ParseQuery(readVNPayFixture(t, "ipn_success.query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name   string
+		tamper func(url.Values)
+		secret string
+	}{
+		{"sửa số tiền", func(q url.Values) { q.Set("vnp_Amount", "100") }, testVNPaySecret},
+		{"sửa mã đơn", func(q url.Values) { q.Set("vnp_TxnRef", "13_20250310160000") }, testVNPaySecret},
+		{"sửa kết quả", func(q url.Values) { q.Set("vnp_ResponseCode", "24") }, testVNPaySecret},
+		{"sửa hash", func(q url.Values) { q.Set("vnp_SecureHash", strings.Repeat("0", 128)) }, testVNPaySecret},
+		{"thiếu hash", func(q url.Values) { q.Del("vnp_SecureHash") }, testVNPaySecret},
+		{"thêm tham số", func(q url.Values) { q.Set("vnp_BankCode", "VCB") }, testVNPaySecret},
+		{"sai mã website", func(q url.Values) { q.Set("vnp_TmnCode", "OTHER") }, testVNPaySecret},
+		{"sai secret", func(url.Values) {}, "another-secret"},
+		{"secret rỗng", func(url.Values) {}, ""},
+	}
+	for _, c := range cases {
+		v := newTestVNPay("")
+		v.HashSecret = c.secret
+		q := url.Values{}
+		for k, vals := range genuine {
+			q[k] = append([]string(nil), vals...)
+		}
+		c.tamper(q)
+
+		_, err := v.ParseWebhook(vnpayCallback(t, q.Encode()))
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, muốn ErrInvalidSignature", c.name, err)
+			continue
+		}
+		rec := httptest.NewRecorder()
+		v.RespondWebhook(rec, err)
+		var body map[string]string
+		json.NewDecoder(rec.Body).Decode(&body)
+		if body["RspCode"] != "97" {
+			t.Errorf("%s: RspCode = %s, muốn 97", c.name, body["RspCode"])
+		}
+	}
+}
+
+func TestVNPayRespondWebhook(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{nil, "00"},
+		{ErrInvalidSignature, "97"},
+		{ErrOrderNotFound, "01"},
+		{ErrAlreadyProcessed, "02"},
+		{ErrAmountMismatch, "04"},
+		{errors.New("db down"), "99"},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		newTestVNPay("").RespondWebhook(rec, c.err)
+		var body map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK || body["RspCode"] != c.want {
+			t.Errorf("%v: %d %v, muốn 200 RspCode %s", c.err, rec.Code, body, c.want)
+		}
+	}
+}
+
+// vnpayAPIServer trả response đã ghi lại và lưu request nhận được.
+func vnpayAPIServer(t *testing.T, response string, got *map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(readVNPayFixture(t, response)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func assertVNPayRequest(t *testing.T, got map[string]string, fixture string) {
+	t.Helper()
+	var want map[string]string
+	if err := json.Unmarshal([]byte(readVNPayFixture(t, fixture)), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("request =\n%v\nmuốn\n%v", got, want)
+	}
+}
+
+func TestVNPayQueryPayment(t *testing.T) {
+	var got map[string]string
+	srv := vnpayAPIServer(t, "querydr_response.json", &got)
+
+	res, err := newTestVNPay(srv.URL).QueryPayment(context.Background(), "12_20250310160000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVNPayRequest(t, got, "querydr_request.json")
+	want := QueryResult{
+		ExternalOrderID: "12_20250310160000",
+		TransactionID:   "14851234",
+		Amount:          150000,
+		Status:          StatusPaid,
+		Message:         "QueryDR Success",
+	}
+	if *res != want {
+		t.Errorf("result = %+v, muốn %+v", *res, want)
+	}
+}
+
+func TestVNPayRefund(t *testing.T) {
+	var got map[string]string
+	srv := vnpayAPIServer(t, "refund_response.json", &got)
+
+	res, err := newTestVNPay(srv.URL).Refund(context.Background(), RefundRequest{
+		RefundID:        "RF12_1",
+		ExternalOrderID: "12_20250310160000",
+		TransactionID:   "14851234",
+		Amount:          50000,
+		TotalAmount:     150000,
+		Description:     "Hoan tien don hang 12",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVNPayRequest(t, got, "refund_request.json")
+	// 94: VNPay đang xử lý yêu cầu hoàn tiền
+	want := RefundResult{TransactionID: "14851299", Status: StatusPending, Message: "Yeu cau hoan tien dang duoc xu ly"}
+	if *res != want {
+		t.Errorf("result = %+v, muốn %+v", *res, want)
+	}
+}
+
+func TestVNPayQueryRefund(t *testing.T) {
+	cases := []struct {
+		name     string
+		response string
+		want     RefundResult
+	}{
+		{"đang xử lý", `{"vnp_ResponseCode":"00","vnp_Message":"OK","vnp_TransactionType":"03","vnp_TransactionStatus":"05"}`,
+			RefundResult{Status: StatusPending, Message: "OK"}},
+		{"đã gửi ngân hàng", `{"vnp_ResponseCode":"00","vnp_Message":"OK","vnp_TransactionType":"03","vnp_TransactionStatus":"06"}`,
+			RefundResult{Status: StatusPending, Message: "OK"}},
+		{"bị từ chối", `{"vnp_ResponseCode":"00","vnp_Message":"OK","vnp_TransactionType":"03","vnp_TransactionStatus":"09"}`,
+			RefundResult{Status: StatusFailed, Message: "OK"}},
+		{"đã hoàn", `{"vnp_ResponseCode":"00","vnp_Message":"OK","vnp_TransactionNo":"14851299","vnp_TransactionType":"03","vnp_TransactionStatus":"00"}`,
+			RefundResult{TransactionID: "14851299", Status: StatusRefunded, Message: "OK"}},
+		{"chưa ghi nhận hoàn", `{"vnp_ResponseCode":"00","vnp_Message":"OK","vnp_TransactionType":"01","vnp_TransactionStatus":"00"}`,
+			RefundResult{Status: StatusPending, Message: "OK"}},
+	}
+	for _, c := range cases {
+		var got map[string]string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&got)
+			w.Write([]byte(c.response))
+		}))
+		res, err := newTestVNPay(srv.URL).QueryRefund(context.Background(), RefundRequest{
+			RefundID: "RF12_1", ExternalOrderID: "12_20250310160000", TransactionID: "14851234", Amount: 50000, TotalAmount: 150000,
+		})
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got["vnp_Command"] != "querydr" || got["vnp_TxnRef"] != "12_20250310160000" {
+			t.Errorf("%s: request = %v, muốn querydr giao dịch gốc", c.name, got)
+		}
+		if *res != c.want {
+			t.Errorf("%s: result = %+v, muốn %+v", c.name, *res, c.want)
+		}
+	}
+}
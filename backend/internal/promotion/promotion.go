@@ -0,0 +1,293 @@
+// Package promotion tính khuyến mãi tự động trên giỏ hàng: mua X tặng Y, combo giá cố định và
+// giảm giá theo bậc tổng tiền. Evaluate là hàm thuần; quy tắc được lưu trong bảng promotions.
+package promotion
+
+import (
+	"sort"
+	"time"
+
+	"backend/internal/models"
+)
+
+// Các loại quy tắc khuyến mãi.
+const (
+	TypeBuyXGetY    = "buy_x_get_y"
+	TypeCombo       = "combo"
+	TypeTieredSpend = "tiered_spend"
+)
+
+// Line là một món trong giỏ hàng.
+type Line struct {
+	ProductID  int
+	CategoryID int
+	Quantity   int
+	UnitPrice  int64
+}
+
+// Adjustment là phần giảm giá của một quy tắc trên món Lines[Line].
+type Adjustment struct {
+	Line      int
+	Promotion models.Promotion
+	Amount    int64
+}
+
+// Result là kết quả áp dụng khuyến mãi cho giỏ hàng.
+type Result struct {
+	Adjustments []Adjustment
+	Applied     []models.AppliedPromotion
+	// BlockedVoucherBy là tên khuyến mãi không cho dùng kèm voucher, rỗng nếu được dùng.
+	BlockedVoucherBy string
+}
+
+// cart là trạng thái giỏ hàng trong lúc áp dụng các quy tắc: số tiền còn lại của mỗi món (để
+// tổng giảm không vượt giá món) và số lượng chưa bị quy tắc theo số lượng (mua X tặng Y, combo)
+// sử dụng, để một món không được tính hai lần.
+type cart struct {
+	lines     []Line
+	remaining []int64
+	freeUnits []int
+}
+
+// Evaluate áp dụng các quy tắc đang hiệu lực theo priority giảm dần (cùng priority thì id tăng dần).
+func Evaluate(rules []models.Promotion, lines []Line, now time.Time) Result {
+	c := &cart{lines: lines, remaining: make([]int64, len(lines)), freeUnits: make([]int, len(lines))}
+	for i, l := range lines {
+		c.remaining[i] = l.UnitPrice * int64(l.Quantity)
+		c.freeUnits[i] = l.Quantity
+	}
+
+	sorted := append([]models.Promotion(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	var result Result
+	for _, rule := range sorted {
+		if !Active(rule, now) || (rule.Exclusive && len(result.Applied) > 0) {
+			continue
+		}
+
+		var amounts map[int]int64
+		switch rule.Type {
+		case TypeBuyXGetY:
+			amounts = c.buyXGetY(rule.Config)
+		case TypeCombo:
+			amounts = c.combo(rule.Config)
+		case TypeTieredSpend:
+			amounts = c.tieredSpend(rule.Config)
+		}
+
+		var total int64
+		for _, i := range sortedKeys(amounts) {
+			amount := min(amounts[i], c.remaining[i])
+			if amount <= 0 {
+				continue
+			}
+			c.remaining[i] -= amount
+			total += amount
+			result.Adjustments = append(result.Adjustments, Adjustment{Line: i, Promotion: rule, Amount: amount})
+		}
+		if total == 0 {
+			continue
+		}
+
+		result.Applied = append(result.Applied, models.AppliedPromotion{ID: rule.ID, Name: rule.Name, Type: rule.Type, Discount: total})
+		if !rule.AllowVoucher && result.BlockedVoucherBy == "" {
+			result.BlockedVoucherBy = rule.Name
+		}
+		if rule.Exclusive {
+			break
+		}
+	}
+	return result
+}
+
+// Active cho biết quy tắc đang bật và trong thời gian hiệu lực.
+func Active(rule models.Promotion, now time.Time) bool {
+	if !rule.IsActive {
+		return false
+	}
+	if rule.StartsAt != nil && now.Before(*rule.StartsAt) {
+		return false
+	}
+	return rule.EndsAt == nil || now.Before(*rule.EndsAt)
+}
+
+func (c *cart) covers(cfg models.PromotionConfig, l Line) bool {
+	if len(cfg.ProductIDs) == 0 && len(cfg.CategoryIDs) == 0 {
+		return true
+	}
+	for _, id := range cfg.ProductIDs {
+		if id == l.ProductID {
+			return true
+		}
+	}
+	for _, id := range cfg.CategoryIDs {
+		if l.CategoryID != 0 && id == l.CategoryID {
+			return true
+		}
+	}
+	return false
+}
+
+type unit struct {
+	line  int
+	price int64
+}
+
+// buyXGetY xếp các món thuộc phạm vi theo giá giảm dần rồi chia thành nhóm Buy+Get; trong mỗi
+// nhóm đủ, Get món cuối (rẻ nhất) được giảm.
+func (c *cart) buyXGetY(cfg models.PromotionConfig) map[int]int64 {
+	group := cfg.BuyQuantity + cfg.GetQuantity
+	if cfg.BuyQuantity <= 0 || cfg.GetQuantity <= 0 {
+		return nil
+	}
+	percent := cfg.GetDiscountPercent
+	if percent <= 0 || percent > 100 {
+		percent = 100
+	}
+
+	var units []unit
+	for i, l := range c.lines {
+		if !c.covers(cfg, l) {
+			continue
+		}
+		for n := 0; n < c.freeUnits[i]; n++ {
+			units = append(units, unit{line: i, price: l.UnitPrice})
+		}
+	}
+	sort.SliceStable(units, func(i, j int) bool { return units[i].price > units[j].price })
+
+	amounts := map[int]int64{}
+	full := len(units) / group * group
+	for start := 0; start < full; start += group {
+		for k, u := range units[start : start+group] {
+			c.freeUnits[u.line]--
+			if k >= cfg.BuyQuantity {
+				amounts[u.line] += u.price * percent / 100
+			}
+		}
+	}
+	return amounts
+}
+
+// combo: mỗi bộ gồm một món của từng sản phẩm trong ProductIDs được tính giá ComboPrice; phần
+// chênh lệch chia cho các món trong bộ theo giá.
+func (c *cart) combo(cfg models.PromotionConfig) map[int]int64 {
+	products := uniqueInts(cfg.ProductIDs)
+	if len(products) < 2 || cfg.ComboPrice <= 0 {
+		return nil
+	}
+
+	amounts := map[int]int64{}
+	for {
+		set := make([]unit, 0, len(products))
+		var normal int64
+		for _, productID := range products {
+			line := -1
+			for i, l := range c.lines {
+				if l.ProductID == productID && c.freeUnits[i] > 0 {
+					line = i
+					break
+				}
+			}
+			if line < 0 {
+				return amounts
+			}
+			set = append(set, unit{line: line, price: c.lines[line].UnitPrice})
+			normal += c.lines[line].UnitPrice
+		}
+		if normal <= cfg.ComboPrice {
+			return amounts
+		}
+
+		weights := map[int]int64{}
+		for _, u := range set {
+			c.freeUnits[u.line]--
+			weights[u.line] += u.price
+		}
+		for i, amount := range allocate(normal-cfg.ComboPrice, weights) {
+			amounts[i] += amount
+		}
+	}
+}
+
+// tieredSpend áp dụng bậc cao nhất mà tổng tiền còn lại của các món thuộc phạm vi đạt được.
+func (c *cart) tieredSpend(cfg models.PromotionConfig) map[int]int64 {
+	weights := map[int]int64{}
+	var base int64
+	for i, l := range c.lines {
+		if c.covers(cfg, l) && c.remaining[i] > 0 {
+			weights[i] = c.remaining[i]
+			base += c.remaining[i]
+		}
+	}
+
+	var tier *models.PromotionTier
+	for i := range cfg.Tiers {
+		t := &cfg.Tiers[i]
+		if base >= t.MinSubtotal && (tier == nil || t.MinSubtotal > tier.MinSubtotal) {
+			tier = t
+		}
+	}
+	if tier == nil || base == 0 {
+		return nil
+	}
+
+	var discount int64
+	switch tier.DiscountType {
+	case "percentage":
+		discount = base * tier.DiscountValue / 100
+	case "fixed_amount":
+		discount = tier.DiscountValue
+	}
+	if tier.MaxDiscount > 0 && discount > tier.MaxDiscount {
+		discount = tier.MaxDiscount
+	}
+	return allocate(min(discount, base), weights)
+}
+
+// allocate chia amount cho các món theo tỷ lệ weights; phần lẻ do làm tròn dồn vào món có chỉ
+// số lớn nhất. Tổng weights phải lớn hơn hoặc bằng amount.
+func allocate(amount int64, weights map[int]int64) map[int]int64 {
+	var total int64
+	for _, w := range weights {
+		total += w
+	}
+	out := map[int]int64{}
+	if amount <= 0 || total <= 0 {
+		return out
+	}
+	keys := sortedKeys(weights)
+	var allocated int64
+	for _, i := range keys {
+		out[i] = amount * weights[i] / total
+		allocated += out[i]
+	}
+	out[keys[len(keys)-1]] += amount - allocated
+	return out
+}
+
+func sortedKeys(m map[int]int64) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func uniqueInts(ids []int) []int {
+	seen := map[int]bool{}
+	var out []int
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package promotion
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"backend/internal/models"
+)
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Columns là danh sách cột của promotions theo thứ tự Scan.
+const Columns = "id, name, type, priority, exclusive, allow_voucher, config, starts_at, ends_at, is_active, created_at"
+
+// Scan đọc một dòng promotions (theo Columns) và giải mã config.
+func Scan(row interface{ Scan(...interface{}) error }) (models.Promotion, error) {
+	var p models.Promotion
+	var config []byte
+	var startsAt, endsAt sql.NullTime
+	err := row.Scan(&p.ID, &p.Name, &p.Type, &p.Priority, &p.Exclusive, &p.AllowVoucher,
+		&config, &startsAt, &endsAt, &p.IsActive, &p.CreatedAt)
+	if err != nil {
+		return p, err
+	}
+	if startsAt.Valid {
+		p.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		p.EndsAt = &endsAt.Time
+	}
+	if err := json.Unmarshal(config, &p.Config); err != nil {
+		return p, fmt.Errorf("promotion %d config: %w", p.ID, err)
+	}
+	return p, nil
+}
+
+// LoadActive đọc các khuyến mãi đang bật và trong thời gian hiệu lực tại now.
+func LoadActive(ctx context.Context, q querier, now time.Time) ([]models.Promotion, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT `+Columns+` FROM promotions
+		WHERE is_active = true
+		AND (starts_at IS NULL OR starts_at <= $1)
+		AND (ends_at IS NULL OR ends_at > $1)
+		ORDER BY priority DESC, id`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promos []models.Promotion
+	for rows.Next() {
+		p, err := Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		promos = append(promos, p)
+	}
+	return promos, rows.Err()
+}
+
+// Validate kiểm tra cấu hình khuyến mãi do admin nhập, trả về thông báo lỗi hoặc chuỗi rỗng.
+func Validate(p models.Promotion) string {
+	if p.Name == "" {
+		return "Tên khuyến mãi không được để trống"
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return "Thời gian kết thúc phải sau thời gian bắt đầu"
+	}
+
+	cfg := p.Config
+	switch p.Type {
+	case TypeBuyXGetY:
+		if cfg.BuyQuantity <= 0 || cfg.GetQuantity <= 0 {
+			return "Số lượng mua và số lượng tặng phải lớn hơn 0"
+		}
+		if cfg.GetDiscountPercent < 0 || cfg.GetDiscountPercent > 100 {
+			return "Phần trăm giảm cho món tặng phải từ 0 đến 100"
+		}
+	case TypeCombo:
+		if len(uniqueInts(cfg.ProductIDs)) < 2 {
+			return "Combo cần ít nhất 2 sản phẩm khác nhau"
+		}
+		if cfg.ComboPrice <= 0 {
+			return "Giá combo phải lớn hơn 0"
+		}
+	case TypeTieredSpend:
+		if len(cfg.Tiers) == 0 {
+			return "Cần ít nhất một bậc giảm giá"
+		}
+		for _, t := range cfg.Tiers {
+			if t.MinSubtotal <= 0 || t.DiscountValue <= 0 || t.MaxDiscount < 0 {
+				return "Mức chi tiêu và giá trị giảm của mỗi bậc phải lớn hơn 0"
+			}
+			switch t.DiscountType {
+			case "percentage":
+				if t.DiscountValue > 100 {
+					return "Phần trăm giảm giá không được vượt quá 100"
+				}
+			case "fixed_amount":
+			default:
+				return "Loại giảm giá của bậc không hợp lệ"
+			}
+		}
+	default:
+		return "Loại khuyến mãi không hợp lệ"
+	}
+	return ""
+}
@@ -0,0 +1,276 @@
+// Package referral quản lý chương trình giới thiệu: mỗi người dùng có một mã giới thiệu, người
+// đăng ký bằng mã được liên kết với người giới thiệu và khi đơn hàng trả trước đầu tiên của người
+// được giới thiệu (đã xác thực email) hoàn thành thì cả hai nhận một voucher từ voucher mẫu
+// REFERRAL_VOUCHER_ID. Đơn đó bị hoàn tiền thì voucher thưởng chưa dùng bị thu hồi.
+package referral
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+)
+
+// Trạng thái của một lượt giới thiệu.
+const (
+	StatusPending  = "pending"
+	StatusRewarded = "rewarded"
+	StatusRejected = "rejected"
+	StatusRevoked  = "revoked"
+)
+
+// Lý do từ chối thưởng.
+const (
+	ReasonSelfReferral    = "self_referral"
+	ReasonDuplicateDevice = "duplicate_device"
+	// ReasonSameIP: đăng ký từ IP người giới thiệu từng đăng ký hoặc đăng nhập.
+	ReasonSameIP = "same_ip"
+	// ReasonDuplicateIP: người giới thiệu đã có lượt giới thiệu khác từ cùng IP.
+	ReasonDuplicateIP = "duplicate_ip"
+)
+
+// Giá trị orders.payment_method / payment_status (payment.MethodCOD, payment.PaymentPaid); không
+// import payment được vì payment phụ thuộc orderstatus, nơi gọi Reward.
+const (
+	methodCOD   = "cod"
+	paymentPaid = "paid"
+)
+
+// SourceReferral là user_vouchers.source của voucher thưởng giới thiệu.
+const SourceReferral = "referral"
+
+// ErrInvalidCode: mã giới thiệu không tồn tại.
+var ErrInvalidCode = errors.New("mã giới thiệu không hợp lệ")
+
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// NewCode sinh mã giới thiệu 8 ký tự, bỏ các ký tự dễ nhầm (O/0, I/1).
+func NewCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// VoucherIDFromEnv đọc REFERRAL_VOUCHER_ID, 0 nếu chưa cấu hình (chưa phát thưởng).
+func VoucherIDFromEnv() int {
+	id, err := strconv.Atoi(os.Getenv("REFERRAL_VOUCHER_ID"))
+	if err != nil || id <= 0 {
+		return 0
+	}
+	return id
+}
+
+// EnsureCode trả về mã giới thiệu của người dùng, cấp mã mới nếu chưa có (vd tài khoản tạo qua OIDC).
+func EnsureCode(ctx context.Context, db *sql.DB, userID int) (string, error) {
+	var code sql.NullString
+	if err := db.QueryRowContext(ctx, "SELECT referral_code FROM users WHERE id = $1", userID).Scan(&code); err != nil {
+		return "", err
+	}
+	if code.Valid {
+		return code.String, nil
+	}
+
+	newCode, err := NewCode()
+	if err != nil {
+		return "", err
+	}
+	err = db.QueryRowContext(ctx, `
+		UPDATE users SET referral_code = COALESCE(referral_code, $2) WHERE id = $1 RETURNING referral_code
+	`, userID, newCode).Scan(&code)
+	return code.String, err
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Lookup trả về id người sở hữu mã giới thiệu.
+func Lookup(ctx context.Context, q querier, code string) (int, error) {
+	var referrerID int
+	err := q.QueryRowContext(ctx, "SELECT id FROM users WHERE referral_code = $1", strings.ToUpper(strings.TrimSpace(code))).Scan(&referrerID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidCode
+	}
+	return referrerID, err
+}
+
+// Link ghi nhận referredID đăng ký bằng mã của referrerID từ thiết bị deviceID, địa chỉ ip. Lượt
+// giới thiệu bị từ chối ngay, không được thưởng, khi thiết bị trùng với thiết bị đăng ký của người
+// giới thiệu hoặc ip là IP người giới thiệu từng đăng ký/đăng nhập (tự giới thiệu), khi thiết bị đã
+// từng đăng ký tài khoản khác, hoặc khi người giới thiệu đã có lượt giới thiệu khác từ cùng IP.
+// Trả về trạng thái của lượt giới thiệu.
+func Link(ctx context.Context, tx *sql.Tx, referrerID, referredID int, deviceID, ip string) (string, error) {
+	status, reason := StatusPending, ""
+
+	var sameDevice, usedDevice, sameIP, usedIP bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT
+			EXISTS (SELECT 1 FROM users WHERE id = $1 AND signup_device_id = $3)
+			OR EXISTS (SELECT 1 FROM referrals WHERE referred_id = $1 AND device_id = $3),
+			EXISTS (SELECT 1 FROM users WHERE signup_device_id = $3 AND id NOT IN ($1, $2))
+			OR EXISTS (SELECT 1 FROM referrals WHERE device_id = $3),
+			$4 <> '' AND (
+				EXISTS (SELECT 1 FROM users WHERE id = $1 AND signup_ip = $4)
+				OR EXISTS (SELECT 1 FROM user_sessions WHERE user_id = $1 AND ip_address = $4)
+			),
+			$4 <> '' AND EXISTS (SELECT 1 FROM referrals WHERE referrer_id = $1 AND ip_address = $4)
+	`, referrerID, referredID, deviceID, ip).Scan(&sameDevice, &usedDevice, &sameIP, &usedIP)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case sameDevice:
+		status, reason = StatusRejected, ReasonSelfReferral
+	case sameIP:
+		status, reason = StatusRejected, ReasonSameIP
+	case usedDevice:
+		status, reason = StatusRejected, ReasonDuplicateDevice
+	case usedIP:
+		status, reason = StatusRejected, ReasonDuplicateIP
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO referrals (referrer_id, referred_id, device_id, ip_address, status, reject_reason)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, NULLIF($6, ''))
+	`, referrerID, referredID, deviceID, ip, status, reason)
+	return status, err
+}
+
+// Reward phát voucher thưởng cho cả hai bên khi đơn orderID (vừa hoàn thành) là đơn hoàn thành
+// đầu tiên đủ điều kiện của người được giới thiệu: người này đã xác thực email và đơn đã được trả
+// trước (không phải COD). Đơn không đủ điều kiện hoặc chưa cấu hình voucher mẫu thì lượt giới
+// thiệu vẫn chờ.
+func Reward(ctx context.Context, tx *sql.Tx, orderID int, now time.Time) error {
+	var userID sql.NullInt64
+	if err := tx.QueryRowContext(ctx, "SELECT user_id FROM orders WHERE id = $1", orderID).Scan(&userID); err != nil {
+		return fmt.Errorf("load order: %w", err)
+	}
+	if !userID.Valid {
+		return nil
+	}
+
+	var referralID, referrerID int
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, referrer_id FROM referrals WHERE referred_id = $1 AND status = $2 FOR UPDATE
+	`, userID.Int64, StatusPending).Scan(&referralID, &referrerID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var emailVerified bool
+	var method, paymentStatus string
+	err = tx.QueryRowContext(ctx, `
+		SELECT u.email_verified_at IS NOT NULL, o.payment_method, o.payment_status
+		FROM orders o JOIN users u ON u.id = o.user_id
+		WHERE o.id = $1
+	`, orderID).Scan(&emailVerified, &method, &paymentStatus)
+	if err != nil {
+		return fmt.Errorf("load referred order: %w", err)
+	}
+	if !emailVerified || method == methodCOD || paymentStatus != paymentPaid {
+		return nil
+	}
+
+	voucherID := VoucherIDFromEnv()
+	if voucherID == 0 {
+		log.Printf("WARNING referral %d: REFERRAL_VOUCHER_ID is not configured, reward postponed", referralID)
+		return nil
+	}
+	var validDays int
+	err = tx.QueryRowContext(ctx, "SELECT valid_duration_days FROM vouchers WHERE id = $1", voucherID).Scan(&validDays)
+	if err == sql.ErrNoRows {
+		log.Printf("WARNING referral %d: REFERRAL_VOUCHER_ID=%d is not a voucher, reward postponed", referralID, voucherID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	expiresAt := now.AddDate(0, 0, validDays)
+
+	grant := func(uid int) (int, error) {
+		var id int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO user_vouchers (user_id, voucher_id, expires_at, source) VALUES ($1, $2, $3, $4) RETURNING id
+		`, uid, voucherID, expiresAt, SourceReferral).Scan(&id)
+		return id, err
+	}
+	referrerVoucher, err := grant(referrerID)
+	if err != nil {
+		return fmt.Errorf("grant referrer voucher: %w", err)
+	}
+	referredVoucher, err := grant(int(userID.Int64))
+	if err != nil {
+		return fmt.Errorf("grant referred voucher: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE referrals
+		SET status = $2, order_id = $3, rewarded_at = $4, referrer_user_voucher_id = $5, referred_user_voucher_id = $6
+		WHERE id = $1
+	`, referralID, StatusRewarded, orderID, now, referrerVoucher, referredVoucher)
+	return err
+}
+
+// Revoke thu hồi thưởng của lượt giới thiệu đã được thưởng bằng đơn orderID khi đơn bị hoàn tiền
+// hoặc hủy: voucher thưởng chưa dùng của cả hai bên hết hạn ngay, lượt giới thiệu chuyển sang revoked.
+func Revoke(ctx context.Context, tx *sql.Tx, orderID int, now time.Time) error {
+	var referralID int
+	var referrerVoucher, referredVoucher sql.NullInt64
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, referrer_user_voucher_id, referred_user_voucher_id
+		FROM referrals WHERE order_id = $1 AND status = $2 FOR UPDATE
+	`, orderID, StatusRewarded).Scan(&referralID, &referrerVoucher, &referredVoucher)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_vouchers SET expires_at = LEAST(expires_at, $3)
+		WHERE id IN ($1, $2) AND NOT is_used
+	`, referrerVoucher, referredVoucher, now)
+	if err != nil {
+		return fmt.Errorf("revoke referral vouchers: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE referrals SET status = $2, revoked_at = $3 WHERE id = $1", referralID, StatusRevoked, now)
+	return err
+}
+
+// Summary thống kê lượt giới thiệu, của một người giới thiệu nếu referrerID khác nil.
+func Summary(ctx context.Context, q querier, referrerID *int) (models.ReferralSummary, error) {
+	var s models.ReferralSummary
+	err := q.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE status = $2),
+		       COUNT(*) FILTER (WHERE status = $3),
+		       COUNT(*) FILTER (WHERE status = $4),
+		       COUNT(*) FILTER (WHERE status = $5)
+		FROM referrals
+		WHERE $1::int IS NULL OR referrer_id = $1
+	`, referrerID, StatusPending, StatusRewarded, StatusRejected, StatusRevoked).Scan(&s.Total, &s.Pending, &s.Rewarded, &s.Rejected, &s.Revoked)
+	if err != nil {
+		return s, err
+	}
+	if eligible := s.Total - s.Rejected; eligible > 0 {
+		s.ConversionRate = float64(s.Rewarded) * 100 / float64(eligible)
+	}
+	return s, nil
+}
@@ -0,0 +1,125 @@
+package referral
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+)
+
+var testNow = time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+func begin(t *testing.T, db *sql.DB) *sql.Tx {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+func TestLinkRejectsReferrerIP(t *testing.T) {
+	fake, db := dbtest.New()
+	// Thiết bị mới nhưng IP trùng IP đăng nhập của người giới thiệu
+	fake.On("FROM user_sessions", dbtest.Rows([]driver.Value{false, false, true, false}))
+
+	status, err := Link(context.Background(), begin(t, db), 3, 8, "device-new", "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != StatusRejected {
+		t.Fatalf("status = %q, muốn rejected", status)
+	}
+	ins := fake.Calls("INSERT INTO referrals")
+	if len(ins) != 1 || ins[0].Args[3] != "203.0.113.7" || ins[0].Args[5] != ReasonSameIP {
+		t.Errorf("referral lưu = %+v, muốn lý do %s", ins, ReasonSameIP)
+	}
+}
+
+func TestLinkRejectsRepeatedIP(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("FROM user_sessions", dbtest.Rows([]driver.Value{false, false, false, true}))
+
+	status, err := Link(context.Background(), begin(t, db), 3, 8, "device-new", "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ins := fake.Calls("INSERT INTO referrals"); status != StatusRejected || ins[0].Args[5] != ReasonDuplicateIP {
+		t.Errorf("status = %q, referral lưu = %+v, muốn lý do %s", status, ins, ReasonDuplicateIP)
+	}
+}
+
+// rewardFixture là lượt giới thiệu đang chờ của người dùng 8 (được giới thiệu bởi 3) với đơn 12.
+func rewardFixture(t *testing.T, emailVerified bool, method, paymentStatus string) *dbtest.DB {
+	t.Setenv("REFERRAL_VOUCHER_ID", "5")
+	fake, db := dbtest.New()
+	fake.On("SELECT user_id FROM orders", dbtest.Rows([]driver.Value{int64(8)}))
+	fake.On("SELECT id, referrer_id FROM referrals", dbtest.Rows([]driver.Value{int64(21), int64(3)}))
+	fake.On("email_verified_at IS NOT NULL", dbtest.Rows([]driver.Value{emailVerified, method, paymentStatus}))
+	fake.On("SELECT valid_duration_days FROM vouchers", dbtest.Rows([]driver.Value{int64(30)}))
+	fake.On("INSERT INTO user_vouchers", dbtest.Rows([]driver.Value{int64(40)}))
+	if err := Reward(context.Background(), begin(t, db), 12, testNow); err != nil {
+		t.Fatal(err)
+	}
+	return fake
+}
+
+func TestRewardPrepaidOrder(t *testing.T) {
+	fake := rewardFixture(t, true, "momo", paymentPaid)
+	if n := len(fake.Calls("INSERT INTO user_vouchers")); n != 2 {
+		t.Errorf("phát %d voucher, muốn 2", n)
+	}
+	if upd := fake.Calls("UPDATE referrals"); len(upd) != 1 || upd[0].Args[1] != StatusRewarded {
+		t.Errorf("referral cập nhật = %+v, muốn rewarded", upd)
+	}
+}
+
+func TestRewardWaitsForEligibleOrder(t *testing.T) {
+	cases := map[string]struct {
+		verified      bool
+		method        string
+		paymentStatus string
+	}{
+		"email chưa xác thực": {false, "momo", paymentPaid},
+		"đơn COD":             {true, methodCOD, paymentPaid},
+		"chưa thanh toán":     {true, "bank_transfer", "unpaid"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			fake := rewardFixture(t, c.verified, c.method, c.paymentStatus)
+			if len(fake.Calls("INSERT INTO user_vouchers")) != 0 || len(fake.Calls("UPDATE referrals")) != 0 {
+				t.Error("đơn không đủ điều kiện thì lượt giới thiệu phải vẫn chờ")
+			}
+		})
+	}
+}
+
+func TestRevokeExpiresUnusedVouchers(t *testing.T) {
+	fake, db := dbtest.New()
+	fake.On("SELECT id, referrer_user_voucher_id, referred_user_voucher_id", dbtest.Rows([]driver.Value{int64(21), int64(40), int64(41)}))
+
+	if err := Revoke(context.Background(), begin(t, db), 12, testNow); err != nil {
+		t.Fatal(err)
+	}
+	exp := fake.Calls("UPDATE user_vouchers SET expires_at")
+	if len(exp) != 1 || exp[0].Args[0] != int64(40) || exp[0].Args[1] != int64(41) || exp[0].Args[2] != testNow {
+		t.Errorf("thu hồi voucher = %+v, muốn voucher 40, 41 hết hạn lúc %v", exp, testNow)
+	}
+	if upd := fake.Calls("UPDATE referrals SET status"); len(upd) != 1 || upd[0].Args[1] != StatusRevoked {
+		t.Errorf("referral cập nhật = %+v, muốn revoked", upd)
+	}
+}
+
+func TestRevokeWithoutRewardIsNoop(t *testing.T) {
+	fake, db := dbtest.New()
+	if err := Revoke(context.Background(), begin(t, db), 12, testNow); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Calls("UPDATE user_vouchers")) != 0 || len(fake.Calls("UPDATE referrals")) != 0 {
+		t.Error("đơn không gắn lượt giới thiệu đã thưởng thì không cập nhật gì")
+	}
+}
@@ -0,0 +1,610 @@
+// Package refund hoàn tiền toàn phần hoặc theo từng món cho đơn hàng: tính số tiền được hoàn,
+// trả phần khách đã trả bằng ví về ví, gọi API hoàn tiền của cổng thanh toán đã thu phần còn lại
+// và ghi lại vào refunds / refund_items.
+package refund
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/internal/loyalty"
+	"backend/internal/models"
+	"backend/internal/orderstatus"
+	"backend/internal/payment"
+	"backend/internal/wallet"
+)
+
+// Trạng thái của một lần hoàn tiền.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// ProviderManual là hoàn tiền cửa hàng tự thực hiện (tiền mặt, chuyển khoản) và chỉ ghi nhận.
+const ProviderManual = "manual"
+
+// ProviderWallet là hoàn phần tiền khách đã trả bằng ví, tiền được cộng lại vào ví ngay.
+const ProviderWallet = "wallet"
+
+var ErrOrderNotFound = orderstatus.ErrOrderNotFound
+
+// Error là lỗi do yêu cầu hoàn tiền không hợp lệ, thông báo hiển thị được cho admin.
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func invalid(format string, args ...interface{}) error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}
+
+type Service struct {
+	db        *sql.DB
+	now       func() time.Time
+	providers map[string]payment.Provider
+}
+
+// NewService tạo Service; providers là các cổng có thể gọi API hoàn tiền, key là tên cổng.
+func NewService(db *sql.DB, now func() time.Time, providers map[string]payment.Provider) *Service {
+	return &Service{db: db, now: now, providers: providers}
+}
+
+// capture là giao dịch đã thu tiền của đơn.
+type capture struct {
+	provider        string
+	externalOrderID string
+	transactionID   string
+	amount          int64
+}
+
+type orderLine struct {
+	id       int
+	name     string
+	quantity int
+	price    int64
+	discount int64
+	refunded int
+}
+
+// Create hoàn tiền cho đơn orderID. Yêu cầu không có Items là hoàn toàn bộ số tiền còn lại.
+// Khi đã hoàn hết số tiền khách trả, đơn được chuyển sang refunded (nếu chưa hủy/hoàn).
+func (s *Service) Create(ctx context.Context, orderID int, req models.CreateRefundRequest, actor orderstatus.Actor) (*models.Refund, error) {
+	refund, cap, paid, err := s.reserve(ctx, orderID, req, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	s.execute(ctx, refund, cap)
+	if err := s.save(ctx, refund); err != nil {
+		return refund, err
+	}
+
+	if refund.Status == StatusSucceeded {
+		if err := s.markRefunded(ctx, orderID, paid, actor); err != nil {
+			return refund, err
+		}
+	}
+	return refund, nil
+}
+
+// RefundRemaining hoàn phần tiền còn lại của đơn đã thanh toán qua cổng trực tuyến, dùng khi
+// admin hủy/hoàn đơn. Trả về nil nếu đơn không thanh toán trực tuyến hoặc đã hoàn hết.
+func (s *Service) RefundRemaining(ctx context.Context, orderID int, reason string, actor orderstatus.Actor) (*models.Refund, error) {
+	remaining, err := s.HasRemaining(ctx, orderID)
+	if err != nil || !remaining {
+		return nil, err
+	}
+	return s.Create(ctx, orderID, models.CreateRefundRequest{Reason: reason}, actor)
+}
+
+// HasRemaining cho biết đơn còn tiền thu qua cổng trực tuyến chưa hoàn, tức RefundRemaining sẽ
+// hoàn tiền thật qua cổng.
+func (s *Service) HasRemaining(ctx context.Context, orderID int) (bool, error) {
+	cap, err := s.loadCapture(ctx, s.db, orderID)
+	if err != nil || cap == nil || s.providers[cap.provider] == nil {
+		return false, err
+	}
+	// Phần trả bằng ví đã được trả lại khi đơn chuyển sang cancelled/refunded
+	refunded, err := cashRefunded(ctx, s.db, orderID)
+	if err != nil {
+		return false, err
+	}
+	return refunded < cap.amount, nil
+}
+
+// reserve kiểm tra yêu cầu và ghi refund ở trạng thái pending trong một transaction khóa đơn
+// hàng, để hai yêu cầu đồng thời không hoàn quá số tiền đã thu. Phần tiền khách trả bằng ví được
+// hoàn trước, vào ví, thành một refund riêng (provider wallet) đã thành công ngay; refund trả về
+// là phần còn lại phải hoàn qua cổng/thủ công, hoặc refund vào ví nếu không còn phần nào khác.
+func (s *Service) reserve(ctx context.Context, orderID int, req models.CreateRefundRequest, actor orderstatus.Actor) (*models.Refund, *capture, int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var paymentStatus string
+	var totalAmount, walletAmount int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT payment_status, total_amount, wallet_amount FROM orders WHERE id = $1 FOR UPDATE
+	`, orderID).Scan(&paymentStatus, &totalAmount, &walletAmount)
+	if err == sql.ErrNoRows {
+		return nil, nil, 0, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	cap, err := s.loadCapture(ctx, tx, orderID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	provider := ProviderManual
+	paid := totalAmount
+	if cap != nil {
+		paid = cap.amount
+		if s.providers[cap.provider] != nil {
+			provider = cap.provider
+		}
+	} else if paymentStatus == payment.PaymentUnpaid {
+		// Chưa ghi nhận thanh toán (COD chưa thu tiền, chuyển khoản chưa xác nhận) thì khách chỉ mới
+		// trả phần bằng ví. Đơn admin đã xác nhận thanh toán (vd chuyển khoản) được hoàn thủ công.
+		if walletAmount == 0 {
+			return nil, nil, 0, invalid("Đơn hàng chưa được thanh toán")
+		}
+		paid = 0
+	}
+	// total_amount không gồm phần trả bằng ví
+	paid += walletAmount
+
+	refunded, err := refundedAmount(ctx, tx, orderID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	remaining := paid - refunded
+	if remaining <= 0 {
+		return nil, nil, 0, invalid("Đơn hàng đã được hoàn hết tiền")
+	}
+
+	lines, err := loadLines(ctx, tx, orderID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	items, amount, err := refundItems(lines, req.Items, totalAmount+walletAmount)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if len(req.Items) == 0 || amount > remaining {
+		amount = remaining
+	}
+
+	walletPart, err := wallet.Returnable(ctx, tx, orderID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	walletPart = max(min(walletPart, amount), 0)
+
+	var refund *models.Refund
+	if walletPart > 0 {
+		refund = &models.Refund{
+			OrderID:          orderID,
+			ExternalRefundID: fmt.Sprintf("RFW%d_%d", orderID, s.now().UnixNano()),
+			Provider:         ProviderWallet,
+			Amount:           walletPart,
+			Status:           StatusSucceeded,
+			Reason:           req.Reason,
+			Message:          "Hoàn vào ví",
+			CreatedBy:        actor.UserID,
+			Items:            []models.RefundItem{},
+		}
+		if err := insertRefund(ctx, tx, refund); err != nil {
+			return nil, nil, 0, err
+		}
+		_, err := wallet.Return(ctx, tx, orderID, walletPart, &refund.ID, actor.UserID, fmt.Sprintf("Hoàn tiền đơn hàng #%d", orderID))
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("return wallet payment: %w", err)
+		}
+	}
+	if amount > walletPart {
+		walletRefund := refund
+		refund = &models.Refund{
+			OrderID: orderID,
+			// Mã gửi cho cổng thanh toán phải duy nhất (MoMo dùng làm orderId của giao dịch hoàn)
+			ExternalRefundID: fmt.Sprintf("RF%d_%d", orderID, s.now().UnixNano()),
+			Provider:         provider,
+			Amount:           amount - walletPart,
+			Status:           StatusPending,
+			Reason:           req.Reason,
+			CreatedBy:        actor.UserID,
+			WalletRefund:     walletRefund,
+		}
+		if err := insertRefund(ctx, tx, refund); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	// Các món được gắn vào refund trả về (phần hoàn qua cổng nếu có)
+	refund.Items = items
+	for _, item := range items {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO refund_items (refund_id, order_item_id, quantity, amount) VALUES ($1, $2, $3, $4)
+		`, refund.ID, item.OrderItemID, item.Quantity, item.Amount)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	return refund, cap, paid, tx.Commit()
+}
+
+func insertRefund(ctx context.Context, tx *sql.Tx, refund *models.Refund) error {
+	return tx.QueryRowContext(ctx, `
+		INSERT INTO refunds (order_id, provider, external_refund_id, amount, status, reason, message, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8)
+		RETURNING id, created_at
+	`, refund.OrderID, refund.Provider, refund.ExternalRefundID, refund.Amount, refund.Status, refund.Reason,
+		refund.Message, refund.CreatedBy).Scan(&refund.ID, &refund.CreatedAt)
+}
+
+// refundItems tính số tiền hoàn cho các món được yêu cầu. Nếu giảm giá đã được phân bổ vào từng
+// món (order_items.discount_amount) thì hoàn theo giá sau giảm của món; đơn cũ không có phân bổ
+// thì giảm giá của đơn được chia theo tỷ lệ giá trị món. Cả hai cách đều cho tổng hoàn của mọi
+// món bằng đúng số tiền khách trả. Yêu cầu rỗng nghĩa là toàn bộ các món chưa hoàn.
+func refundItems(lines []orderLine, requested []models.RefundItemRequest, totalAmount int64) ([]models.RefundItem, int64, error) {
+	var subtotal, net int64
+	byID := map[int]*orderLine{}
+	for i := range lines {
+		subtotal += lines[i].price * int64(lines[i].quantity)
+		net += lines[i].price*int64(lines[i].quantity) - lines[i].discount
+		byID[lines[i].id] = &lines[i]
+	}
+	perLine := net == totalAmount
+	if len(requested) == 0 {
+		for _, l := range lines {
+			if left := l.quantity - l.refunded; left > 0 {
+				requested = append(requested, models.RefundItemRequest{OrderItemID: l.id, Quantity: left})
+			}
+		}
+	}
+
+	items := []models.RefundItem{}
+	var amount int64
+	seen := map[int]bool{}
+	for _, r := range requested {
+		line, ok := byID[r.OrderItemID]
+		if !ok || seen[r.OrderItemID] {
+			return nil, 0, invalid("Món #%d không thuộc đơn hàng hoặc bị lặp", r.OrderItemID)
+		}
+		seen[r.OrderItemID] = true
+		if r.Quantity <= 0 || r.Quantity > line.quantity-line.refunded {
+			return nil, 0, invalid("Số lượng hoàn của %q không hợp lệ (còn %d)", line.name, line.quantity-line.refunded)
+		}
+		lineAmount := line.price * int64(r.Quantity)
+		if perLine {
+			lineAmount -= line.discount * int64(r.Quantity) / int64(line.quantity)
+		} else if subtotal > 0 {
+			lineAmount = lineAmount * totalAmount / subtotal
+		}
+		amount += lineAmount
+		items = append(items, models.RefundItem{
+			OrderItemID: line.id,
+			ProductName: line.name,
+			Quantity:    r.Quantity,
+			Amount:      lineAmount,
+		})
+	}
+	return items, amount, nil
+}
+
+// execute gọi API hoàn tiền của cổng; hoàn thủ công được ghi nhận thành công ngay, hoàn vào ví đã
+// xong trong reserve.
+func (s *Service) execute(ctx context.Context, refund *models.Refund, cap *capture) {
+	if refund.Provider == ProviderWallet {
+		return
+	}
+	provider := s.providers[refund.Provider]
+	if provider == nil || cap == nil {
+		refund.Status = StatusSucceeded
+		refund.Message = "Hoàn tiền thủ công"
+		return
+	}
+
+	res, err := provider.Refund(ctx, payment.RefundRequest{
+		RefundID:        refund.ExternalRefundID,
+		ExternalOrderID: cap.externalOrderID,
+		TransactionID:   cap.transactionID,
+		Amount:          refund.Amount,
+		TotalAmount:     cap.amount,
+		Description:     fmt.Sprintf("Hoan tien don hang %d", refund.OrderID),
+	})
+	if err != nil {
+		refund.Status = StatusFailed
+		refund.Message = err.Error()
+		return
+	}
+	refund.ProviderRefundID = res.TransactionID
+	refund.Message = res.Message
+	refund.Status = refundStatus(res.Status)
+}
+
+// refundStatus chuyển trạng thái cổng trả về thành trạng thái của refund.
+func refundStatus(providerStatus string) string {
+	switch providerStatus {
+	case payment.StatusRefunded:
+		return StatusSucceeded
+	case payment.StatusPending:
+		return StatusPending
+	default:
+		return StatusFailed
+	}
+}
+
+// ReconcilePending tra cứu lại các lần hoàn tiền cổng báo đang xử lý (tạo trước before, để không
+// tranh với Create đang gọi cổng) và cập nhật kết quả; hoàn thành công thì cập nhật đơn như Create.
+// Trả về số lần hoàn tiền đã có kết quả.
+func (s *Service) ReconcilePending(ctx context.Context, before time.Time) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.id, r.order_id, r.provider, r.external_refund_id, COALESCE(r.provider_refund_id, ''), r.amount, o.wallet_amount
+		FROM refunds r
+		JOIN orders o ON o.id = r.order_id
+		WHERE r.status = $1 AND r.created_at <= $2
+		ORDER BY r.id
+	`, StatusPending, before)
+	if err != nil {
+		return 0, err
+	}
+	type pendingRefund struct {
+		refund       models.Refund
+		walletAmount int64
+	}
+	var pending []pendingRefund
+	for rows.Next() {
+		var p pendingRefund
+		if err := rows.Scan(&p.refund.ID, &p.refund.OrderID, &p.refund.Provider, &p.refund.ExternalRefundID,
+			&p.refund.ProviderRefundID, &p.refund.Amount, &p.walletAmount); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	for _, p := range pending {
+		refund := p.refund
+		querier, ok := s.providers[refund.Provider].(payment.RefundQuerier)
+		if !ok {
+			continue
+		}
+		cap, err := s.loadCapture(ctx, s.db, refund.OrderID)
+		if err != nil {
+			return settled, err
+		}
+		if cap == nil {
+			continue
+		}
+
+		res, err := querier.QueryRefund(ctx, payment.RefundRequest{
+			RefundID:        refund.ExternalRefundID,
+			ExternalOrderID: cap.externalOrderID,
+			TransactionID:   cap.transactionID,
+			Amount:          refund.Amount,
+			TotalAmount:     cap.amount,
+		})
+		if err != nil {
+			log.Printf("ERROR querying %s refund %s: %v", refund.Provider, refund.ExternalRefundID, err)
+			continue
+		}
+		if refund.Status = refundStatus(res.Status); refund.Status == StatusPending {
+			continue
+		}
+		if res.TransactionID != "" {
+			refund.ProviderRefundID = res.TransactionID
+		}
+		refund.Message = res.Message
+		if err := s.save(ctx, &refund); err != nil {
+			return settled, err
+		}
+		settled++
+		if refund.Status == StatusSucceeded {
+			if err := s.markRefunded(ctx, refund.OrderID, cap.amount+p.walletAmount, orderstatus.System); err != nil {
+				return settled, err
+			}
+		}
+	}
+	return settled, nil
+}
+
+func (s *Service) save(ctx context.Context, refund *models.Refund) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE refunds SET status = $1, provider_refund_id = NULLIF($2, ''), message = $3, updated_at = NOW()
+		WHERE id = $4
+	`, refund.Status, refund.ProviderRefundID, refund.Message, refund.ID)
+	return err
+}
+
+// markRefunded cập nhật payment_status theo tổng tiền đã hoàn và chuyển đơn sang refunded khi
+// đã hoàn bằng số tiền khách trả.
+func (s *Service) markRefunded(ctx context.Context, orderID int, paid int64, actor orderstatus.Actor) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var refunded int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE((SELECT SUM(amount) FROM refunds WHERE order_id = $1 AND status = $2 AND provider <> $3), 0)
+		       + wallet_refunded
+		FROM orders WHERE id = $1
+	`, orderID, StatusSucceeded, ProviderWallet).Scan(&refunded)
+	if err != nil {
+		return err
+	}
+
+	if refunded < paid {
+		if err := payment.SetOrderPaymentStatus(ctx, tx, orderID, payment.PaymentPartiallyRefunded); err != nil {
+			return err
+		}
+		// Thu hồi điểm thưởng theo tỷ lệ số tiền đã hoàn
+		if err := loyalty.Clawback(ctx, tx, orderID, refunded, paid, s.now()); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	if err := payment.SetOrderPaymentStatus(ctx, tx, orderID, payment.PaymentRefunded); err != nil {
+		return err
+	}
+
+	_, err = orderstatus.Transition(ctx, tx, orderID, orderstatus.Refunded, actor, "Đã hoàn toàn bộ tiền", s.now())
+	var te *orderstatus.TransitionError
+	if errors.As(err, &te) {
+		// Đơn đã hủy/hoàn trước đó
+		return tx.Commit()
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// loadCapture trả về giao dịch thanh toán thành công gần nhất của đơn, nil nếu không có. Giao
+// dịch tới sau khi đơn đã hủy cũng là tiền đã thu và phải hoàn được.
+func (s *Service) loadCapture(ctx context.Context, q querier, orderID int) (*capture, error) {
+	var c capture
+	var transactionID sql.NullString
+	err := q.QueryRowContext(ctx, `
+		SELECT provider, external_order_id, provider_transaction_id, amount
+		FROM payment_transactions
+		WHERE order_id = $1 AND outcome IN ($2, $3)
+		ORDER BY id DESC LIMIT 1
+	`, orderID, payment.OutcomeApplied, payment.OutcomePaidAfterCancel).Scan(&c.provider, &c.externalOrderID, &transactionID, &c.amount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.transactionID = transactionID.String
+	return &c, nil
+}
+
+// refundedAmount là tổng tiền đã hoàn hoặc đang hoàn của đơn, gồm phần tiền ví đã trả lại (qua
+// refund hoặc khi hủy đơn).
+func refundedAmount(ctx context.Context, q querier, orderID int) (int64, error) {
+	cash, err := cashRefunded(ctx, q, orderID)
+	if err != nil {
+		return 0, err
+	}
+	var walletRefunded int64
+	err = q.QueryRowContext(ctx, "SELECT wallet_refunded FROM orders WHERE id = $1", orderID).Scan(&walletRefunded)
+	return cash + walletRefunded, err
+}
+
+// cashRefunded là tổng tiền đã hoàn hoặc đang hoàn qua cổng/thủ công (không tính hoàn vào ví).
+func cashRefunded(ctx context.Context, q querier, orderID int) (int64, error) {
+	var refunded int64
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE order_id = $1 AND status <> $2 AND provider <> $3
+	`, orderID, StatusFailed, ProviderWallet).Scan(&refunded)
+	return refunded, err
+}
+
+func loadLines(ctx context.Context, q querier, orderID int) ([]orderLine, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT oi.id, p.name, oi.quantity, oi.price_at_purchase, oi.discount_amount,
+		       COALESCE((SELECT SUM(ri.quantity) FROM refund_items ri
+		                 JOIN refunds r ON r.id = ri.refund_id
+		                 WHERE ri.order_item_id = oi.id AND r.status <> $2), 0)
+		FROM order_items oi
+		JOIN products p ON p.id = oi.product_id
+		WHERE oi.order_id = $1
+		ORDER BY oi.id
+	`, orderID, StatusFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []orderLine
+	for rows.Next() {
+		var l orderLine
+		if err := rows.Scan(&l.id, &l.name, &l.quantity, &l.price, &l.discount, &l.refunded); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
+
+// List trả về các lần hoàn tiền của đơn, mới nhất trước.
+func (s *Service) List(ctx context.Context, orderID int) ([]models.Refund, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, order_id, provider, external_refund_id, COALESCE(provider_refund_id, ''), amount, status,
+		       COALESCE(reason, ''), COALESCE(message, ''), created_by, created_at
+		FROM refunds WHERE order_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refunds := []models.Refund{}
+	index := map[int64]int{}
+	for rows.Next() {
+		var r models.Refund
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&r.ID, &r.OrderID, &r.Provider, &r.ExternalRefundID, &r.ProviderRefundID, &r.Amount, &r.Status,
+			&r.Reason, &r.Message, &createdBy, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if createdBy.Valid {
+			id := int(createdBy.Int64)
+			r.CreatedBy = &id
+		}
+		r.Items = []models.RefundItem{}
+		index[r.ID] = len(refunds)
+		refunds = append(refunds, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	itemRows, err := s.db.QueryContext(ctx, `
+		SELECT ri.refund_id, ri.order_item_id, p.name, ri.quantity, ri.amount
+		FROM refund_items ri
+		JOIN refunds r ON r.id = ri.refund_id
+		JOIN order_items oi ON oi.id = ri.order_item_id
+		JOIN products p ON p.id = oi.product_id
+		WHERE r.order_id = $1
+		ORDER BY ri.id
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var refundID int64
+		var item models.RefundItem
+		if err := itemRows.Scan(&refundID, &item.OrderItemID, &item.ProductName, &item.Quantity, &item.Amount); err != nil {
+			return nil, err
+		}
+		if i, ok := index[refundID]; ok {
+			refunds[i].Items = append(refunds[i].Items, item)
+		}
+	}
+	return refunds, itemRows.Err()
+}
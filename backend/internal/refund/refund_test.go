@@ -0,0 +1,139 @@
+package refund
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"backend/internal/dbtest"
+	"backend/internal/models"
+	"backend/internal/orderstatus"
+	"backend/internal/payment"
+)
+
+var testNow = time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+// orderFixture là đơn 150.000đ không trả bằng ví, chưa hoàn lần nào.
+func orderFixture(paymentStatus string) (*dbtest.DB, *Service) {
+	fake, db := dbtest.New()
+	fake.On("SELECT payment_status, total_amount, wallet_amount FROM orders", dbtest.Rows([]driver.Value{paymentStatus, int64(150000), int64(0)}))
+	fake.On("SELECT COALESCE(SUM(amount), 0) FROM refunds", dbtest.Rows([]driver.Value{int64(0)}))
+	fake.On("SELECT wallet_refunded FROM orders", dbtest.Rows([]driver.Value{int64(0)}))
+	fake.On("SELECT wallet_amount - wallet_refunded FROM orders", dbtest.Rows([]driver.Value{int64(0)}))
+	fake.On("INSERT INTO refunds", dbtest.Rows([]driver.Value{int64(9), testNow}))
+	fake.On("+ wallet_refunded", dbtest.Rows([]driver.Value{int64(150000)}))
+	fake.On("SELECT status FROM orders", dbtest.Rows([]driver.Value{"paid"}))
+	return fake, NewService(db, func() time.Time { return testNow }, map[string]payment.Provider{})
+}
+
+func TestCreateUsesPaymentStatusWithoutCapture(t *testing.T) {
+	// Đơn chuyển khoản admin đã xác nhận thanh toán: không có giao dịch cổng nhưng đã thu tiền
+	fake, s := orderFixture(payment.PaymentPaid)
+	refund, err := s.Create(context.Background(), 12, models.CreateRefundRequest{Reason: "Hết hàng"}, orderstatus.System)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.Provider != ProviderManual || refund.Amount != 150000 || refund.Status != StatusSucceeded {
+		t.Errorf("refund = %+v, muốn hoàn thủ công 150000 thành công", refund)
+	}
+	if want := fmt.Sprintf("RF12_%d", testNow.UnixNano()); refund.ExternalRefundID != want {
+		t.Errorf("ExternalRefundID = %q, muốn %q (theo đồng hồ của service)", refund.ExternalRefundID, want)
+	}
+	if st := fake.Calls("UPDATE orders SET payment_status"); len(st) != 1 || st[0].Args[0] != payment.PaymentRefunded {
+		t.Errorf("payment_status = %+v, muốn refunded", st)
+	}
+}
+
+func TestCreateRejectsUnpaidOrder(t *testing.T) {
+	fake, s := orderFixture(payment.PaymentUnpaid)
+	_, err := s.Create(context.Background(), 12, models.CreateRefundRequest{}, orderstatus.System)
+	var e *Error
+	if !errors.As(err, &e) || e.Message != "Đơn hàng chưa được thanh toán" {
+		t.Fatalf("err = %v, muốn đơn chưa thanh toán", err)
+	}
+	if len(fake.Calls("INSERT INTO refunds")) != 0 {
+		t.Error("không được ghi refund")
+	}
+}
+
+// refundQuerier là cổng giả trả kết quả tra cứu hoàn tiền cố định.
+type refundQuerier struct {
+	payment.Provider
+	result  payment.RefundResult
+	queried []payment.RefundRequest
+}
+
+func (q *refundQuerier) Name() string { return "momo" }
+
+func (q *refundQuerier) QueryRefund(_ context.Context, req payment.RefundRequest) (*payment.RefundResult, error) {
+	q.queried = append(q.queried, req)
+	res := q.result
+	return &res, nil
+}
+
+func pendingRefundFixture(result payment.RefundResult) (*dbtest.DB, *Service, *refundQuerier) {
+	fake, db := dbtest.New()
+	fake.On("FROM refunds r", dbtest.Rows([]driver.Value{int64(9), int64(12), "momo", "RF12_1", "", int64(50000), int64(0)}))
+	fake.On("FROM payment_transactions", dbtest.Rows([]driver.Value{"momo", "BISTROBLISS_12_1", "4088", int64(150000)}))
+	fake.On("+ wallet_refunded", dbtest.Rows([]driver.Value{int64(50000)}))
+	querier := &refundQuerier{result: result}
+	s := NewService(db, func() time.Time { return testNow }, map[string]payment.Provider{"momo": querier})
+	return fake, s, querier
+}
+
+func TestReconcilePendingSettlesRefund(t *testing.T) {
+	fake, s, querier := pendingRefundFixture(payment.RefundResult{TransactionID: "5001", Status: payment.StatusRefunded, Message: "Thành công"})
+
+	before := testNow.Add(-10 * time.Minute)
+	settled, err := s.ReconcilePending(context.Background(), before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settled != 1 {
+		t.Fatalf("settled = %d, muốn 1", settled)
+	}
+	if q := fake.Calls("FROM refunds r"); len(q) != 1 || q[0].Args[0] != StatusPending || q[0].Args[1] != before {
+		t.Errorf("chỉ tra cứu refund pending tạo trước %v, có %+v", before, q)
+	}
+	want := payment.RefundRequest{RefundID: "RF12_1", ExternalOrderID: "BISTROBLISS_12_1", TransactionID: "4088", Amount: 50000, TotalAmount: 150000}
+	if len(querier.queried) != 1 || querier.queried[0] != want {
+		t.Errorf("QueryRefund = %+v, muốn %+v", querier.queried, want)
+	}
+	saved := fake.Calls("UPDATE refunds SET status")
+	if len(saved) != 1 || saved[0].Args[0] != StatusSucceeded || saved[0].Args[1] != "5001" {
+		t.Errorf("refund lưu = %+v, muốn succeeded 5001", saved)
+	}
+	// Hoàn một phần 50.000/150.000
+	if st := fake.Calls("UPDATE orders SET payment_status"); len(st) != 1 || st[0].Args[0] != payment.PaymentPartiallyRefunded {
+		t.Errorf("payment_status = %+v, muốn partially_refunded", st)
+	}
+}
+
+func TestReconcilePendingKeepsProcessingRefund(t *testing.T) {
+	fake, s, _ := pendingRefundFixture(payment.RefundResult{Status: payment.StatusPending})
+
+	settled, err := s.ReconcilePending(context.Background(), testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settled != 0 || len(fake.Calls("UPDATE refunds")) != 0 || len(fake.Calls("UPDATE orders")) != 0 {
+		t.Errorf("refund còn đang xử lý thì giữ nguyên, settled = %d", settled)
+	}
+}
+
+func TestReconcilePendingRecordsFailure(t *testing.T) {
+	fake, s, _ := pendingRefundFixture(payment.RefundResult{Status: payment.StatusFailed, Message: "Từ chối"})
+
+	if _, err := s.ReconcilePending(context.Background(), testNow); err != nil {
+		t.Fatal(err)
+	}
+	if saved := fake.Calls("UPDATE refunds SET status"); len(saved) != 1 || saved[0].Args[0] != StatusFailed {
+		t.Errorf("refund lưu = %+v, muốn failed", saved)
+	}
+	if len(fake.Calls("UPDATE orders")) != 0 {
+		t.Error("hoàn thất bại không được cập nhật đơn")
+	}
+}
@@ -0,0 +1,97 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret là khóa "12345678901234567890" của phụ lục B, RFC 6238 (SHA1), mã hóa base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 cho mã 8 chữ số; mã 6 chữ số là 6 chữ số cuối của cùng giá trị rút gọn.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	for _, v := range rfcVectors {
+		at := time.Unix(v.unix, 0).UTC()
+		got, err := Code(rfcSecret, at)
+		if err != nil {
+			t.Fatalf("Code(%d): %v", v.unix, err)
+		}
+		if want := v.code[len(v.code)-Digits:]; got != want {
+			t.Errorf("Code(%d) = %s, muốn %s", v.unix, got, want)
+		}
+		step, ok := Validate(rfcSecret, got, at, 0)
+		if !ok || step != v.unix/Period {
+			t.Errorf("Validate(%d) = %d, %v; muốn %d, true", v.unix, step, ok, v.unix/Period)
+		}
+	}
+}
+
+func TestCodeAcceptsLowercaseAndSpacedSecret(t *testing.T) {
+	spaced := strings.ToLower("GEZD GNBV GY3T QOJQ GEZD GNBV GY3T QOJQ")
+	got, err := Code(spaced, time.Unix(59, 0))
+	if err != nil || got != "287082" {
+		t.Fatalf("Code = %q, %v; muốn 287082", got, err)
+	}
+}
+
+func TestValidateSkewWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0).UTC()
+	current := Step(now)
+
+	cases := []struct {
+		name   string
+		offset int64 // chu kỳ sinh mã so với hiện tại
+		skew   int
+		ok     bool
+	}{
+		{"cùng chu kỳ", 0, 0, true},
+		{"chu kỳ trước, không cho lệch", -1, 0, false},
+		{"chu kỳ trước", -1, 1, true},
+		{"chu kỳ sau", 1, 1, true},
+		{"trễ hai chu kỳ", -2, 1, false},
+		{"sớm hai chu kỳ", 2, 1, false},
+	}
+	for _, c := range cases {
+		code, err := Code(rfcSecret, time.Unix((current+c.offset)*Period, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := Validate(rfcSecret, code, now, c.skew)
+		if ok != c.ok {
+			t.Errorf("%s: ok = %v, muốn %v", c.name, ok, c.ok)
+			continue
+		}
+		// Chu kỳ trả về là chu kỳ của mã, để nơi gọi chặn dùng lại
+		if ok && step != current+c.offset {
+			t.Errorf("%s: step = %d, muốn %d", c.name, step, current+c.offset)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedCode(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "abcdef", "94287082"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("Validate(%q) phải sai", code)
+		}
+	}
+	if _, ok := Validate(rfcSecret, " 287082 ", now, 0); !ok {
+		t.Error("khoảng trắng hai đầu mã phải được bỏ qua")
+	}
+	if _, ok := Validate("not base32!", "287082", now, 0); ok {
+		t.Error("secret sai định dạng phải không hợp lệ")
+	}
+}
@@ -4,18 +4,12 @@ package utils
 import (
 	"fmt"
 	"gopkg.in/gomail.v2"
+	"html"
 	"os"
+	"time"
 )
 
 func SendPasswordResetEmail(toEmail string, resetLink string) error {
-	senderEmail := os.Getenv("SENDER_EMAIL")
-	sendgridAPIKey := os.Getenv("SENDGRID_API_KEY")
-
-	m := gomail.NewMessage()
-	m.SetHeader("From", senderEmail)
-	m.SetHeader("To", toEmail)
-	m.SetHeader("Subject", "Yêu cầu đặt lại mật khẩu cho Thai Duong's Food")
-
 	// Tạo nội dung email bằng HTML
 	emailBody := fmt.Sprintf(`
 		<p>Xin chào,</p>
@@ -23,7 +17,41 @@ func SendPasswordResetEmail(toEmail string, resetLink string) error {
 		<a href="%s">Đặt lại mật khẩu của bạn</a>
 		<p>Nếu bạn không yêu cầu điều này, vui lòng bỏ qua email này.</p>
 	`, resetLink)
-	m.SetBody("text/html", emailBody)
+
+	return sendEmail(toEmail, "Yêu cầu đặt lại mật khẩu cho Thai Duong's Food", emailBody)
+}
+
+func SendVerificationEmail(toEmail string, verifyLink string) error {
+	emailBody := fmt.Sprintf(`
+		<p>Xin chào,</p>
+		<p>Cảm ơn bạn đã đăng ký tài khoản tại Thai Duong's Food. Vui lòng nhấn vào đường link dưới đây để xác thực email:</p>
+		<a href="%s">Xác thực email của bạn</a>
+		<p>Liên kết có hiệu lực trong 24 giờ. Nếu bạn không đăng ký tài khoản, vui lòng bỏ qua email này.</p>
+	`, verifyLink)
+
+	return sendEmail(toEmail, "Xác thực email tài khoản Thai Duong's Food", emailBody)
+}
+
+// SendCampaignEmail báo cho người dùng voucher vừa được tặng trong chiến dịch.
+func SendCampaignEmail(toEmail, subject, message, voucherCode string, expiresAt time.Time) error {
+	emailBody := fmt.Sprintf(`
+		<p>Xin chào,</p>
+		<p>%s</p>
+		<p>Thai Duong's Food tặng bạn voucher <b>%s</b>, đã có sẵn trong ví voucher của bạn và có hiệu lực đến %s.</p>
+	`, html.EscapeString(message), html.EscapeString(voucherCode), expiresAt.Format("02/01/2006"))
+
+	return sendEmail(toEmail, subject, emailBody)
+}
+
+func sendEmail(toEmail, subject, htmlBody string) error {
+	senderEmail := os.Getenv("SENDER_EMAIL")
+	sendgridAPIKey := os.Getenv("SENDGRID_API_KEY")
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", senderEmail)
+	m.SetHeader("To", toEmail)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/html", htmlBody)
 
 	d := gomail.NewDialer("smtp.sendgrid.net", 587, "apikey", sendgridAPIKey)
 
@@ -10,6 +10,17 @@ func RespondWithError(w http.ResponseWriter, code int, message string) {
 	RespondWithJSON(w, code, map[string]string{"error": message})
 }
 
+// APIError là dạng lỗi có cấu trúc; vẫn giữ key "error" để tương thích với RespondWithError.
+type APIError struct {
+	Error   string            `json:"error"`
+	Code    string            `json:"code"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+func RespondWithAPIError(w http.ResponseWriter, status int, code, message string, details map[string]string) {
+	RespondWithJSON(w, status, APIError{Error: message, Code: code, Details: details})
+}
+
 func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, err := json.Marshal(payload)
 	if err != nil {
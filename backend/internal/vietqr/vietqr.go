@@ -0,0 +1,85 @@
+// Package vietqr tạo payload QR chuyển khoản theo chuẩn EMVCo / VietQR (NAPAS) để ứng dụng
+// ngân hàng quét và điền sẵn tài khoản, số tiền và nội dung chuyển khoản.
+package vietqr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// napasGUID là AID của NAPAS trong Merchant Account Information (tag 38).
+	napasGUID = "A000000727"
+	// serviceAccount: chuyển nhanh NAPAS247 tới số tài khoản.
+	serviceAccount = "QRIBFTTA"
+	currencyVND    = "704"
+	countryVN      = "VN"
+)
+
+// Transfer là thông tin một lệnh chuyển khoản được mã hóa vào QR.
+type Transfer struct {
+	// BankBIN là mã BIN 6 số của ngân hàng thụ hưởng (vd 970407 Techcombank).
+	BankBIN       string
+	AccountNumber string
+	Amount        int64
+	// Memo là nội dung chuyển khoản; chỉ nên dùng chữ không dấu và số.
+	Memo string
+}
+
+// Payload trả về chuỗi EMVCo đã kèm CRC16 (tag 63).
+func Payload(t Transfer) (string, error) {
+	if t.BankBIN == "" || t.AccountNumber == "" {
+		return "", fmt.Errorf("vietqr: thiếu BIN ngân hàng hoặc số tài khoản")
+	}
+	if len(t.Memo) > 25 {
+		return "", fmt.Errorf("vietqr: nội dung chuyển khoản %q dài quá 25 ký tự", t.Memo)
+	}
+
+	beneficiary := field("00", t.BankBIN) + field("01", t.AccountNumber)
+	merchant := field("00", napasGUID) + field("01", beneficiary) + field("02", serviceAccount)
+
+	var b strings.Builder
+	b.WriteString(field("00", "01"))
+	if t.Amount > 0 {
+		// 12: QR động, dùng một lần cho số tiền cụ thể
+		b.WriteString(field("01", "12"))
+	} else {
+		b.WriteString(field("01", "11"))
+	}
+	b.WriteString(field("38", merchant))
+	b.WriteString(field("53", currencyVND))
+	if t.Amount > 0 {
+		b.WriteString(field("54", strconv.FormatInt(t.Amount, 10)))
+	}
+	b.WriteString(field("58", countryVN))
+	if t.Memo != "" {
+		b.WriteString(field("62", field("08", t.Memo)))
+	}
+
+	// CRC tính trên toàn bộ payload kể cả "6304"
+	b.WriteString("6304")
+	b.WriteString(fmt.Sprintf("%04X", CRC16(b.String())))
+	return b.String(), nil
+}
+
+// field mã hóa một trường ID + độ dài 2 chữ số + giá trị.
+func field(id, value string) string {
+	return fmt.Sprintf("%s%02d%s", id, len(value), value)
+}
+
+// CRC16 là CRC-16/CCITT-FALSE (đa thức 0x1021, giá trị đầu 0xFFFF) theo EMVCo.
+func CRC16(data string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
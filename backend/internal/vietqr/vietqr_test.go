@@ -0,0 +1,48 @@
+package vietqr
+
+import "testing"
+
+func TestCRC16(t *testing.T) {
+	// Giá trị kiểm tra chuẩn của CRC-16/CCITT-FALSE
+	if got := CRC16("123456789"); got != 0x29B1 {
+		t.Fatalf("CRC16(\"123456789\") = %04X, muốn 29B1", got)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	// Payload mẫu được tạo độc lập (CRC bằng binascii.crc_hqx của Python)
+	cases := []struct {
+		name     string
+		transfer Transfer
+		want     string
+	}{
+		{
+			"QR động có số tiền và nội dung",
+			Transfer{BankBIN: "970407", AccountNumber: "19072027706012", Amount: 150000, Memo: "DH12"},
+			"00020101021238580010A000000727012800069704070114190720277060120208QRIBFTTA530370454061500005802VN62080804DH126304FCAF",
+		},
+		{
+			"QR tĩnh chỉ có tài khoản",
+			Transfer{BankBIN: "970407", AccountNumber: "19072027706012"},
+			"00020101021138580010A000000727012800069704070114190720277060120208QRIBFTTA53037045802VN63046257",
+		},
+	}
+	for _, c := range cases {
+		got, err := Payload(c.transfer)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("%s:\n có  %s\n muốn %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPayloadValidates(t *testing.T) {
+	if _, err := Payload(Transfer{AccountNumber: "19072027706012"}); err == nil {
+		t.Error("thiếu BIN phải báo lỗi")
+	}
+	if _, err := Payload(Transfer{BankBIN: "970407", AccountNumber: "1", Memo: "NOI DUNG QUA DAI HON 25 KY TU"}); err == nil {
+		t.Error("nội dung dài quá 25 ký tự phải báo lỗi")
+	}
+}
@@ -0,0 +1,578 @@
+// Package wallet quản lý ví trả trước và thẻ quà tặng trên sổ kép: mỗi lần tiền di chuyển là một
+// wallet_transactions gồm các wallet_entries có tổng bằng 0, và số dư của tài khoản
+// (wallet_accounts.balance) được cập nhật trong cùng transaction.
+//
+// Các tài khoản:
+//   - user: ví của một người dùng, không được âm;
+//   - gift_card: số dư chưa nạp của một thẻ quà tặng, không được âm;
+//   - system: gift_card_sales (nguồn phát hành thẻ), order_payments (tiền ví đã trả cho đơn hàng),
+//     adjustments (điều chỉnh thủ công của admin).
+package wallet
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// Các loại giao dịch.
+const (
+	TypeGiftCardIssue  = "gift_card_issue"
+	TypeGiftCardVoid   = "gift_card_void"
+	TypeGiftCardRedeem = "gift_card_redeem"
+	TypeOrderPayment   = "order_payment"
+	TypeOrderRefund    = "order_refund"
+	TypeAdjust         = "adjust"
+)
+
+// Các tài khoản hệ thống (wallet_accounts.code).
+const (
+	AccountGiftCardSales = "gift_card_sales"
+	AccountOrderPayments = "order_payments"
+	AccountAdjustments   = "adjustments"
+)
+
+// Trạng thái thẻ quà tặng.
+const (
+	GiftCardActive   = "active"
+	GiftCardRedeemed = "redeemed"
+	GiftCardVoid     = "void"
+)
+
+// ProductTypeGiftCard là products.product_type của sản phẩm thẻ quà tặng.
+const ProductTypeGiftCard = "gift_card"
+
+// methodSandbox là orders.payment_method của đơn thanh toán qua cổng sandbox (payment.Sandbox); không
+// import payment được vì payment phụ thuộc orderstatus, nơi gọi IssueGiftCards.
+const methodSandbox = "sandbox"
+
+var (
+	ErrInsufficientBalance = errors.New("insufficient wallet balance")
+	ErrGiftCardNotFound    = errors.New("gift card not found")
+	ErrGiftCardUnavailable = errors.New("gift card already redeemed or void")
+)
+
+// entry là một bút toán: amount > 0 ghi tăng, < 0 ghi giảm số dư tài khoản.
+type entry struct {
+	account int64
+	amount  int64
+}
+
+// txn là thông tin chung của một giao dịch.
+type txn struct {
+	typ        string
+	orderID    *int
+	giftCardID *int64
+	refundID   *int64
+	actor      *int
+	note       string
+}
+
+// post ghi một giao dịch sổ kép. Tổng các bút toán phải bằng 0; tài khoản không phải hệ thống bị
+// âm sau giao dịch trả về ErrInsufficientBalance.
+func post(ctx context.Context, tx *sql.Tx, t txn, entries ...entry) (int64, error) {
+	var sum int64
+	for _, e := range entries {
+		sum += e.amount
+	}
+	if sum != 0 {
+		return 0, fmt.Errorf("unbalanced wallet transaction %s: %d", t.typ, sum)
+	}
+
+	var id int64
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO wallet_transactions (type, order_id, gift_card_id, refund_id, actor_user_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
+	`, t.typ, t.orderID, t.giftCardID, t.refundID, t.actor, t.note).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("insert wallet transaction: %w", err)
+	}
+
+	// Cập nhật số dư theo thứ tự id tài khoản để hai giao dịch đồng thời không deadlock
+	sort.Slice(entries, func(i, j int) bool { return entries[i].account < entries[j].account })
+	for _, e := range entries {
+		if e.amount == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO wallet_entries (transaction_id, account_id, amount) VALUES ($1, $2, $3)
+		`, id, e.account, e.amount); err != nil {
+			return 0, fmt.Errorf("insert wallet entry: %w", err)
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE wallet_accounts SET balance = balance + $2 WHERE id = $1", e.account, e.amount)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Constraint == "wallet_accounts_balance_check" {
+			return 0, ErrInsufficientBalance
+		}
+		if err != nil {
+			return 0, fmt.Errorf("update wallet balance: %w", err)
+		}
+	}
+	return id, nil
+}
+
+// userAccount trả về tài khoản ví của người dùng, tạo mới nếu chưa có.
+func userAccount(ctx context.Context, tx *sql.Tx, userID int) (int64, error) {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO wallet_accounts (kind, user_id) VALUES ('user', $1) ON CONFLICT (user_id) DO NOTHING
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM wallet_accounts WHERE user_id = $1", userID).Scan(&id)
+	return id, err
+}
+
+func systemAccount(ctx context.Context, tx *sql.Tx, code string) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, "SELECT id FROM wallet_accounts WHERE code = $1", code).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("system account %s: %w", code, err)
+	}
+	return id, nil
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Balance trả về số dư ví của người dùng. Với lock = true dòng tài khoản bị khóa tới hết transaction.
+func Balance(ctx context.Context, q querier, userID int, lock bool) (int64, error) {
+	query := "SELECT balance FROM wallet_accounts WHERE user_id = $1"
+	if lock {
+		query += " FOR UPDATE"
+	}
+	var balance int64
+	err := q.QueryRowContext(ctx, query, userID).Scan(&balance)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return balance, err
+}
+
+// Pay trừ amount trong ví người dùng để trả cho đơn orderID.
+func Pay(ctx context.Context, tx *sql.Tx, userID, orderID int, amount int64) error {
+	if amount <= 0 {
+		return nil
+	}
+	account, err := userAccount(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	payments, err := systemAccount(ctx, tx, AccountOrderPayments)
+	if err != nil {
+		return err
+	}
+	_, err = post(ctx, tx, txn{
+		typ: TypeOrderPayment, orderID: &orderID, note: fmt.Sprintf("Thanh toán đơn hàng #%d", orderID),
+	}, entry{account, -amount}, entry{payments, amount})
+	return err
+}
+
+// Returnable là phần tiền ví của đơn chưa được trả lại.
+func Returnable(ctx context.Context, q querier, orderID int) (int64, error) {
+	var amount int64
+	err := q.QueryRowContext(ctx, "SELECT wallet_amount - wallet_refunded FROM orders WHERE id = $1", orderID).Scan(&amount)
+	return amount, err
+}
+
+// Return trả lại tối đa amount trong phần tiền ví của đơn vào ví người dùng và trả về số tiền
+// thực sự được trả (0 nếu đã trả hết). Đơn phải đang bị khóa trong tx.
+func Return(ctx context.Context, tx *sql.Tx, orderID int, amount int64, refundID *int64, actor *int, note string) (int64, error) {
+	var userID sql.NullInt64
+	var returnable int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT user_id, wallet_amount - wallet_refunded FROM orders WHERE id = $1
+	`, orderID).Scan(&userID, &returnable)
+	if err != nil {
+		return 0, err
+	}
+	amount = min(amount, returnable)
+	if amount <= 0 || !userID.Valid {
+		return 0, nil
+	}
+
+	account, err := userAccount(ctx, tx, int(userID.Int64))
+	if err != nil {
+		return 0, err
+	}
+	payments, err := systemAccount(ctx, tx, AccountOrderPayments)
+	if err != nil {
+		return 0, err
+	}
+	_, err = post(ctx, tx, txn{typ: TypeOrderRefund, orderID: &orderID, refundID: refundID, actor: actor, note: note},
+		entry{payments, -amount}, entry{account, amount})
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE orders SET wallet_refunded = wallet_refunded + $2 WHERE id = $1", orderID, amount)
+	return amount, err
+}
+
+// ReleaseOrder trả lại toàn bộ phần tiền ví chưa hoàn của đơn bị hủy/hoàn.
+func ReleaseOrder(ctx context.Context, tx *sql.Tx, orderID int) error {
+	returnable, err := Returnable(ctx, tx, orderID)
+	if err != nil || returnable <= 0 {
+		return err
+	}
+	_, err = Return(ctx, tx, orderID, returnable, nil, nil, fmt.Sprintf("Hoàn tiền ví của đơn hàng #%d", orderID))
+	return err
+}
+
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// NewCode sinh mã thẻ quà tặng 16 ký tự, bỏ các ký tự dễ nhầm (O/0, I/1).
+func NewCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// NormalizeCode bỏ khoảng trắng, dấu gạch và chuyển mã thẻ khách nhập sang chữ hoa.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// IssueGiftCards phát hành thẻ quà tặng cho các món thẻ quà tặng của đơn (mỗi đơn vị một thẻ, mệnh
+// giá bằng số tiền khách thực trả cho món đó sau khuyến mãi, voucher và điểm thưởng, chia đều cho
+// các đơn vị). Đơn thanh toán qua cổng sandbox (demo) không được phát hành thẻ. Gọi lại cho đơn đã
+// phát hành thì không làm gì.
+func IssueGiftCards(ctx context.Context, tx *sql.Tx, orderID int) error {
+	var issued bool
+	var method string
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM gift_cards WHERE order_id = $1), payment_method FROM orders WHERE id = $1
+	`, orderID).Scan(&issued, &method)
+	if err != nil {
+		return err
+	}
+	if issued || method == methodSandbox {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT oi.id, oi.quantity, oi.price_at_purchase * oi.quantity - oi.discount_amount
+		FROM order_items oi
+		JOIN products p ON p.id = oi.product_id
+		WHERE oi.order_id = $1 AND p.product_type = $2
+		ORDER BY oi.id
+	`, orderID, ProductTypeGiftCard)
+	if err != nil {
+		return err
+	}
+	type line struct {
+		itemID   int
+		quantity int
+		paid     int64
+	}
+	var lines []line
+	for rows.Next() {
+		var l line
+		if err := rows.Scan(&l.itemID, &l.quantity, &l.paid); err != nil {
+			rows.Close()
+			return err
+		}
+		lines = append(lines, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(lines) == 0 {
+		return err
+	}
+
+	sales, err := systemAccount(ctx, tx, AccountGiftCardSales)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if l.paid <= 0 || l.quantity <= 0 {
+			continue
+		}
+		for i := 0; i < l.quantity; i++ {
+			// Phần lẻ khi chia được cộng vào các thẻ đầu để tổng mệnh giá bằng số tiền đã trả
+			value := l.paid / int64(l.quantity)
+			if int64(i) < l.paid%int64(l.quantity) {
+				value++
+			}
+			code, err := NewCode()
+			if err != nil {
+				return err
+			}
+			var account, cardID int64
+			if err := tx.QueryRowContext(ctx, "INSERT INTO wallet_accounts (kind) VALUES ('gift_card') RETURNING id").Scan(&account); err != nil {
+				return fmt.Errorf("create gift card account: %w", err)
+			}
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO gift_cards (code, account_id, initial_value, order_id, order_item_id)
+				VALUES ($1, $2, $3, $4, $5) RETURNING id
+			`, code, account, value, orderID, l.itemID).Scan(&cardID)
+			if err != nil {
+				return fmt.Errorf("insert gift card: %w", err)
+			}
+			_, err = post(ctx, tx, txn{
+				typ: TypeGiftCardIssue, orderID: &orderID, giftCardID: &cardID,
+				note: fmt.Sprintf("Phát hành thẻ quà tặng của đơn hàng #%d", orderID),
+			}, entry{sales, -value}, entry{account, value})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// VoidGiftCards hủy các thẻ chưa nạp của đơn bị hủy/hoàn và đưa số dư về gift_card_sales. Thẻ đã
+// nạp vào ví thì không thu hồi được, chỉ ghi cảnh báo để xử lý thủ công.
+func VoidGiftCards(ctx context.Context, tx *sql.Tx, orderID int) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT gc.id, gc.account_id, a.balance, gc.status
+		FROM gift_cards gc
+		JOIN wallet_accounts a ON a.id = gc.account_id
+		WHERE gc.order_id = $1 AND gc.status <> $2
+		ORDER BY gc.id
+		FOR UPDATE OF gc, a
+	`, orderID, GiftCardVoid)
+	if err != nil {
+		return err
+	}
+	type card struct {
+		id, account, balance int64
+		status               string
+	}
+	var cards []card
+	for rows.Next() {
+		var c card
+		if err := rows.Scan(&c.id, &c.account, &c.balance, &c.status); err != nil {
+			rows.Close()
+			return err
+		}
+		cards = append(cards, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(cards) == 0 {
+		return err
+	}
+
+	sales, err := systemAccount(ctx, tx, AccountGiftCardSales)
+	if err != nil {
+		return err
+	}
+	for _, c := range cards {
+		if c.status == GiftCardRedeemed {
+			log.Printf("WARNING gift card %d of order %d was already redeemed, cannot void", c.id, orderID)
+			continue
+		}
+		if c.balance > 0 {
+			_, err := post(ctx, tx, txn{
+				typ: TypeGiftCardVoid, orderID: &orderID, giftCardID: &c.id,
+				note: fmt.Sprintf("Hủy thẻ quà tặng của đơn hàng #%d", orderID),
+			}, entry{c.account, -c.balance}, entry{sales, c.balance})
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE gift_cards SET status = $2 WHERE id = $1", c.id, GiftCardVoid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redeem nạp toàn bộ số dư của thẻ code vào ví người dùng và trả về thẻ cùng số dư ví mới.
+func Redeem(ctx context.Context, db *sql.DB, userID int, code string, now time.Time) (models.GiftCard, int64, error) {
+	var card models.GiftCard
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return card, 0, err
+	}
+	defer tx.Rollback()
+
+	var account int64
+	var orderID sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+		SELECT gc.id, gc.code, gc.initial_value, gc.status, gc.order_id, gc.created_at, gc.account_id, a.balance
+		FROM gift_cards gc
+		JOIN wallet_accounts a ON a.id = gc.account_id
+		WHERE gc.code = $1
+		FOR UPDATE OF gc, a
+	`, NormalizeCode(code)).Scan(&card.ID, &card.Code, &card.InitialValue, &card.Status, &orderID, &card.CreatedAt, &account, &card.Balance)
+	if err == sql.ErrNoRows {
+		return card, 0, ErrGiftCardNotFound
+	}
+	if err != nil {
+		return card, 0, err
+	}
+	if card.Status != GiftCardActive || card.Balance <= 0 {
+		return card, 0, ErrGiftCardUnavailable
+	}
+	if orderID.Valid {
+		id := int(orderID.Int64)
+		card.OrderID = &id
+	}
+
+	userAcc, err := userAccount(ctx, tx, userID)
+	if err != nil {
+		return card, 0, err
+	}
+	_, err = post(ctx, tx, txn{
+		typ: TypeGiftCardRedeem, giftCardID: &card.ID, actor: &userID, note: "Nạp thẻ quà tặng " + card.Code,
+	}, entry{account, -card.Balance}, entry{userAcc, card.Balance})
+	if err != nil {
+		return card, 0, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE gift_cards SET status = $2, redeemed_by = $3, redeemed_at = $4 WHERE id = $1
+	`, card.ID, GiftCardRedeemed, userID, now)
+	if err != nil {
+		return card, 0, err
+	}
+	card.Status, card.RedeemedBy, card.RedeemedAt, card.Balance = GiftCardRedeemed, &userID, &now, 0
+
+	balance, err := Balance(ctx, tx, userID, false)
+	if err != nil {
+		return card, 0, err
+	}
+	return card, balance, tx.Commit()
+}
+
+// Adjust cộng (amount > 0) hoặc trừ (amount < 0) số dư ví thủ công. Trừ quá số dư trả về
+// ErrInsufficientBalance.
+func Adjust(ctx context.Context, tx *sql.Tx, userID int, amount int64, reason string, actorID int) error {
+	account, err := userAccount(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	adjustments, err := systemAccount(ctx, tx, AccountAdjustments)
+	if err != nil {
+		return err
+	}
+	_, err = post(ctx, tx, txn{typ: TypeAdjust, actor: &actorID, note: reason},
+		entry{adjustments, -amount}, entry{account, amount})
+	return err
+}
+
+// History trả về các bút toán trên ví của người dùng, mới nhất trước.
+func History(ctx context.Context, db *sql.DB, userID, limit, offset int) ([]models.WalletEntry, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT e.id, t.id, t.type, e.amount, t.order_id, COALESCE(gc.code, ''), t.note, t.created_at
+		FROM wallet_entries e
+		JOIN wallet_accounts a ON a.id = e.account_id
+		JOIN wallet_transactions t ON t.id = e.transaction_id
+		LEFT JOIN gift_cards gc ON gc.id = t.gift_card_id
+		WHERE a.user_id = $1
+		ORDER BY t.created_at DESC, e.id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.WalletEntry{}
+	for rows.Next() {
+		var e models.WalletEntry
+		var orderID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.TransactionID, &e.Type, &e.Amount, &orderID, &e.GiftCardCode, &e.Note, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			e.OrderID = &id
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Audit đối soát sổ kép: mọi giao dịch có tổng bằng 0 và số dư lưu của mọi tài khoản bằng tổng
+// bút toán của nó.
+func Audit(ctx context.Context, db *sql.DB) (models.WalletAudit, error) {
+	audit := models.WalletAudit{UnbalancedTransactions: []int64{}, MismatchedAccounts: []int64{}}
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(balance), 0),
+		       COALESCE(SUM(balance) FILTER (WHERE kind = 'user'), 0),
+		       COALESCE(SUM(balance) FILTER (WHERE kind = 'gift_card'), 0)
+		FROM wallet_accounts
+	`).Scan(&audit.TotalBalance, &audit.UserBalances, &audit.GiftCardBalances)
+	if err != nil {
+		return audit, err
+	}
+
+	collect := func(query string, into *[]int64) error {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			*into = append(*into, id)
+		}
+		return rows.Err()
+	}
+	err = collect(`
+		SELECT transaction_id FROM wallet_entries GROUP BY transaction_id HAVING SUM(amount) <> 0 ORDER BY transaction_id
+	`, &audit.UnbalancedTransactions)
+	if err != nil {
+		return audit, err
+	}
+	err = collect(`
+		SELECT a.id FROM wallet_accounts a
+		LEFT JOIN (SELECT account_id, SUM(amount) AS total FROM wallet_entries GROUP BY account_id) e ON e.account_id = a.id
+		WHERE a.balance <> COALESCE(e.total, 0)
+		ORDER BY a.id
+	`, &audit.MismatchedAccounts)
+	if err != nil {
+		return audit, err
+	}
+
+	audit.Balanced = audit.TotalBalance == 0 && len(audit.UnbalancedTransactions) == 0 && len(audit.MismatchedAccounts) == 0
+	return audit, nil
+}
+
+// Entries trả về bút toán của các giao dịch ids, nhóm theo giao dịch. Account mô tả tài khoản:
+// username với ví người dùng, mã thẻ với thẻ quà tặng, mã tài khoản với tài khoản hệ thống.
+func Entries(ctx context.Context, db *sql.DB, ids []int64) (map[int64][]models.WalletLedgerEntry, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT e.transaction_id, a.id, a.kind, COALESCE(u.username, gc.code, a.code, ''), e.amount
+		FROM wallet_entries e
+		JOIN wallet_accounts a ON a.id = e.account_id
+		LEFT JOIN users u ON u.id = a.user_id
+		LEFT JOIN gift_cards gc ON gc.account_id = a.id
+		WHERE e.transaction_id = ANY($1)
+		ORDER BY e.transaction_id, e.id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make(map[int64][]models.WalletLedgerEntry, len(ids))
+	for rows.Next() {
+		var txID int64
+		var e models.WalletLedgerEntry
+		if err := rows.Scan(&txID, &e.AccountID, &e.AccountKind, &e.Account, &e.Amount); err != nil {
+			return nil, err
+		}
+		entries[txID] = append(entries[txID], e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,54 @@
+package wallet
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"backend/internal/dbtest"
+)
+
+// giftCardOrder là đơn 12 có một món 3 thẻ quà tặng 100.000đ, được giảm tổng cộng 50.000đ.
+func giftCardOrder(t *testing.T, method string) *dbtest.DB {
+	t.Helper()
+	fake, db := dbtest.New()
+	fake.On("FROM gift_cards WHERE order_id", dbtest.Rows([]driver.Value{false, method}))
+	fake.On("FROM order_items oi", dbtest.Rows([]driver.Value{int64(30), int64(3), int64(250000)}))
+	fake.On("SELECT id FROM wallet_accounts WHERE code", dbtest.Rows([]driver.Value{int64(1)}))
+	fake.On("INSERT INTO wallet_accounts", dbtest.Rows([]driver.Value{int64(50)}))
+	fake.On("INSERT INTO gift_cards", dbtest.Rows([]driver.Value{int64(60)}))
+	fake.On("INSERT INTO wallet_transactions", dbtest.Rows([]driver.Value{int64(70)}))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := IssueGiftCards(context.Background(), tx, 12); err != nil {
+		t.Fatal(err)
+	}
+	return fake
+}
+
+func TestIssueGiftCardsUsesAmountPaid(t *testing.T) {
+	fake := giftCardOrder(t, "momo")
+
+	cards := fake.Calls("INSERT INTO gift_cards")
+	if len(cards) != 3 {
+		t.Fatalf("phát hành %d thẻ, muốn 3", len(cards))
+	}
+	// 250.000đ chia cho 3 thẻ, phần lẻ cộng vào thẻ đầu
+	want := []int64{83334, 83333, 83333}
+	for i, c := range cards {
+		if c.Args[2] != want[i] {
+			t.Errorf("thẻ %d mệnh giá %v, muốn %d", i, c.Args[2], want[i])
+		}
+	}
+}
+
+func TestIssueGiftCardsSkipsSandboxOrders(t *testing.T) {
+	fake := giftCardOrder(t, methodSandbox)
+	if len(fake.Calls("FROM order_items")) != 0 || len(fake.Calls("INSERT INTO gift_cards")) != 0 {
+		t.Error("đơn demo không được phát hành thẻ quà tặng")
+	}
+}
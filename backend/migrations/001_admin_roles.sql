@@ -0,0 +1,9 @@
+-- Phân quyền admin theo role (owner, manager, kitchen_staff, support).
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'customer';
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check
+    CHECK (role IN ('customer', 'owner', 'manager', 'kitchen_staff', 'support'));
+
+-- Các tài khoản admin hiện có được giữ toàn quyền.
+UPDATE users SET role = 'owner' WHERE is_admin = TRUE AND role = 'customer';
@@ -0,0 +1,19 @@
+-- Chống brute-force: bộ đếm đăng nhập sai theo tài khoản và khóa tạm thời.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_count INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_failed_login_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+
+-- Lịch sử đăng nhập / yêu cầu quên mật khẩu; cũng dùng để đếm số lần sai theo IP.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INT REFERENCES users(id) ON DELETE CASCADE,
+    username   VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    user_agent TEXT,
+    kind       VARCHAR(32) NOT NULL,
+    result     VARCHAR(32) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_user ON login_attempts(user_id, kind, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address, kind, created_at DESC);
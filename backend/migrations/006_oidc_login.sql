@@ -0,0 +1,23 @@
+-- Đăng nhập bằng tài khoản mạng xã hội (OpenID Connect).
+-- state/nonce/PKCE verifier của một lần đăng nhập, chỉ dùng được một lần.
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash    VARCHAR(64) PRIMARY KEY,
+    provider      VARCHAR(50) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    nonce         VARCHAR(128) NOT NULL,
+    expires_at    TIMESTAMPTZ NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Liên kết (provider, sub) với tài khoản nội bộ.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id         SERIAL PRIMARY KEY,
+    user_id    INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider   VARCHAR(50) NOT NULL,
+    subject    VARCHAR(255) NOT NULL,
+    email      VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
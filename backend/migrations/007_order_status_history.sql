@@ -0,0 +1,21 @@
+-- Máy trạng thái đơn hàng: pending, paid, confirmed, preparing, shipped, completed, cancelled, refunded.
+-- Các trạng thái cũ được gộp vào trạng thái mới tương ứng.
+UPDATE orders SET status = 'pending' WHERE status = 'pending_payment';
+UPDATE orders SET status = 'preparing' WHERE status = 'processing';
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'paid', 'confirmed', 'preparing', 'shipped', 'completed', 'cancelled', 'refunded'));
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id            BIGSERIAL PRIMARY KEY,
+    order_id      INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status   VARCHAR(20),
+    to_status     VARCHAR(20) NOT NULL,
+    actor_type    VARCHAR(20) NOT NULL CHECK (actor_type IN ('customer', 'staff', 'system')),
+    actor_user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    reason        TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order_id ON order_status_history(order_id);
@@ -0,0 +1,15 @@
+-- Giữ hàng cho đơn chưa giao. expires_at NULL nghĩa là giữ tới khi giao hoặc hủy;
+-- released_at khác NULL nghĩa là đã trả hàng (hủy/hết hạn) hoặc đã trừ kho thật.
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id          BIGSERIAL PRIMARY KEY,
+    order_id    INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    product_id  INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    quantity    INT NOT NULL CHECK (quantity > 0),
+    expires_at  TIMESTAMPTZ,
+    released_at TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_active
+    ON stock_reservations(product_id) WHERE released_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_order_id ON stock_reservations(order_id);
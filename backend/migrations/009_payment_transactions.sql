@@ -0,0 +1,18 @@
+-- Mỗi callback (IPN) của cổng thanh toán được ghi lại đúng một lần để các lần gửi lại không có tác dụng.
+CREATE TABLE IF NOT EXISTS payment_transactions (
+    id                      BIGSERIAL PRIMARY KEY,
+    provider                VARCHAR(30) NOT NULL,
+    external_order_id       VARCHAR(100) NOT NULL,
+    provider_transaction_id VARCHAR(100),
+    order_id                INT REFERENCES orders(id) ON DELETE SET NULL,
+    amount                  BIGINT NOT NULL,
+    -- Mã kết quả của các cổng không phải lúc nào cũng là số (VNPay dùng "00", "24"...)
+    result_code             VARCHAR(20) NOT NULL,
+    message                 TEXT,
+    -- applied | ignored | amount_mismatch | order_not_found
+    outcome                 VARCHAR(30),
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, external_order_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_transactions_order_id ON payment_transactions(order_id);
@@ -0,0 +1,13 @@
+-- Mỗi lần tạo link thanh toán qua cổng trực tuyến; dùng để tra cứu trạng thái (query) và hoàn tiền.
+CREATE TABLE IF NOT EXISTS payment_attempts (
+    id                BIGSERIAL PRIMARY KEY,
+    order_id          INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider          VARCHAR(30) NOT NULL,
+    external_order_id VARCHAR(100) NOT NULL,
+    amount            BIGINT NOT NULL,
+    payment_url       TEXT,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, external_order_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_attempts_order_id ON payment_attempts(order_id);
@@ -0,0 +1,30 @@
+-- Hoàn tiền toàn phần/một phần cho đơn hàng. provider = 'manual' khi cửa hàng tự hoàn
+-- (chuyển khoản, tiền mặt) và chỉ ghi nhận lại.
+CREATE TABLE IF NOT EXISTS refunds (
+    id                  BIGSERIAL PRIMARY KEY,
+    order_id            INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider            VARCHAR(30) NOT NULL,
+    -- Mã hoàn tiền phía cửa hàng gửi cho cổng thanh toán
+    external_refund_id  VARCHAR(100) NOT NULL UNIQUE,
+    provider_refund_id  VARCHAR(100),
+    amount              BIGINT NOT NULL CHECK (amount > 0),
+    status              VARCHAR(20) NOT NULL DEFAULT 'pending'
+                        CHECK (status IN ('pending', 'succeeded', 'failed')),
+    reason              TEXT,
+    message             TEXT,
+    created_by          INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_order_id ON refunds(order_id);
+
+CREATE TABLE IF NOT EXISTS refund_items (
+    id            BIGSERIAL PRIMARY KEY,
+    refund_id     BIGINT NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    order_item_id INT NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    quantity      INT NOT NULL CHECK (quantity > 0),
+    amount        BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_refund_items_refund_id ON refund_items(refund_id);
@@ -0,0 +1,29 @@
+-- Phương thức và trạng thái thanh toán của đơn, tách khỏi trạng thái giao hàng (orders.status).
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_method VARCHAR(30) NOT NULL DEFAULT 'cod';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_status VARCHAR(20) NOT NULL DEFAULT 'unpaid'
+    CHECK (payment_status IN ('unpaid', 'paid', 'partially_refunded', 'refunded'));
+
+CREATE INDEX IF NOT EXISTS idx_orders_payment_method ON orders(payment_method);
+
+-- Đơn cũ: lấy phương thức từ lần tạo link thanh toán hoặc giao dịch đã ghi nhận
+UPDATE orders o SET payment_method = src.provider
+FROM (
+    SELECT DISTINCT ON (order_id) order_id, provider FROM (
+        SELECT order_id, provider, created_at FROM payment_attempts
+        UNION ALL
+        SELECT order_id, provider, created_at FROM payment_transactions WHERE order_id IS NOT NULL
+    ) p
+    ORDER BY order_id, created_at DESC
+) src
+WHERE o.id = src.order_id;
+
+UPDATE orders o SET payment_status = 'paid'
+WHERE EXISTS (
+    SELECT 1 FROM payment_transactions t WHERE t.order_id = o.id AND t.outcome = 'applied'
+) OR o.status IN ('paid', 'completed');
+
+UPDATE orders o SET payment_status = CASE WHEN r.refunded >= o.total_amount THEN 'refunded' ELSE 'partially_refunded' END
+FROM (
+    SELECT order_id, SUM(amount) AS refunded FROM refunds WHERE status = 'succeeded' GROUP BY order_id
+) r
+WHERE o.id = r.order_id;
@@ -0,0 +1,12 @@
+-- Điều kiện áp dụng voucher: danh mục, giá trị đơn tối thiểu, mức giảm tối đa (voucher phần
+-- trăm) và tổng số lượt dùng. NULL là không giới hạn.
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS applicable_category_ids INT[];
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS min_order_value BIGINT NOT NULL DEFAULT 0 CHECK (min_order_value >= 0);
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS max_discount BIGINT CHECK (max_discount > 0);
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS usage_limit INT CHECK (usage_limit > 0);
+-- Số đơn (chưa hủy) đang dùng voucher; tăng khi đặt hàng, giảm khi đơn bị hủy
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS used_count INT NOT NULL DEFAULT 0;
+
+UPDATE vouchers v SET used_count = (
+    SELECT COUNT(*) FROM user_vouchers uv WHERE uv.voucher_id = v.id AND uv.is_used = true
+);
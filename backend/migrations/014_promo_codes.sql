@@ -0,0 +1,21 @@
+-- Mã khuyến mãi công khai (vd TET2027): khách nhập mã khi thanh toán, không cần "săn" trước.
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS is_public BOOLEAN NOT NULL DEFAULT false;
+-- Thời gian hiệu lực của mã công khai; NULL là không giới hạn
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS valid_from TIMESTAMPTZ;
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS valid_until TIMESTAMPTZ;
+ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS per_user_limit INT NOT NULL DEFAULT 1 CHECK (per_user_limit > 0);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_vouchers_public_code ON vouchers (UPPER(code)) WHERE is_public;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS promo_voucher_id INT REFERENCES vouchers(id) ON DELETE SET NULL;
+
+-- Mỗi lần dùng mã công khai; dùng để đếm giới hạn theo người dùng. Xóa khi đơn bị hủy.
+CREATE TABLE IF NOT EXISTS voucher_redemptions (
+    id         BIGSERIAL PRIMARY KEY,
+    voucher_id INT NOT NULL REFERENCES vouchers(id) ON DELETE CASCADE,
+    user_id    INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    order_id   INT NOT NULL UNIQUE REFERENCES orders(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_voucher_redemptions_voucher_user ON voucher_redemptions(voucher_id, user_id);
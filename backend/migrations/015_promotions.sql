@@ -0,0 +1,33 @@
+-- Khuyến mãi tự động trên giỏ hàng, áp dụng theo thứ tự priority giảm dần.
+CREATE TABLE IF NOT EXISTS promotions (
+    id            SERIAL PRIMARY KEY,
+    name          VARCHAR(255) NOT NULL,
+    type          VARCHAR(30) NOT NULL CHECK (type IN ('buy_x_get_y', 'combo', 'tiered_spend')),
+    priority      INT NOT NULL DEFAULT 0,
+    -- exclusive: không cộng dồn với khuyến mãi khác; allow_voucher: được dùng kèm voucher/mã
+    exclusive     BOOLEAN NOT NULL DEFAULT false,
+    allow_voucher BOOLEAN NOT NULL DEFAULT true,
+    -- Tham số theo loại quy tắc (sản phẩm, số lượng, giá combo, các bậc...)
+    config        JSONB NOT NULL DEFAULT '{}',
+    starts_at     TIMESTAMPTZ,
+    ends_at       TIMESTAMPTZ,
+    is_active     BOOLEAN NOT NULL DEFAULT true,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- orders.discount_amount là tổng giảm giá (khuyến mãi + voucher)
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS promotion_discount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS discount_amount BIGINT NOT NULL DEFAULT 0;
+
+-- Chi tiết giảm giá của từng món: mỗi khuyến mãi/voucher đã áp dụng là một dòng.
+CREATE TABLE IF NOT EXISTS order_item_adjustments (
+    id            BIGSERIAL PRIMARY KEY,
+    order_item_id INT NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    source        VARCHAR(20) NOT NULL CHECK (source IN ('promotion', 'voucher')),
+    promotion_id  INT REFERENCES promotions(id) ON DELETE SET NULL,
+    label         VARCHAR(255) NOT NULL,
+    amount        BIGINT NOT NULL CHECK (amount > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_item_adjustments_item ON order_item_adjustments(order_item_id);
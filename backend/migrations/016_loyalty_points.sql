@@ -0,0 +1,28 @@
+-- Sổ điểm thưởng: mỗi dòng là một lần cộng/trừ điểm (points có dấu). Các dòng cộng điểm là một
+-- "lô" có hạn dùng; remaining là số điểm còn lại của lô, được trừ dần theo thứ tự hết hạn sớm nhất.
+CREATE TABLE IF NOT EXISTS loyalty_ledger (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    order_id      INT REFERENCES orders(id) ON DELETE SET NULL,
+    type          VARCHAR(20) NOT NULL CHECK (type IN ('earn', 'redeem', 'restore', 'clawback', 'expire', 'adjust')),
+    points        INT NOT NULL CHECK (points <> 0),
+    remaining     INT NOT NULL DEFAULT 0 CHECK (remaining >= 0 AND remaining <= GREATEST(points, 0)),
+    expires_at    TIMESTAMPTZ,
+    reason        TEXT NOT NULL DEFAULT '',
+    actor_user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_loyalty_ledger_user ON loyalty_ledger(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_loyalty_ledger_lots ON loyalty_ledger(user_id, expires_at) WHERE remaining > 0;
+CREATE INDEX IF NOT EXISTS idx_loyalty_ledger_order ON loyalty_ledger(order_id);
+-- Mỗi đơn chỉ được cộng điểm một lần
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loyalty_ledger_earn_order ON loyalty_ledger(order_id) WHERE type = 'earn';
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS points_redeemed INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS points_discount BIGINT NOT NULL DEFAULT 0;
+
+-- Giảm giá bằng điểm cũng được phân bổ vào từng món
+ALTER TABLE order_item_adjustments DROP CONSTRAINT IF EXISTS order_item_adjustments_source_check;
+ALTER TABLE order_item_adjustments ADD CONSTRAINT order_item_adjustments_source_check
+    CHECK (source IN ('promotion', 'voucher', 'points'));
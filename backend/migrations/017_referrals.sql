@@ -0,0 +1,36 @@
+-- Mã giới thiệu của mỗi người dùng; tài khoản cũ được cấp mã ngẫu nhiên.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS referral_code VARCHAR(16);
+UPDATE users SET referral_code = UPPER(SUBSTRING(MD5(id::text || clock_timestamp()::text) FOR 8))
+WHERE referral_code IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_referral_code ON users(referral_code);
+
+-- Mã thiết bị (do trình duyệt sinh và lưu lại) lúc đăng ký, dùng để chặn tạo nhiều tài khoản
+-- trên cùng thiết bị để nhận thưởng giới thiệu.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS signup_device_id VARCHAR(64);
+CREATE INDEX IF NOT EXISTS idx_users_signup_device ON users(signup_device_id);
+
+-- Nguồn của voucher trong ví: claim (tự săn) | referral. Chỉ voucher tự săn mới giới hạn mỗi
+-- người một lượt; voucher thưởng có thể được cấp nhiều lần (mỗi lần giới thiệu thành công).
+ALTER TABLE user_vouchers ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'claim';
+ALTER TABLE user_vouchers DROP CONSTRAINT IF EXISTS user_vouchers_user_id_voucher_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_vouchers_claim ON user_vouchers(user_id, voucher_id) WHERE source = 'claim';
+
+CREATE TABLE IF NOT EXISTS referrals (
+    id                       SERIAL PRIMARY KEY,
+    referrer_id              INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    referred_id              INT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    device_id                VARCHAR(64) NOT NULL,
+    ip_address               VARCHAR(64),
+    -- rejected: giới thiệu chính mình hoặc thiết bị đã đăng ký tài khoản khác, không được thưởng
+    status                   VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'rewarded', 'rejected')),
+    reject_reason            VARCHAR(50),
+    order_id                 INT REFERENCES orders(id) ON DELETE SET NULL,
+    referrer_user_voucher_id INT REFERENCES user_vouchers(id) ON DELETE SET NULL,
+    referred_user_voucher_id INT REFERENCES user_vouchers(id) ON DELETE SET NULL,
+    created_at               TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    rewarded_at              TIMESTAMPTZ,
+    CHECK (referrer_id <> referred_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_referrals_referrer ON referrals(referrer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_referrals_device ON referrals(device_id);
@@ -0,0 +1,38 @@
+-- Ngày sinh (không bắt buộc) cho chiến dịch sinh nhật
+ALTER TABLE users ADD COLUMN IF NOT EXISTS birthday DATE;
+
+-- Chiến dịch tự động tặng voucher cho một nhóm người dùng, chạy lại mỗi interval_hours.
+CREATE TABLE IF NOT EXISTS voucher_campaigns (
+    id             SERIAL PRIMARY KEY,
+    name           VARCHAR(255) NOT NULL,
+    voucher_id     INT NOT NULL REFERENCES vouchers(id) ON DELETE CASCADE,
+    -- inactive: không đặt hàng trong inactive_days ngày; birthday_month: sinh nhật trong tháng
+    segment        VARCHAR(30) NOT NULL CHECK (segment IN ('inactive', 'birthday_month')),
+    inactive_days  INT NOT NULL DEFAULT 30 CHECK (inactive_days > 0),
+    interval_hours INT NOT NULL DEFAULT 24 CHECK (interval_hours > 0),
+    email_subject  VARCHAR(255) NOT NULL,
+    email_message  TEXT NOT NULL DEFAULT '',
+    starts_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ends_at        TIMESTAMPTZ,
+    is_active      BOOLEAN NOT NULL DEFAULT true,
+    last_run_at    TIMESTAMPTZ,
+    next_run_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_voucher_campaigns_due ON voucher_campaigns(next_run_at) WHERE is_active;
+
+-- Mỗi người dùng nhận voucher của một chiến dịch tối đa một lần.
+CREATE TABLE IF NOT EXISTS voucher_campaign_deliveries (
+    id              BIGSERIAL PRIMARY KEY,
+    campaign_id     INT NOT NULL REFERENCES voucher_campaigns(id) ON DELETE CASCADE,
+    user_id         INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_voucher_id INT REFERENCES user_vouchers(id) ON DELETE SET NULL,
+    email_sent_at   TIMESTAMPTZ,
+    email_error     TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (campaign_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_voucher_campaign_deliveries_user ON voucher_campaign_deliveries(user_id);
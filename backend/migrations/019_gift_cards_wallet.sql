@@ -0,0 +1,74 @@
+-- Loại sản phẩm: món ăn hoặc thẻ quà tặng (mệnh giá = giá bán)
+ALTER TABLE products ADD COLUMN IF NOT EXISTS product_type VARCHAR(20) NOT NULL DEFAULT 'food'
+    CHECK (product_type IN ('food', 'gift_card'));
+
+-- Tài khoản trong sổ kép: ví của người dùng, số dư của từng thẻ quà tặng và các tài khoản hệ thống.
+-- balance là tổng các bút toán của tài khoản, được cập nhật cùng transaction với bút toán.
+CREATE TABLE IF NOT EXISTS wallet_accounts (
+    id         BIGSERIAL PRIMARY KEY,
+    kind       VARCHAR(20) NOT NULL CHECK (kind IN ('user', 'gift_card', 'system')),
+    user_id    INT UNIQUE REFERENCES users(id) ON DELETE RESTRICT,
+    code       VARCHAR(50) UNIQUE,
+    balance    BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Chỉ tài khoản hệ thống được âm (vd gift_card_sales là nguồn phát hành thẻ)
+    CONSTRAINT wallet_accounts_balance_check CHECK (kind = 'system' OR balance >= 0),
+    CHECK ((kind = 'user') = (user_id IS NOT NULL)),
+    CHECK ((kind = 'system') = (code IS NOT NULL))
+);
+
+INSERT INTO wallet_accounts (kind, code) VALUES
+    ('system', 'gift_card_sales'),
+    ('system', 'order_payments'),
+    ('system', 'adjustments')
+ON CONFLICT (code) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS gift_cards (
+    id            BIGSERIAL PRIMARY KEY,
+    code          VARCHAR(32) NOT NULL UNIQUE,
+    account_id    BIGINT NOT NULL UNIQUE REFERENCES wallet_accounts(id),
+    initial_value BIGINT NOT NULL CHECK (initial_value > 0),
+    -- Đơn mua thẻ; NULL nếu admin phát hành thủ công
+    order_id      INT REFERENCES orders(id) ON DELETE SET NULL,
+    order_item_id INT REFERENCES order_items(id) ON DELETE SET NULL,
+    status        VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'redeemed', 'void')),
+    redeemed_by   INT REFERENCES users(id) ON DELETE SET NULL,
+    redeemed_at   TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_gift_cards_order ON gift_cards(order_id);
+
+-- Mỗi lần tiền di chuyển là một giao dịch gồm các bút toán có tổng bằng 0.
+CREATE TABLE IF NOT EXISTS wallet_transactions (
+    id            BIGSERIAL PRIMARY KEY,
+    type          VARCHAR(30) NOT NULL CHECK (type IN (
+                      'gift_card_issue', 'gift_card_void', 'gift_card_redeem',
+                      'order_payment', 'order_refund', 'adjust')),
+    order_id      INT REFERENCES orders(id) ON DELETE SET NULL,
+    gift_card_id  BIGINT REFERENCES gift_cards(id) ON DELETE SET NULL,
+    refund_id     BIGINT REFERENCES refunds(id) ON DELETE SET NULL,
+    actor_user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    note          TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_transactions_order ON wallet_transactions(order_id);
+CREATE INDEX IF NOT EXISTS idx_wallet_transactions_created ON wallet_transactions(created_at);
+
+CREATE TABLE IF NOT EXISTS wallet_entries (
+    id             BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT NOT NULL REFERENCES wallet_transactions(id) ON DELETE RESTRICT,
+    account_id     BIGINT NOT NULL REFERENCES wallet_accounts(id) ON DELETE RESTRICT,
+    amount         BIGINT NOT NULL CHECK (amount <> 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_entries_transaction ON wallet_entries(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_wallet_entries_account ON wallet_entries(account_id);
+
+-- Số tiền trả bằng ví (không nằm trong total_amount, là số tiền còn phải thu qua phương thức
+-- thanh toán) và phần đã trả lại vào ví khi hoàn/hủy đơn.
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS wallet_amount BIGINT NOT NULL DEFAULT 0 CHECK (wallet_amount >= 0),
+    ADD COLUMN IF NOT EXISTS wallet_refunded BIGINT NOT NULL DEFAULT 0 CHECK (wallet_refunded >= 0);
+
@@ -0,0 +1,12 @@
+-- Thời điểm nhận voucher, dùng để lọc lượt nhận theo khoảng ngày trong báo cáo hiệu quả voucher.
+ALTER TABLE user_vouchers ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ;
+-- Voucher đã nhận trước đây: suy ra từ hạn dùng
+UPDATE user_vouchers uv
+SET claimed_at = uv.expires_at - make_interval(days => v.valid_duration_days)
+FROM vouchers v
+WHERE v.id = uv.voucher_id AND uv.claimed_at IS NULL;
+ALTER TABLE user_vouchers ALTER COLUMN claimed_at SET DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_user_vouchers_voucher_claimed ON user_vouchers(voucher_id, claimed_at);
+CREATE INDEX IF NOT EXISTS idx_orders_applied_voucher ON orders(applied_voucher_id) WHERE applied_voucher_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_orders_promo_voucher ON orders(promo_voucher_id) WHERE promo_voucher_id IS NOT NULL;
@@ -0,0 +1,9 @@
+-- IP lúc đăng ký, cùng với signup_device_id dùng để phát hiện tự giới thiệu.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS signup_ip VARCHAR(64);
+CREATE INDEX IF NOT EXISTS idx_referrals_referrer_ip ON referrals(referrer_id, ip_address);
+
+-- revoked: đơn được thưởng đã bị hoàn tiền, voucher thưởng chưa dùng bị thu hồi
+ALTER TABLE referrals DROP CONSTRAINT IF EXISTS referrals_status_check;
+ALTER TABLE referrals ADD CONSTRAINT referrals_status_check
+    CHECK (status IN ('pending', 'rewarded', 'rejected', 'revoked'));
+ALTER TABLE referrals ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMPTZ;
@@ -1,16 +1,49 @@
-import { OrderPayload } from "@/types/api"
+import { CheckoutQuote, OrderPayload } from "@/types/api"
 
 import apiClient from "."
 
+// Đã đăng nhập thì gửi token để đơn gắn với tài khoản; khách vãng lai đặt hàng không cần token
+const getAuthHeaders = (): Record<string, string> => {
+  const token = localStorage.getItem("authToken")
+  return token ? { Authorization: `Bearer ${token}` } : {}
+}
+
+// Price the cart (eligible lines, discount, and why a voucher does not apply)
+export const quoteCheckout = async (payload: OrderPayload): Promise<CheckoutQuote> => {
+  const response = await apiClient.post<CheckoutQuote>("/checkout/quote", payload, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
 // Pay by COD
 export const placeOrder = async (payload: OrderPayload): Promise<any> => {
-  const response = await apiClient.post("/orders", payload)
+  const response = await apiClient.post("/orders", payload, { headers: getAuthHeaders() })
   return response.data
 }
 
 // Pay by MoMo
 export const createMoMoPayment = async (payload: OrderPayload): Promise<{ payUrl: string }> => {
-  const response = await apiClient.post<{ payUrl: string }>("/payment/momo", payload)
+  const response = await apiClient.post<{ payUrl: string }>("/payment/momo", payload, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+// Pay by VNPay
+export const createVNPayPayment = async (payload: OrderPayload): Promise<{ payUrl: string }> => {
+  const response = await apiClient.post<{ payUrl: string }>("/payment/vnpay", payload, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+// Verify the signed result a gateway appends to the return URL
+export const verifyPaymentReturn = async (
+  provider: string,
+  query: string
+): Promise<{ order_id: number; success: boolean; message: string; status: string }> => {
+  const response = await apiClient.get(`/payment/${provider}/return?${query}`)
   return response.data
 }
 
@@ -20,7 +53,8 @@ export const createBankTransferPayment = async (
 ): Promise<{ orderId: number; amount: number }> => {
   const response = await apiClient.post<{ orderId: number; amount: number }>(
     "/payment/bank-transfer",
-    payload
+    payload,
+    { headers: getAuthHeaders() }
   )
   return response.data
 }
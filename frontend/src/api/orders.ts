@@ -4,8 +4,19 @@ import apiClient from "."
 
 const API_URL = "http://localhost:8080/api"
 
-export const getAllOrders = async (page: number = 1): Promise<PaginatedOrders> => {
-  const response = await apiClient.get<PaginatedOrders>(`/admin/orders?page=${page}`)
+export const getAllOrders = async (
+  page: number = 1,
+  paymentMethod?: string
+): Promise<PaginatedOrders> => {
+  const response = await apiClient.get<PaginatedOrders>("/admin/orders", {
+    params: { page, payment_method: paymentMethod || undefined },
+  })
+  return response.data
+}
+
+// Xác nhận shipper/admin đã thu tiền mặt của đơn COD
+export const confirmCODCollection = async (orderId: number, note?: string): Promise<unknown> => {
+  const response = await apiClient.post(`/admin/orders/${orderId}/cod-collection`, { note })
   return response.data
 }
 
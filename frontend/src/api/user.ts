@@ -1,4 +1,16 @@
-import { DashboardStats } from "@/types/api"
+import {
+  DashboardStats,
+  GiftCard,
+  LoyaltyBalance,
+  LoyaltyEntry,
+  Referral,
+  ReferralInfo,
+  ReferralSummary,
+  WalletAudit,
+  WalletBalance,
+  WalletEntry,
+  WalletTransaction,
+} from "@/types/api"
 
 import apiClient from "."
 
@@ -11,3 +23,106 @@ export const getUsers = async (page: number = 1, limit: number = 10) => {
   const response = await apiClient.get(`/admin/users?page=${page}&limit=${limit}`)
   return response.data
 }
+
+export const getLoyaltyBalance = async (): Promise<LoyaltyBalance> => {
+  const response = await apiClient.get<LoyaltyBalance>("/user/loyalty")
+  return response.data
+}
+
+export const getLoyaltyHistory = async (
+  page: number = 1
+): Promise<{ entries: LoyaltyEntry[]; page: number; totalPages: number }> => {
+  const response = await apiClient.get(`/user/loyalty/history?page=${page}`)
+  return response.data
+}
+
+export const adminAdjustLoyaltyPoints = async (
+  userId: number,
+  points: number,
+  reason: string
+): Promise<LoyaltyBalance> => {
+  const response = await apiClient.post<LoyaltyBalance>(`/admin/users/${userId}/loyalty/adjust`, {
+    points,
+    reason,
+  })
+  return response.data
+}
+
+export const getMyReferral = async (): Promise<ReferralInfo> => {
+  const response = await apiClient.get<ReferralInfo>("/user/referral")
+  return response.data
+}
+
+export const updateBirthday = async (birthday: string): Promise<{ message: string }> => {
+  const response = await apiClient.put("/user/birthday", { birthday })
+  return response.data
+}
+
+export const getReferralReport = async (
+  page: number = 1,
+  status: string = ""
+): Promise<{ summary: ReferralSummary; referrals: Referral[]; page: number; totalPages: number }> => {
+  const params = new URLSearchParams({ page: String(page) })
+  if (status) params.set("status", status)
+  const response = await apiClient.get(`/admin/referrals?${params.toString()}`)
+  return response.data
+}
+
+export const getWallet = async (): Promise<WalletBalance> => {
+  const response = await apiClient.get<WalletBalance>("/user/wallet")
+  return response.data
+}
+
+export const getWalletHistory = async (
+  page: number = 1
+): Promise<{ entries: WalletEntry[]; page: number; totalPages: number }> => {
+  const response = await apiClient.get(`/user/wallet/history?page=${page}`)
+  return response.data
+}
+
+export const redeemGiftCard = async (
+  code: string
+): Promise<{ message: string; amount: number; gift_card: GiftCard; balance: number }> => {
+  const response = await apiClient.post("/user/wallet/redeem", { code })
+  return response.data
+}
+
+export const getMyGiftCards = async (): Promise<GiftCard[]> => {
+  const response = await apiClient.get<GiftCard[]>("/user/gift-cards")
+  return response.data
+}
+
+export const adminAdjustWallet = async (userId: number, amount: number, reason: string): Promise<WalletBalance> => {
+  const response = await apiClient.post<WalletBalance>(`/admin/users/${userId}/wallet/adjust`, {
+    amount,
+    reason,
+  })
+  return response.data
+}
+
+export const adminGetWalletTransactions = async (
+  page: number = 1,
+  filters: { type?: string; user_id?: number; order_id?: number; from?: string; to?: string } = {}
+): Promise<{ transactions: WalletTransaction[]; page: number; totalPages: number }> => {
+  const params = new URLSearchParams({ page: String(page) })
+  Object.entries(filters).forEach(([key, value]) => {
+    if (value) params.set(key, String(value))
+  })
+  const response = await apiClient.get(`/admin/wallet/transactions?${params.toString()}`)
+  return response.data
+}
+
+export const adminGetWalletAudit = async (): Promise<WalletAudit> => {
+  const response = await apiClient.get<WalletAudit>("/admin/wallet/audit")
+  return response.data
+}
+
+export const adminGetGiftCards = async (
+  page: number = 1,
+  status: string = ""
+): Promise<{ gift_cards: GiftCard[]; page: number; totalPages: number }> => {
+  const params = new URLSearchParams({ page: String(page) })
+  if (status) params.set("status", status)
+  const response = await apiClient.get(`/admin/gift-cards?${params.toString()}`)
+  return response.data
+}
@@ -1,4 +1,13 @@
-import { Voucher, UserVoucher, MessageResponse } from "@/types/api"
+import {
+  Voucher,
+  UserVoucher,
+  MessageResponse,
+  Promotion,
+  VoucherCampaign,
+  CampaignDelivery,
+  CampaignRunResult,
+  VoucherAnalytics,
+} from "@/types/api"
 import { VoucherFormValues } from "@/app/(admin)/vouchers/VoucherForm"
 
 import apiClient from "."
@@ -10,11 +19,23 @@ const getAuthHeaders = () => {
 
 export type VoucherApiPayload = Omit<
   VoucherFormValues,
-  "hunt_start_time" | "hunt_end_time" | "applicable_product_ids"
+  | "hunt_start_time"
+  | "hunt_end_time"
+  | "valid_from"
+  | "valid_until"
+  | "applicable_product_ids"
+  | "applicable_category_ids"
+  | "max_discount"
+  | "usage_limit"
 > & {
-  hunt_start_time: string
-  hunt_end_time: string
+  hunt_start_time: string | null
+  hunt_end_time: string | null
+  valid_from: string | null
+  valid_until: string | null
   applicable_product_ids: number[]
+  applicable_category_ids: number[]
+  max_discount: number | null
+  usage_limit: number | null
 }
 
 export const adminGetAllVouchers = async (page: number = 1, limit: number = 10) => {
@@ -46,6 +67,92 @@ export const adminDeleteVoucher = async (id: number): Promise<MessageResponse> =
   return response.data
 }
 
+export type PromotionPayload = Omit<Promotion, "id" | "created_at">
+
+export const adminGetPromotions = async (): Promise<Promotion[]> => {
+  const response = await apiClient.get<Promotion[]>("/admin/promotions", {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+export const adminCreatePromotion = async (payload: PromotionPayload): Promise<{ id: number }> => {
+  const response = await apiClient.post<{ id: number }>("/admin/promotions", payload, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+export const adminUpdatePromotion = async (
+  id: number,
+  payload: PromotionPayload
+): Promise<MessageResponse> => {
+  const response = await apiClient.put<MessageResponse>(`/admin/promotions/${id}`, payload, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+export const adminDeletePromotion = async (id: number): Promise<MessageResponse> => {
+  const response = await apiClient.delete<MessageResponse>(`/admin/promotions/${id}`, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+export type CampaignPayload = Omit<
+  VoucherCampaign,
+  "id" | "voucher_code" | "last_run_at" | "next_run_at" | "deliveries" | "created_at"
+>
+
+export const adminGetCampaigns = async (): Promise<VoucherCampaign[]> => {
+  const response = await apiClient.get<VoucherCampaign[]>("/admin/campaigns", {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+export const adminCreateCampaign = async (payload: CampaignPayload): Promise<{ id: number }> => {
+  const response = await apiClient.post<{ id: number }>("/admin/campaigns", payload, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+export const adminUpdateCampaign = async (
+  id: number,
+  payload: CampaignPayload
+): Promise<MessageResponse> => {
+  const response = await apiClient.put<MessageResponse>(`/admin/campaigns/${id}`, payload, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+export const adminDeleteCampaign = async (id: number): Promise<MessageResponse> => {
+  const response = await apiClient.delete<MessageResponse>(`/admin/campaigns/${id}`, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+export const adminRunCampaign = async (id: number): Promise<CampaignRunResult> => {
+  const response = await apiClient.post<CampaignRunResult>(`/admin/campaigns/${id}/run`, null, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+export const adminGetCampaignDeliveries = async (
+  id: number,
+  page: number = 1
+): Promise<{ items: CampaignDelivery[]; page: number; totalPages: number }> => {
+  const response = await apiClient.get(`/admin/campaigns/${id}/deliveries?page=${page}`, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
 export const getClaimableVouchers = async (): Promise<Voucher[]> => {
   const response = await apiClient.get<Voucher[]>("/user/vouchers/claimable", {
     headers: getAuthHeaders(),
@@ -75,3 +182,25 @@ export const deleteUserVoucher = async (userVoucherId: number): Promise<MessageR
   })
   return response.data
 }
+
+// from/to dạng YYYY-MM-DD; bỏ trống là 30 ngày gần nhất
+export const adminGetVoucherAnalytics = async (from?: string, to?: string): Promise<VoucherAnalytics> => {
+  const params = new URLSearchParams()
+  if (from) params.set("from", from)
+  if (to) params.set("to", to)
+  const response = await apiClient.get<VoucherAnalytics>(`/admin/vouchers/analytics?${params.toString()}`, {
+    headers: getAuthHeaders(),
+  })
+  return response.data
+}
+
+export const adminExportVoucherAnalyticsCSV = async (from?: string, to?: string): Promise<Blob> => {
+  const params = new URLSearchParams({ format: "csv" })
+  if (from) params.set("from", from)
+  if (to) params.set("to", to)
+  const response = await apiClient.get(`/admin/vouchers/analytics?${params.toString()}`, {
+    headers: getAuthHeaders(),
+    responseType: "blob",
+  })
+  return response.data
+}
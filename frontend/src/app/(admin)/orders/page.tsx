@@ -6,7 +6,12 @@ import { useRouter, useSearchParams } from "next/navigation"
 import { useEffect, useState } from "react"
 import { toast } from "sonner"
 
-import { getAllOrders, getOrderDetails, updateOrderStatus } from "@/api/orders"
+import {
+  confirmCODCollection,
+  getAllOrders,
+  getOrderDetails,
+  updateOrderStatus,
+} from "@/api/orders"
 import ExportPdf from "@/components/ExportPdf"
 import { Badge } from "@/components/ui/badge"
 import { Button } from "@/components/ui/button"
@@ -18,6 +23,7 @@ import {
   DropdownMenuSeparator,
   DropdownMenuTrigger,
 } from "@/components/ui/dropdown-menu"
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "@/components/ui/select"
 import {
   Table,
   TableBody,
@@ -34,28 +40,47 @@ const getStatusVariant = (status: string): string => {
   switch (status?.toLowerCase()) {
     case "pending":
       return "bg-yellow-100 text-yellow-800 border-yellow-200"
-    case "pending_payment":
+    case "paid":
       return "bg-orange-100 text-orange-800 border-orange-200"
-    case "processing":
+    case "confirmed":
+    case "preparing":
       return "bg-blue-100 text-blue-800 border-blue-200"
     case "shipped":
       return "bg-indigo-100 text-indigo-800 border-indigo-200"
     case "completed":
       return "bg-green-100 text-green-800 border-green-200"
     case "cancelled":
+    case "refunded":
       return "bg-red-100 text-red-800 border-red-200"
     default:
       return "bg-gray-100 text-gray-800 border-gray-200"
   }
 }
 
+const paymentMethodLabels: Record<string, string> = {
+  cod: "COD",
+  bank_transfer: "Chuyển khoản",
+  momo: "MoMo",
+  vnpay: "VNPay",
+  free: "Miễn phí",
+}
+
+const paymentStatusLabels: Record<string, string> = {
+  unpaid: "Chưa thanh toán",
+  paid: "Đã thanh toán",
+  partially_refunded: "Hoàn một phần",
+  refunded: "Đã hoàn tiền",
+}
+
 const orderStatuses = [
   "pending",
-  "pending_payment",
-  "processing",
+  "paid",
+  "confirmed",
+  "preparing",
   "shipped",
   "completed",
   "cancelled",
+  "refunded",
 ]
 
 export default function OrdersPage() {
@@ -70,12 +95,13 @@ export default function OrdersPage() {
   const [isLoadingDetails, setIsLoadingDetails] = useState(false)
 
   const pageQuery = parseInt(searchParams.get("page") || "1")
+  const methodQuery = searchParams.get("payment_method") || ""
 
   useEffect(() => {
     const fetchOrders = async () => {
       try {
         setIsLoading(true)
-        const data = await getAllOrders(pageQuery)
+        const data = await getAllOrders(pageQuery, methodQuery)
         setOrders(data.orders)
         setTotalPages(data.totalPages)
         setCurrentPage(data.page)
@@ -88,11 +114,33 @@ export default function OrdersPage() {
     }
     fetchOrders()
     // eslint-disable-next-line react-hooks/exhaustive-deps
-  }, [pageQuery])
+  }, [pageQuery, methodQuery])
+
+  const ordersURL = (page: number, method: string) =>
+    method ? `/orders?page=${page}&payment_method=${method}` : `/orders?page=${page}`
 
   const handlePageChange = (newPage: number) => {
     if (newPage >= 1 && newPage <= totalPages) {
-      router.push(`/orders?page=${newPage}`)
+      router.push(ordersURL(newPage, methodQuery))
+    }
+  }
+
+  const handleMethodChange = (method: string) => {
+    router.push(ordersURL(1, method === "all" ? "" : method))
+  }
+
+  const handleCODCollected = async (orderId: number) => {
+    try {
+      await confirmCODCollection(orderId)
+      toast.success(`Đã xác nhận thu tiền đơn hàng #${orderId}.`)
+      setOrders((prevOrders) =>
+        prevOrders.map((order) =>
+          order.id === orderId ? { ...order, payment_status: "paid" } : order
+        )
+      )
+    } catch (error) {
+      console.error(error)
+      toast.error("Không thể xác nhận thu tiền.")
     }
   }
 
@@ -135,6 +183,19 @@ export default function OrdersPage() {
     <div className="pt-6">
       <div className="flex items-center justify-between">
         <h1 className="text-3xl font-bold">Đơn hàng</h1>
+        <Select value={methodQuery || "all"} onValueChange={handleMethodChange}>
+          <SelectTrigger className="w-[200px] bg-white">
+            <SelectValue placeholder="Phương thức thanh toán" />
+          </SelectTrigger>
+          <SelectContent>
+            <SelectItem value="all">Tất cả phương thức</SelectItem>
+            {Object.entries(paymentMethodLabels).map(([value, label]) => (
+              <SelectItem key={value} value={value}>
+                {label}
+              </SelectItem>
+            ))}
+          </SelectContent>
+        </Select>
       </div>
       <div className="mt-4 rounded-lg border bg-white">
         <Table>
@@ -146,6 +207,7 @@ export default function OrdersPage() {
               <TableHead>Địa chỉ</TableHead>
               <TableHead>Thời gian</TableHead>
               <TableHead className="w-[150px]">Tổng tiền</TableHead>
+              <TableHead>Thanh toán</TableHead>
               <TableHead>Trạng thái</TableHead>
               <TableHead className="w-[150px]">Hành động</TableHead>
             </TableRow>
@@ -172,6 +234,14 @@ export default function OrdersPage() {
                   })}
                 </TableCell>
                 <TableCell className="w-[150px]">{formatCurrencyVND(order.total_amount)}</TableCell>
+                <TableCell>
+                  <div className="font-medium">
+                    {paymentMethodLabels[order.payment_method] ?? order.payment_method}
+                  </div>
+                  <div className="text-sm text-muted-foreground">
+                    {paymentStatusLabels[order.payment_status] ?? order.payment_status}
+                  </div>
+                </TableCell>
                 <TableCell>
                   <Badge className={getStatusVariant(order.status)}>{order.status}</Badge>
                 </TableCell>
@@ -192,10 +262,7 @@ export default function OrdersPage() {
                           if (order.status === status) {
                             isDisabled = true
                           }
-                          if (order.status === "completed") {
-                            isDisabled = true
-                          }
-                          if (order.status === "shipped" && status === "cancelled") {
+                          if (!(order.allowed_transitions ?? []).includes(status)) {
                             isDisabled = true
                           }
 
@@ -210,6 +277,17 @@ export default function OrdersPage() {
                             </DropdownMenuItem>
                           )
                         })}
+                        {order.payment_method === "cod" && order.payment_status === "unpaid" && (
+                          <>
+                            <DropdownMenuSeparator />
+                            <DropdownMenuItem
+                              onClick={() => handleCODCollected(order.id)}
+                              disabled={!["shipped", "completed"].includes(order.status)}
+                            >
+                              Đã thu tiền COD
+                            </DropdownMenuItem>
+                          </>
+                        )}
                         <DropdownMenuSeparator />
                         <DropdownMenuItem onClick={() => handleViewDetails(order.id)}>
                           <Eye className="mr-2 h-4 w-4" />
@@ -223,7 +301,7 @@ export default function OrdersPage() {
             ))}
           </TableBody>
           <TableFooter>
-            <TableCell colSpan={8}>
+            <TableCell colSpan={9}>
               <div className="flex items-center justify-end gap-4">
                 <span className="text-sm text-muted-foreground">
                   Trang {currentPage} trong tổng {totalPages}
@@ -284,6 +362,12 @@ export default function OrdersPage() {
                       {selectedOrder.status}
                     </Badge>
                   </p>
+                  <p>
+                    <span className="font-medium">Thanh toán:</span>{" "}
+                    {paymentMethodLabels[selectedOrder.payment_method] ??
+                      selectedOrder.payment_method}{" "}
+                    - {paymentStatusLabels[selectedOrder.payment_status] ?? selectedOrder.payment_status}
+                  </p>
                 </div>
               </div>
 
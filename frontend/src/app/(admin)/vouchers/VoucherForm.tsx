@@ -43,11 +43,13 @@ const formSchema = z
     description: z.string().optional(),
     discount_type: z.enum(["percentage", "fixed_amount"]),
     discount_value: z.number().positive("Giá trị giảm phải là số dương."),
-    hunt_start_time: z
-      .date()
-      .refine((val) => val != null, "Vui lòng chọn thời gian bắt đầu.")
-      .min(new Date(), "Thời gian bắt đầu phải sau thời điểm hiện tại"),
-    hunt_end_time: z.date().refine((val) => val != null, "Vui lòng chọn thời gian kết thúc."),
+    // Mã công khai không có giờ săn
+    hunt_start_time: z.date().optional(),
+    hunt_end_time: z.date().optional(),
+    is_public: z.boolean(),
+    valid_from: z.date().optional(),
+    valid_until: z.date().optional(),
+    per_user_limit: z.number().int("Số lượt phải là số nguyên").min(1, "Mỗi khách ít nhất 1 lượt."),
     valid_duration_days: z
       .number()
       .int("Thời hạn phải là số nguyên")
@@ -65,6 +67,26 @@ const formSchema = z
           message: "ID sản phẩm phải là các con số phân cách bởi dấu phẩy.",
         }
       ),
+    applicable_category_ids: z
+      .string()
+      .optional()
+      .refine(
+        (val) => {
+          if (!val || val.trim() === "") return true
+          const ids = val.split(",").map((id) => parseInt(id.trim(), 10))
+          return !ids.some(isNaN)
+        },
+        {
+          message: "ID danh mục phải là các con số phân cách bởi dấu phẩy.",
+        }
+      ),
+    min_order_value: z.number().min(0, "Giá trị đơn tối thiểu không được âm."),
+    max_discount: z.number().positive("Mức giảm tối đa phải là số dương.").optional(),
+    usage_limit: z
+      .number()
+      .int("Số lượt phải là số nguyên")
+      .positive("Số lượt phải lớn hơn 0.")
+      .optional(),
   })
   .superRefine((data, ctx) => {
     // Validate percentage value
@@ -78,8 +100,45 @@ const formSchema = z
         code: z.ZodIssueCode.custom,
       })
     }
+    if (data.discount_type !== "percentage" && data.max_discount !== undefined) {
+      ctx.addIssue({
+        path: ["max_discount"],
+        message: "Mức giảm tối đa chỉ dùng cho voucher phần trăm.",
+        code: z.ZodIssueCode.custom,
+      })
+    }
+    if (data.is_public) {
+      if (data.valid_from && data.valid_until && data.valid_from >= data.valid_until) {
+        ctx.addIssue({
+          path: ["valid_until"],
+          message: "Thời gian kết thúc phải sau thời gian bắt đầu.",
+          code: z.ZodIssueCode.custom,
+        })
+      }
+      return
+    }
+    if (!data.hunt_start_time) {
+      ctx.addIssue({
+        path: ["hunt_start_time"],
+        message: "Vui lòng chọn thời gian bắt đầu.",
+        code: z.ZodIssueCode.custom,
+      })
+    } else if (data.hunt_start_time < new Date()) {
+      ctx.addIssue({
+        path: ["hunt_start_time"],
+        message: "Thời gian bắt đầu phải sau thời điểm hiện tại",
+        code: z.ZodIssueCode.custom,
+      })
+    }
+    if (!data.hunt_end_time) {
+      ctx.addIssue({
+        path: ["hunt_end_time"],
+        message: "Vui lòng chọn thời gian kết thúc.",
+        code: z.ZodIssueCode.custom,
+      })
+    }
     // Validate date range
-    if (data.hunt_start_time >= data.hunt_end_time) {
+    if (data.hunt_start_time && data.hunt_end_time && data.hunt_start_time >= data.hunt_end_time) {
       ctx.addIssue({
         path: ["hunt_end_time"],
         message: "Thời gian kết thúc phải sau thời gian bắt đầu.",
@@ -110,8 +169,17 @@ export default function VoucherForm({ initialData, onSave, onCancel, isSaving }:
       hunt_end_time: initialData ? new Date(initialData.hunt_end_time) : undefined,
       valid_duration_days: initialData?.valid_duration_days || 7,
       applicable_product_ids: initialData?.applicable_product_ids?.join(", ") || "",
+      applicable_category_ids: initialData?.applicable_category_ids?.join(", ") || "",
+      min_order_value: initialData?.min_order_value || 0,
+      max_discount: initialData?.max_discount ?? undefined,
+      usage_limit: initialData?.usage_limit ?? undefined,
+      is_public: initialData?.is_public ?? false,
+      valid_from: initialData?.valid_from ? new Date(initialData.valid_from) : undefined,
+      valid_until: initialData?.valid_until ? new Date(initialData.valid_until) : undefined,
+      per_user_limit: initialData?.per_user_limit || 1,
     },
   })
+  const isPublic = form.watch("is_public")
 
   const onSubmit: SubmitHandler<VoucherFormValues> = (data) => {
     onSave(data)
@@ -192,42 +260,121 @@ export default function VoucherForm({ initialData, onSave, onCancel, isSaving }:
             )}
           />
         </div>
-        <div className="grid grid-cols-2 gap-4">
-          <FormField
-            control={form.control}
-            name="hunt_start_time"
-            render={({ field }) => (
-              <FormItem>
-                <FormLabel>Bắt đầu săn</FormLabel>
-                <FormControl>
-                  <Input
-                    type="datetime-local"
-                    value={field.value ? formatDateForInput(field.value) : ""}
-                    onChange={(e) => field.onChange(new Date(e.target.value))}
-                  />
-                </FormControl>
-                <FormMessage />
-              </FormItem>
-            )}
-          />
-          <FormField
-            control={form.control}
-            name="hunt_end_time"
-            render={({ field }) => (
-              <FormItem>
-                <FormLabel>Kết thúc săn</FormLabel>
-                <FormControl>
-                  <Input
-                    type="datetime-local"
-                    value={field.value ? formatDateForInput(field.value) : ""}
-                    onChange={(e) => field.onChange(new Date(e.target.value))}
-                  />
-                </FormControl>
-                <FormMessage />
-              </FormItem>
-            )}
-          />
-        </div>
+        <FormField
+          control={form.control}
+          name="is_public"
+          render={({ field }) => (
+            <FormItem className="flex items-center gap-2 space-y-0">
+              <FormControl>
+                <input
+                  type="checkbox"
+                  className="h-4 w-4"
+                  checked={field.value}
+                  onChange={(e) => field.onChange(e.target.checked)}
+                />
+              </FormControl>
+              <FormLabel>Mã khuyến mãi công khai (khách tự nhập mã khi thanh toán)</FormLabel>
+            </FormItem>
+          )}
+        />
+        {isPublic ? (
+          <div className="grid grid-cols-3 gap-4">
+            <FormField
+              control={form.control}
+              name="valid_from"
+              render={({ field }) => (
+                <FormItem>
+                  <FormLabel>Hiệu lực từ</FormLabel>
+                  <FormControl>
+                    <Input
+                      type="datetime-local"
+                      value={field.value ? formatDateForInput(field.value) : ""}
+                      onChange={(e) =>
+                        field.onChange(e.target.value ? new Date(e.target.value) : undefined)
+                      }
+                    />
+                  </FormControl>
+                  <FormMessage />
+                </FormItem>
+              )}
+            />
+            <FormField
+              control={form.control}
+              name="valid_until"
+              render={({ field }) => (
+                <FormItem>
+                  <FormLabel>Hiệu lực đến</FormLabel>
+                  <FormControl>
+                    <Input
+                      type="datetime-local"
+                      value={field.value ? formatDateForInput(field.value) : ""}
+                      onChange={(e) =>
+                        field.onChange(e.target.value ? new Date(e.target.value) : undefined)
+                      }
+                    />
+                  </FormControl>
+                  <FormMessage />
+                </FormItem>
+              )}
+            />
+            <FormField
+              control={form.control}
+              name="per_user_limit"
+              render={({ field }) => (
+                <FormItem>
+                  <FormLabel>Lượt mỗi khách</FormLabel>
+                  <FormControl>
+                    <Input
+                      type="number"
+                      value={field.value || ""}
+                      onChange={(e) =>
+                        field.onChange(e.target.value ? parseInt(e.target.value, 10) : 0)
+                      }
+                    />
+                  </FormControl>
+                  <FormMessage />
+                </FormItem>
+              )}
+            />
+          </div>
+        ) : (
+          <div className="grid grid-cols-2 gap-4">
+            <FormField
+              control={form.control}
+              name="hunt_start_time"
+              render={({ field }) => (
+                <FormItem>
+                  <FormLabel>Bắt đầu săn</FormLabel>
+                  <FormControl>
+                    <Input
+                      type="datetime-local"
+                      value={field.value ? formatDateForInput(field.value) : ""}
+                      onChange={(e) => field.onChange(new Date(e.target.value))}
+                    />
+                  </FormControl>
+                  <FormMessage />
+                </FormItem>
+              )}
+            />
+            <FormField
+              control={form.control}
+              name="hunt_end_time"
+              render={({ field }) => (
+                <FormItem>
+                  <FormLabel>Kết thúc săn</FormLabel>
+                  <FormControl>
+                    <Input
+                      type="datetime-local"
+                      value={field.value ? formatDateForInput(field.value) : ""}
+                      onChange={(e) => field.onChange(new Date(e.target.value))}
+                    />
+                  </FormControl>
+                  <FormMessage />
+                </FormItem>
+              )}
+            />
+          </div>
+        )}
         <FormField
           control={form.control}
           name="valid_duration_days"
@@ -260,6 +407,84 @@ export default function VoucherForm({ initialData, onSave, onCancel, isSaving }:
             </FormItem>
           )}
         />
+        <FormField
+          control={form.control}
+          name="applicable_category_ids"
+          render={({ field }) => (
+            <FormItem>
+              <FormLabel>Áp dụng cho ID danh mục (tùy chọn)</FormLabel>
+              <FormControl>
+                <Textarea placeholder="2, 3" {...field} />
+              </FormControl>
+              <FormDescription>
+                Món thuộc sản phẩm hoặc danh mục đã chọn mới được giảm giá.
+              </FormDescription>
+              <FormMessage />
+            </FormItem>
+          )}
+        />
+        <div className="grid grid-cols-3 gap-4">
+          <FormField
+            control={form.control}
+            name="min_order_value"
+            render={({ field }) => (
+              <FormItem>
+                <FormLabel>Đơn tối thiểu (VND)</FormLabel>
+                <FormControl>
+                  <Input
+                    type="number"
+                    placeholder="0"
+                    value={field.value || ""}
+                    onChange={(e) =>
+                      field.onChange(e.target.value ? parseFloat(e.target.value) : 0)
+                    }
+                  />
+                </FormControl>
+                <FormMessage />
+              </FormItem>
+            )}
+          />
+          <FormField
+            control={form.control}
+            name="max_discount"
+            render={({ field }) => (
+              <FormItem>
+                <FormLabel>Giảm tối đa (VND)</FormLabel>
+                <FormControl>
+                  <Input
+                    type="number"
+                    placeholder="Không giới hạn"
+                    value={field.value ?? ""}
+                    onChange={(e) =>
+                      field.onChange(e.target.value ? parseFloat(e.target.value) : undefined)
+                    }
+                  />
+                </FormControl>
+                <FormMessage />
+              </FormItem>
+            )}
+          />
+          <FormField
+            control={form.control}
+            name="usage_limit"
+            render={({ field }) => (
+              <FormItem>
+                <FormLabel>Tổng lượt dùng</FormLabel>
+                <FormControl>
+                  <Input
+                    type="number"
+                    placeholder="Không giới hạn"
+                    value={field.value ?? ""}
+                    onChange={(e) =>
+                      field.onChange(e.target.value ? parseInt(e.target.value, 10) : undefined)
+                    }
+                  />
+                </FormControl>
+                <FormMessage />
+              </FormItem>
+            )}
+          />
+        </div>
         <div className="flex justify-end gap-2 pt-4">
           <Button type="button" variant="outline" onClick={onCancel}>
             Hủy
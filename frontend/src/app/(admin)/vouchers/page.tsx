@@ -76,18 +76,24 @@ const VouchersPageContent = () => {
 
   const handleSave = async (data: VoucherFormValues) => {
     setIsSaving(true)
-    const productIds = data.applicable_product_ids
-      ? data.applicable_product_ids
-          .split(",")
-          .map((id) => parseInt(id.trim(), 10))
-          .filter((id) => !isNaN(id))
-      : []
+    const parseIds = (value?: string) =>
+      value
+        ? value
+            .split(",")
+            .map((id) => parseInt(id.trim(), 10))
+            .filter((id) => !isNaN(id))
+        : []
 
     const payload = {
       ...data,
-      hunt_start_time: data.hunt_start_time.toISOString(),
-      hunt_end_time: data.hunt_end_time.toISOString(),
-      applicable_product_ids: productIds,
+      hunt_start_time: data.hunt_start_time?.toISOString() ?? null,
+      hunt_end_time: data.hunt_end_time?.toISOString() ?? null,
+      valid_from: data.is_public ? (data.valid_from?.toISOString() ?? null) : null,
+      valid_until: data.is_public ? (data.valid_until?.toISOString() ?? null) : null,
+      applicable_product_ids: parseIds(data.applicable_product_ids),
+      applicable_category_ids: parseIds(data.applicable_category_ids),
+      max_discount: data.max_discount ?? null,
+      usage_limit: data.usage_limit ?? null,
     }
 
     try {
@@ -172,8 +178,19 @@ const VouchersPageContent = () => {
                       : formatCurrencyVND(voucher.discount_value)}
                   </TableCell>
                   <TableCell>
-                    {new Date(voucher.hunt_start_time).toLocaleString()} <br />{" "}
-                    {new Date(voucher.hunt_end_time).toLocaleString()}
+                    {voucher.is_public ? (
+                      <>
+                        Mã công khai ({voucher.used_count}
+                        {voucher.usage_limit ? `/${voucher.usage_limit}` : ""} lượt) <br />
+                        {voucher.valid_from ? new Date(voucher.valid_from).toLocaleString() : "—"} -{" "}
+                        {voucher.valid_until ? new Date(voucher.valid_until).toLocaleString() : "—"}
+                      </>
+                    ) : (
+                      <>
+                        {new Date(voucher.hunt_start_time).toLocaleString()} <br />{" "}
+                        {new Date(voucher.hunt_end_time).toLocaleString()}
+                      </>
+                    )}
                   </TableCell>
                   <TableCell className="text-right">
                     <Button
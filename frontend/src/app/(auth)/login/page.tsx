@@ -82,14 +82,14 @@ export default function LoginPage() {
           <form onSubmit={handleSubmit} className="space-y-6">
             <div>
               <label htmlFor="username" className="mb-2 block text-sm font-medium">
-                Username
+                Username hoặc email
               </label>
               <Input
                 id="username"
                 type="text"
                 value={username}
                 onChange={(e) => setUsername(e.target.value)}
-                placeholder="Your username"
+                placeholder="Your username or email"
                 required
               />
             </div>
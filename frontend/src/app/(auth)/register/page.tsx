@@ -1,6 +1,6 @@
 "use client"
 
-import { useState } from "react"
+import { useEffect, useState } from "react"
 import { useRouter } from "next/navigation"
 import Link from "next/link"
 import { toast } from "sonner"
@@ -10,6 +10,7 @@ import axios from "axios"
 import Main from "@/app/layouts/main"
 import { Button } from "@/components/ui/button"
 import { Input } from "@/components/ui/input"
+import { getDeviceId } from "@/lib/utils"
 
 const playfair = Playfair_Display({
   subsets: ["latin"],
@@ -21,8 +22,15 @@ export default function RegisterPage() {
   const [username, setUsername] = useState("")
   const [email, setEmail] = useState("")
   const [password, setPassword] = useState("")
+  const [referralCode, setReferralCode] = useState("")
   const [isLoading, setIsLoading] = useState(false)
 
+  // Link giới thiệu có dạng /register?ref=MA_GIOI_THIEU
+  useEffect(() => {
+    const ref = new URLSearchParams(window.location.search).get("ref")
+    if (ref) setReferralCode(ref.toUpperCase())
+  }, [])
+
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault()
     setIsLoading(true)
@@ -32,12 +40,19 @@ export default function RegisterPage() {
         username,
         email,
         password,
+        referral_code: referralCode || undefined,
+        device_id: referralCode ? getDeviceId() : undefined,
       })
 
       toast.success("Đăng ký thành công! Vui lòng đăng nhập.")
       router.push("/login")
     } catch (error) {
-      toast.error("Đăng ký thất bại. Tên người dùng hoặc email có thể đã tồn tại.")
+      const err = error as { response?: { status?: number; data?: { error?: string } } }
+      toast.error(
+        err.response?.status === 400 && err.response.data?.error
+          ? err.response.data.error
+          : "Đăng ký thất bại. Tên người dùng hoặc email có thể đã tồn tại."
+      )
       console.error("Registration failed:", error)
     } finally {
       setIsLoading(false)
@@ -101,6 +116,18 @@ export default function RegisterPage() {
                 required
               />
             </div>
+            <div>
+              <label htmlFor="referralCode" className="mb-2 block text-sm font-medium">
+                Mã giới thiệu (không bắt buộc)
+              </label>
+              <Input
+                id="referralCode"
+                type="text"
+                value={referralCode}
+                onChange={(e) => setReferralCode(e.target.value.toUpperCase())}
+                placeholder="VD: AB12CD34"
+              />
+            </div>
             <Button type="submit" className="w-full" disabled={isLoading}>
               {isLoading ? "Đang đăng ký..." : "Đăng ký"}
             </Button>
@@ -6,7 +6,14 @@ import { useRouter } from "next/navigation"
 import { useEffect, useState } from "react"
 import { toast } from "sonner"
 
-import { createBankTransferPayment, createMoMoPayment, placeOrder } from "@/api/checkout"
+import {
+  createBankTransferPayment,
+  createMoMoPayment,
+  createVNPayPayment,
+  placeOrder,
+  quoteCheckout,
+} from "@/api/checkout"
+import { getLoyaltyBalance, getWallet } from "@/api/user"
 import { getUserVouchers } from "@/api/vouchers"
 import { Button } from "@/components/ui/button"
 import { Input } from "@/components/ui/input"
@@ -17,7 +24,7 @@ import {
   SelectTrigger,
   SelectValue,
 } from "@/components/ui/select"
-import { OrderPayload, UserVoucher } from "@/types/api"
+import { CheckoutQuote, LoyaltyBalance, OrderPayload, UserVoucher } from "@/types/api"
 import { useBoundStore } from "@/zustand/total"
 
 import { formatCurrencyVND } from "../../../lib/utils"
@@ -34,6 +41,13 @@ const CheckoutPage = () => {
   const [myVouchers, setMyVouchers] = useState<UserVoucher[]>([])
   const [selectedVoucher, setSelectedVoucher] = useState<UserVoucher | null>(null)
   const [isLoading, setIsLoading] = useState(false)
+  const [quote, setQuote] = useState<CheckoutQuote | null>(null)
+  const [promoInput, setPromoInput] = useState("")
+  const [promoCode, setPromoCode] = useState("")
+  const [loyalty, setLoyalty] = useState<LoyaltyBalance | null>(null)
+  const [usePoints, setUsePoints] = useState(false)
+  const [walletBalance, setWalletBalance] = useState(0)
+  const [useWallet, setUseWallet] = useState(false)
 
   useEffect(() => {
     const fetchVouchers = async () => {
@@ -41,6 +55,8 @@ const CheckoutPage = () => {
         try {
           const data = await getUserVouchers(false)
           setMyVouchers(data)
+          setLoyalty(await getLoyaltyBalance())
+          setWalletBalance((await getWallet()).balance)
         } catch (error) {
           console.error(error)
         }
@@ -53,15 +69,45 @@ const CheckoutPage = () => {
     return total + item.product.price * item.quantity
   }, 0)
 
-  let discountAmount = 0
-  if (selectedVoucher) {
-    if (selectedVoucher.voucher_info.discount_type === "percentage") {
-      discountAmount = (subtotal * selectedVoucher.voucher_info.discount_value) / 100
-    } else {
-      discountAmount = selectedVoucher.voucher_info.discount_value
+  const redeemPoints = usePoints && loyalty ? loyalty.points : 0
+  // Backend chỉ trừ ví tối đa bằng số tiền còn phải trả
+  const walletAmount = useWallet ? walletBalance : 0
+
+  // Giảm giá do backend tính: khuyến mãi tự động, voucher (phạm vi, đơn tối thiểu, mức giảm tối
+  // đa) và điểm thưởng (giới hạn theo tỷ lệ giá trị đơn)
+  useEffect(() => {
+    if (!cartItems?.length) {
+      setQuote(null)
+      return
     }
-  }
-  const finalTotal = subtotal - discountAmount
+    quoteCheckout({
+      customer_name: "",
+      customer_phone: "",
+      shipping_address: "",
+      cart_items: cartItems.map((item) => ({
+        product_id: item.product.id,
+        quantity: item.quantity,
+      })),
+      applied_user_voucher_id: selectedVoucher?.id ?? null,
+      promo_code: selectedVoucher ? undefined : promoCode,
+      redeem_points: redeemPoints,
+      wallet_amount: walletAmount,
+    })
+      .then(setQuote)
+      .catch((error) => {
+        const err = error as { response?: { data?: { error?: string } } }
+        toast.error(err.response?.data?.error || "Không thể áp dụng mã giảm giá.")
+        setPromoCode("")
+        setQuote(null)
+      })
+  }, [selectedVoucher, promoCode, redeemPoints, walletAmount, cartItems, accountInfo.id])
+
+  const discountAmount = quote?.discount_amount ?? 0
+  const voucherNotice = quote?.voucher && !quote.voucher.applicable ? quote.voucher.reason : ""
+  const voucherDiscount =
+    discountAmount - (quote?.promotion_discount ?? 0) - (quote?.points_discount ?? 0)
+  const paidByWallet = quote?.wallet_amount ?? 0
+  const finalTotal = subtotal - discountAmount - paidByWallet
 
   const handlePlaceOrder = async (e: React.FormEvent<HTMLFormElement>) => {
     e.preventDefault()
@@ -69,7 +115,6 @@ const CheckoutPage = () => {
 
     const formData = new FormData(e.currentTarget)
     const payload: OrderPayload = {
-      user_id: accountInfo.id ? parseInt(accountInfo.id) : null,
       customer_name: formData.get("name") as string,
       customer_phone: formData.get("phone") as string,
       shipping_address: `${formData.get("address")}, ${formData.get("city")}`,
@@ -77,11 +122,16 @@ const CheckoutPage = () => {
         product_id: item.product.id,
         quantity: item.quantity,
       })),
-      applied_user_voucher_id: selectedVoucher ? selectedVoucher.id : null,
+      // Voucher không áp dụng được thì đặt hàng không kèm voucher
+      applied_user_voucher_id: selectedVoucher && !voucherNotice ? selectedVoucher.id : null,
+      promo_code: !selectedVoucher && promoCode && !voucherNotice ? promoCode : undefined,
+      redeem_points: quote?.points_redeemed ?? 0,
+      wallet_amount: paidByWallet,
     }
 
     try {
-      if (paymentMethod === "cod") {
+      // Ví, voucher hoặc điểm thưởng trả hết thì không cần qua cổng thanh toán
+      if (paymentMethod === "cod" || finalTotal === 0) {
         await placeOrder(payload)
         toast.success("Your order has been placed successfully!")
         await clearCart()
@@ -90,6 +140,9 @@ const CheckoutPage = () => {
         const { payUrl } = await createMoMoPayment(payload)
         // await clearCart()
         window.location.href = payUrl
+      } else if (paymentMethod === "vnpay") {
+        const { payUrl } = await createVNPayPayment(payload)
+        window.location.href = payUrl
       } else if (paymentMethod === "bank") {
         const { orderId } = await createBankTransferPayment(payload)
         router.push(`/payment/bank-transfer/${orderId}`)
@@ -192,16 +245,72 @@ const CheckoutPage = () => {
                 ))}
               </SelectContent>
             </Select>
+            {!selectedVoucher && (
+              <div className="mt-3 flex gap-2">
+                <Input
+                  placeholder="Nhập mã khuyến mãi"
+                  value={promoInput}
+                  onChange={(e) => setPromoInput(e.target.value.toUpperCase())}
+                />
+                <Button
+                  type="button"
+                  variant="outline"
+                  disabled={!accountInfo.id}
+                  onClick={() => setPromoCode(promoInput.trim())}
+                >
+                  Áp dụng
+                </Button>
+              </div>
+            )}
+            {voucherNotice && <p className="mt-2 text-sm text-red-600">{voucherNotice}</p>}
+            {loyalty && loyalty.points > 0 && (
+              <label className="mt-3 flex items-center gap-2 text-sm">
+                <input
+                  type="checkbox"
+                  checked={usePoints}
+                  onChange={(e) => setUsePoints(e.target.checked)}
+                />
+                Dùng điểm thưởng (bạn có {loyalty.points} điểm)
+              </label>
+            )}
+            {walletBalance > 0 && (
+              <label className="mt-3 flex items-center gap-2 text-sm">
+                <input
+                  type="checkbox"
+                  checked={useWallet}
+                  onChange={(e) => setUseWallet(e.target.checked)}
+                />
+                Dùng số dư ví ({formatCurrencyVND(walletBalance)})
+              </label>
+            )}
           </div>
 
           <div className="mb-2 flex justify-between text-gray-600">
             <span>Tạm tính: </span>
             <span>{formatCurrencyVND(subtotal)}</span>
           </div>
-          {discountAmount > 0 && (
+          {quote?.promotions?.map((promo) => (
+            <div key={promo.id} className="mb-2 flex justify-between text-green-600">
+              <span>{promo.name}: </span>
+              <span>- {formatCurrencyVND(promo.discount)}</span>
+            </div>
+          ))}
+          {voucherDiscount > 0 && (
+            <div className="mb-2 flex justify-between text-green-600">
+              <span>Voucher: </span>
+              <span>- {formatCurrencyVND(voucherDiscount)}</span>
+            </div>
+          )}
+          {(quote?.points_discount ?? 0) > 0 && (
+            <div className="mb-2 flex justify-between text-green-600">
+              <span>Điểm thưởng ({quote?.points_redeemed} điểm): </span>
+              <span>- {formatCurrencyVND(quote?.points_discount ?? 0)}</span>
+            </div>
+          )}
+          {paidByWallet > 0 && (
             <div className="mb-2 flex justify-between text-green-600">
-              <span>Giảm giá: </span>
-              <span>- {formatCurrencyVND(discountAmount)}</span>
+              <span>Thanh toán bằng ví: </span>
+              <span>- {formatCurrencyVND(paidByWallet)}</span>
             </div>
           )}
           <div className="mb-6 flex justify-between text-xl font-bold">
@@ -253,6 +362,23 @@ const CheckoutPage = () => {
                 className="ml-auto h-6 w-6"
               />
             </div>
+            <div
+              onClick={() => setPaymentMethod("vnpay")}
+              className={`flex cursor-pointer items-center rounded-lg border p-4 ${paymentMethod === "vnpay" ? "border-[#AD343E] ring-2 ring-[#AD343E]" : ""}`}
+            >
+              <input
+                type="radio"
+                id="vnpay"
+                name="payment"
+                value="vnpay"
+                checked={paymentMethod === "vnpay"}
+                readOnly
+                className="h-4 w-4"
+              />
+              <label htmlFor="vnpay" className="ml-3 block text-sm font-medium">
+                Thanh toán qua VNPay
+              </label>
+            </div>
             <div
               onClick={() => setPaymentMethod("bank")}
               className={`flex cursor-pointer items-center rounded-lg border p-4 ${paymentMethod === "bank" ? "border-[#AD343E] ring-2 ring-[#AD343E]" : ""}`}
@@ -5,6 +5,7 @@ import { Playfair_Display } from "next/font/google"
 import { useRouter, useSearchParams } from "next/navigation"
 import { CheckCircle, Loader2, XCircle } from "lucide-react"
 
+import { verifyPaymentReturn } from "@/api/checkout"
 import { useBoundStore } from "@/zustand/total"
 import { Button } from "@/components/ui/button"
 
@@ -18,8 +19,24 @@ export default function OrderResultPage() {
   const searchParams = useSearchParams()
   const { clearCart } = useBoundStore()
   const [status, setStatus] = useState<"loading" | "success" | "failed">("loading")
+  const [message, setMessage] = useState<string | null>(null)
 
   useEffect(() => {
+    if (searchParams.get("vnp_SecureHash")) {
+      verifyPaymentReturn("vnpay", searchParams.toString())
+        .then((result) => {
+          setMessage(result.message)
+          if (result.success) {
+            setStatus("success")
+            clearCart()
+          } else {
+            setStatus("failed")
+          }
+        })
+        .catch(() => setStatus("failed"))
+      return
+    }
+
     const resultCode = searchParams.get("resultCode")
     if (resultCode === "0") {
       setStatus("success")
@@ -87,7 +104,7 @@ export default function OrderResultPage() {
           Đơn hàng của bạn chưa được thanh toán. Vui lòng thử lại.
         </p>
         <p className="mt-2 text-sm text-gray-500">
-          {searchParams.get("message") || "Giao dịch đã bị huỷ hoặc hết hạn"}
+          {message || searchParams.get("message") || "Giao dịch đã bị huỷ hoặc hết hạn"}
         </p>
         <div className="mt-8 flex flex-col gap-4 sm:flex-row sm:justify-center">
           <Button
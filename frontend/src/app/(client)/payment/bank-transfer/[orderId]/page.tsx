@@ -16,6 +16,19 @@ interface OrderInfo {
   status: string
 }
 
+interface TransferInfo {
+  order_id: number
+  amount: number
+  memo: string
+  qr_payload: string
+  bank: {
+    bank_name: string
+    bank_bin: string
+    account_number: string
+    account_name: string
+  }
+}
+
 export default function BankTransferPaymentPage() {
   const params = useParams()
   const router = useRouter()
@@ -26,13 +39,15 @@ export default function BankTransferPaymentPage() {
   const [copied, setCopied] = useState<string | null>(null)
   const [isCheckingStatus, setIsCheckingStatus] = useState(false)
 
-  // Thông tin tài khoản Techcombank
+  const [transfer, setTransfer] = useState<TransferInfo | null>(null)
+
+  // Thông tin tài khoản và nội dung chuyển khoản do backend cấp (VietQR)
   const bankInfo = {
-    bankName: "Techcombank",
-    accountNumber: "19072027706012",
-    accountName: "NGUYEN THAI DUONG",
-    amount: order?.total_amount || 0,
-    content: `DH${orderId}`,
+    bankName: transfer?.bank.bank_name ?? "",
+    accountNumber: transfer?.bank.account_number ?? "",
+    accountName: transfer?.bank.account_name ?? "",
+    amount: transfer?.amount ?? order?.total_amount ?? 0,
+    content: transfer?.memo ?? `DH${orderId}`,
   }
 
   const fetchOrderInfo = async () => {
@@ -40,6 +55,10 @@ export default function BankTransferPaymentPage() {
       setIsLoading(true)
       const response = await apiClient.get(`/orders/${orderId}/status`)
       setOrder(response.data)
+      if (response.data.status === "pending") {
+        const qr = await apiClient.get<TransferInfo>(`/orders/${orderId}/vietqr`)
+        setTransfer(qr.data)
+      }
     } catch (error) {
       console.error("Error fetching order:", error)
       toast.error("Không thể tải thông tin đơn hàng")
@@ -64,7 +83,7 @@ export default function BankTransferPaymentPage() {
     setIsCheckingStatus(true)
     try {
       const response = await apiClient.get(`/orders/${orderId}/status`)
-      if (response.data.status === "processing" || response.data.status === "paid") {
+      if (response.data.status !== "pending" && response.data.status !== "cancelled") {
         toast.success("Thanh toán thành công!")
         router.push("/")
       } else {
@@ -114,13 +133,16 @@ export default function BankTransferPaymentPage() {
           {/* QR Code */}
           <div className="mb-6 flex justify-center">
             <div className="rounded-lg border-4 border-gray-200 p-4">
-              <Image
-                src="/images/qr.jpg"
-                alt="QR Code Techcombank"
-                width={300}
-                height={300}
-                className="rounded"
-              />
+              {transfer && (
+                <Image
+                  src={`${apiClient.defaults.baseURL}/orders/${orderId}/vietqr.png`}
+                  alt={`VietQR ${bankInfo.bankName}`}
+                  width={300}
+                  height={300}
+                  className="rounded"
+                  unoptimized
+                />
+              )}
             </div>
           </div>
 
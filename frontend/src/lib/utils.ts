@@ -11,4 +11,13 @@ export function formatCurrencyVND(amount: number | string): string {
     style: 'currency',
     currency: 'VND',
   }).format(numericAmount);
-}
\ No newline at end of file
+}
+// Mã thiết bị ngẫu nhiên lưu trong trình duyệt, gửi kèm khi đăng ký bằng mã giới thiệu
+export function getDeviceId(): string {
+  let id = localStorage.getItem("deviceId")
+  if (!id) {
+    id = crypto.randomUUID()
+    localStorage.setItem("deviceId", id)
+  }
+  return id
+}
@@ -15,6 +15,35 @@ export interface RegisterRequest {
   username?: string
   email?: string
   password?: string
+  referral_code?: string
+  device_id?: string
+}
+
+export interface ReferralSummary {
+  total: number
+  pending: number
+  rewarded: number
+  rejected: number
+  revoked: number
+  conversion_rate: number
+}
+
+export interface ReferralInfo {
+  code: string
+  summary: ReferralSummary
+}
+
+export interface Referral {
+  id: number
+  referrer_id: number
+  referrer_username: string
+  referred_id: number
+  referred_username: string
+  status: "pending" | "rewarded" | "rejected" | "revoked"
+  reject_reason?: string
+  order_id?: number
+  created_at: string
+  rewarded_at?: string
 }
 
 export interface Product {
@@ -31,6 +60,7 @@ export interface Product {
   protein_grams?: number
   carb_grams?: number
   fat_grams?: number
+  product_type?: "food" | "gift_card"
 }
 
 export interface PaginatedProducts {
@@ -46,6 +76,7 @@ export interface OrderItem {
   product_image: string
   quantity: number
   price_at_purchase: number
+  discount_amount?: number
 }
 
 export interface Order {
@@ -54,10 +85,31 @@ export interface Order {
   customer_phone: string
   shipping_address: string
   total_amount: number
+  discount_amount?: number
+  promotion_discount?: number
+  points_redeemed?: number
+  points_discount?: number
+  wallet_amount?: number
+  wallet_refunded?: number
   status: string
+  payment_method: string
+  payment_status: "unpaid" | "paid" | "partially_refunded" | "refunded"
   created_at: string
   username: string
   items?: OrderItem[]
+  timeline?: OrderStatusChange[]
+  allowed_transitions?: string[]
+}
+
+export interface OrderStatusChange {
+  id: number
+  from_status?: string
+  to_status: string
+  actor_type: "customer" | "staff" | "system"
+  actor_user_id?: number
+  actor_name?: string
+  reason?: string
+  created_at: string
 }
 
 export interface ProductPayload {
@@ -73,15 +125,18 @@ export interface ProductPayload {
   protein_grams?: number
   carb_grams?: number
   fat_grams?: number
+  product_type?: "food" | "gift_card"
 }
 
 export interface OrderPayload {
-  user_id?: number | null
   customer_name: string
   customer_phone: string
   shipping_address: string
   cart_items: { product_id: number; quantity: number }[]
   applied_user_voucher_id?: number | null
+  promo_code?: string
+  redeem_points?: number
+  wallet_amount?: number
 }
 
 export interface ChatbotResponse {
@@ -194,6 +249,15 @@ export interface Voucher {
   hunt_end_time: string
   valid_duration_days: number
   applicable_product_ids: number[] | null
+  applicable_category_ids: number[] | null
+  min_order_value: number
+  max_discount: number | null
+  usage_limit: number | null
+  used_count: number
+  is_public: boolean
+  valid_from: string | null
+  valid_until: string | null
+  per_user_limit: number
   created_at: string
 }
 
@@ -207,6 +271,235 @@ export interface UserVoucher {
   voucher_info: Voucher
 }
 
+export interface QuoteItem {
+  product_id: number
+  product_name: string
+  quantity: number
+  unit_price: number
+  line_total: number
+  voucher_eligible?: boolean
+  discount?: number
+  adjustments?: LineAdjustment[]
+}
+
+export interface LineAdjustment {
+  source: "promotion" | "voucher"
+  promotion_id?: number
+  label: string
+  amount: number
+}
+
+export type PromotionType = "buy_x_get_y" | "combo" | "tiered_spend"
+
+export interface PromotionTier {
+  min_subtotal: number
+  discount_type: "percentage" | "fixed_amount"
+  discount_value: number
+  max_discount?: number
+}
+
+export interface PromotionConfig {
+  product_ids?: number[]
+  category_ids?: number[]
+  buy_quantity?: number
+  get_quantity?: number
+  get_discount_percent?: number
+  combo_price?: number
+  tiers?: PromotionTier[]
+}
+
+export interface Promotion {
+  id: number
+  name: string
+  type: PromotionType
+  priority: number
+  exclusive: boolean
+  allow_voucher: boolean
+  config: PromotionConfig
+  starts_at: string | null
+  ends_at: string | null
+  is_active: boolean
+  created_at: string
+}
+
+export type CampaignSegment = "inactive" | "birthday_month"
+
+export interface VoucherCampaign {
+  id: number
+  name: string
+  voucher_id: number
+  voucher_code?: string
+  segment: CampaignSegment
+  inactive_days: number
+  interval_hours: number
+  email_subject: string
+  email_message: string
+  starts_at: string
+  ends_at: string | null
+  is_active: boolean
+  last_run_at?: string
+  next_run_at: string
+  deliveries: number
+  created_at: string
+}
+
+export interface CampaignDelivery {
+  id: number
+  user_id: number
+  username: string
+  email: string
+  user_voucher_id?: number
+  email_sent_at?: string
+  email_error?: string
+  created_at: string
+}
+
+export interface CampaignRunResult {
+  granted: number
+  emailed: number
+  email_failed: number
+}
+
+export interface AppliedPromotion {
+  id: number
+  name: string
+  type: PromotionType
+  discount: number
+}
+
+export interface VoucherCheck {
+  user_voucher_id?: number
+  code?: string
+  applicable: boolean
+  reason?: string
+  eligible_subtotal: number
+}
+
+export interface CheckoutQuote {
+  items: QuoteItem[]
+  subtotal: number
+  discount_amount: number
+  promotion_discount: number
+  total: number
+  applied_user_voucher_id?: number
+  promo_voucher_id?: number
+  voucher?: VoucherCheck
+  promotions?: AppliedPromotion[]
+  points_redeemed?: number
+  points_discount?: number
+  wallet_amount?: number
+}
+
+export interface LoyaltyPolicy {
+  spend_per_point: number
+  point_value: number
+  max_redeem_percent: number
+  valid_days: number
+}
+
+export interface LoyaltyBalance {
+  points: number
+  value: number
+  expiring_points: number
+  expiring_before: string
+  policy: LoyaltyPolicy
+}
+
+export interface LoyaltyEntry {
+  id: number
+  order_id?: number
+  type: "earn" | "redeem" | "restore" | "clawback" | "expire" | "adjust"
+  points: number
+  remaining?: number
+  expires_at?: string
+  reason?: string
+  created_at: string
+}
+
+export interface VoucherMetrics {
+  voucher_id: number
+  code: string
+  description: string
+  is_public: boolean
+  claims: number
+  redeemed_claims: number
+  redemption_rate: number
+  redemptions: number
+  total_discount: number
+  revenue: number
+  average_order_value: number
+}
+
+export interface OrderValueStats {
+  orders: number
+  revenue: number
+  average_order_value: number
+}
+
+export interface VoucherAnalytics {
+  from: string
+  to: string
+  with_voucher: OrderValueStats
+  without_voucher: OrderValueStats
+  vouchers: VoucherMetrics[]
+}
+
+export interface WalletBalance {
+  balance: number
+}
+
+export interface WalletEntry {
+  id: number
+  transaction_id: number
+  type: "gift_card_redeem" | "order_payment" | "order_refund" | "adjust"
+  amount: number
+  order_id?: number
+  gift_card_code?: string
+  note?: string
+  created_at: string
+}
+
+export interface WalletLedgerEntry {
+  account_id: number
+  account_kind: "user" | "gift_card" | "system"
+  account: string
+  amount: number
+}
+
+export interface WalletTransaction {
+  id: number
+  type: string
+  order_id?: number
+  gift_card_id?: number
+  refund_id?: number
+  actor_user_id?: number
+  actor_username?: string
+  note?: string
+  created_at: string
+  entries: WalletLedgerEntry[]
+}
+
+export interface WalletAudit {
+  balanced: boolean
+  total_balance: number
+  user_balances: number
+  gift_card_balances: number
+  unbalanced_transactions: number[]
+  mismatched_accounts: number[]
+}
+
+export interface GiftCard {
+  id: number
+  code: string
+  initial_value: number
+  balance: number
+  status: "active" | "redeemed" | "void"
+  order_id?: number
+  redeemed_by?: number
+  redeemed_at?: string
+  created_at: string
+}
+
 export interface MessageResponse {
   message: string
 }